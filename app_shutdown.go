@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/util/wm/ewmh"
+	"pkg.deepin.io/dde/startdde/swapsched"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+const (
+	sysAppShutdownConfigFile = "/usr/share/startdde/app_shutdown.json"
+
+	defaultAppShutdownGracePeriod = 10 // seconds
+	// 在宽限期结束之前这么长时间发送 AppsStillRunning 信号，让界面有时间提示用户
+	appsStillRunningNotice = 3 * time.Second
+
+	signalAppsStillRunning = "AppsStillRunning"
+)
+
+type appShutdownConfig struct {
+	// 发送关闭请求后等待应用退出的时间，单位秒
+	GracePeriod int `json:"grace-period"`
+	// 有窗口的应用优先通过关闭窗口的方式退出
+	CloseWindows bool `json:"close-windows"`
+}
+
+// 通过 StartManager 启动的，仍在运行的应用。
+// 启动的进程 fork 出应用后退出时，只要应用的 cgroup 或者进程组中还有进程，就认为应用仍在运行；
+// 调用 setsid 等方式离开进程组，或者交给已经运行的实例处理的应用无法跟踪。
+type runningApp struct {
+	cmd   *exec.Cmd
+	uiApp *swapsched.UIApp
+	// 通过 setsid 启动时是应用的进程组 id，和启动的进程的 pid 相同，否则为 0
+	pgid       int
+	launchTime time.Time
+	info       *sessionApp
+	// 启动的进程已经退出，由 StartManager.runningAppsMu 保护
+	exited bool
+}
+
+// 从 /proc 中查找进程组中的所有进程
+func getProcessGroupPids(pgid int) []int {
+	dirs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	var pids []int
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(dir.Name())
+		if err != nil {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join("/proc", dir.Name(), "stat"))
+		if err != nil {
+			continue
+		}
+		// pid (comm) state ppid pgrp ...，comm 中可能有空格和括号
+		stat := string(content)
+		idx := strings.LastIndexByte(stat, ')')
+		if idx == -1 {
+			continue
+		}
+		fields := strings.Fields(stat[idx+1:])
+		if len(fields) < 3 {
+			continue
+		}
+		if fields[2] == strconv.Itoa(pgid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+func (app *runningApp) getPids() []int {
+	if app.uiApp != nil {
+		pids, err := app.uiApp.GetProcs()
+		if err == nil && len(pids) > 0 {
+			return pids
+		}
+	}
+	if app.pgid > 0 {
+		pids := getProcessGroupPids(app.pgid)
+		if len(pids) > 0 {
+			return pids
+		}
+	}
+	if app.cmd.Process == nil {
+		return nil
+	}
+	return []int{app.cmd.Process.Pid}
+}
+
+// 返回应用的 cgroup 或者进程组中是否还有进程
+func (app *runningApp) hasProcesses() bool {
+	if app.uiApp != nil {
+		pids, err := app.uiApp.GetProcs()
+		if err == nil && len(pids) > 0 {
+			return true
+		}
+	}
+	if app.pgid > 0 {
+		return syscall.Kill(-app.pgid, 0) != syscall.ESRCH
+	}
+	return false
+}
+
+// 向应用的 cgroup 中的所有进程，或者应用所在的进程组发送信号
+func (app *runningApp) signal(sig syscall.Signal) {
+	if app.uiApp != nil {
+		pids, err := app.uiApp.GetProcs()
+		if err == nil && len(pids) > 0 {
+			for _, pid := range pids {
+				_ = syscall.Kill(pid, sig)
+			}
+			return
+		}
+	}
+
+	var err error
+	if app.pgid > 0 {
+		err = syscall.Kill(-app.pgid, sig)
+	} else if app.cmd.Process != nil {
+		err = syscall.Kill(app.cmd.Process.Pid, sig)
+	}
+	if err != nil && err != syscall.ESRCH {
+		logger.Warningf("failed to send %v to %q: %v", sig, app.info.DesktopFile, err)
+	}
+}
+
+func loadAppShutdownConfig() *appShutdownConfig {
+	cfg := &appShutdownConfig{
+		GracePeriod:  defaultAppShutdownGracePeriod,
+		CloseWindows: true,
+	}
+	userFile := filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", "app_shutdown.json")
+	content, err := ioutil.ReadFile(userFile)
+	if err != nil {
+		content, err = ioutil.ReadFile(sysAppShutdownConfigFile)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warning(err)
+			}
+			return cfg
+		}
+	}
+
+	err = json.Unmarshal(content, cfg)
+	if err != nil {
+		logger.Warning("failed to load app shutdown config:", err)
+	}
+	if cfg.GracePeriod < 0 {
+		cfg.GracePeriod = 0
+	}
+	return cfg
+}
+
+func (m *StartManager) addRunningApp(app *runningApp) {
+	m.runningAppsMu.Lock()
+	m.runningApps[app.cmd] = app
+	m.runningAppsMu.Unlock()
+}
+
+// 启动的进程退出后调用，应用还有其他进程时保留，直到进程都退出
+func (m *StartManager) removeRunningApp(cmd *exec.Cmd) {
+	m.runningAppsMu.Lock()
+	defer m.runningAppsMu.Unlock()
+	app, ok := m.runningApps[cmd]
+	if !ok {
+		return
+	}
+	if app.hasProcesses() {
+		app.exited = true
+		return
+	}
+	delete(m.runningApps, cmd)
+}
+
+func (m *StartManager) setShuttingDown(value bool) {
+	m.runningAppsMu.Lock()
+	m.shuttingDown = value
+	m.runningAppsMu.Unlock()
+}
+
+func (m *StartManager) isShuttingDown() bool {
+	m.runningAppsMu.Lock()
+	defer m.runningAppsMu.Unlock()
+	return m.shuttingDown
+}
+
+func (m *StartManager) getRunningApps() []*runningApp {
+	m.runningAppsMu.Lock()
+	defer m.runningAppsMu.Unlock()
+
+	apps := make([]*runningApp, 0, len(m.runningApps))
+	for cmd, app := range m.runningApps {
+		if app.exited && !app.hasProcesses() {
+			delete(m.runningApps, cmd)
+			continue
+		}
+		apps = append(apps, app)
+	}
+	sort.Slice(apps, func(i, j int) bool {
+		return apps[i].launchTime.Before(apps[j].launchTime)
+	})
+	return apps
+}
+
+// 返回 pid 和窗口的对应关系
+func (m *StartManager) getClientWindows() map[int][]x.Window {
+	result := make(map[int][]x.Window)
+	if m.xConn == nil {
+		return result
+	}
+	clientList, err := ewmh.GetClientList(m.xConn).Reply(m.xConn)
+	if err != nil {
+		logger.Warning("failed to get client list:", err)
+		return result
+	}
+	for _, win := range clientList {
+		pid, err := ewmh.GetWMPid(m.xConn, win).Reply(m.xConn)
+		if err != nil {
+			continue
+		}
+		result[int(pid)] = append(result[int(pid)], win)
+	}
+	return result
+}
+
+// 请求关闭应用的窗口，由窗口管理器发送 WM_DELETE_WINDOW 给应用，返回是否有窗口
+func (m *StartManager) closeAppWindows(app *runningApp, clientWindows map[int][]x.Window) bool {
+	var found bool
+	for _, pid := range app.getPids() {
+		for _, win := range clientWindows[pid] {
+			found = true
+			err := ewmh.RequestCloseWindowChecked(m.xConn, win, 0, 2).Check(m.xConn)
+			if err != nil {
+				logger.Warningf("failed to close window %d of %q: %v", win, app.info.DesktopFile, err)
+			}
+		}
+	}
+	return found
+}
+
+// 返回宽限期中发送 AppsStillRunning 信号的时间
+func getAppsStillRunningNoticeTime(deadline time.Time, gracePeriod time.Duration) time.Time {
+	notice := appsStillRunningNotice
+	if notice > gracePeriod/2 {
+		notice = gracePeriod / 2
+	}
+	return deadline.Add(-notice)
+}
+
+func getDesktopFiles(apps []*runningApp) []string {
+	desktopFiles := make([]string, len(apps))
+	for i, app := range apps {
+		desktopFiles[i] = app.info.DesktopFile
+	}
+	return desktopFiles
+}
+
+func (m *SessionManager) emitAppsStillRunning(apps []*runningApp) {
+	desktopFiles := getDesktopFiles(apps)
+	logger.Warning("apps still running:", desktopFiles)
+	err := m.service.Emit(m, signalAppsStillRunning, desktopFiles)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// 在注销之前通知应用退出，快到超时时上报仍未退出的应用，超时后杀掉它们
+func (m *SessionManager) terminateApps(force bool) {
+	if _startManager == nil {
+		return
+	}
+	// 先设置，在发送信号后退出的应用不会被自动重启
+	_startManager.setShuttingDown(true)
+	apps := _startManager.getRunningApps()
+	if len(apps) == 0 {
+		return
+	}
+
+	cfg := loadAppShutdownConfig()
+	logger.Infof("terminate %d apps, grace period: %ds", len(apps), cfg.GracePeriod)
+
+	var clientWindows map[int][]x.Window
+	if cfg.CloseWindows && !force {
+		clientWindows = _startManager.getClientWindows()
+	}
+	for _, app := range apps {
+		if clientWindows != nil && _startManager.closeAppWindows(app, clientWindows) {
+			continue
+		}
+		app.signal(syscall.SIGTERM)
+	}
+
+	if force {
+		return
+	}
+
+	gracePeriod := time.Duration(cfg.GracePeriod) * time.Second
+	deadline := time.Now().Add(gracePeriod)
+	noticeTime := getAppsStillRunningNoticeTime(deadline, gracePeriod)
+	noticed := false
+	for time.Now().Before(deadline) {
+		if m.stages.getCurrent() != SessionStageEndingQuery {
+			logger.Info("ending session is canceled, stop terminating apps")
+			return
+		}
+		apps = _startManager.getRunningApps()
+		if len(apps) == 0 {
+			logger.Info("all apps exited")
+			return
+		}
+		if !noticed && !time.Now().Before(noticeTime) {
+			noticed = true
+			m.emitAppsStillRunning(apps)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	apps = _startManager.getRunningApps()
+	if len(apps) == 0 || m.stages.getCurrent() != SessionStageEndingQuery {
+		return
+	}
+	if !noticed {
+		// 宽限期为 0
+		m.emitAppsStillRunning(apps)
+	}
+	for _, app := range apps {
+		app.signal(syscall.SIGKILL)
+	}
+}
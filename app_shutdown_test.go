@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"pkg.deepin.io/lib/appinfo/desktopappinfo"
+)
+
+func Test_getAppsStillRunningNoticeTime(t *testing.T) {
+	deadline := time.Unix(100, 0)
+	assert.Equal(t, time.Unix(97, 0), getAppsStillRunningNoticeTime(deadline, 10*time.Second))
+	// 宽限期很短时在一半的时候发送
+	assert.Equal(t, time.Unix(99, 0), getAppsStillRunningNoticeTime(deadline, 2*time.Second))
+	assert.Equal(t, deadline, getAppsStillRunningNoticeTime(deadline, 0))
+}
+
+func TestStartManager_shuttingDown(t *testing.T) {
+	m := &StartManager{}
+	assert.False(t, m.isShuttingDown())
+	m.setShuttingDown(true)
+	assert.True(t, m.isShuttingDown())
+}
+
+func TestStartManager_launchForkingApp(t *testing.T) {
+	setsidBin, err := exec.LookPath("setsid")
+	if err != nil {
+		t.Skip("setsid not found")
+	}
+	m := &StartManager{
+		setsidBin:   setsidBin,
+		runningApps: make(map[*exec.Cmd]*runningApp),
+	}
+	// 启动的进程 fork 出子进程后退出
+	appInfo, err := desktopappinfo.NewDesktopAppInfoFromFile("testdata/desktop/forking-app.desktop")
+	require.NoError(t, err)
+	err = m.launch(appInfo, 0, nil, appInfo, appInfo.GetFileName())
+	require.NoError(t, err)
+
+	apps := m.getRunningApps()
+	require.Len(t, apps, 1)
+	app := apps[0]
+	assert.Equal(t, app.cmd.Process.Pid, app.pgid)
+	defer syscall.Kill(-app.pgid, syscall.SIGKILL)
+
+	// 等待启动的进程退出
+	for i := 0; i < 50; i++ {
+		m.runningAppsMu.Lock()
+		exited := app.exited
+		m.runningAppsMu.Unlock()
+		if exited {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	apps = m.getRunningApps()
+	require.Len(t, apps, 1)
+	assert.True(t, apps[0].exited)
+	assert.NotEmpty(t, apps[0].getPids())
+	assert.NotContains(t, apps[0].getPids(), app.cmd.Process.Pid)
+}
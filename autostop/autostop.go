@@ -20,57 +20,302 @@
 package autostop
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"pkg.deepin.io/lib/keyfile"
 	"pkg.deepin.io/lib/log"
 )
 
+const (
+	PhaseLogout   = "logout"
+	PhaseShutdown = "shutdown"
+)
+
+const (
+	sectionDesktopEntry = "Desktop Entry"
+
+	keyName        = "Name"
+	keyExec        = "Exec"
+	keyHidden      = "Hidden"
+	keyOnlyShowIn  = "OnlyShowIn"
+	keyNotShowIn   = "NotShowIn"
+	keyOrder       = "X-Deepin-Autostop-Order"
+	keyTimeout     = "X-Deepin-Autostop-Timeout"
+	keyRunOnPhases = "X-Deepin-Autostop-On"
+
+	currentDesktop = "Deepin"
+
+	defaultOrder   = 50
+	defaultTimeout = 10 * time.Second
+	// 所有脚本都必须在这个时间内结束
+	defaultDeadline = 30 * time.Second
+)
+
 type Manager struct {
-	logger *log.Logger
+	logger   *log.Logger
+	deadline time.Duration
 }
 
-func LaunchAutostopScripts(logger *log.Logger) error {
+// Entry 是一个 autostop 项，可以是可执行的脚本，
+// 也可以是 desktop 文件，desktop 文件可以设置顺序、超时等信息。
+type Entry struct {
+	Name    string
+	File    string
+	Exec    []string
+	Order   int
+	Timeout time.Duration
+	Phases  []string
+}
+
+func (e *Entry) hasPhase(phase string) bool {
+	for _, p := range e.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+type Result struct {
+	Entry    *Entry
+	Err      error
+	Output   []byte
+	Duration time.Duration
+	TimedOut bool
+}
+
+// LaunchAutostopScripts 运行 phase 阶段的 autostop 项，
+// order 相同的项并行运行，不同 order 的组按从小到大的顺序依次运行。
+func LaunchAutostopScripts(logger *log.Logger, phase string) error {
 	if logger == nil {
 		return fmt.Errorf("Logger is nil")
 	}
 
 	var m = Manager{
-		logger: logger,
+		logger:   logger,
+		deadline: defaultDeadline,
 	}
 
-	m.launchScripts(m.getAutostopScripts())
+	m.launchEntries(m.getAutostopEntries(phase))
 	return nil
 }
 
-func (m *Manager) launchScripts(scripts []string) {
-	for _, script := range scripts {
-		m.logger.Info("[Autostop] will launch:", script)
-		out, err := exec.Command(script).CombinedOutput()
-		if err != nil {
-			m.logger.Warningf("[Autostop] failed to launch %s: %v, %v",
-				script, string(out), err)
+func (m *Manager) launchEntries(entries []*Entry) []*Result {
+	var results []*Result
+	deadline := time.Now().Add(m.deadline)
+	for _, group := range groupEntries(entries) {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			for _, entry := range group {
+				m.logger.Warningf("[Autostop] skip %s, deadline exceeded", entry.Name)
+			}
+			continue
+		}
+
+		ch := make(chan *Result, len(group))
+		for _, entry := range group {
+			timeout := entry.Timeout
+			if timeout > remaining {
+				timeout = remaining
+			}
+			go func(entry *Entry) {
+				ch <- m.runEntry(entry, timeout)
+			}(entry)
+		}
+		for range group {
+			result := <-ch
+			m.logResult(result)
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+func (m *Manager) logResult(result *Result) {
+	name := result.Entry.Name
+	switch {
+	case result.TimedOut:
+		m.logger.Warningf("[Autostop] %s timed out after %v, killed", name, result.Duration)
+	case result.Err != nil:
+		m.logger.Warningf("[Autostop] %s failed after %v: %v, %s", name, result.Duration,
+			result.Err, result.Output)
+	default:
+		m.logger.Infof("[Autostop] %s exited with status 0, cost %v", name, result.Duration)
+	}
+}
+
+func (m *Manager) runEntry(entry *Entry, timeout time.Duration) *Result {
+	m.logger.Info("[Autostop] will launch:", entry.Name)
+	result := &Result{Entry: entry}
+	var out bytes.Buffer
+	cmd := exec.Command(entry.Exec[0], entry.Exec[1:]...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	// 使用单独的进程组，超时后连同子进程一起杀掉
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	t0 := time.Now()
+	err := cmd.Start()
+	if err != nil {
+		result.Err = err
+		return result
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err = <-done:
+		result.Err = err
+		result.Output = out.Bytes()
+	case <-timer.C:
+		result.TimedOut = true
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		// 子进程可能还持有输出管道，不再等待
+		select {
+		case <-done:
+		case <-time.After(100 * time.Millisecond):
 		}
 	}
+	result.Duration = time.Since(t0)
+	return result
 }
 
-func (m *Manager) getAutostopScripts() []string {
+func groupEntries(entries []*Entry) [][]*Entry {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Order < entries[j].Order
+	})
+
+	var groups [][]*Entry
+	for i, entry := range entries {
+		if i == 0 || entry.Order != entries[i-1].Order {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], entry)
+	}
+	return groups
+}
+
+func (m *Manager) getAutostopEntries(phase string) []*Entry {
 	var dirs = []string{
 		path.Join(os.Getenv("HOME"), ".config", "autostop"),
 		"/etc/xdg/autostop",
 	}
-	var scripts []string
+	var entries []*Entry
+	// 用户目录中的项覆盖系统目录中的同名项
+	names := make(map[string]bool)
 	for _, dir := range dirs {
-		tmp, err := doScanScripts(dir)
+		scripts, err := doScanScripts(dir)
 		if err != nil {
-			m.logger.Warning("[Autostop] failed to scan dir:", dir, err)
+			if !os.IsNotExist(err) {
+				m.logger.Warning("[Autostop] failed to scan dir:", dir, err)
+			}
 			continue
 		}
-		scripts = append(scripts, tmp...)
+		for _, script := range scripts {
+			name := path.Base(script)
+			if names[name] {
+				continue
+			}
+			names[name] = true
+
+			entry, err := loadEntry(script)
+			if err != nil {
+				m.logger.Warningf("[Autostop] failed to load %s: %v", script, err)
+				continue
+			}
+			if entry == nil || !entry.hasPhase(phase) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
 	}
-	return scripts
+	return entries
+}
+
+// 返回 nil, nil 表示该项被隐藏或者不在当前桌面显示
+func loadEntry(file string) (*Entry, error) {
+	if !strings.HasSuffix(file, ".desktop") {
+		return &Entry{
+			Name:    path.Base(file),
+			File:    file,
+			Exec:    []string{file},
+			Order:   defaultOrder,
+			Timeout: defaultTimeout,
+			Phases:  []string{PhaseLogout},
+		}, nil
+	}
+
+	kf := keyfile.NewKeyFile()
+	err := kf.LoadFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	hidden, _ := kf.GetBool(sectionDesktopEntry, keyHidden)
+	if hidden {
+		return nil, nil
+	}
+	onlyShowIn, _ := kf.GetStringList(sectionDesktopEntry, keyOnlyShowIn)
+	if len(onlyShowIn) > 0 && !contains(onlyShowIn, currentDesktop) {
+		return nil, nil
+	}
+	notShowIn, _ := kf.GetStringList(sectionDesktopEntry, keyNotShowIn)
+	if contains(notShowIn, currentDesktop) {
+		return nil, nil
+	}
+
+	execStr, _ := kf.GetString(sectionDesktopEntry, keyExec)
+	if execStr == "" {
+		return nil, fmt.Errorf("key %s is empty", keyExec)
+	}
+
+	entry := &Entry{
+		File:    file,
+		Exec:    []string{"/bin/sh", "-c", execStr},
+		Order:   defaultOrder,
+		Timeout: defaultTimeout,
+		Phases:  []string{PhaseLogout},
+	}
+	entry.Name, _ = kf.GetString(sectionDesktopEntry, keyName)
+	if entry.Name == "" {
+		entry.Name = path.Base(file)
+	}
+	order, err := kf.GetInt(sectionDesktopEntry, keyOrder)
+	if err == nil {
+		entry.Order = order
+	}
+	timeout, err := kf.GetInt(sectionDesktopEntry, keyTimeout)
+	if err == nil && timeout > 0 {
+		entry.Timeout = time.Duration(timeout) * time.Second
+	}
+	phases, _ := kf.GetStringList(sectionDesktopEntry, keyRunOnPhases)
+	if len(phases) > 0 {
+		entry.Phases = phases
+	}
+	return entry, nil
+}
+
+func contains(list []string, str string) bool {
+	for _, v := range list {
+		if v == str {
+			return true
+		}
+	}
+	return false
 }
 
 func doScanScripts(dir string) ([]string, error) {
@@ -81,8 +326,11 @@ func doScanScripts(dir string) ([]string, error) {
 
 	var scripts []string
 	for _, finfo := range finfos {
-		if finfo.IsDir() ||
-			(finfo.Mode().Perm()&os.FileMode(0111) == 0) {
+		if finfo.IsDir() {
+			continue
+		}
+		if !strings.HasSuffix(finfo.Name(), ".desktop") &&
+			finfo.Mode().Perm()&os.FileMode(0111) == 0 {
 			continue
 		}
 		scripts = append(scripts, path.Join(dir, finfo.Name()))
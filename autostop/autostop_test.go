@@ -21,8 +21,11 @@ package autostop
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"pkg.deepin.io/lib/log"
 )
 
 func Test_doScanScripts(t *testing.T) {
@@ -58,3 +61,65 @@ func Test_doScanScripts(t *testing.T) {
 		})
 	}
 }
+
+func Test_loadEntry(t *testing.T) {
+	entry, err := loadEntry("testdata/entries/backup.desktop")
+	require.Nil(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "Backup", entry.Name)
+	assert.Equal(t, []string{"/bin/sh", "-c", "echo backup"}, entry.Exec)
+	assert.Equal(t, 10, entry.Order)
+	assert.Equal(t, 5*time.Second, entry.Timeout)
+	assert.True(t, entry.hasPhase(PhaseLogout))
+	assert.True(t, entry.hasPhase(PhaseShutdown))
+
+	entry, err = loadEntry("testdata/entries/hidden.desktop")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+
+	entry, err = loadEntry("testdata/entries/gnome-only.desktop")
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+
+	entry, err = loadEntry("testdata/scripts/hello.sh")
+	require.Nil(t, err)
+	assert.Equal(t, defaultOrder, entry.Order)
+	assert.Equal(t, []string{PhaseLogout}, entry.Phases)
+}
+
+func Test_groupEntries(t *testing.T) {
+	a := &Entry{Name: "a", Order: 50}
+	b := &Entry{Name: "b", Order: 10}
+	c := &Entry{Name: "c", Order: 50}
+	d := &Entry{Name: "d", Order: 20}
+
+	groups := groupEntries([]*Entry{a, b, c, d})
+	assert.Equal(t, [][]*Entry{{b}, {d}, {a, c}}, groups)
+	assert.Nil(t, groupEntries(nil))
+}
+
+func TestManager_launchEntries(t *testing.T) {
+	m := &Manager{
+		logger:   log.NewLogger("test/autostop"),
+		deadline: 3 * time.Second,
+	}
+	backup, err := loadEntry("testdata/entries/backup.desktop")
+	require.Nil(t, err)
+	sleep, err := loadEntry("testdata/entries/sleep.desktop")
+	require.Nil(t, err)
+	fail := &Entry{Name: "fail", Exec: []string{"/bin/false"}, Order: 10, Timeout: time.Second}
+
+	t0 := time.Now()
+	results := m.launchEntries([]*Entry{sleep, backup, fail})
+	assert.True(t, time.Since(t0) < 3*time.Second)
+	require.Len(t, results, 3)
+
+	byName := make(map[string]*Result)
+	for _, result := range results {
+		byName[result.Entry.Name] = result
+	}
+	assert.Nil(t, byName["Backup"].Err)
+	assert.Equal(t, "backup\n", string(byName["Backup"].Output))
+	assert.NotNil(t, byName["fail"].Err)
+	assert.True(t, byName["Sleep"].TimedOut)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+)
+
+// decodeLayout 把 YAML 或者 JSON 格式的布局文件转换成 JSON，字段名和 display.json 相同
+func decodeLayout(data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return trimmed, nil
+	}
+	var v interface{}
+	err := yaml.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// 从 JSON 解析出的 yaml.Node 是流式的，改成块式的
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
+
+// encodeLayout 把 JSON 格式的布局转换成 format 格式，保持字段的顺序
+func encodeLayout(data []byte, format string) ([]byte, error) {
+	switch format {
+	case formatJSON:
+		var buf bytes.Buffer
+		err := json.Indent(&buf, data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteByte('\n')
+		return buf.Bytes(), nil
+
+	case formatYAML:
+		var node yaml.Node
+		err := yaml.Unmarshal(data, &node)
+		if err != nil {
+			return nil, err
+		}
+		clearStyle(&node)
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		err = enc.Encode(&node)
+		if err != nil {
+			return nil, err
+		}
+		err = enc.Close()
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"pkg.deepin.io/dde/startdde/display/core"
+)
+
+const testLayoutYAML = `Monitors:
+  - Name: HDMI-1
+    Enabled: true
+    X: 0
+    Y: 0
+    Width: 1920
+    Height: 1080
+    RefreshRate: 60
+    Primary: true
+  - UUID: eDP-1:BOE-0747
+    Enabled: false
+`
+
+func TestDecodeLayout(t *testing.T) {
+	data, err := decodeLayout([]byte(testLayoutYAML))
+	require.NoError(t, err)
+	f, err := core.ParseLayoutFile(data)
+	require.NoError(t, err)
+	require.Len(t, f.Monitors, 2)
+	assert.Equal(t, "HDMI-1", f.Monitors[0].Name)
+	assert.Equal(t, uint16(1920), f.Monitors[0].Width)
+	assert.Equal(t, 60.0, f.Monitors[0].RefreshRate)
+	assert.True(t, f.Monitors[0].Primary)
+	assert.Equal(t, "eDP-1:BOE-0747", f.Monitors[1].UUID)
+
+	// JSON 原样使用
+	data, err = decodeLayout([]byte(` {"Monitors": []}` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"Monitors": []}`, string(data))
+
+	_, err = decodeLayout([]byte("Monitors: [\n"))
+	assert.Error(t, err)
+}
+
+func TestEncodeLayout(t *testing.T) {
+	data := []byte(`{"Monitors":[{"UUID":"HDMI-1","Name":"HDMI-1","Enabled":true,"X":0,"Y":0,` +
+		`"Width":1920,"Height":1080,"Rotation":1,"Reflect":0,"RefreshRate":60,"Primary":true}]}`)
+
+	out, err := encodeLayout(data, formatYAML)
+	require.NoError(t, err)
+	// 块式的，保持字段的顺序，序列的缩进和 yaml 库的版本有关
+	yamlStr := string(out)
+	assert.True(t, strings.HasPrefix(yamlStr, "Monitors:\n"))
+	assert.NotContains(t, yamlStr, "{")
+	assert.Contains(t, yamlStr, "RefreshRate: 60\n")
+	assert.Less(t, strings.Index(yamlStr, "UUID:"), strings.Index(yamlStr, "Name:"))
+	assert.Less(t, strings.Index(yamlStr, "Width:"), strings.Index(yamlStr, "Height:"))
+
+	// YAML 转换回来和原来的相同
+	decoded, err := decodeLayout(out)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(data), string(decoded))
+
+	out, err = encodeLayout(data, formatJSON)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "\n  \"Monitors\": [\n")
+
+	_, err = encodeLayout(data, "xml")
+	assert.Error(t, err)
+}
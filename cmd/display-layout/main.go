@@ -0,0 +1,215 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/display/core"
+)
+
+// display-layout 读取和应用显示布局，由会话中的 com.deepin.daemon.Display 应用，
+// 用于脚本和自助终端等需要固定布局的场景
+
+const (
+	displayService   = "com.deepin.daemon.Display"
+	displayPath      = "/com/deepin/daemon/Display"
+	displayInterface = "com.deepin.daemon.Display"
+
+	orgFreedesktopDBus = "org.freedesktop.DBus"
+	propsInterface     = "org.freedesktop.DBus.Properties"
+)
+
+// 热插拔之后等 Display 服务应用完自己的配置再应用布局
+const watchDelay = 2 * time.Second
+
+func init() {
+	log.SetFlags(0)
+	log.SetPrefix("display-layout: ")
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  %[1]s dump [--format yaml|json]
+  %[1]s apply [--format yaml|json] [--dry-run] [--watch] FILE
+
+dump prints the layout of connected monitors.
+apply validates FILE (YAML or JSON, "-" for stdin) and applies it atomically.
+With --dry-run the resulting layout is printed without applying it.
+With --watch the layout is applied again whenever monitors are plugged in or out.
+`, os.Args[0])
+}
+
+func getDisplay() (dbus.BusObject, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+	return conn.Object(displayService, displayPath), nil
+}
+
+func printLayout(data []byte, format string) error {
+	out, err := encodeLayout(data, format)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
+
+func dump(format string) error {
+	obj, err := getDisplay()
+	if err != nil {
+		return err
+	}
+	var layout string
+	err = obj.Call(displayInterface+".GetLayout", 0).Store(&layout)
+	if err != nil {
+		return err
+	}
+	return printLayout([]byte(layout), format)
+}
+
+func readLayoutFile(filename string) ([]byte, error) {
+	var data []byte
+	var err error
+	if filename == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+	data, err = decodeLayout(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filename, err)
+	}
+	// 先在本地检查，不需要连接 Display 服务就能发现文件中的错误
+	_, err = core.ParseLayoutFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid layout %s: %v", filename, err)
+	}
+	return data, nil
+}
+
+func applyLayout(obj dbus.BusObject, layout []byte, format string, dryRun bool) error {
+	var result string
+	err := obj.Call(displayInterface+".ApplyLayout", 0, string(layout), dryRun).Store(&result)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		return printLayout([]byte(result), format)
+	}
+	return nil
+}
+
+// 监听 Display 服务的 Monitors 属性，显示器连接或断开时调用 cb
+func watchMonitors(cb func()) error {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	signalChan := make(chan *dbus.Signal, 10)
+	conn.Signal(signalChan)
+	rule := fmt.Sprintf("type='signal',interface='%s',member='PropertiesChanged',path='%s'",
+		propsInterface, displayPath)
+	err = conn.BusObject().Call(orgFreedesktopDBus+".AddMatch", 0, rule).Err
+	if err != nil {
+		return err
+	}
+
+	var timer *time.Timer
+	for signal := range signalChan {
+		if signal.Name != propsInterface+".PropertiesChanged" || signal.Path != displayPath ||
+			len(signal.Body) < 2 {
+			continue
+		}
+		iface, _ := signal.Body[0].(string)
+		changed, _ := signal.Body[1].(map[string]dbus.Variant)
+		if iface != displayInterface {
+			continue
+		}
+		if _, ok := changed["Monitors"]; !ok {
+			continue
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		timer = time.AfterFunc(watchDelay, cb)
+	}
+	return nil
+}
+
+func apply(filename, format string, dryRun, watch bool) error {
+	layout, err := readLayoutFile(filename)
+	if err != nil {
+		return err
+	}
+	obj, err := getDisplay()
+	if err != nil {
+		return err
+	}
+	err = applyLayout(obj, layout, format, dryRun)
+	if err != nil {
+		return err
+	}
+	if !watch {
+		return nil
+	}
+
+	return watchMonitors(func() {
+		log.Println("monitors changed, apply layout")
+		err := applyLayout(obj, layout, format, dryRun)
+		if err != nil {
+			log.Println("failed to apply layout:", err)
+		}
+	})
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	fs.Usage = usage
+	format := fs.String("format", formatYAML, "output format, yaml or json")
+	var dryRun, watch bool
+	if os.Args[1] == "apply" {
+		fs.BoolVar(&dryRun, "dry-run", false, "validate and print the layout without applying it")
+		fs.BoolVar(&watch, "watch", false, "apply the layout again on hotplug")
+	}
+	_ = fs.Parse(os.Args[2:])
+	if *format != formatYAML && *format != formatJSON {
+		log.Fatalf("unknown format %q", *format)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "dump":
+		if fs.NArg() != 0 {
+			usage()
+			os.Exit(2)
+		}
+		err = dump(*format)
+	case "apply":
+		if fs.NArg() != 1 {
+			usage()
+			os.Exit(2)
+		}
+		err = apply(fs.Arg(0), *format, dryRun, watch)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,423 @@
+package display
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"pkg.deepin.io/dde/startdde/display/configfile"
+)
+
+// 根据环境光传感器自动调节内置显示器的亮度
+
+const (
+	defaultIIODevicesDir = "/sys/bus/iio/devices"
+
+	defaultAutoBrightnessInterval = 500 // ms
+	// 环境光照度的平滑系数，越小越平滑
+	luxSmoothingFactor = 0.3
+	// 亮度差异小于该值时不调节，避免来回跳动
+	autoBrightnessDeadband = 0.02
+	// 每次最多调节的亮度
+	autoBrightnessMaxStep = 0.02
+)
+
+// 亮度曲线上的点，Brightness 是实际设置的亮度
+type brightnessCurvePoint struct {
+	Lux        float64
+	Brightness float64
+}
+
+// 按 Lux 从小到大排列，亮度单调不减
+type brightnessCurve []brightnessCurvePoint
+
+var defaultBrightnessCurve = brightnessCurve{
+	{Lux: 0, Brightness: 0.2},
+	{Lux: 10, Brightness: 0.3},
+	{Lux: 100, Brightness: 0.5},
+	{Lux: 1000, Brightness: 0.8},
+	{Lux: 10000, Brightness: 1},
+}
+
+// 人眼对照度的感知接近对数，在 log10(lux+1) 上做线性插值
+func luxToLog(lux float64) float64 {
+	return math.Log10(math.Max(lux, 0) + 1)
+}
+
+func (c brightnessCurve) eval(lux float64) float64 {
+	if len(c) == 0 {
+		return 1
+	}
+	if lux <= c[0].Lux {
+		return c[0].Brightness
+	}
+	for i := 1; i < len(c); i++ {
+		if lux <= c[i].Lux {
+			x0, x1 := luxToLog(c[i-1].Lux), luxToLog(c[i].Lux)
+			t := (luxToLog(lux) - x0) / (x1 - x0)
+			return c[i-1].Brightness + (c[i].Brightness-c[i-1].Brightness)*t
+		}
+	}
+	return c[len(c)-1].Brightness
+}
+
+// learn 根据用户在照度 lux 下手动设置的亮度修正曲线，返回新的曲线。
+// 离 lux 最近的点被移动到 (lux, brightness)，距离太远时插入新的点，
+// 然后调整其它的点使曲线保持单调。
+func (c brightnessCurve) learn(lux, brightness float64) brightnessCurve {
+	const mergeDistance = 0.25 // log10 上的距离
+
+	result := make(brightnessCurve, 0, len(c)+1)
+	var merged bool
+	for _, p := range c {
+		if !merged && math.Abs(luxToLog(p.Lux)-luxToLog(lux)) < mergeDistance {
+			merged = true
+			continue
+		}
+		result = append(result, p)
+	}
+	result = append(result, brightnessCurvePoint{Lux: lux, Brightness: brightness})
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Lux < result[j].Lux
+	})
+
+	for i := range result {
+		p := &result[i]
+		if p.Lux < lux && p.Brightness > brightness {
+			p.Brightness = brightness
+		} else if p.Lux > lux && p.Brightness < brightness {
+			p.Brightness = brightness
+		}
+	}
+	return result
+}
+
+func (c brightnessCurve) isValid() bool {
+	if len(c) == 0 {
+		return false
+	}
+	for i, p := range c {
+		if p.Lux < 0 || p.Brightness < 0 || p.Brightness > 1 {
+			return false
+		}
+		if i > 0 && (p.Lux <= c[i-1].Lux || p.Brightness < c[i-1].Brightness) {
+			return false
+		}
+	}
+	return true
+}
+
+type autoBrightnessConfig struct {
+	Enabled bool
+	// IIO 设备的目录，比如 /sys/bus/iio/devices/iio:device0，为空时自动查找
+	SensorPath string `json:",omitempty"`
+	// 读取传感器的间隔，单位毫秒
+	Interval int
+	Curve    brightnessCurve
+}
+
+func loadAutoBrightnessConfig(filename string) *autoBrightnessConfig {
+	cfg := &autoBrightnessConfig{}
+	data, err := ioutil.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load auto brightness config:", err)
+	}
+
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultAutoBrightnessInterval
+	}
+	if !cfg.Curve.isValid() {
+		cfg.Curve = append(brightnessCurve(nil), defaultBrightnessCurve...)
+	}
+	return cfg
+}
+
+// 每次学习都会保存，不保留备份
+func (cfg *autoBrightnessConfig) save(filename string) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, data, 0644, 0)
+}
+
+// 环境光传感器，读取 IIO 设备的 in_illuminance_input 或 in_illuminance_raw
+type lightSensor struct {
+	dir    string
+	useRaw bool
+	scale  float64
+	offset float64
+}
+
+func findLightSensor(iioDir string) (*lightSensor, error) {
+	devices, err := filepath.Glob(filepath.Join(iioDir, "iio:device*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range devices {
+		sensor, err := openLightSensor(dir)
+		if err == nil {
+			return sensor, nil
+		}
+	}
+	return nil, errors.New("not found ambient light sensor")
+}
+
+func openLightSensor(dir string) (*lightSensor, error) {
+	sensor := &lightSensor{dir: dir, scale: 1}
+	_, err := os.Stat(filepath.Join(dir, "in_illuminance_input"))
+	if err == nil {
+		return sensor, nil
+	}
+
+	_, err = os.Stat(filepath.Join(dir, "in_illuminance_raw"))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an ambient light sensor", dir)
+	}
+	sensor.useRaw = true
+	if v, err := readSysfsFloat(filepath.Join(dir, "in_illuminance_scale")); err == nil {
+		sensor.scale = v
+	}
+	if v, err := readSysfsFloat(filepath.Join(dir, "in_illuminance_offset")); err == nil {
+		sensor.offset = v
+	}
+	return sensor, nil
+}
+
+func readSysfsFloat(filename string) (float64, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+}
+
+// 返回照度，单位 lux
+func (s *lightSensor) read() (float64, error) {
+	if !s.useRaw {
+		return readSysfsFloat(filepath.Join(s.dir, "in_illuminance_input"))
+	}
+	raw, err := readSysfsFloat(filepath.Join(s.dir, "in_illuminance_raw"))
+	if err != nil {
+		return 0, err
+	}
+	return (raw + s.offset) * s.scale, nil
+}
+
+type autoBrightness struct {
+	m       *Manager
+	mu      sync.Mutex
+	cfgFile string
+	cfg     *autoBrightnessConfig
+	sensor  *lightSensor
+	lux     float64 // 平滑后的照度，小于 0 表示还没有读取过
+	quit    chan struct{}
+	settled bool // 亮度是否已经调节到目标值
+}
+
+func newAutoBrightness(m *Manager, cfgFile, iioDir string) *autoBrightness {
+	ab := &autoBrightness{
+		m:       m,
+		cfgFile: cfgFile,
+		cfg:     loadAutoBrightnessConfig(cfgFile),
+		lux:     -1,
+	}
+
+	var err error
+	if ab.cfg.SensorPath != "" {
+		ab.sensor, err = openLightSensor(ab.cfg.SensorPath)
+	} else {
+		ab.sensor, err = findLightSensor(iioDir)
+	}
+	if err != nil {
+		logger.Debug(err)
+	} else {
+		logger.Debug("ambient light sensor:", ab.sensor.dir)
+	}
+	return ab
+}
+
+func (ab *autoBrightness) hasSensor() bool {
+	return ab.sensor != nil
+}
+
+func (ab *autoBrightness) isEnabled() bool {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	return ab.cfg.Enabled && ab.sensor != nil
+}
+
+func (ab *autoBrightness) setEnabled(enabled bool) error {
+	if enabled && ab.sensor == nil {
+		return errors.New("no ambient light sensor")
+	}
+
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	if ab.cfg.Enabled != enabled {
+		ab.cfg.Enabled = enabled
+		err := ab.cfg.save(ab.cfgFile)
+		if err != nil {
+			logger.Warning("failed to save auto brightness config:", err)
+		}
+	}
+
+	if enabled && ab.quit == nil {
+		ab.quit = make(chan struct{})
+		ab.lux = -1
+		go ab.loop(ab.quit, time.Duration(ab.cfg.Interval)*time.Millisecond)
+	} else if !enabled && ab.quit != nil {
+		close(ab.quit)
+		ab.quit = nil
+	}
+	return nil
+}
+
+func (ab *autoBrightness) loop(quit chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ab.update()
+		select {
+		case <-ticker.C:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// 读取传感器，按平滑后的照度计算目标亮度，每次最多调节 autoBrightnessMaxStep
+func (ab *autoBrightness) update() {
+	lux, err := ab.sensor.read()
+	if err != nil {
+		logger.Warning("failed to read ambient light sensor:", err)
+		return
+	}
+
+	ab.mu.Lock()
+	if ab.lux < 0 {
+		ab.lux = lux
+	} else {
+		ab.lux = luxSmoothingFactor*lux + (1-luxSmoothingFactor)*ab.lux
+	}
+	target := ab.cfg.Curve.eval(ab.lux)
+	ab.mu.Unlock()
+
+	ab.m.applyAutoBrightness(target, ab)
+}
+
+// learn 把用户手动设置的亮度记录到曲线中
+func (ab *autoBrightness) learn(value float64) {
+	ab.mu.Lock()
+	defer ab.mu.Unlock()
+	if !ab.cfg.Enabled || ab.lux < 0 {
+		return
+	}
+	logger.Debugf("learn auto brightness %.3f at %.1f lux", value, ab.lux)
+	ab.cfg.Curve = ab.cfg.Curve.learn(ab.lux, value)
+	err := ab.cfg.save(ab.cfgFile)
+	if err != nil {
+		logger.Warning("failed to save auto brightness config:", err)
+	}
+}
+
+// 计算下一次要设置的亮度，返回是否需要调节
+func nextAutoBrightness(current, target float64) (float64, bool) {
+	diff := target - current
+	if math.Abs(diff) < autoBrightnessDeadband {
+		return current, false
+	}
+	if diff > autoBrightnessMaxStep {
+		diff = autoBrightnessMaxStep
+	} else if diff < -autoBrightnessMaxStep {
+		diff = -autoBrightnessMaxStep
+	}
+	return current + diff, true
+}
+
+func (m *Manager) initAutoBrightness() {
+	m.autoBrightness = newAutoBrightness(m, autoBrightnessConfigFile, defaultIIODevicesDir)
+	m.PropsMu.Lock()
+	m.setPropHasAmbientLightSensor(m.autoBrightness.hasSensor())
+	m.PropsMu.Unlock()
+
+	if m.autoBrightness.cfg.Enabled {
+		err := m.setAutoBrightness(true)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+}
+
+func (m *Manager) setAutoBrightness(enabled bool) error {
+	if m.autoBrightness == nil {
+		return errors.New("auto brightness is not initialized")
+	}
+	err := m.autoBrightness.setEnabled(enabled)
+	if err != nil {
+		return err
+	}
+	m.PropsMu.Lock()
+	m.setPropAutoBrightness(enabled)
+	m.PropsMu.Unlock()
+	return nil
+}
+
+func (m *Manager) applyAutoBrightness(target float64, ab *autoBrightness) {
+	monitor := m.getBuiltinMonitor()
+	if monitor == nil || m.isScreenDimmed() {
+		return
+	}
+	profile := m.getBrightnessProfile(monitor.uuid)
+	target = math.Max(profile.getMin(m.isNightTime()), math.Min(profile.Max, target))
+
+	current := m.getBrightness(monitor.Name)
+
+	value, changed := nextAutoBrightness(current, target)
+	if !changed {
+		ab.mu.Lock()
+		settled := ab.settled
+		ab.settled = true
+		ab.mu.Unlock()
+		if !settled {
+			m.saveBrightness()
+		}
+		return
+	}
+
+	ab.mu.Lock()
+	ab.settled = false
+	ab.mu.Unlock()
+	err := m.doSetBrightness(value, monitor.Name)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// 用户通过快捷键或者 SetAndSaveBrightness 调节内置显示器的亮度时，修正自动亮度的曲线。
+// SetBrightness 常用于预览和临时的调节，不修正。
+func (m *Manager) learnAutoBrightness(outputName string) {
+	if m.autoBrightness == nil || !m.autoBrightness.isEnabled() {
+		return
+	}
+	monitor := m.getBuiltinMonitor()
+	if monitor == nil || monitor.Name != outputName {
+		return
+	}
+	value, ok := m.brightness.Get(outputName)
+	if ok {
+		m.autoBrightness.learn(value)
+	}
+}
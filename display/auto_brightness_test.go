@@ -0,0 +1,102 @@
+package display
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrightnessCurve_eval(t *testing.T) {
+	c := brightnessCurve{
+		{Lux: 0, Brightness: 0.2},
+		{Lux: 99, Brightness: 0.6},
+		{Lux: 9999, Brightness: 1},
+	}
+	assert.Equal(t, 0.2, c.eval(-1))
+	assert.Equal(t, 0.2, c.eval(0))
+	assert.InDelta(t, 0.4, c.eval(9), 1e-9)
+	assert.InDelta(t, 0.6, c.eval(99), 1e-9)
+	assert.InDelta(t, 0.8, c.eval(999), 1e-9)
+	assert.Equal(t, 1.0, c.eval(100000))
+}
+
+func TestBrightnessCurve_learn(t *testing.T) {
+	c := append(brightnessCurve(nil), defaultBrightnessCurve...)
+
+	// 靠近已有的点时替换它，并保持单调
+	c1 := c.learn(110, 0.9)
+	assert.True(t, c1.isValid())
+	assert.Len(t, c1, len(c))
+	assert.InDelta(t, 0.9, c1.eval(110), 1e-9)
+	assert.Equal(t, 0.9, c1[3].Brightness)
+	assert.Equal(t, 1.0, c1[4].Brightness)
+
+	// 离已有的点较远时插入新的点
+	c2 := c.learn(30, 0.2)
+	assert.True(t, c2.isValid())
+	assert.Len(t, c2, len(c)+1)
+	assert.InDelta(t, 0.2, c2.eval(30), 1e-9)
+	assert.Equal(t, 0.2, c2[1].Brightness)
+
+	// 原来的曲线不变
+	assert.Equal(t, defaultBrightnessCurve, c)
+}
+
+func Test_nextAutoBrightness(t *testing.T) {
+	_, changed := nextAutoBrightness(0.5, 0.51)
+	assert.False(t, changed)
+
+	v, changed := nextAutoBrightness(0.5, 0.9)
+	assert.True(t, changed)
+	assert.InDelta(t, 0.5+autoBrightnessMaxStep, v, 1e-9)
+
+	v, changed = nextAutoBrightness(0.5, 0.1)
+	assert.True(t, changed)
+	assert.InDelta(t, 0.5-autoBrightnessMaxStep, v, 1e-9)
+}
+
+func Test_lightSensor(t *testing.T) {
+	sensor, err := findLightSensor("./testdata/iio")
+	require.NoError(t, err)
+	assert.Equal(t, "testdata/iio/iio:device1", sensor.dir)
+	lux, err := sensor.read()
+	require.NoError(t, err)
+	assert.Equal(t, 100.0, lux)
+
+	sensor, err = openLightSensor("./testdata/iio/iio:device2")
+	require.NoError(t, err)
+	lux, err = sensor.read()
+	require.NoError(t, err)
+	assert.Equal(t, 35.5, lux)
+
+	_, err = openLightSensor("./testdata/iio/iio:device0")
+	assert.Error(t, err)
+}
+
+func Test_autoBrightnessConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-display")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "auto-brightness.json")
+	cfg := loadAutoBrightnessConfig(filename)
+	assert.False(t, cfg.Enabled)
+	assert.Equal(t, defaultAutoBrightnessInterval, cfg.Interval)
+	assert.Equal(t, defaultBrightnessCurve, cfg.Curve)
+
+	cfg.Enabled = true
+	cfg.SensorPath = "./testdata/iio/iio:device2"
+	cfg.Curve = cfg.Curve.learn(30, 0.2)
+	err = cfg.save(filename)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, loadAutoBrightnessConfig(filename))
+
+	// 无效的曲线使用默认值
+	err = ioutil.WriteFile(filename, []byte(`{"Curve":[{"Lux":10,"Brightness":0.5},{"Lux":1,"Brightness":0.6}]}`), 0644)
+	require.NoError(t, err)
+	assert.Equal(t, defaultBrightnessCurve, loadAutoBrightnessConfig(filename).Curve)
+}
@@ -0,0 +1,331 @@
+package display
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	sensorproxy "github.com/linuxdeepin/go-dbus-factory/net.hadess.sensorproxy"
+	"pkg.deepin.io/dde/startdde/display/configfile"
+	"pkg.deepin.io/dde/startdde/display/core"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// 根据 iio-sensor-proxy 报告的方向自动旋转内置显示器
+
+// 方向保持这么久不变才旋转
+const autoRotationDelay = time.Second
+
+// 设置为 session 时从 session bus 上的 net.hadess.SensorProxy 读取方向，
+// 用于在没有加速度传感器的机器上运行假的服务进行测试
+const envSensorProxyBus = "DEEPIN_DISPLAY_SENSOR_PROXY_BUS"
+
+// 方向传感器
+type orientationSensor interface {
+	hasAccelerometer() (bool, error)
+	// 开始读取传感器，之后才会报告方向的变化
+	claim() error
+	release() error
+	orientation() (string, error)
+	connectOrientationChanged(cb func(orientation string)) error
+}
+
+// iio-sensor-proxy 的 D-Bus 接口
+type sensorProxy struct {
+	obj *sensorproxy.SensorProxy
+}
+
+func newSensorProxy() (*sensorProxy, error) {
+	var conn *dbus.Conn
+	var err error
+	if os.Getenv(envSensorProxyBus) == "session" {
+		conn, err = dbus.SessionBus()
+	} else {
+		conn, err = dbus.SystemBus()
+	}
+	if err != nil {
+		return nil, err
+	}
+	sigLoop := dbusutil.NewSignalLoop(conn, 10)
+	sigLoop.Start()
+	obj := sensorproxy.NewSensorProxy(conn)
+	obj.InitSignalExt(sigLoop, true)
+	return &sensorProxy{obj: obj}, nil
+}
+
+func (p *sensorProxy) hasAccelerometer() (bool, error) {
+	return p.obj.HasAccelerometer().Get(0)
+}
+
+func (p *sensorProxy) claim() error {
+	return p.obj.ClaimAccelerometer(0)
+}
+
+func (p *sensorProxy) release() error {
+	return p.obj.ReleaseAccelerometer(0)
+}
+
+func (p *sensorProxy) orientation() (string, error) {
+	return p.obj.AccelerometerOrientation().Get(0)
+}
+
+func (p *sensorProxy) connectOrientationChanged(cb func(orientation string)) error {
+	return p.obj.AccelerometerOrientation().ConnectChanged(func(hasValue bool, value string) {
+		if hasValue {
+			cb(value)
+		}
+	})
+}
+
+type autoRotationConfig struct {
+	Enabled bool
+	// 用户锁定了旋转，暂时不自动旋转
+	Locked bool
+}
+
+func loadAutoRotationConfig(filename string) *autoRotationConfig {
+	cfg := &autoRotationConfig{Enabled: true}
+	data, err := ioutil.ReadFile(filename)
+	if err == nil {
+		err = json.Unmarshal(data, cfg)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load auto rotation config:", err)
+	}
+	return cfg
+}
+
+func (cfg *autoRotationConfig) save(filename string) error {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, data, 0644, 0)
+}
+
+type autoRotation struct {
+	mu        sync.Mutex
+	cfgFile   string
+	cfg       *autoRotationConfig
+	sensor    orientationSensor // 没有加速度传感器时为 nil
+	claimed   bool
+	debouncer *core.OrientationDebouncer
+}
+
+// rotate 在方向稳定之后被调用，参数是内置显示器需要的旋转
+func newAutoRotation(cfgFile string, sensor orientationSensor, delay time.Duration,
+	rotate func(rotation uint16)) *autoRotation {
+	ar := &autoRotation{
+		cfgFile: cfgFile,
+		cfg:     loadAutoRotationConfig(cfgFile),
+	}
+	ar.debouncer = core.NewOrientationDebouncer(delay, func(orientation string) {
+		rotation, ok := core.OrientationToRotation(orientation)
+		if ok && ar.isActive() {
+			rotate(rotation)
+		}
+	})
+
+	if sensor != nil {
+		has, err := sensor.hasAccelerometer()
+		if err != nil {
+			logger.Debug("failed to get HasAccelerometer:", err)
+		} else if has {
+			ar.sensor = sensor
+		}
+	}
+	if ar.sensor == nil {
+		return ar
+	}
+
+	err := ar.sensor.connectOrientationChanged(func(orientation string) {
+		if ar.isActive() {
+			ar.debouncer.Update(orientation)
+		}
+	})
+	if err != nil {
+		logger.Warning(err)
+	}
+	ar.mu.Lock()
+	ar.update()
+	ar.mu.Unlock()
+	return ar
+}
+
+func (ar *autoRotation) hasSensor() bool {
+	return ar.sensor != nil
+}
+
+func (ar *autoRotation) isActive() bool {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	return ar.claimed
+}
+
+// 开启并且没有锁定时读取传感器，否则释放传感器，调用时需要持有 ar.mu
+func (ar *autoRotation) update() {
+	if ar.sensor == nil {
+		return
+	}
+	active := ar.cfg.Enabled && !ar.cfg.Locked
+	if active == ar.claimed {
+		return
+	}
+
+	if !active {
+		ar.debouncer.Stop()
+		err := ar.sensor.release()
+		if err != nil {
+			logger.Warning("failed to release accelerometer:", err)
+		}
+		ar.claimed = false
+		return
+	}
+
+	err := ar.sensor.claim()
+	if err != nil {
+		logger.Warning("failed to claim accelerometer:", err)
+		return
+	}
+	ar.claimed = true
+	// 锁定期间设备的方向可能变了，立即按当前方向旋转
+	ar.debouncer.Reset()
+	orientation, err := ar.sensor.orientation()
+	if err != nil {
+		logger.Warning(err)
+		return
+	}
+	ar.debouncer.Update(orientation)
+}
+
+func (ar *autoRotation) setConfig(fn func(cfg *autoRotationConfig)) error {
+	if ar.sensor == nil {
+		return errors.New("no accelerometer")
+	}
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	old := *ar.cfg
+	fn(ar.cfg)
+	if *ar.cfg != old {
+		err := ar.cfg.save(ar.cfgFile)
+		if err != nil {
+			logger.Warning("failed to save auto rotation config:", err)
+		}
+	}
+	ar.update()
+	return nil
+}
+
+func (ar *autoRotation) setEnabled(enabled bool) error {
+	return ar.setConfig(func(cfg *autoRotationConfig) {
+		cfg.Enabled = enabled
+	})
+}
+
+func (ar *autoRotation) setLocked(locked bool) error {
+	return ar.setConfig(func(cfg *autoRotationConfig) {
+		cfg.Locked = locked
+	})
+}
+
+func (m *Manager) initAutoRotation() {
+	var sensor orientationSensor
+	proxy, err := newSensorProxy()
+	if err != nil {
+		logger.Warning(err)
+	} else {
+		sensor = proxy
+	}
+	m.autoRotation = newAutoRotation(autoRotationConfigFile, sensor, autoRotationDelay,
+		m.rotateBuiltinMonitor)
+
+	m.PropsMu.Lock()
+	m.setPropAutoRotation(m.autoRotation.cfg.Enabled)
+	m.setPropRotationLocked(m.autoRotation.cfg.Locked)
+	m.PropsMu.Unlock()
+}
+
+func (m *Manager) setAutoRotation(enabled bool) error {
+	if m.autoRotation == nil {
+		return errors.New("auto rotation is not initialized")
+	}
+	err := m.autoRotation.setEnabled(enabled)
+	if err != nil {
+		return err
+	}
+	m.PropsMu.Lock()
+	m.setPropAutoRotation(enabled)
+	m.PropsMu.Unlock()
+	return nil
+}
+
+func (m *Manager) setRotationLock(locked bool) error {
+	if m.autoRotation == nil {
+		return errors.New("auto rotation is not initialized")
+	}
+	err := m.autoRotation.setLocked(locked)
+	if err != nil {
+		return err
+	}
+	m.PropsMu.Lock()
+	m.setPropRotationLocked(locked)
+	m.PropsMu.Unlock()
+	return nil
+}
+
+// 旋转内置显示器并保存，触摸屏的坐标变换矩阵在 apply 中更新。
+// 用户有没有保存的修改时不旋转，避免把这些修改也保存了。
+func (m *Manager) rotateBuiltinMonitor(rotation uint16) {
+	monitor := m.getBuiltinMonitor()
+	if monitor == nil || !monitor.Enabled || monitor.Rotation == rotation {
+		return
+	}
+	if m.HasChanged {
+		logger.Debug("has unsaved changes, skip auto rotation")
+		return
+	}
+	if m.lid.Closed() {
+		logger.Debug("lid is closed, skip auto rotation")
+		return
+	}
+	logger.Infof("auto rotate %s to %d", monitor.Name, rotation)
+
+	monitor.PropsMu.RLock()
+	x, y := monitor.X, monitor.Y
+	oldWidth, oldHeight := monitor.Width, monitor.Height
+	monitor.PropsMu.RUnlock()
+	monitor.setRotation(rotation)
+	monitor.PropsMu.RLock()
+	dw := int16(monitor.Width) - int16(oldWidth)
+	dh := int16(monitor.Height) - int16(oldHeight)
+	monitor.PropsMu.RUnlock()
+
+	// 内置显示器的宽高交换了，右边和下边的显示器跟着移动，避免重叠或者出现空隙
+	for _, other := range m.getConnectedMonitors() {
+		if other == monitor || !other.Enabled {
+			continue
+		}
+		other.PropsMu.Lock()
+		if dw != 0 && other.X >= x+int16(oldWidth) {
+			other.setPropX(other.X + dw)
+		}
+		if dh != 0 && other.Y >= y+int16(oldHeight) {
+			other.setPropY(other.Y + dh)
+		}
+		other.PropsMu.Unlock()
+	}
+
+	err := m.apply()
+	if err != nil {
+		logger.Warning("failed to apply auto rotation:", err)
+		return
+	}
+	err = m.save()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
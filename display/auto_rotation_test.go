@@ -0,0 +1,152 @@
+package display
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"pkg.deepin.io/dde/startdde/display/core"
+)
+
+// 代替 iio-sensor-proxy 的假传感器
+type fakeOrientationSensor struct {
+	mu              sync.Mutex
+	claimed         bool
+	current         string
+	onChanged       func(orientation string)
+	noAccelerometer bool
+}
+
+func (s *fakeOrientationSensor) hasAccelerometer() (bool, error) {
+	return !s.noAccelerometer, nil
+}
+
+func (s *fakeOrientationSensor) claim() error {
+	s.mu.Lock()
+	s.claimed = true
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *fakeOrientationSensor) release() error {
+	s.mu.Lock()
+	s.claimed = false
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *fakeOrientationSensor) orientation() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current, nil
+}
+
+func (s *fakeOrientationSensor) connectOrientationChanged(cb func(orientation string)) error {
+	s.onChanged = cb
+	return nil
+}
+
+// 只有被读取时才报告方向的变化
+func (s *fakeOrientationSensor) setOrientation(orientation string) {
+	s.mu.Lock()
+	s.current = orientation
+	claimed := s.claimed
+	s.mu.Unlock()
+	if claimed {
+		s.onChanged(orientation)
+	}
+}
+
+func (s *fakeOrientationSensor) isClaimed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.claimed
+}
+
+func newTestAutoRotation(t *testing.T, sensor *fakeOrientationSensor) (*autoRotation, chan uint16, func()) {
+	dir, err := ioutil.TempDir("", "startdde-display")
+	require.NoError(t, err)
+	rotations := make(chan uint16, 10)
+	ar := newAutoRotation(filepath.Join(dir, "auto-rotation.json"), sensor, 20*time.Millisecond,
+		func(rotation uint16) {
+			rotations <- rotation
+		})
+	return ar, rotations, func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func waitRotation(t *testing.T, rotations chan uint16) uint16 {
+	select {
+	case rotation := <-rotations:
+		return rotation
+	case <-time.After(time.Second):
+		t.Fatal("not rotated")
+	}
+	return 0
+}
+
+func TestAutoRotation(t *testing.T) {
+	sensor := &fakeOrientationSensor{current: core.OrientationNormal}
+	ar, rotations, cleanup := newTestAutoRotation(t, sensor)
+	defer cleanup()
+
+	// 默认开启，启动时按当前方向旋转
+	assert.True(t, ar.hasSensor())
+	assert.True(t, sensor.isClaimed())
+	assert.Equal(t, core.RotationRotate0, waitRotation(t, rotations))
+
+	sensor.setOrientation(core.OrientationLeftUp)
+	assert.Equal(t, core.RotationRotate90, waitRotation(t, rotations))
+
+	// 锁定之后不再旋转
+	require.NoError(t, ar.setLocked(true))
+	assert.False(t, sensor.isClaimed())
+	sensor.setOrientation(core.OrientationBottomUp)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, rotations, 0)
+
+	// 解除锁定时按当前方向旋转
+	require.NoError(t, ar.setLocked(false))
+	assert.Equal(t, core.RotationRotate180, waitRotation(t, rotations))
+
+	// 配置被保存
+	cfg := loadAutoRotationConfig(ar.cfgFile)
+	assert.Equal(t, &autoRotationConfig{Enabled: true}, cfg)
+	require.NoError(t, ar.setEnabled(false))
+	assert.False(t, sensor.isClaimed())
+	cfg = loadAutoRotationConfig(ar.cfgFile)
+	assert.Equal(t, &autoRotationConfig{Enabled: false}, cfg)
+}
+
+func TestAutoRotation_flapping(t *testing.T) {
+	sensor := &fakeOrientationSensor{current: core.OrientationNormal}
+	ar, rotations, cleanup := newTestAutoRotation(t, sensor)
+	defer cleanup()
+	waitRotation(t, rotations)
+
+	for i := 0; i < 5; i++ {
+		sensor.setOrientation(core.OrientationRightUp)
+		time.Sleep(5 * time.Millisecond)
+		sensor.setOrientation(core.OrientationNormal)
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, rotations, 0)
+	assert.True(t, ar.isActive())
+}
+
+func TestAutoRotation_noSensor(t *testing.T) {
+	sensor := &fakeOrientationSensor{noAccelerometer: true}
+	ar, _, cleanup := newTestAutoRotation(t, sensor)
+	defer cleanup()
+
+	assert.False(t, ar.hasSensor())
+	assert.False(t, sensor.isClaimed())
+	assert.Error(t, ar.setEnabled(true))
+}
@@ -20,109 +20,93 @@
 package display
 
 import (
-	"encoding/json"
-	"fmt"
-	"math"
 	"os"
 	"path/filepath"
 
 	"pkg.deepin.io/dde/startdde/display/brightness"
+	"pkg.deepin.io/dde/startdde/display/core"
 )
 
-type InvalidOutputNameError struct {
-	Name string
+type InvalidOutputNameError = core.InvalidOutputNameError
+
+// 通过 RandR 或者背光设置硬件的亮度
+type brightnessBackend struct {
+	m *Manager
 }
 
-func (err InvalidOutputNameError) Error() string {
-	return fmt.Sprintf("invalid output name %q", err.Name)
+func (b brightnessBackend) OutputEnabled(name string) (enabled, ok bool) {
+	monitor := b.m.getConnectedMonitors().GetByName(name)
+	if monitor == nil {
+		return false, false
+	}
+	monitor.PropsMu.RLock()
+	enabled = monitor.Enabled
+	monitor.PropsMu.RUnlock()
+	return enabled, true
+}
+
+func (b brightnessBackend) SetOutputBrightness(name string, value float64) error {
+	monitor := b.m.getConnectedMonitors().GetByName(name)
+	if monitor == nil {
+		return InvalidOutputNameError{Name: name}
+	}
+	err := b.m.setMonitorBrightness(monitor, value)
+	if err != nil {
+		logger.Warningf("failed to set brightness for %s: %v", name, err)
+	}
+	return err
 }
 
 func (m *Manager) saveBrightness() {
-	jsonStr := jsonMarshal(m.Brightness)
-	m.settings.SetString(gsKeyBrightness, jsonStr)
+	m.brightness.SaveAll()
 }
 
-func (m *Manager) changeBrightness(raised bool) error {
-	var step float64 = 0.05
-	if m.MaxBacklightBrightness < 100 {
-		step = 1 / float64(m.MaxBacklightBrightness)
+// 返回输出设备的亮度，没有记录时为 1
+func (m *Manager) getBrightness(name string) float64 {
+	value, ok := m.brightness.Get(name)
+	if !ok {
+		return 1
+	}
+	return value
+}
+
+// 返回通过背光调节亮度的显示器的背光级数，级数较多或者不使用背光时返回 0
+func (m *Manager) getBacklightLevels(monitor *Monitor) int {
+	levels := int(m.MaxBacklightBrightness)
+	if levels <= 0 || levels >= 100 {
+		return 0
 	}
-	if !raised {
-		step = -step
+	if !brightness.UsesBacklight(m.getBrightnessSetter(), m.isBuiltinMonitor(monitor),
+		monitor.ID, m.xConn) {
+		return 0
 	}
+	return levels
+}
+
+func (m *Manager) changeBrightness(raised bool) error {
+	night := m.isNightTime()
 
 	monitors := m.getConnectedMonitors()
 
 	for _, monitor := range monitors {
-		v, ok := m.Brightness[monitor.Name]
-		if !ok {
-			v = 1.0
-		}
-
-		var br float64
-		//setBr := true
-
-		//if blCtrl, err := brightness.GetBacklightController(monitor.ID, m.xConn); err != nil {
-		//	logger.Debugf("get output %q backlight controller failed: %v", monitor.Name, err)
-		//} else {
-		//	max := blCtrl.MaxBrightness
-		//	cur, err := blCtrl.GetBrightness()
-		//	if err == nil {
-		//		// TODO: Some drivers will also set the brightness when the brightness up/down key is pressed
-		//		hv := float64(cur) / float64(max)
-		//		avg := (v + hv) / 2
-		//		delta := (v - hv) / avg
-		//		logger.Debugf("v: %g, hv: %g, avg: %g delta: %g", v, hv, avg, delta)
-		//
-		//		if math.Abs(delta) > 0.05 {
-		//			logger.Debug("backlight actual brightness is not set")
-		//			setBr = false
-		//			br = hv
-		//		}
-		//	}
-		//}
-
-		//if setBr {
-		br = v + step
-		if br > 1.0 {
-			br = 1.0
-		}
-		if br < 0.0 {
-			br = 0.0
-		}
+		v := m.getBrightness(monitor.Name)
+		profile := m.getBrightnessProfile(monitor.uuid)
+		// 背光的级数较少时，调节的次数不超过级数，并且每次至少调节一级
+		br := profile.stepLevels(v, raised, night, m.getBacklightLevels(monitor))
 		logger.Debug("[changeBrightness] will set to:", monitor.Name, br)
 		err := m.doSetBrightness(br, monitor.Name)
 		if err != nil {
 			return err
 		}
-		//} else {
-		//	logger.Debug("[changeBrightness] will update to:", monitor.Name, br)
-		//	err := m.doSetBrightnessFake(br, monitor.Name)
-		//	if err != nil {
-		//		return err
-		//	}
-		//}
 	}
 
 	m.saveBrightness()
 	return nil
 }
 
-func (m *Manager) getSavedBrightnessTable() (map[string]float64, error) {
-	value := m.settings.GetString(gsKeyBrightness)
-	if value == "" {
-		return nil, nil
-	}
-	var result map[string]float64
-	err := json.Unmarshal([]byte(value), &result)
-	if err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
 func (m *Manager) initBrightness() {
-	brightnessTable, err := m.getSavedBrightnessTable()
+	m.initBrightnessProfiles()
+	brightnessTable, err := core.ParseBrightnessTable(m.settings.GetString(gsKeyBrightness))
 	if err != nil {
 		logger.Warning(err)
 	}
@@ -135,9 +119,26 @@ func (m *Manager) initBrightness() {
 		if _, ok := brightnessTable[monitor.Name]; ok {
 			continue
 		}
-		brightnessTable[monitor.Name] = 1
+		// 没有保存过亮度时，使用硬件当前的亮度，避免登录后亮度被重置到最高
+		value, err := brightness.Get(m.getBrightnessSetter(), m.isBuiltinMonitor(monitor),
+			monitor.ID, m.xConn)
+		if err != nil {
+			logger.Debugf("failed to get brightness of %s: %v", monitor.Name, err)
+			value = 1
+		}
+		brightnessTable[monitor.Name] = value
+	}
+
+	m.brightness = core.NewBrightness(brightnessBackend{m: m}, brightnessTable)
+	m.brightness.Changed = func(values map[string]float64) {
+		m.PropsMu.Lock()
+		m.setPropBrightness(values)
+		m.PropsMu.Unlock()
+	}
+	m.brightness.Save = func(values map[string]float64) {
+		m.settings.SetString(gsKeyBrightness, core.MarshalBrightnessTable(values))
 	}
-	m.Brightness = brightnessTable
+	m.Brightness = m.brightness.Values()
 }
 
 func (m *Manager) getBrightnessSetter() string {
@@ -162,46 +163,11 @@ func (m *Manager) isBuiltinMonitor(monitor *Monitor) bool {
 
 func (m *Manager) setMonitorBrightness(monitor *Monitor, value float64) error {
 	isBuiltin := m.isBuiltinMonitor(monitor)
-	err := brightness.Set(value, m.getBrightnessSetter(), isBuiltin,
+	err := brightness.Set(value, m.getColorTemperature(), m.getBrightnessSetter(), isBuiltin,
 		monitor.ID, m.xConn)
 	return err
 }
 
-func (m *Manager) doSetBrightnessAux(fake bool, value float64, name string) error {
-	monitors := m.getConnectedMonitors()
-	monitor0 := monitors.GetByName(name)
-	if monitor0 == nil {
-		return InvalidOutputNameError{Name: name}
-	}
-
-	monitor0.PropsMu.RLock()
-	enabled := monitor0.Enabled
-	monitor0.PropsMu.RUnlock()
-
-	value = math.Round(value*1000) / 1000 // 通过该方法，用来对亮度值(亮度值范围为0-1)四舍五入保留小数点后三位有效数字
-	if !fake && enabled {
-		err := m.setMonitorBrightness(monitor0, value)
-		if err != nil {
-			logger.Warningf("failed to set brightness for %s: %v", name, err)
-			return err
-		}
-	}
-
-	oldValue := m.Brightness[name]
-	if oldValue == value {
-		return nil
-	}
-
-	// update brightness of the output
-	m.Brightness[name] = value
-	err := m.emitPropChangedBrightness(m.Brightness)
-	if err != nil {
-		logger.Warning(err)
-	}
-
-	return nil
-}
-
 func (m *Manager) doSetBrightness(value float64, name string) error {
-	return m.doSetBrightnessAux(false, value, name)
+	return m.brightness.Set(name, value)
 }
@@ -20,6 +20,7 @@
 package brightness
 
 import (
+	"errors"
 	"fmt"
 
 	dbus "github.com/godbus/dbus"
@@ -34,6 +35,7 @@ const (
 	SetterAuto      = "auto"
 	SetterGamma     = "gamma"
 	SetterBacklight = "backlight"
+	SetterDDCCI     = "ddcci"
 )
 
 var logger = log.NewLogger("daemon/display/brightness")
@@ -49,7 +51,9 @@ func InitBacklightHelper() {
 	helper = backlight.NewBacklight(sysBus)
 }
 
-func Set(value float64, setter string, isBuiltin bool, outputId uint32, conn *x.Conn) error {
+// Set 设置输出的亮度和色温，色温总是通过 gamma 调节，
+// 使用 gamma 调节亮度时，亮度和色温合并到同一个 gamma ramp 中。
+func Set(value float64, temperature int, setter string, isBuiltin bool, outputId uint32, conn *x.Conn) error {
 	if value < 0 {
 		value = 0
 	} else if value > 1 {
@@ -59,19 +63,99 @@ func Set(value float64, setter string, isBuiltin bool, outputId uint32, conn *x.
 	output := randr.Output(outputId)
 	switch setter {
 	case SetterBacklight:
-		return setBacklight(value, output, conn)
+		return setHardwareAndColorTemp(setBacklight, value, temperature, output, conn)
+	case SetterDDCCI:
+		return setHardwareAndColorTemp(setDDCCI, value, temperature, output, conn)
 	case SetterGamma:
-		return setOutputCrtcGamma(value, output, conn)
+		return setOutputCrtcGamma(value, temperature, output, conn)
 	}
 
 	// case SetterAuto
 	if isBuiltin {
 		if supportBacklight(output, conn) {
-			return setBacklight(value, output, conn)
+			return setHardwareAndColorTemp(setBacklight, value, temperature, output, conn)
 		}
+	} else if supportDDCCI(output, conn) {
+		return setHardwareAndColorTemp(setDDCCI, value, temperature, output, conn)
 	}
 
-	return setOutputCrtcGamma(value, output, conn)
+	return setOutputCrtcGamma(value, temperature, output, conn)
+}
+
+// CanSet 返回是否可以调节输出的亮度，选择设置方式的逻辑和 Set 一致
+func CanSet(setter string, isBuiltin bool, outputId uint32, conn *x.Conn) bool {
+	output := randr.Output(outputId)
+	switch setter {
+	case SetterBacklight:
+		return supportBacklight(output, conn)
+	case SetterDDCCI:
+		return supportDDCCI(output, conn)
+	case SetterGamma:
+		return supportGamma(output, conn)
+	}
+
+	// case SetterAuto
+	if isBuiltin {
+		if supportBacklight(output, conn) {
+			return true
+		}
+	} else if supportDDCCI(output, conn) {
+		return true
+	}
+	return supportGamma(output, conn)
+}
+
+// UsesBacklight 返回是否通过背光调节输出的亮度，选择设置方式的逻辑和 Set 一致
+func UsesBacklight(setter string, isBuiltin bool, outputId uint32, conn *x.Conn) bool {
+	output := randr.Output(outputId)
+	switch setter {
+	case SetterBacklight:
+		return true
+	case SetterDDCCI, SetterGamma:
+		return false
+	}
+
+	// case SetterAuto
+	return isBuiltin && supportBacklight(output, conn)
+}
+
+// Get 返回输出的硬件亮度，使用 gamma 调节亮度时无法读取，总是返回 1
+func Get(setter string, isBuiltin bool, outputId uint32, conn *x.Conn) (float64, error) {
+	output := randr.Output(outputId)
+	switch setter {
+	case SetterBacklight:
+		return getBacklight()
+	case SetterDDCCI:
+		return getDDCCI(output, conn)
+	case SetterGamma:
+		return 1, nil
+	}
+
+	// case SetterAuto
+	if isBuiltin {
+		if supportBacklight(output, conn) {
+			return getBacklight()
+		}
+	} else if supportDDCCI(output, conn) {
+		return getDDCCI(output, conn)
+	}
+	return 1, nil
+}
+
+type hardwareSetter func(value float64, output randr.Output, conn *x.Conn) error
+
+func setHardwareAndColorTemp(setFn hardwareSetter, value float64, temperature int,
+	output randr.Output, conn *x.Conn) error {
+	err := setFn(value, output, conn)
+	if err != nil {
+		return err
+	}
+	// 亮度由硬件调节，gamma 只用来调节色温
+	err = setOutputCrtcGamma(1, temperature, output, conn)
+	if err != nil {
+		logger.Warningf("failed to set color temperature for output %v: %v", output, err)
+	}
+	return nil
 }
 
 // unused function
@@ -120,7 +204,23 @@ func supportBacklight(output randr.Output, conn *x.Conn) bool {
 	return len(controllers) > 0
 }
 
-func setOutputCrtcGamma(value float64, output randr.Output, conn *x.Conn) error {
+// 没有启用的输出无法判断，认为支持，亮度会在启用后设置
+func supportGamma(output randr.Output, conn *x.Conn) bool {
+	oinfo, err := randr.GetOutputInfo(conn, output, x.CurrentTime).Reply(conn)
+	if err != nil {
+		return false
+	}
+	if oinfo.Crtc == 0 {
+		return true
+	}
+	gamma, err := randr.GetCrtcGammaSize(conn, oinfo.Crtc).Reply(conn)
+	if err != nil {
+		return false
+	}
+	return gamma.Size > 0
+}
+
+func setOutputCrtcGamma(value float64, temperature int, output randr.Output, conn *x.Conn) error {
 	oinfo, err := randr.GetOutputInfo(conn, output, x.CurrentTime).Reply(conn)
 	if err != nil {
 		fmt.Printf("Get output(%v) failed: %v\n", output, err)
@@ -142,21 +242,23 @@ func setOutputCrtcGamma(value float64, output randr.Output, conn *x.Conn) error
 		return fmt.Errorf("The output(%v) has invalid gamma size", output)
 	}
 
-	red, green, blue := genGammaRamp(gamma.Size, value)
+	red, green, blue := genGammaRamp(gamma.Size, value, temperature)
 	return randr.SetCrtcGammaChecked(conn, oinfo.Crtc,
 		red, green, blue).Check(conn)
 }
 
-func genGammaRamp(size uint16, brightness float64) (red, green, blue []uint16) {
+func genGammaRamp(size uint16, brightness float64, temperature int) (red, green, blue []uint16) {
 	red = make([]uint16, size)
 	green = make([]uint16, size)
 	blue = make([]uint16, size)
 
+	r, g, b := ColorTemperatureToRGB(temperature)
 	step := uint16(65535 / uint32(size))
 	for i := uint16(0); i < size; i++ {
-		red[i] = uint16(float64(step*i) * brightness)
-		green[i] = uint16(float64(step*i) * brightness)
-		blue[i] = uint16(float64(step*i) * brightness)
+		v := float64(step*i) * brightness
+		red[i] = uint16(v * r)
+		green[i] = uint16(v * g)
+		blue[i] = uint16(v * b)
 	}
 	return
 }
@@ -181,6 +283,21 @@ func setBacklight(value float64, output randr.Output, conn *x.Conn) error {
 	return nil
 }
 
+func getBacklight() (float64, error) {
+	if len(controllers) == 0 {
+		return 0, errors.New("no backlight controller")
+	}
+	controller := controllers[0]
+	if controller.MaxBrightness <= 0 {
+		return 0, fmt.Errorf("invalid max brightness of %s", controller.Name)
+	}
+	br, err := controller.GetBrightness()
+	if err != nil {
+		return 0, err
+	}
+	return float64(br) / float64(controller.MaxBrightness), nil
+}
+
 func _setBacklight(value float64, controller *displayBl.Controller) error {
 	br := int32(float64(controller.MaxBrightness) * value)
 	const backlightTypeDisplay = 1
@@ -0,0 +1,57 @@
+package brightness
+
+import (
+	"math"
+)
+
+const (
+	ColorTemperatureMin     = 1000
+	ColorTemperatureMax     = 25000
+	ColorTemperatureNeutral = 6500 // 不做调节时的色温
+)
+
+// 黑体在 temperature 开尔文时的 RGB 值，范围 [0, 255]，
+// 使用 Tanner Helland 的拟合公式
+func blackbodyRGB(temperature int) (r, g, b float64) {
+	t := float64(temperature) / 100
+
+	if t <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(t) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(t-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(t-60, -0.0755148492)
+	}
+
+	if t >= 66 {
+		b = 255
+	} else if t <= 19 {
+		b = 0
+	} else {
+		b = 138.5177312231*math.Log(t-10) - 305.0447927307
+	}
+
+	return clamp(r, 0, 255), clamp(g, 0, 255), clamp(b, 0, 255)
+}
+
+// ColorTemperatureToRGB 返回色温 temperature 对应的 RGB 系数，范围 [0, 1]，
+// 以 ColorTemperatureNeutral 为白点，即 ColorTemperatureNeutral 对应 (1, 1, 1)。
+func ColorTemperatureToRGB(temperature int) (r, g, b float64) {
+	if temperature <= 0 || temperature == ColorTemperatureNeutral {
+		return 1, 1, 1
+	}
+	temperature = int(clamp(float64(temperature), ColorTemperatureMin, ColorTemperatureMax))
+
+	r0, g0, b0 := blackbodyRGB(ColorTemperatureNeutral)
+	r, g, b = blackbodyRGB(temperature)
+	return clamp(r/r0, 0, 1), clamp(g/g0, 0, 1), clamp(b/b0, 0, 1)
+}
+
+func clamp(v, min, max float64) float64 {
+	if v < min {
+		return min
+	} else if v > max {
+		return max
+	}
+	return v
+}
@@ -0,0 +1,48 @@
+package brightness
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestColorTemperatureToRGB(t *testing.T) {
+	r, g, b := ColorTemperatureToRGB(ColorTemperatureNeutral)
+	assert.Equal(t, []float64{1, 1, 1}, []float64{r, g, b})
+
+	r, g, b = ColorTemperatureToRGB(0)
+	assert.Equal(t, []float64{1, 1, 1}, []float64{r, g, b})
+
+	// 低色温偏红
+	r, g, b = ColorTemperatureToRGB(3500)
+	assert.Equal(t, 1.0, r)
+	assert.True(t, g < 1 && b < g)
+
+	// 高色温偏蓝
+	r, g, b = ColorTemperatureToRGB(10000)
+	assert.Equal(t, 1.0, b)
+	assert.True(t, r < 1 && g < 1)
+
+	// 超出范围的值被限制
+	r1, g1, b1 := ColorTemperatureToRGB(100)
+	r2, g2, b2 := ColorTemperatureToRGB(ColorTemperatureMin)
+	assert.Equal(t, []float64{r2, g2, b2}, []float64{r1, g1, b1})
+
+	// 色温越低，蓝色越少
+	_, _, bLow := ColorTemperatureToRGB(2500)
+	_, _, bHigh := ColorTemperatureToRGB(4500)
+	assert.True(t, bLow < bHigh)
+}
+
+func Test_genGammaRamp(t *testing.T) {
+	red, green, blue := genGammaRamp(256, 1, ColorTemperatureNeutral)
+	assert.Len(t, red, 256)
+	assert.Equal(t, red, green)
+	assert.Equal(t, red, blue)
+	assert.Equal(t, uint16(255*255), red[255])
+
+	red, green, blue = genGammaRamp(256, 0.5, 3500)
+	assert.Equal(t, uint16(255*255/2), red[255])
+	assert.True(t, green[255] < red[255])
+	assert.True(t, blue[255] < green[255])
+}
@@ -0,0 +1,465 @@
+package brightness
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/ext/randr"
+	"pkg.deepin.io/dde/startdde/display/utils"
+)
+
+// DDC/CI 通过显示器的 I2C 总线读写 MCCS 定义的 VCP 功能，
+// 参考 VESA DDC/CI 1.1 和 MCCS 2.2 标准。
+
+const (
+	VCPCodeBrightness  = 0x10
+	VCPCodeContrast    = 0x12
+	VCPCodeInputSource = 0x60
+)
+
+const (
+	ddcciAddr     = 0x37 // DDC/CI 的 I2C 从设备地址
+	edidAddr      = 0x50
+	ddcciHostAddr = 0x51 // 主机的源地址
+	ddcciDestAddr = 0x6e // 显示器的目标地址，即 ddcciAddr << 1
+
+	ddcciOpGetVCP          = 0x01
+	ddcciOpGetVCPReply     = 0x02
+	ddcciOpSetVCP          = 0x03
+	ddcciOpCapabilities    = 0xf3
+	ddcciOpCapabilitiesRep = 0xe3
+
+	i2cSlave = 0x0703 // linux/i2c-dev.h 中的 I2C_SLAVE
+
+	ddcciRetryTimes   = 3
+	ddcciReplyDelay   = 50 * time.Millisecond
+	ddcciMaxCapsBytes = 4096
+)
+
+var (
+	sysClassDrmDir = "/sys/class/drm"
+	sysBusI2CDir   = "/sys/bus/i2c/devices"
+	devDir         = "/dev"
+)
+
+// DDCCIDevice 是支持 DDC/CI 的显示器对应的 I2C 设备
+type DDCCIDevice struct {
+	mu   sync.Mutex
+	path string // /dev/i2c-N
+
+	maxBrightness uint16
+}
+
+func (d *DDCCIDevice) String() string {
+	return d.path
+}
+
+type ddcciCacheItem struct {
+	dev *DDCCIDevice
+	err error
+}
+
+var (
+	// 键为 EDID 的校验和，查找失败的结果也缓存，直到热插拔时清空
+	ddcciCache   = make(map[string]*ddcciCacheItem)
+	ddcciCacheMu sync.Mutex
+)
+
+// GetDDCCIDevice 返回输出对应的 DDC/CI 设备，通过 EDID 匹配输出和 I2C 总线
+func GetDDCCIDevice(outputId uint32, conn *x.Conn) (*DDCCIDevice, error) {
+	edid, err := utils.GetOutputEDID(conn, randr.Output(outputId))
+	if err != nil {
+		return nil, err
+	}
+	key := utils.GetEDIDChecksum(edid)
+	if key == "" {
+		return nil, errors.New("invalid EDID")
+	}
+
+	ddcciCacheMu.Lock()
+	item, ok := ddcciCache[key]
+	ddcciCacheMu.Unlock()
+	if ok {
+		return item.dev, item.err
+	}
+
+	// 读写 I2C 总线很慢，不持有锁
+	dev, err := findDDCCIDevice(edid)
+	ddcciCacheMu.Lock()
+	if item, ok := ddcciCache[key]; ok {
+		// 其他调用者已经找到了
+		ddcciCacheMu.Unlock()
+		return item.dev, item.err
+	}
+	ddcciCache[key] = &ddcciCacheItem{dev: dev, err: err}
+	ddcciCacheMu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("found DDC/CI device %s for output %d", dev, outputId)
+	return dev, nil
+}
+
+// ResetDDCCICache 清空 DDC/CI 设备的缓存，在显示器热插拔之后调用
+func ResetDDCCICache() {
+	ddcciCacheMu.Lock()
+	ddcciCache = make(map[string]*ddcciCacheItem)
+	ddcciCacheMu.Unlock()
+}
+
+func invalidateDDCCIDevice(dev *DDCCIDevice) {
+	ddcciCacheMu.Lock()
+	for key, item := range ddcciCache {
+		if item.dev == dev {
+			delete(ddcciCache, key)
+		}
+	}
+	ddcciCacheMu.Unlock()
+}
+
+func findDDCCIDevice(edid []byte) (*DDCCIDevice, error) {
+	bus, err := findI2CBusBySysfs(sysClassDrmDir, edid)
+	if err != nil {
+		// 有的驱动没有在 sysfs 中提供 EDID，从连接器的 I2C 总线读取
+		bus, err = findI2CBusByProbe(sysClassDrmDir, edid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	dev := &DDCCIDevice{path: filepath.Join(devDir, bus)}
+	_, max, err := dev.GetVCP(VCPCodeBrightness)
+	if err != nil {
+		return nil, fmt.Errorf("%s does not support DDC/CI: %v", dev, err)
+	}
+	dev.maxBrightness = max
+	return dev, nil
+}
+
+func edidEqual(a, b []byte) bool {
+	const edidBlockSize = 128
+	if len(a) < edidBlockSize || len(b) < edidBlockSize {
+		return false
+	}
+	return bytes.Equal(a[:edidBlockSize], b[:edidBlockSize])
+}
+
+// 在 /sys/class/drm/card*-*/ 中查找 EDID 相同的连接器，返回它的 I2C 总线名，比如 i2c-3
+func findI2CBusBySysfs(drmDir string, edid []byte) (string, error) {
+	connectors, err := filepath.Glob(filepath.Join(drmDir, "card*-*"))
+	if err != nil {
+		return "", err
+	}
+	for _, connector := range connectors {
+		content, err := ioutil.ReadFile(filepath.Join(connector, "edid"))
+		if err != nil || !edidEqual(content, edid) {
+			continue
+		}
+
+		// HDMI、DVI 等通过 ddc 链接指向 I2C 总线
+		target, err := os.Readlink(filepath.Join(connector, "ddc"))
+		if err == nil {
+			return filepath.Base(target), nil
+		}
+		// DP 的 AUX 通道作为子目录
+		buses, _ := filepath.Glob(filepath.Join(connector, "i2c-*"))
+		if len(buses) > 0 {
+			return filepath.Base(buses[0]), nil
+		}
+		return "", fmt.Errorf("no i2c bus for %s", filepath.Base(connector))
+	}
+	return "", errors.New("not found connector with the same EDID")
+}
+
+// 返回 /sys/class/drm/card*-*/ 中连接器的 DDC 和 DP AUX 的 I2C 总线名
+func listDrmI2CBuses(drmDir string) []string {
+	connectors, _ := filepath.Glob(filepath.Join(drmDir, "card*-*"))
+	var buses []string
+	seen := make(map[string]bool)
+	add := func(bus string) {
+		if !seen[bus] {
+			seen[bus] = true
+			buses = append(buses, bus)
+		}
+	}
+	for _, connector := range connectors {
+		target, err := os.Readlink(filepath.Join(connector, "ddc"))
+		if err == nil {
+			add(filepath.Base(target))
+		}
+		subDirs, _ := filepath.Glob(filepath.Join(connector, "i2c-*"))
+		auxSubDirs, _ := filepath.Glob(filepath.Join(connector, "drm_dp_aux*", "i2c-*"))
+		for _, dir := range append(subDirs, auxSubDirs...) {
+			add(filepath.Base(dir))
+		}
+	}
+	return buses
+}
+
+// SMBus 上通常是内存条的 SPD EEPROM，也在 0x50 地址，不能写
+func isSMBusAdapter(bus string) bool {
+	name, err := ioutil.ReadFile(filepath.Join(sysBusI2CDir, bus, "name"))
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(string(name)), "smbus")
+}
+
+// 只读取连接器的 I2C 总线，不碰其他 I2C 设备
+func findI2CBusByProbe(drmDir string, edid []byte) (string, error) {
+	for _, bus := range listDrmI2CBuses(drmDir) {
+		if isSMBusAdapter(bus) {
+			continue
+		}
+		content, err := readI2CEDID(filepath.Join(devDir, bus))
+		if err == nil && edidEqual(content, edid) {
+			return bus, nil
+		}
+	}
+	return "", errors.New("not found i2c bus with the same EDID")
+}
+
+func readI2CEDID(device string) ([]byte, error) {
+	f, err := openI2C(device, edidAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.Write([]byte{0})
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 128)
+	_, err = f.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func openI2C(device string, addr int) (*os.File, error) {
+	f, err := os.OpenFile(device, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), i2cSlave, uintptr(addr))
+	if errno != 0 {
+		_ = f.Close()
+		return nil, errno
+	}
+	return f, nil
+}
+
+func ddcciChecksum(init byte, data []byte) byte {
+	chk := init
+	for _, b := range data {
+		chk ^= b
+	}
+	return chk
+}
+
+// 构造发送给显示器的包：源地址、长度、数据、校验和
+func buildDDCCIRequest(data ...byte) []byte {
+	req := make([]byte, 0, len(data)+3)
+	req = append(req, ddcciHostAddr, 0x80|byte(len(data)))
+	req = append(req, data...)
+	return append(req, ddcciChecksum(ddcciDestAddr, req))
+}
+
+// 检查显示器的回复，返回其中的数据
+func parseDDCCIReply(reply []byte) ([]byte, error) {
+	if len(reply) < 3 {
+		return nil, errors.New("reply too short")
+	}
+	if reply[0] != ddcciDestAddr {
+		return nil, fmt.Errorf("invalid reply source address %#x", reply[0])
+	}
+	length := int(reply[1] &^ 0x80)
+	if len(reply) < length+3 {
+		return nil, fmt.Errorf("invalid reply length %d", length)
+	}
+	// 回复的校验和以 0x50 为初始值
+	chk := ddcciChecksum(0x50, reply[:length+2])
+	if chk != reply[length+2] {
+		return nil, errors.New("reply checksum mismatch")
+	}
+	return reply[2 : length+2], nil
+}
+
+func parseGetVCPReply(code byte, data []byte) (cur, max uint16, err error) {
+	if len(data) != 8 || data[0] != ddcciOpGetVCPReply {
+		return 0, 0, errors.New("invalid get VCP reply")
+	}
+	if data[1] != 0 {
+		return 0, 0, fmt.Errorf("VCP code %#x is not supported", code)
+	}
+	if data[2] != code {
+		return 0, 0, fmt.Errorf("VCP code mismatch, want %#x got %#x", code, data[2])
+	}
+	max = uint16(data[4])<<8 | uint16(data[5])
+	cur = uint16(data[6])<<8 | uint16(data[7])
+	return cur, max, nil
+}
+
+// 发送请求，replyLen 大于 0 时读取回复
+func (d *DDCCIDevice) transfer(req []byte, replyLen int) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var err error
+	for i := 0; i < ddcciRetryTimes; i++ {
+		var reply []byte
+		reply, err = d.transferOnce(req, replyLen)
+		if err == nil {
+			return reply, nil
+		}
+		time.Sleep(ddcciReplyDelay)
+	}
+	return nil, err
+}
+
+func (d *DDCCIDevice) transferOnce(req []byte, replyLen int) ([]byte, error) {
+	f, err := openI2C(d.path, ddcciAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	_, err = f.Write(req)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(ddcciReplyDelay)
+	if replyLen <= 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, replyLen)
+	_, err = f.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return parseDDCCIReply(buf)
+}
+
+// GetVCP 读取 VCP 功能的当前值和最大值
+func (d *DDCCIDevice) GetVCP(code byte) (cur, max uint16, err error) {
+	data, err := d.transfer(buildDDCCIRequest(ddcciOpGetVCP, code), 11)
+	if err != nil {
+		return
+	}
+	return parseGetVCPReply(code, data)
+}
+
+func (d *DDCCIDevice) SetVCP(code byte, value uint16) error {
+	_, err := d.transfer(buildDDCCIRequest(ddcciOpSetVCP, code, byte(value>>8), byte(value)), 0)
+	return err
+}
+
+// GetCapabilities 读取显示器的能力字符串
+func (d *DDCCIDevice) GetCapabilities() (string, error) {
+	var caps []byte
+	for offset := 0; offset < ddcciMaxCapsBytes; {
+		req := buildDDCCIRequest(ddcciOpCapabilities, byte(offset>>8), byte(offset))
+		data, err := d.transfer(req, 38)
+		if err != nil {
+			return "", err
+		}
+		if len(data) < 3 || data[0] != ddcciOpCapabilitiesRep {
+			return "", errors.New("invalid capabilities reply")
+		}
+		fragment := data[3:]
+		if len(fragment) == 0 {
+			break
+		}
+		caps = append(caps, fragment...)
+		offset += len(fragment)
+	}
+	return strings.TrimRight(string(caps), "\x00"), nil
+}
+
+// GetValue 以 [0, 1] 的比例返回 VCP 功能的当前值
+func (d *DDCCIDevice) GetValue(code byte) (float64, error) {
+	cur, max, err := d.GetVCP(code)
+	if err != nil {
+		return 0, err
+	}
+	if max == 0 {
+		return 0, fmt.Errorf("invalid max value of VCP code %#x", code)
+	}
+	return float64(cur) / float64(max), nil
+}
+
+// SetValue 以 [0, 1] 的比例设置 VCP 功能的值
+func (d *DDCCIDevice) SetValue(code byte, value float64) error {
+	max := d.maxBrightness
+	if code != VCPCodeBrightness || max == 0 {
+		var err error
+		_, max, err = d.GetVCP(code)
+		if err != nil {
+			return err
+		}
+	}
+	return d.SetVCP(code, uint16(math.Round(value*float64(max))))
+}
+
+var inputSourcesReg = regexp.MustCompile(`(?i)(?:^|[\s(])60\s*\(([0-9a-f\s]*)\)`)
+
+// ParseInputSources 从能力字符串中解析显示器支持的输入源
+func ParseInputSources(caps string) []uint16 {
+	idx := strings.Index(caps, "vcp(")
+	if idx == -1 {
+		return nil
+	}
+	match := inputSourcesReg.FindStringSubmatch(caps[idx+len("vcp("):])
+	if match == nil {
+		return nil
+	}
+
+	var result []uint16
+	for _, field := range strings.Fields(match[1]) {
+		v, err := strconv.ParseUint(field, 16, 16)
+		if err == nil {
+			result = append(result, uint16(v))
+		}
+	}
+	return result
+}
+
+func supportDDCCI(output randr.Output, conn *x.Conn) bool {
+	_, err := GetDDCCIDevice(uint32(output), conn)
+	return err == nil
+}
+
+func setDDCCI(value float64, output randr.Output, conn *x.Conn) error {
+	dev, err := GetDDCCIDevice(uint32(output), conn)
+	if err != nil {
+		return err
+	}
+	err = dev.SetValue(VCPCodeBrightness, value)
+	if err != nil {
+		invalidateDDCCIDevice(dev)
+	}
+	return err
+}
+
+func getDDCCI(output randr.Output, conn *x.Conn) (float64, error) {
+	dev, err := GetDDCCIDevice(uint32(output), conn)
+	if err != nil {
+		return 0, err
+	}
+	return dev.GetValue(VCPCodeBrightness)
+}
@@ -0,0 +1,79 @@
+package brightness
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_buildDDCCIRequest(t *testing.T) {
+	assert.Equal(t, []byte{0x51, 0x82, 0x01, 0x10, 0xac},
+		buildDDCCIRequest(ddcciOpGetVCP, VCPCodeBrightness))
+	assert.Equal(t, []byte{0x51, 0x84, 0x03, 0x10, 0x00, 0x32, 0x9a},
+		buildDDCCIRequest(ddcciOpSetVCP, VCPCodeBrightness, 0, 50))
+}
+
+func Test_parseGetVCPReply(t *testing.T) {
+	reply := []byte{0x6e, 0x88, 0x02, 0x00, 0x10, 0x00, 0x00, 0x64, 0x00, 0x32, 0xf2}
+	data, err := parseDDCCIReply(reply)
+	require.NoError(t, err)
+	cur, max, err := parseGetVCPReply(VCPCodeBrightness, data)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(50), cur)
+	assert.Equal(t, uint16(100), max)
+
+	_, _, err = parseGetVCPReply(VCPCodeContrast, data)
+	assert.Error(t, err)
+
+	// 校验和错误
+	reply[9] = 0x33
+	_, err = parseDDCCIReply(reply)
+	assert.Error(t, err)
+
+	_, err = parseDDCCIReply([]byte{0x6e, 0x88, 0x02})
+	assert.Error(t, err)
+}
+
+func TestParseInputSources(t *testing.T) {
+	caps := "(prot(monitor)type(LCD)model(P2419H)cmds(01 02 03 07 0C E3 F3)vcp(02 04 05 08 10 12 14(05 08 0B 0C) " +
+		"16 18 1A 52 60( 0F 11 12) AA(01 02) AC AE B2 B6 C6 C8 C9 D6(01 04 05) DC(00 02 03 05) DF FD)mccs_ver(2.1))"
+	assert.Equal(t, []uint16{0x0f, 0x11, 0x12}, ParseInputSources(caps))
+
+	assert.Nil(t, ParseInputSources("(prot(monitor)vcp(02 10 12))"))
+	assert.Nil(t, ParseInputSources(""))
+}
+
+func Test_findI2CBusBySysfs(t *testing.T) {
+	edid, err := ioutil.ReadFile("./testdata/drm/card0-HDMI-A-1/edid")
+	require.NoError(t, err)
+	bus, err := findI2CBusBySysfs("./testdata/drm", edid)
+	require.NoError(t, err)
+	assert.Equal(t, "i2c-3", bus)
+
+	edid, err = ioutil.ReadFile("./testdata/drm/card0-DP-1/edid")
+	require.NoError(t, err)
+	bus, err = findI2CBusBySysfs("./testdata/drm", edid)
+	require.NoError(t, err)
+	assert.Equal(t, "i2c-5", bus)
+
+	edid[8] = 3
+	_, err = findI2CBusBySysfs("./testdata/drm", edid)
+	assert.Error(t, err)
+}
+
+func Test_listDrmI2CBuses(t *testing.T) {
+	assert.Equal(t, []string{"i2c-5", "i2c-3"}, listDrmI2CBuses("./testdata/drm"))
+	assert.Nil(t, listDrmI2CBuses("./testdata/not-exist"))
+}
+
+func Test_isSMBusAdapter(t *testing.T) {
+	sysBusI2CDir = "./testdata/i2c"
+	defer func() {
+		sysBusI2CDir = "/sys/bus/i2c/devices"
+	}()
+	assert.True(t, isSMBusAdapter("i2c-0"))
+	assert.False(t, isSMBusAdapter("i2c-3"))
+	assert.False(t, isSMBusAdapter("i2c-9"))
+}
@@ -0,0 +1,205 @@
+package display
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+
+	"pkg.deepin.io/dde/startdde/display/configfile"
+)
+
+const (
+	defaultBrightnessGamma = 2.2
+	defaultBrightnessSteps = 20
+)
+
+// BrightnessProfile 是显示器的亮度调节配置，保存在 brightnessProfilesFile 中，以显示器的 UUID 为键。
+// Min、Max 和 NightMin 都是实际设置的亮度值，范围为 [0, 1]。
+type BrightnessProfile struct {
+	Min float64
+	Max float64
+	// 夜晚时的最低亮度，为 0 时和 Min 相同
+	NightMin float64
+	// 感知亮度和实际亮度之间的 gamma 值，实际亮度 = 感知亮度 ^ Gamma
+	Gamma float64
+	// 通过快捷键从最低亮度调到最高亮度需要的次数
+	Steps int
+}
+
+func newBrightnessProfile() *BrightnessProfile {
+	return &BrightnessProfile{
+		Max:   1,
+		Gamma: defaultBrightnessGamma,
+		Steps: defaultBrightnessSteps,
+	}
+}
+
+func (p *BrightnessProfile) fix() {
+	if p.Max <= 0 || p.Max > 1 {
+		p.Max = 1
+	}
+	if p.Min < 0 || p.Min >= p.Max {
+		p.Min = 0
+	}
+	if p.NightMin < 0 || p.NightMin >= p.Max {
+		p.NightMin = 0
+	}
+	if p.Gamma <= 0 {
+		p.Gamma = defaultBrightnessGamma
+	}
+	if p.Steps <= 0 {
+		p.Steps = defaultBrightnessSteps
+	}
+}
+
+func (p *BrightnessProfile) getMin(night bool) float64 {
+	if night && p.NightMin > 0 {
+		return p.NightMin
+	}
+	return p.Min
+}
+
+// 实际亮度转换成感知亮度，范围 [0, 1]
+func (p *BrightnessProfile) toPerceptual(value, min float64) float64 {
+	if value <= min {
+		return 0
+	} else if value >= p.Max {
+		return 1
+	}
+	return math.Pow((value-min)/(p.Max-min), 1/p.Gamma)
+}
+
+// 感知亮度转换成实际亮度
+func (p *BrightnessProfile) fromPerceptual(perceptual, min float64) float64 {
+	return min + (p.Max-min)*math.Pow(perceptual, p.Gamma)
+}
+
+// 返回按感知亮度调高或调低一级后的实际亮度，steps 为 0 时使用 p.Steps
+func (p *BrightnessProfile) step(value float64, raised, night bool, steps int) float64 {
+	if steps <= 0 {
+		steps = p.Steps
+	}
+	min := p.getMin(night)
+	idx := math.Round(p.toPerceptual(value, min) * float64(steps))
+	if raised {
+		idx++
+	} else {
+		idx--
+	}
+	idx = math.Max(0, math.Min(float64(steps), idx))
+	result := p.fromPerceptual(idx/float64(steps), min)
+
+	// 当前亮度在范围之外时，不要往相反的方向调节
+	if raised {
+		return math.Max(result, value)
+	}
+	return math.Min(result, value)
+}
+
+// 按硬件亮度的级数 levels 调节，调节的次数不超过级数，并且每次至少调节一级。
+// levels 为 0 时和 step 相同。
+func (p *BrightnessProfile) stepLevels(value float64, raised, night bool, levels int) float64 {
+	if levels <= 0 {
+		return p.step(value, raised, night, 0)
+	}
+	steps := p.Steps
+	if levels < steps {
+		steps = levels
+	}
+	result := p.step(value, raised, night, steps)
+	if result == value {
+		return result
+	}
+
+	// 感知亮度低的一端步长较小，可能和当前亮度落在同一级
+	n := float64(levels)
+	level := math.Round(value * n)
+	if math.Round(result*n) != level {
+		return result
+	}
+	if raised {
+		return math.Min(p.Max, (level+1)/n)
+	}
+	return math.Max(p.getMin(night), (level-1)/n)
+}
+
+func loadBrightnessProfiles(filename string) (map[string]*BrightnessProfile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles map[string]*BrightnessProfile
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		p.fix()
+	}
+	return profiles, nil
+}
+
+func saveBrightnessProfiles(filename string, profiles map[string]*BrightnessProfile) error {
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, data, 0644, 0)
+}
+
+func (m *Manager) initBrightnessProfiles() {
+	profiles, err := loadBrightnessProfiles(brightnessProfilesFile)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load brightness profiles:", err)
+	}
+	if profiles == nil {
+		profiles = make(map[string]*BrightnessProfile)
+	}
+	m.brightnessProfilesMu.Lock()
+	m.brightnessProfiles = profiles
+	m.brightnessProfilesMu.Unlock()
+}
+
+// 返回显示器的亮度配置的副本，没有配置时返回默认配置
+func (m *Manager) getBrightnessProfile(uuid string) BrightnessProfile {
+	m.brightnessProfilesMu.Lock()
+	defer m.brightnessProfilesMu.Unlock()
+	p, ok := m.brightnessProfiles[uuid]
+	if !ok {
+		return *newBrightnessProfile()
+	}
+	return *p
+}
+
+func (m *Manager) setBrightnessProfile(uuid string, p BrightnessProfile) error {
+	p.fix()
+	m.brightnessProfilesMu.Lock()
+	defer m.brightnessProfilesMu.Unlock()
+	m.brightnessProfiles[uuid] = &p
+	return saveBrightnessProfiles(brightnessProfilesFile, m.brightnessProfiles)
+}
+
+// 把亮度配置的键按 renames 替换，新的键已经有配置时保留已有的，返回是否被修改
+func renameBrightnessProfiles(profiles map[string]*BrightnessProfile, renames map[string]string) bool {
+	changed := false
+	for oldUuid, newUuid := range renames {
+		p, ok := profiles[oldUuid]
+		if !ok {
+			continue
+		}
+		delete(profiles, oldUuid)
+		if _, ok := profiles[newUuid]; !ok {
+			profiles[newUuid] = p
+		}
+		changed = true
+	}
+	return changed
+}
+
+// 按色温的时间表判断现在是否是夜晚
+func (m *Manager) isNightTime() bool {
+	return m.getColorTempConfig().getState(time.Now()).night
+}
@@ -0,0 +1,121 @@
+package display
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBrightnessProfile_step(t *testing.T) {
+	p := newBrightnessProfile()
+
+	// 从最低到最高正好需要 Steps 次
+	v := 0.0
+	var values []float64
+	for i := 0; i < p.Steps; i++ {
+		v = p.step(v, true, false, 0)
+		values = append(values, v)
+	}
+	assert.InDelta(t, 1.0, v, 1e-9)
+	assert.Equal(t, 1.0, p.step(v, true, false, 0))
+
+	// 低亮度时步长更小
+	assert.True(t, values[1]-values[0] < values[len(values)-1]-values[len(values)-2])
+
+	for i := 0; i < p.Steps; i++ {
+		v = p.step(v, false, false, 0)
+	}
+	assert.InDelta(t, 0, v, 1e-9)
+
+	p = &BrightnessProfile{Min: 0.2, Max: 0.8, NightMin: 0.05, Gamma: 1, Steps: 6}
+	assert.InDelta(t, 0.3, p.step(0.2, true, false, 0), 1e-9)
+	assert.InDelta(t, 0.2, p.step(0.3, false, false, 0), 1e-9)
+	assert.InDelta(t, 0.2, p.step(0.2, false, false, 0), 1e-9)
+	// 夜晚可以调得更暗
+	assert.InDelta(t, 0.05, p.step(0.175, false, true, 0), 1e-9)
+	// 超出范围时不往相反方向调节
+	assert.Equal(t, 1.0, p.step(1.0, true, false, 0))
+	assert.Equal(t, 0.1, p.step(0.1, false, false, 0))
+	// 指定步数
+	assert.InDelta(t, 0.5, p.step(0.2, true, false, 2), 1e-9)
+}
+
+func TestBrightnessProfile_stepLevels(t *testing.T) {
+	p := newBrightnessProfile()
+
+	// 背光只有 7 级时，每次至少调节一级，最多 7 次从最低调到最高
+	const levels = 7
+	v := 0.0
+	n := 0
+	for v < 1 {
+		next := p.stepLevels(v, true, false, levels)
+		assert.True(t, math.Round(next*levels) > math.Round(v*levels) || next == 1, "%v -> %v", v, next)
+		v = next
+		n++
+	}
+	assert.True(t, n <= levels)
+	assert.Equal(t, v, p.stepLevels(v, true, false, levels))
+
+	n = 0
+	for v > 0 {
+		next := p.stepLevels(v, false, false, levels)
+		assert.True(t, math.Round(next*levels) < math.Round(v*levels) || next == 0, "%v -> %v", v, next)
+		v = next
+		n++
+	}
+	assert.True(t, n <= levels)
+
+	// 级数多时按感知亮度调节
+	assert.Equal(t, p.step(0.5, true, false, 0), p.stepLevels(0.5, true, false, 255))
+	assert.Equal(t, p.step(0.5, true, false, 0), p.stepLevels(0.5, true, false, 0))
+}
+
+func TestBrightnessProfile_fix(t *testing.T) {
+	p := &BrightnessProfile{Min: 0.9, Max: 0.5, NightMin: -1}
+	p.fix()
+	assert.Equal(t, &BrightnessProfile{
+		Min:   0,
+		Max:   0.5,
+		Gamma: defaultBrightnessGamma,
+		Steps: defaultBrightnessSteps,
+	}, p)
+}
+
+func Test_saveBrightnessProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-display")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "brightness-profiles.json")
+	profiles := map[string]*BrightnessProfile{
+		"uuid1": {Min: 0.1, Max: 1, Gamma: 2.2, Steps: 10},
+	}
+	err = saveBrightnessProfiles(filename, profiles)
+	require.NoError(t, err)
+
+	profiles1, err := loadBrightnessProfiles(filename)
+	require.NoError(t, err)
+	assert.Equal(t, profiles, profiles1)
+}
+
+func Test_renameBrightnessProfiles(t *testing.T) {
+	profiles := map[string]*BrightnessProfile{
+		"HDMI-1abc":     {Min: 0.1, Max: 1, Gamma: 2.2, Steps: 10},
+		"DP-1abc":       {Min: 0.2, Max: 1, Gamma: 2.2, Steps: 10},
+		"DP-1:DEL-A0BC": {Min: 0.3, Max: 1, Gamma: 2.2, Steps: 10},
+	}
+	assert.False(t, renameBrightnessProfiles(profiles, map[string]string{"eDP-1abc": "eDP-1:BOE-0747"}))
+	assert.True(t, renameBrightnessProfiles(profiles, map[string]string{
+		"HDMI-1abc": "HDMI-1:DEL-A0BC",
+		"DP-1abc":   "DP-1:DEL-A0BC",
+	}))
+	assert.Equal(t, map[string]*BrightnessProfile{
+		"HDMI-1:DEL-A0BC": {Min: 0.1, Max: 1, Gamma: 2.2, Steps: 10},
+		"DP-1:DEL-A0BC":   {Min: 0.3, Max: 1, Gamma: 2.2, Steps: 10},
+	}, profiles)
+}
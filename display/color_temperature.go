@@ -0,0 +1,341 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"pkg.deepin.io/dde/startdde/display/brightness"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+const (
+	sysColorTempConfigFile = "/usr/share/startdde/color_temperature.json"
+
+	colorTempScheduleSolar  = "solar"
+	colorTempScheduleManual = "manual"
+
+	defaultColorTempDay        = brightness.ColorTemperatureNeutral
+	defaultColorTempNight      = 3500
+	defaultColorTempNightBegin = "20:00"
+	defaultColorTempNightEnd   = "07:00"
+	defaultColorTempTransition = 1800 // seconds
+
+	// 过渡期间更新色温的间隔
+	colorTempTransitionInterval = 10 * time.Second
+	// 不在过渡期间时，最长的更新间隔，避免系统休眠后定时器不准确
+	colorTempMaxUpdateInterval = time.Minute
+)
+
+// 自动调节色温的配置，用户配置优先于系统配置
+type colorTempConfig struct {
+	// 时间表的类型，solar 根据日出日落时间，manual 使用固定的时间
+	Schedule string `json:"schedule"`
+	// 经纬度，都未设置时根据时区推算
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// manual 时间表中夜晚的开始和结束时间，格式为 HH:MM
+	NightBegin       string `json:"night-begin"`
+	NightEnd         string `json:"night-end"`
+	DayTemperature   int    `json:"day-temperature"`
+	NightTemperature int    `json:"night-temperature"`
+	// 白天和夜晚之间过渡的时间，单位秒，为 0 时立即切换，未设置时使用默认值
+	Transition *int `json:"transition,omitempty"`
+
+	location   geoLocation
+	transition time.Duration
+	nightBegin time.Duration // 距离 0 点的时间
+	nightEnd   time.Duration
+}
+
+func getUserColorTempConfigFile() string {
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", "color_temperature.json")
+}
+
+func loadColorTempConfig() *colorTempConfig {
+	cfg := &colorTempConfig{}
+	content, err := ioutil.ReadFile(getUserColorTempConfigFile())
+	if err != nil {
+		content, err = ioutil.ReadFile(sysColorTempConfigFile)
+	}
+	if err == nil {
+		err = json.Unmarshal(content, cfg)
+		if err != nil {
+			logger.Warning("failed to load color temperature config:", err)
+		}
+	} else if !os.IsNotExist(err) {
+		logger.Warning(err)
+	}
+
+	cfg.fix()
+	return cfg
+}
+
+// 补全默认值并检查配置
+func (cfg *colorTempConfig) fix() {
+	if cfg.DayTemperature == 0 {
+		cfg.DayTemperature = defaultColorTempDay
+	}
+	if cfg.NightTemperature == 0 {
+		cfg.NightTemperature = defaultColorTempNight
+	}
+	cfg.DayTemperature = clampColorTemperature(cfg.DayTemperature)
+	cfg.NightTemperature = clampColorTemperature(cfg.NightTemperature)
+	transition := defaultColorTempTransition
+	if cfg.Transition != nil {
+		transition = *cfg.Transition
+		if transition < 0 {
+			transition = 0
+		}
+	}
+	cfg.transition = time.Duration(transition) * time.Second
+
+	var err error
+	cfg.nightBegin, err = parseTimeOfDay(cfg.NightBegin)
+	if err != nil {
+		cfg.nightBegin, _ = parseTimeOfDay(defaultColorTempNightBegin)
+	}
+	cfg.nightEnd, err = parseTimeOfDay(cfg.NightEnd)
+	if err != nil {
+		cfg.nightEnd, _ = parseTimeOfDay(defaultColorTempNightEnd)
+	}
+
+	if cfg.Schedule != colorTempScheduleManual {
+		cfg.Schedule = colorTempScheduleSolar
+		if cfg.Latitude != nil && cfg.Longitude != nil {
+			cfg.location = geoLocation{latitude: *cfg.Latitude, longitude: *cfg.Longitude}
+		} else {
+			cfg.location, err = getLocationByTimezone(getTimezoneName())
+			if err != nil {
+				logger.Warning("failed to get location, use manual schedule:", err)
+				cfg.Schedule = colorTempScheduleManual
+			}
+		}
+	}
+}
+
+func clampColorTemperature(v int) int {
+	if v < brightness.ColorTemperatureMin {
+		return brightness.ColorTemperatureMin
+	} else if v > brightness.ColorTemperatureMax {
+		return brightness.ColorTemperatureMax
+	}
+	return v
+}
+
+func parseTimeOfDay(str string) (time.Duration, error) {
+	var hour, minute int
+	_, err := fmt.Sscanf(str, "%d:%d", &hour, &minute)
+	if err != nil {
+		return 0, err
+	}
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", str)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// 白天和夜晚切换的时刻
+type colorTempEvent struct {
+	time  time.Time
+	night bool // 是否进入夜晚
+}
+
+// 返回 now 前后各一天内的切换时刻，按时间排序。
+// 极昼或极夜的日期整天都是白天或夜晚，在这一天的 0 点切换，
+// 相邻日期落在这一天之内的日出日落时刻会被忽略。
+func (cfg *colorTempConfig) getEvents(now time.Time) []colorTempEvent {
+	var events []colorTempEvent
+	var polarDates []time.Time
+	year, month, day := now.Date()
+	for i := -1; i <= 1; i++ {
+		date := time.Date(year, month, day+i, 0, 0, 0, 0, now.Location())
+		if cfg.Schedule == colorTempScheduleManual {
+			events = append(events,
+				colorTempEvent{time: date.Add(cfg.nightEnd), night: false},
+				colorTempEvent{time: date.Add(cfg.nightBegin), night: true})
+			continue
+		}
+
+		sunrise, sunset, state := getSunriseSunset(date, cfg.location)
+		switch state {
+		case sunStateNormal:
+			events = append(events,
+				colorTempEvent{time: sunrise, night: false},
+				colorTempEvent{time: sunset, night: true})
+		case sunStatePolarDay, sunStatePolarNight:
+			polarDates = append(polarDates, date)
+			events = append(events, colorTempEvent{time: date, night: state == sunStatePolarNight})
+		}
+	}
+
+	// 手动设置的夜晚结束时间可能晚于开始时间，需要排序
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].time.Before(events[j].time)
+	})
+
+	// 连续的极昼或极夜没有切换，去掉重复的时刻
+	result := events[:0]
+	for _, ev := range events {
+		if isInPolarDate(ev.time, polarDates) {
+			continue
+		}
+		if len(result) > 0 && result[len(result)-1].night == ev.night {
+			continue
+		}
+		result = append(result, ev)
+	}
+	return result
+}
+
+// 判断 t 是否在极昼或极夜的日期之内，不包括这一天的 0 点
+func isInPolarDate(t time.Time, polarDates []time.Time) bool {
+	for _, date := range polarDates {
+		if t.After(date) && t.Before(date.AddDate(0, 0, 1)) {
+			return true
+		}
+	}
+	return false
+}
+
+type colorTempState struct {
+	temperature    int
+	night          bool
+	inTransition   bool
+	nextTransition time.Time // 下一次开始过渡的时间，零值表示没有
+}
+
+// 计算 now 时刻的色温，切换时刻之后的 Transition 秒内，色温从一个值线性变化到另一个值
+func (cfg *colorTempConfig) getState(now time.Time) colorTempState {
+	events := cfg.getEvents(now)
+
+	var state colorTempState
+	var prev *colorTempEvent
+	for i := range events {
+		if events[i].time.After(now) {
+			state.nextTransition = events[i].time
+			break
+		}
+		prev = &events[i]
+	}
+
+	if prev == nil {
+		state.temperature = cfg.DayTemperature
+		return state
+	}
+
+	state.night = prev.night
+	from, to := cfg.DayTemperature, cfg.NightTemperature
+	if !prev.night {
+		from, to = to, from
+	}
+	elapsed := now.Sub(prev.time)
+	if elapsed >= cfg.transition {
+		state.temperature = to
+		return state
+	}
+
+	progress := float64(elapsed) / float64(cfg.transition)
+	state.temperature = from + int(float64(to-from)*progress)
+	state.inTransition = true
+	return state
+}
+
+func (m *Manager) getTargetColorTemperature(now time.Time) int {
+	switch m.ColorTemperatureMode.Get() {
+	case ColorTemperatureModeAuto:
+		return m.getColorTempConfig().getState(now).temperature
+	case ColorTemperatureModeManual:
+		return int(m.ColorTemperatureManual.Get())
+	}
+	return brightness.ColorTemperatureNeutral
+}
+
+func (m *Manager) getColorTempConfig() *colorTempConfig {
+	m.colorTempMu.Lock()
+	defer m.colorTempMu.Unlock()
+	if m.colorTempCfg == nil {
+		m.colorTempCfg = loadColorTempConfig()
+	}
+	return m.colorTempCfg
+}
+
+func (m *Manager) reloadColorTempConfig() {
+	cfg := loadColorTempConfig()
+	m.colorTempMu.Lock()
+	m.colorTempCfg = cfg
+	m.colorTempMu.Unlock()
+}
+
+func (m *Manager) getColorTemperature() int {
+	m.colorTempMu.Lock()
+	v := m.colorTemperature
+	m.colorTempMu.Unlock()
+	return v
+}
+
+// 根据当前的色温调节方式更新色温，自动模式下会定时再次更新
+func (m *Manager) updateColorTemperature() {
+	now := time.Now()
+	var state colorTempState
+	mode := m.ColorTemperatureMode.Get()
+	switch mode {
+	case ColorTemperatureModeAuto:
+		state = m.getColorTempConfig().getState(now)
+	default:
+		state.temperature = m.getTargetColorTemperature(now)
+	}
+
+	m.colorTempMu.Lock()
+	if m.colorTempTimer != nil {
+		m.colorTempTimer.Stop()
+		m.colorTempTimer = nil
+	}
+	if mode == ColorTemperatureModeAuto {
+		interval := colorTempMaxUpdateInterval
+		if state.inTransition {
+			interval = colorTempTransitionInterval
+		} else if !state.nextTransition.IsZero() && state.nextTransition.Sub(now) < interval {
+			interval = state.nextTransition.Sub(now)
+		}
+		m.colorTempTimer = time.AfterFunc(interval, m.updateColorTemperature)
+	}
+	changed := m.colorTemperature != state.temperature
+	m.colorTemperature = state.temperature
+	m.colorTempMu.Unlock()
+
+	var nextTransition int64
+	if !state.nextTransition.IsZero() {
+		nextTransition = state.nextTransition.Unix()
+	}
+	m.PropsMu.Lock()
+	m.setPropColorTemperatureCurrent(int32(state.temperature))
+	m.setPropColorTemperatureNextTransition(nextTransition)
+	m.PropsMu.Unlock()
+
+	if changed {
+		logger.Debug("set color temperature:", state.temperature)
+		m.applyColorTemperature()
+	}
+}
+
+// 色温和亮度一起设置到 gamma ramp 中
+func (m *Manager) applyColorTemperature() {
+	for _, monitor := range m.getConnectedMonitors() {
+		monitor.PropsMu.RLock()
+		enabled := monitor.Enabled
+		monitor.PropsMu.RUnlock()
+		if !enabled {
+			continue
+		}
+
+		err := m.setMonitorBrightness(monitor, m.getBrightness(monitor.Name))
+		if err != nil {
+			logger.Warningf("failed to set color temperature for %s: %v", monitor.Name, err)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package display
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseISO6709(t *testing.T) {
+	location, err := parseISO6709("+3114+12128")
+	require.NoError(t, err)
+	assert.InDelta(t, 31.233, location.latitude, 0.001)
+	assert.InDelta(t, 121.467, location.longitude, 0.001)
+
+	location, err = parseISO6709("+404251-0740023")
+	require.NoError(t, err)
+	assert.InDelta(t, 40.714, location.latitude, 0.001)
+	assert.InDelta(t, -74.006, location.longitude, 0.001)
+
+	_, err = parseISO6709("+31+121")
+	assert.Error(t, err)
+}
+
+func Test_findLocationInZoneTab(t *testing.T) {
+	location, err := findLocationInZoneTab("./testdata/zone1970.tab", "Europe/Oslo")
+	require.NoError(t, err)
+	assert.InDelta(t, 59.917, location.latitude, 0.001)
+	assert.InDelta(t, 10.75, location.longitude, 0.001)
+
+	_, err = findLocationInZoneTab("./testdata/zone1970.tab", "Asia/Tokyo")
+	assert.Error(t, err)
+}
+
+func Test_getSunriseSunset(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	shanghai := geoLocation{latitude: 31.233, longitude: 121.467}
+
+	sunrise, sunset, state := getSunriseSunset(time.Date(2020, 6, 21, 0, 0, 0, 0, cst), shanghai)
+	assert.Equal(t, sunStateNormal, state)
+	assert.WithinDuration(t, time.Date(2020, 6, 21, 4, 50, 0, 0, cst), sunrise, 5*time.Minute)
+	assert.WithinDuration(t, time.Date(2020, 6, 21, 19, 1, 0, 0, cst), sunset, 5*time.Minute)
+
+	sunrise, sunset, state = getSunriseSunset(time.Date(2020, 12, 21, 0, 0, 0, 0, cst), shanghai)
+	assert.Equal(t, sunStateNormal, state)
+	assert.WithinDuration(t, time.Date(2020, 12, 21, 6, 50, 0, 0, cst), sunrise, 5*time.Minute)
+	assert.WithinDuration(t, time.Date(2020, 12, 21, 16, 55, 0, 0, cst), sunset, 5*time.Minute)
+
+	tromso := geoLocation{latitude: 69.65, longitude: 18.96}
+	_, _, state = getSunriseSunset(time.Date(2020, 6, 21, 0, 0, 0, 0, time.UTC), tromso)
+	assert.Equal(t, sunStatePolarDay, state)
+	_, _, state = getSunriseSunset(time.Date(2020, 12, 21, 0, 0, 0, 0, time.UTC), tromso)
+	assert.Equal(t, sunStatePolarNight, state)
+}
+
+func Test_parseTimeOfDay(t *testing.T) {
+	d, err := parseTimeOfDay("20:30")
+	require.NoError(t, err)
+	assert.Equal(t, 20*time.Hour+30*time.Minute, d)
+
+	_, err = parseTimeOfDay("24:00")
+	assert.Error(t, err)
+	_, err = parseTimeOfDay("abc")
+	assert.Error(t, err)
+}
+
+func TestColorTempConfig_getState(t *testing.T) {
+	cfg := &colorTempConfig{
+		Schedule:         colorTempScheduleManual,
+		DayTemperature:   6500,
+		NightTemperature: 3500,
+		transition:       10 * time.Minute,
+		nightBegin:       20 * time.Hour,
+		nightEnd:         7 * time.Hour,
+	}
+	date := func(hour, min int) time.Time {
+		return time.Date(2020, 6, 21, hour, min, 0, 0, time.UTC)
+	}
+
+	state := cfg.getState(date(12, 0))
+	assert.Equal(t, 6500, state.temperature)
+	assert.False(t, state.inTransition)
+	assert.Equal(t, date(20, 0), state.nextTransition)
+
+	// 过渡期间线性变化
+	state = cfg.getState(date(20, 5))
+	assert.Equal(t, 5000, state.temperature)
+	assert.True(t, state.inTransition)
+	assert.Equal(t, date(7, 0).AddDate(0, 0, 1), state.nextTransition)
+
+	state = cfg.getState(date(23, 0))
+	assert.Equal(t, 3500, state.temperature)
+	assert.False(t, state.inTransition)
+
+	state = cfg.getState(date(2, 0))
+	assert.Equal(t, 3500, state.temperature)
+	assert.Equal(t, date(7, 0), state.nextTransition)
+
+	state = cfg.getState(date(7, 1))
+	assert.Equal(t, 3800, state.temperature)
+	assert.True(t, state.inTransition)
+
+	// 极夜
+	cfg = &colorTempConfig{
+		Schedule:         colorTempScheduleSolar,
+		DayTemperature:   6500,
+		NightTemperature: 3500,
+		transition:       10 * time.Minute,
+		location:         geoLocation{latitude: 69.65, longitude: 18.96},
+	}
+	state = cfg.getState(time.Date(2020, 12, 21, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, 3500, state.temperature)
+	assert.True(t, state.nextTransition.IsZero())
+
+	// 极昼的第一天整天都是白天，前一天的日落时刻在这一天的 0 点之后
+	cest := time.FixedZone("CEST", 2*3600)
+	state = cfg.getState(time.Date(2020, 5, 18, 0, 5, 0, 0, cest))
+	assert.Equal(t, 6500, state.temperature)
+	assert.False(t, state.night)
+	state = cfg.getState(time.Date(2020, 5, 18, 12, 0, 0, 0, cest))
+	assert.Equal(t, 6500, state.temperature)
+	assert.False(t, state.night)
+	assert.True(t, state.nextTransition.IsZero())
+	state = cfg.getState(time.Date(2020, 6, 21, 0, 5, 0, 0, cest))
+	assert.Equal(t, 6500, state.temperature)
+	assert.False(t, state.inTransition)
+	assert.True(t, state.nextTransition.IsZero())
+
+	// 过渡时间为 0 时立即切换
+	cfg = &colorTempConfig{
+		Schedule:         colorTempScheduleManual,
+		DayTemperature:   6500,
+		NightTemperature: 3500,
+		nightBegin:       20 * time.Hour,
+		nightEnd:         7 * time.Hour,
+	}
+	state = cfg.getState(time.Date(2020, 6, 21, 20, 0, 0, 0, time.UTC))
+	assert.Equal(t, 3500, state.temperature)
+	assert.False(t, state.inTransition)
+}
+
+func TestColorTempConfig_fix(t *testing.T) {
+	cfg := &colorTempConfig{Schedule: colorTempScheduleManual}
+	cfg.fix()
+	assert.Equal(t, time.Duration(defaultColorTempTransition)*time.Second, cfg.transition)
+
+	transition := 0
+	cfg = &colorTempConfig{Schedule: colorTempScheduleManual, Transition: &transition}
+	cfg.fix()
+	assert.Equal(t, time.Duration(0), cfg.transition)
+
+	transition = -1
+	cfg.fix()
+	assert.Equal(t, time.Duration(0), cfg.transition)
+}
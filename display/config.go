@@ -1,24 +1,28 @@
 package display
 
 import (
-	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/davecgh/go-spew/spew"
-	"github.com/linuxdeepin/go-x11-client/ext/randr"
+	"pkg.deepin.io/dde/startdde/display/core"
 	"pkg.deepin.io/lib/log"
 	"pkg.deepin.io/lib/xdg/basedir"
 )
 
-const configVersion = "4.0"
-
 var (
 	configFile               string
 	configVersionFile        string
 	builtinMonitorConfigFile string
+	brightnessProfilesFile   string
+	autoBrightnessConfigFile string
+	displayProfilesFile      string
+	tabletMapFile            string
+	autoRotationConfigFile   string
+	lidConfigFile            string
+	screenPowerConfigFile    string
 )
 
 func init() {
@@ -26,237 +30,39 @@ func init() {
 	configFile = filepath.Join(cfgDir, "display.json")
 	configVersionFile = filepath.Join(cfgDir, "config.version")
 	builtinMonitorConfigFile = filepath.Join(cfgDir, "builtin-monitor")
-}
-
-type Config map[string]*ScreenConfig
-
-type ScreenConfig struct {
-	Custom  []*CustomModeConfig `json:",omitempty"`
-	Mirror  *MirrorModeConfig   `json:",omitempty"`
-	Extend  *ExtendModeConfig   `json:",omitempty"`
-	OnlyOne *OnlyOneModeConfig  `json:",omitempty"`
-	Single  *MonitorConfig      `json:",omitempty"`
-}
-
-type CustomModeConfig struct {
-	Name     string
-	Monitors []*MonitorConfig
-}
-
-type MirrorModeConfig struct {
-	Monitors []*MonitorConfig
-}
-
-type ExtendModeConfig struct {
-	Monitors []*MonitorConfig
-}
-
-type OnlyOneModeConfig struct {
-	Monitors []*MonitorConfig
-}
-
-func (s *ScreenConfig) getMonitorConfigs(mode uint8, customName string) []*MonitorConfig {
-	switch mode {
-	case DisplayModeCustom:
-		for _, custom := range s.Custom {
-			if custom.Name == customName {
-				return custom.Monitors
-			}
-		}
-	case DisplayModeMirror:
-		if s.Mirror == nil {
-			return nil
-		}
-		return s.Mirror.Monitors
-
-	case DisplayModeExtend:
-		if s.Extend == nil {
-			return nil
-		}
-		return s.Extend.Monitors
-
-	case DisplayModeOnlyOne:
-		if s.OnlyOne == nil {
-			return nil
-		}
-		return s.OnlyOne.Monitors
-	}
-
-	return nil
-}
-
-func getMonitorConfigByUuid(configs []*MonitorConfig, uuid string) *MonitorConfig {
-	for _, mc := range configs {
-		if mc.UUID == uuid {
-			return mc
-		}
-	}
-	return nil
-}
-
-func setMonitorConfigsPrimary(configs []*MonitorConfig, uuid string) {
-	for _, mc := range configs {
-		if mc.UUID == uuid {
-			mc.Primary = true
-		} else {
-			mc.Primary = false
-		}
-	}
-}
-
-func updateMonitorConfigsName(configs []*MonitorConfig, monitorMap map[randr.Output]*Monitor) {
-	for _, mc := range configs {
-		for _, m := range monitorMap {
-			if mc.UUID == m.uuid {
-				mc.Name = m.Name
-				break
-			}
-		}
-	}
-}
-
-func (s *ScreenConfig) setMonitorConfigs(mode uint8, customName string, configs []*MonitorConfig) {
-	switch mode {
-	case DisplayModeCustom:
-		foundName := false
-		for _, custom := range s.Custom {
-			if custom.Name == customName {
-				foundName = true
-				custom.Monitors = configs
-			}
-		}
-
-		// new custom
-		if !foundName {
-			s.Custom = append(s.Custom, &CustomModeConfig{
-				Name:     customName,
-				Monitors: configs,
-			})
-		}
-
-	case DisplayModeMirror:
-		if s.Mirror == nil {
-			s.Mirror = &MirrorModeConfig{}
-		}
-		s.Mirror.Monitors = configs
-
-	case DisplayModeExtend:
-		if s.Extend == nil {
-			s.Extend = &ExtendModeConfig{}
-		}
-		s.Extend.Monitors = configs
-
-	case DisplayModeOnlyOne:
-		s.setMonitorConfigsOnlyOne(configs)
-	}
-}
-
-func (s *ScreenConfig) setMonitorConfigsOnlyOne(configs []*MonitorConfig) {
-	if s.OnlyOne == nil {
-		s.OnlyOne = &OnlyOneModeConfig{}
-	}
-	oldConfigs := s.OnlyOne.Monitors
-	var newConfigs []*MonitorConfig
-	for _, cfg := range configs {
-		if !cfg.Enabled {
-			oldCfg := getMonitorConfigByUuid(oldConfigs, cfg.UUID)
-			if oldCfg != nil {
-				// 不设置 X,Y 是因为它们总是 0
-				cfg.Width = oldCfg.Width
-				cfg.Height = oldCfg.Height
-				cfg.RefreshRate = oldCfg.RefreshRate
-				cfg.Rotation = oldCfg.Rotation
-				cfg.Reflect = oldCfg.Reflect
-			} else {
-				continue
-			}
-		}
-		newConfigs = append(newConfigs, cfg)
-	}
-	s.OnlyOne.Monitors = newConfigs
-}
-
-type MonitorConfig struct {
-	UUID        string
-	Name        string
-	Enabled     bool
-	X           int16
-	Y           int16
-	Width       uint16
-	Height      uint16
-	Rotation    uint16
-	Reflect     uint16
-	RefreshRate float64
-	Primary     bool
-}
-
-func loadConfigV4(filename string) (Config, error) {
-	data, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return nil, err
-	}
-
-	var c Config
-	err = json.Unmarshal(data, &c)
-	if err != nil {
-		return nil, err
-	}
-
-	return c, nil
-}
-
-func loadConfig() (config Config) {
-	cfgVer, err := getConfigVersion(configVersionFile)
-	if err == nil {
-		if cfgVer == "3.3" {
-			cfg0, err := loadConfigV3_3(configFile)
-			if err == nil {
-				config = cfg0.toConfig()
-			} else if !os.IsNotExist(err) {
-				logger.Warning(err)
-			}
-		}
+	brightnessProfilesFile = filepath.Join(cfgDir, "brightness-profiles.json")
+	autoBrightnessConfigFile = filepath.Join(cfgDir, "auto-brightness.json")
+	displayProfilesFile = filepath.Join(cfgDir, "display-profiles.json")
+	tabletMapFile = filepath.Join(cfgDir, "tablet-map.json")
+	autoRotationConfigFile = filepath.Join(cfgDir, "auto-rotation.json")
+	lidConfigFile = filepath.Join(cfgDir, "lid.json")
+	screenPowerConfigFile = filepath.Join(cfgDir, "screen-power.json")
+}
+
+// 配置模型在 core 包中，X11 和 Wayland 共用
+type (
+	Config            = core.Config
+	ScreenConfig      = core.ScreenConfig
+	CustomModeConfig  = core.CustomModeConfig
+	MirrorModeConfig  = core.MirrorModeConfig
+	ExtendModeConfig  = core.ExtendModeConfig
+	OnlyOneModeConfig = core.OnlyOneModeConfig
+	MonitorConfig     = core.MonitorConfig
+)
 
-	} else if !os.IsNotExist(err) {
-		logger.Warning(err)
+func loadConfig() Config {
+	config, err := core.LoadConfig(configFile, configVersionFile)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load config:", err)
 	}
-
-	if len(config) == 0 {
-		config, err = loadConfigV4(configFile)
-		if err != nil {
-			config = make(Config)
-			if !os.IsNotExist(err) {
-				logger.Warning(err)
-			}
-		}
+	if config == nil {
+		config = make(Config)
 	}
 
 	if logger.GetLogLevel() == log.LevelDebug {
 		logger.Debug("load config:", spew.Sdump(config))
 	}
-	return
-}
-
-func (c Config) save(filename string) error {
-	var data []byte
-	var err error
-	if logger.GetLogLevel() == log.LevelDebug {
-		data, err = json.MarshalIndent(c, "", "    ")
-		if err != nil {
-			return err
-		}
-	} else {
-		data, err = json.Marshal(c)
-		if err != nil {
-			return err
-		}
-	}
-
-	err = ioutil.WriteFile(filename, data, 0644)
-	if err != nil {
-		return err
-	}
-	return nil
+	return config
 }
 
 func loadBuiltinMonitorConfig(filename string) (string, error) {
@@ -279,3 +85,36 @@ func saveBuiltinMonitorConfig(filename, name string) error {
 	}
 	return nil
 }
+
+// migrateMonitorUUIDs 把使用旧版本 UUID 的显示配置和亮度配置迁移到新的 UUID，
+// 旧的 UUID 中是 EDID 的 md5，无法直接转换，只能迁移已连接的显示器
+func (m *Manager) migrateMonitorUUIDs() {
+	renames := make(map[string]string)
+	for _, monitor := range m.getConnectedMonitors() {
+		monitor.PropsMu.RLock()
+		if monitor.legacyUUID != monitor.uuid {
+			renames[monitor.legacyUUID] = monitor.uuid
+		}
+		monitor.PropsMu.RUnlock()
+	}
+	if len(renames) == 0 {
+		return
+	}
+
+	if m.config.RenameMonitors(renames) {
+		logger.Debug("migrate monitor uuids:", renames)
+		err := m.saveConfig()
+		if err != nil {
+			logger.Warning("failed to save config:", err)
+		}
+	}
+
+	m.brightnessProfilesMu.Lock()
+	if renameBrightnessProfiles(m.brightnessProfiles, renames) {
+		err := saveBrightnessProfiles(brightnessProfilesFile, m.brightnessProfiles)
+		if err != nil {
+			logger.Warning("failed to save brightness profiles:", err)
+		}
+	}
+	m.brightnessProfilesMu.Unlock()
+}
@@ -0,0 +1,124 @@
+package configfile
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DefaultBackups 是保存配置时默认保留的备份数量
+const DefaultBackups = 3
+
+// BackupFilename 返回第 n 个备份的文件名，n 越小越新
+func BackupFilename(filename string, n int) string {
+	return fmt.Sprintf("%s.bak.%d", filename, n)
+}
+
+// WriteFileAtomic 先写入同目录下的临时文件，fsync 后再重命名为 filename，
+// 写入过程中崩溃也不会损坏原来的文件。
+// backups 大于 0 时，原来的文件会被保留为备份，最多保留 backups 个。
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode, backups int) error {
+	dir := filepath.Dir(filename)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := f.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmpName)
+		}
+	}()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if backups > 0 {
+		err = rotateBackups(filename, backups)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = os.Rename(tmpName, filename)
+	if err != nil {
+		return err
+	}
+	syncDir(dir)
+	return nil
+}
+
+// 把 filename 保存为第 1 个备份，原来的备份依次后移，超出 backups 的被删除
+func rotateBackups(filename string, backups int) error {
+	_, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = os.Remove(BackupFilename(filename, backups))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := backups - 1; n >= 1; n-- {
+		err = os.Rename(BackupFilename(filename, n), BackupFilename(filename, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	// 用硬链接保留原文件，之后的 rename 不会影响它
+	backup := BackupFilename(filename, 1)
+	err = os.Link(filename, backup)
+	if err != nil {
+		err = copyFile(filename, backup)
+	}
+	return err
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// 保证 rename 操作写入磁盘，出错可以忽略
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
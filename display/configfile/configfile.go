@@ -0,0 +1,156 @@
+// Package configfile 负责显示配置文件 display.json 的读写和版本升级，
+// X11 和 Wayland 下的 display 模块共用这个文件。
+// 其他配置文件也使用 WriteFileAtomic 保存。
+package configfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+)
+
+type file struct {
+	Version string
+	Config  interface{}
+}
+
+// 配置文件中有 Version 字段时以它为准，否则使用 config.version 文件中的版本，都没有时认为是 4.0
+func detectVersion(data []byte, versionFile string) (string, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return "", err
+	}
+	if raw, ok := fields["Version"]; ok {
+		var version string
+		if json.Unmarshal(raw, &version) == nil {
+			return version, nil
+		}
+	}
+
+	content, err := ioutil.ReadFile(versionFile)
+	if err == nil {
+		version := string(bytes.TrimSpace(content))
+		if version != "" {
+			return version, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	return Version4, nil
+}
+
+func loadFile(filename, versionFile string) (json.RawMessage, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	version, err := detectVersion(data, versionFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err = Migrate(data, version)
+	if err != nil {
+		return nil, err
+	}
+
+	var f fileV5
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Config) == 0 {
+		return nil, errors.New("config is empty")
+	}
+	return f.Config, nil
+}
+
+// Load 读取配置文件并升级到当前版本，返回其中 Config 部分的 JSON。
+// 配置文件损坏时依次尝试备份，文件不存在时返回的错误满足 os.IsNotExist。
+func Load(filename, versionFile string) (json.RawMessage, error) {
+	cfg, err := loadFile(filename, versionFile)
+	if err == nil || os.IsNotExist(err) {
+		return cfg, err
+	}
+	firstErr := err
+
+	for n := 1; n <= DefaultBackups; n++ {
+		cfg, err = loadFile(BackupFilename(filename, n), versionFile)
+		if err == nil {
+			return cfg, nil
+		}
+	}
+	return nil, firstErr
+}
+
+// 旧版本的配置文件中没有 Version 字段，版本只记录在 config.version 中。
+// 保存时它会被保留为备份，而 config.version 会被删除，之后从备份恢复时会被当作 4.0 读取，
+// 所以先把它升级并改写为当前版本。无法升级时不保留为备份，返回是否可以保留。
+func upgradeLegacyFile(filename, versionFile string) (bool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return false, nil
+	}
+	if _, ok := fields["Version"]; ok {
+		return true, nil
+	}
+
+	cfg, err := loadFile(filename, versionFile)
+	if err != nil {
+		return false, nil
+	}
+	data, err = json.Marshal(file{Version: CurrentVersion, Config: cfg})
+	if err != nil {
+		return false, err
+	}
+	err = WriteFileAtomic(filename, data, 0644, 0)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Save 以当前版本的格式原子地保存配置，并删除不再需要的 config.version 文件
+func Save(filename, versionFile string, config interface{}, indent bool) error {
+	f := file{
+		Version: CurrentVersion,
+		Config:  config,
+	}
+	var data []byte
+	var err error
+	if indent {
+		data, err = json.MarshalIndent(f, "", "    ")
+	} else {
+		data, err = json.Marshal(f)
+	}
+	if err != nil {
+		return err
+	}
+
+	backups := DefaultBackups
+	keep, err := upgradeLegacyFile(filename, versionFile)
+	if err != nil {
+		return err
+	}
+	if !keep {
+		backups = 0
+	}
+	err = WriteFileAtomic(filename, data, 0644, backups)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(versionFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
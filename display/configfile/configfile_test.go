@@ -0,0 +1,224 @@
+package configfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func indentJSON(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	err := json.Indent(&buf, data, "", "    ")
+	require.NoError(t, err)
+	buf.WriteByte('\n')
+	return buf.Bytes()
+}
+
+func testGolden(t *testing.T, input, golden string, migrate func([]byte) ([]byte, error)) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", input))
+	require.NoError(t, err)
+	result, err := migrate(data)
+	require.NoError(t, err)
+	result = indentJSON(t, result)
+
+	goldenFile := filepath.Join("testdata", golden)
+	if *update {
+		err = ioutil.WriteFile(goldenFile, result, 0644)
+		require.NoError(t, err)
+	}
+	expected, err := ioutil.ReadFile(goldenFile)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(result))
+}
+
+func Test_migrateV3_3ToV4(t *testing.T) {
+	testGolden(t, "v3.3.json", "v3.3-v4.golden.json", migrateV3_3ToV4)
+
+	data, err := ioutil.ReadFile("testdata/v3.3.json")
+	require.NoError(t, err)
+	data, err = migrateV3_3ToV4(data)
+	require.NoError(t, err)
+	var c configV4
+	err = json.Unmarshal(data, &c)
+	require.NoError(t, err)
+	assert.Len(t, c, 2)
+
+	screenCfg := c["eDP12c5a5c24e4ab14126abf8dc36e7e9d4"]
+	require.NotNil(t, screenCfg)
+	assert.Equal(t, &monitorConfigV4{
+		UUID:        "eDP12c5a5c24e4ab14126abf8dc36e7e9d4",
+		Name:        "eDP-1",
+		Enabled:     true,
+		Width:       1360,
+		Height:      768,
+		Rotation:    1,
+		RefreshRate: 59.79899072004335,
+		Primary:     true,
+	}, screenCfg.Single)
+
+	screenCfg = c["HDMIf5cae317c40b01139be5af61896be0cf,eDP12c5a5c24e4ab14126abf8dc36e7e9d4"]
+	require.NotNil(t, screenCfg)
+	require.Len(t, screenCfg.Custom, 1)
+	customModeCfg := screenCfg.Custom[0]
+	assert.Equal(t, "_dde_display_config_private", customModeCfg.Name)
+	require.Len(t, customModeCfg.Monitors, 2)
+	assert.True(t, customModeCfg.Monitors[0].Primary)
+	assert.Equal(t, "HDMI-2", customModeCfg.Monitors[1].Name)
+	assert.Equal(t, int16(1366), customModeCfg.Monitors[1].X)
+	assert.False(t, customModeCfg.Monitors[1].Primary)
+}
+
+func Test_migrateV4ToV5(t *testing.T) {
+	testGolden(t, "v4.json", "v4-v5.golden.json", migrateV4ToV5)
+}
+
+func TestMigrate(t *testing.T) {
+	testGolden(t, "v3.3.json", "v3.3-v5.golden.json", func(data []byte) ([]byte, error) {
+		return Migrate(data, Version3_3)
+	})
+
+	data := []byte(`{"Version":"5.0","Config":{}}`)
+	result, err := Migrate(data, Version5)
+	require.NoError(t, err)
+	assert.Equal(t, data, result)
+
+	_, err = Migrate(data, "2.0")
+	assert.Error(t, err)
+}
+
+func Test_detectVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-configfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	versionFile := filepath.Join(dir, "config.version")
+
+	version, err := detectVersion([]byte(`{}`), versionFile)
+	require.NoError(t, err)
+	assert.Equal(t, Version4, version)
+
+	err = ioutil.WriteFile(versionFile, []byte("3.3\n"), 0644)
+	require.NoError(t, err)
+	version, err = detectVersion([]byte(`{}`), versionFile)
+	require.NoError(t, err)
+	assert.Equal(t, Version3_3, version)
+
+	version, err = detectVersion([]byte(`{"Version":"5.0","Config":{}}`), versionFile)
+	require.NoError(t, err)
+	assert.Equal(t, Version5, version)
+
+	_, err = detectVersion([]byte(`[`), versionFile)
+	assert.Error(t, err)
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-configfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "display.json")
+	versionFile := filepath.Join(dir, "config.version")
+
+	_, err = Load(filename, versionFile)
+	assert.True(t, os.IsNotExist(err))
+
+	// 旧版本的配置被升级，保存后 config.version 被删除
+	data, err := ioutil.ReadFile("testdata/v3.3.json")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filename, data, 0644))
+	require.NoError(t, ioutil.WriteFile(versionFile, []byte("3.3"), 0644))
+	cfg, err := Load(filename, versionFile)
+	require.NoError(t, err)
+	var c configV4
+	require.NoError(t, json.Unmarshal(cfg, &c))
+	assert.Len(t, c, 2)
+
+	require.NoError(t, Save(filename, versionFile, c, false))
+	_, err = os.Stat(versionFile)
+	assert.True(t, os.IsNotExist(err))
+	cfg1, err := Load(filename, versionFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(cfg), string(cfg1))
+
+	// 配置文件损坏时使用备份
+	require.NoError(t, Save(filename, versionFile, map[string]int{"a": 1}, false))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{"Version":`), 0644))
+	cfg, err = Load(filename, versionFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(cfg1), string(cfg))
+}
+
+func TestSave_legacyBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-configfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "display.json")
+	versionFile := filepath.Join(dir, "config.version")
+
+	data, err := ioutil.ReadFile("testdata/v3.3.json")
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(filename, data, 0644))
+	require.NoError(t, ioutil.WriteFile(versionFile, []byte("3.3"), 0644))
+	cfg, err := Load(filename, versionFile)
+	require.NoError(t, err)
+
+	// 旧版本的配置先升级再保留为备份，config.version 删除后仍然可以正确读取
+	require.NoError(t, Save(filename, versionFile, map[string]int{"a": 1}, false))
+	backup, err := ioutil.ReadFile(BackupFilename(filename, 1))
+	require.NoError(t, err)
+	version, err := detectVersion(backup, versionFile)
+	require.NoError(t, err)
+	assert.Equal(t, CurrentVersion, version)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{"Version":`), 0644))
+	cfg1, err := Load(filename, versionFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(cfg), string(cfg1))
+
+	// 无法读取的旧版本配置不保留为备份
+	require.NoError(t, os.Remove(BackupFilename(filename, 1)))
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{"a":`), 0644))
+	require.NoError(t, Save(filename, versionFile, map[string]int{"a": 1}, false))
+	_, err = os.Stat(BackupFilename(filename, 1))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-configfile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "sub", "file")
+
+	for i := 0; i < 5; i++ {
+		err = WriteFileAtomic(filename, []byte{byte('0' + i)}, 0600, 2)
+		require.NoError(t, err)
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	require.NoError(t, err)
+	assert.Equal(t, "4", string(content))
+	content, err = ioutil.ReadFile(BackupFilename(filename, 1))
+	require.NoError(t, err)
+	assert.Equal(t, "3", string(content))
+	content, err = ioutil.ReadFile(BackupFilename(filename, 2))
+	require.NoError(t, err)
+	assert.Equal(t, "2", string(content))
+	_, err = os.Stat(BackupFilename(filename, 3))
+	assert.True(t, os.IsNotExist(err))
+
+	fi, err := os.Stat(filename)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	// 不留下临时文件
+	files, err := ioutil.ReadDir(filepath.Dir(filename))
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+}
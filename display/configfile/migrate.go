@@ -0,0 +1,208 @@
+package configfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 配置文件 display.json 的格式版本。
+// 3.3 和 4.0 的版本号保存在单独的 config.version 文件中，从 5.0 开始保存在配置文件内。
+const (
+	Version3_3     = "3.3"
+	Version4       = "4.0"
+	Version5       = "5.0"
+	CurrentVersion = Version5
+)
+
+type migration struct {
+	from    string
+	to      string
+	migrate func(data []byte) ([]byte, error)
+}
+
+// 按顺序执行，新增版本时在末尾添加
+var migrations = []migration{
+	{Version3_3, Version4, migrateV3_3ToV4},
+	{Version4, Version5, migrateV4ToV5},
+}
+
+// Migrate 把 version 版本的配置文件内容逐步升级到 CurrentVersion
+func Migrate(data []byte, version string) ([]byte, error) {
+	for _, m := range migrations {
+		if version == CurrentVersion {
+			break
+		}
+		if m.from != version {
+			continue
+		}
+		var err error
+		data, err = m.migrate(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to migrate config from %s to %s: %v", m.from, m.to, err)
+		}
+		version = m.to
+	}
+	if version != CurrentVersion {
+		return nil, fmt.Errorf("unsupported config version %q", version)
+	}
+	return data, nil
+}
+
+// 以下是各个旧版本的配置格式，不要修改。
+
+const (
+	customModeDelimV3_3   = "+"
+	monitorsIdDelimiterV4 = ","
+)
+
+type configV3_3 map[string]*screenConfigV3_3
+
+type screenConfigV3_3 struct {
+	Name      string
+	Primary   string
+	BaseInfos []*monitorConfigV3_3
+}
+
+type monitorConfigV3_3 struct {
+	UUID        string
+	Name        string
+	Enabled     bool
+	X           int16
+	Y           int16
+	Width       uint16
+	Height      uint16
+	Rotation    uint16
+	Reflect     uint16
+	RefreshRate float64
+}
+
+type configV4 map[string]*screenConfigV4
+
+type screenConfigV4 struct {
+	Custom  []*customModeConfigV4 `json:",omitempty"`
+	Mirror  *monitorsConfigV4     `json:",omitempty"`
+	Extend  *monitorsConfigV4     `json:",omitempty"`
+	OnlyOne *monitorsConfigV4     `json:",omitempty"`
+	Single  *monitorConfigV4      `json:",omitempty"`
+}
+
+type customModeConfigV4 struct {
+	Name     string
+	Monitors []*monitorConfigV4
+}
+
+type monitorsConfigV4 struct {
+	Monitors []*monitorConfigV4
+}
+
+type monitorConfigV4 struct {
+	UUID        string
+	Name        string
+	Enabled     bool
+	X           int16
+	Y           int16
+	Width       uint16
+	Height      uint16
+	Rotation    uint16
+	Reflect     uint16
+	RefreshRate float64
+	Primary     bool
+}
+
+type fileV5 struct {
+	Version string
+	Config  json.RawMessage
+}
+
+func (sc *screenConfigV3_3) toMonitorConfigsV4() []*monitorConfigV4 {
+	result := make([]*monitorConfigV4, len(sc.BaseInfos))
+	for idx, bi := range sc.BaseInfos {
+		result[idx] = &monitorConfigV4{
+			UUID:        bi.UUID,
+			Name:        bi.Name,
+			Enabled:     bi.Enabled,
+			X:           bi.X,
+			Y:           bi.Y,
+			Width:       bi.Width,
+			Height:      bi.Height,
+			Rotation:    bi.Rotation,
+			Reflect:     bi.Reflect,
+			RefreshRate: bi.RefreshRate,
+			Primary:     bi.Name == sc.Primary,
+		}
+	}
+	return result
+}
+
+// 3.3 的键是 “自定义模式名称+显示器 UUID 列表”，没有名称的是单屏配置
+func parseConfigKeyV3_3(str string) (name string, joinedId string) {
+	var idFields []string
+	idx := strings.LastIndex(str, customModeDelimV3_3)
+	if idx == -1 {
+		idFields = strings.Split(str, monitorsIdDelimiterV4)
+	} else {
+		name = str[:idx]
+		idFields = strings.Split(str[idx+1:], monitorsIdDelimiterV4)
+	}
+	sort.Strings(idFields)
+	return name, strings.Join(idFields, monitorsIdDelimiterV4)
+}
+
+func migrateV3_3ToV4(data []byte) ([]byte, error) {
+	var c configV3_3
+	err := json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	newConfig := make(configV4)
+	for id, sc := range c {
+		if sc == nil {
+			continue
+		}
+		name, joinedId := parseConfigKeyV3_3(id)
+		if name == "" {
+			// 单屏幕，可设置分辨率
+			if !strings.Contains(joinedId, monitorsIdDelimiterV4) && len(sc.BaseInfos) == 1 {
+				single := sc.toMonitorConfigsV4()[0]
+				single.Primary = true
+				newConfig[joinedId] = &screenConfigV4{Single: single}
+			}
+			continue
+		}
+
+		// custom mode
+		screenCfg := newConfig[joinedId]
+		if screenCfg == nil {
+			screenCfg = &screenConfigV4{}
+			newConfig[joinedId] = screenCfg
+		}
+		screenCfg.Custom = append(screenCfg.Custom, &customModeConfigV4{
+			Name:     name,
+			Monitors: sc.toMonitorConfigsV4(),
+		})
+	}
+	return json.Marshal(newConfig)
+}
+
+// 5.0 只是把 4.0 的配置和版本号一起保存
+func migrateV4ToV5(data []byte) ([]byte, error) {
+	var c configV4
+	err := json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = make(configV4)
+	}
+	cfgData, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(fileV5{
+		Version: Version5,
+		Config:  cfgData,
+	})
+}
@@ -0,0 +1,150 @@
+// Package core 是 X11 和 Wayland 下 display 模块共用的部分，
+// 包括配置模型、模式切换、主屏幕的选择和亮度，通过 OutputBackend 和 BrightnessBackend
+// 接口操作具体的输出设备。D-Bus 对象的导出和属性仍由各个包实现，方法只转发到这里。
+package core
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// 和 RandR 的定义相同
+const (
+	RotationRotate0   uint16 = 1
+	RotationRotate90  uint16 = 2
+	RotationRotate180 uint16 = 4
+	RotationRotate270 uint16 = 8
+)
+
+func NeedSwapWidthHeight(rotation uint16) bool {
+	return rotation&RotationRotate90 != 0 ||
+		rotation&RotationRotate270 != 0
+}
+
+type Mode struct {
+	ID     uint32
+	Width  uint16
+	Height uint16
+	Rate   float64
+}
+
+// Output 是和后端无关的输出设备信息
+type Output struct {
+	ID            uint32
+	Name          string
+	UUID          string
+	Connected     bool
+	Manufacturer  string
+	Model         string
+	MmWidth       uint32
+	MmHeight      uint32
+	Builtin       bool
+	ConnectedTime time.Time // 最近一次连接的时间
+	Modes         []Mode
+	BestMode      Mode
+
+	// 当前的状态
+	Enabled  bool
+	X        int16
+	Y        int16
+	Mode     Mode
+	Rotation uint16
+	Reflect  uint16
+	// 缩放比例，为 0 时和 1 一样不缩放
+	Scale float64
+}
+
+// 旋转之后的大小
+func (o *Output) size() (width, height uint16) {
+	width, height = o.Mode.Width, o.Mode.Height
+	if NeedSwapWidthHeight(o.Rotation) {
+		width, height = height, width
+	}
+	return
+}
+
+// ScaledSize 返回缩放之后在屏幕中占用的大小，scale 大于 1 时内容被放大，占用的区域变小
+func ScaledSize(width, height uint16, scale float64) (uint16, uint16) {
+	if scale <= 0 || scale == 1 {
+		return width, height
+	}
+	return uint16(math.Round(float64(width) / scale)), uint16(math.Round(float64(height) / scale))
+}
+
+// OutputConfig 是布局中一个输出设备的设置
+type OutputConfig struct {
+	ID       uint32
+	Enabled  bool
+	X        int16
+	Y        int16
+	Mode     Mode
+	Rotation uint16
+	Reflect  uint16
+	Scale    float64
+}
+
+// Layout 是所有输出设备的布局，不在 Outputs 中的输出设备会被禁用
+type Layout struct {
+	Outputs []OutputConfig
+	// 主屏幕的 ID，为 0 时不设置
+	Primary uint32
+}
+
+func (l *Layout) Get(id uint32) *OutputConfig {
+	for i := range l.Outputs {
+		if l.Outputs[i].ID == id {
+			return &l.Outputs[i]
+		}
+	}
+	return nil
+}
+
+// OutputBackend 封装了 RandR、KWayland 等具体的输出设备接口
+type OutputBackend interface {
+	// ListOutputs 返回所有的输出设备，包括没有连接的。
+	// 返回的顺序也是扩展模式下从左到右排列的顺序
+	ListOutputs() ([]*Output, error)
+	// ApplyLayout 应用布局，要么全部成功，要么恢复到应用之前的状态并返回错误
+	ApplyLayout(layout *Layout) error
+	SetPrimary(id uint32) error
+	// SubscribeHotplug 在输出设备连接或断开时调用 cb，返回的函数用于取消订阅
+	SubscribeHotplug(cb func()) (unsubscribe func())
+}
+
+// HotplugHandlers 保存 SubscribeHotplug 注册的回调，供各个后端复用
+type HotplugHandlers struct {
+	mu       sync.Mutex
+	handlers map[int]func()
+	nextId   int
+}
+
+func (h *HotplugHandlers) SubscribeHotplug(cb func()) (unsubscribe func()) {
+	h.mu.Lock()
+	if h.handlers == nil {
+		h.handlers = make(map[int]func())
+	}
+	id := h.nextId
+	h.nextId++
+	h.handlers[id] = cb
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		delete(h.handlers, id)
+		h.mu.Unlock()
+	}
+}
+
+// NotifyHotplug 调用所有的回调，在已连接的输出设备发生变化时调用
+func (h *HotplugHandlers) NotifyHotplug() {
+	h.mu.Lock()
+	handlers := make([]func(), 0, len(h.handlers))
+	for _, cb := range h.handlers {
+		handlers = append(handlers, cb)
+	}
+	h.mu.Unlock()
+
+	for _, cb := range handlers {
+		cb()
+	}
+}
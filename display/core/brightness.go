@@ -0,0 +1,189 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// 亮度的值范围为 [0, 1]，按输出设备的名称保存，X11 和 Wayland 共用。
+// D-Bus 接口中获取、设置、保存和刷新亮度的方法都由 Brightness 实现，
+// 各个包只负责硬件亮度的设置和 D-Bus 属性的更新。
+
+type InvalidOutputNameError struct {
+	Name string
+}
+
+func (err InvalidOutputNameError) Error() string {
+	return fmt.Sprintf("invalid output name %q", err.Name)
+}
+
+// BrightnessBackend 设置输出设备的硬件亮度
+type BrightnessBackend interface {
+	// OutputEnabled 返回输出设备是否启用，没有连接时 ok 为 false
+	OutputEnabled(name string) (enabled, ok bool)
+	SetOutputBrightness(name string, value float64) error
+}
+
+// RoundBrightness 把亮度四舍五入保留小数点后三位
+func RoundBrightness(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// ParseBrightnessTable 解析保存的亮度，value 为空时返回 nil
+func ParseBrightnessTable(value string) (map[string]float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var result map[string]float64
+	err := json.Unmarshal([]byte(value), &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func MarshalBrightnessTable(values map[string]float64) string {
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+type Brightness struct {
+	Backend BrightnessBackend
+	// Changed 在亮度变化后调用，参数是所有亮度的副本，用于更新 D-Bus 属性
+	Changed func(values map[string]float64)
+	// Save 保存所有的亮度，比如写入 GSettings
+	Save func(values map[string]float64)
+
+	// setMu 让设置硬件亮度和更新 values 按顺序进行，
+	// mu 只保护 values，设置硬件亮度期间读取亮度不会被阻塞
+	setMu  sync.Mutex
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+func NewBrightness(backend BrightnessBackend, values map[string]float64) *Brightness {
+	b := &Brightness{
+		Backend: backend,
+		values:  make(map[string]float64, len(values)),
+	}
+	for name, value := range values {
+		b.values[name] = value
+	}
+	return b
+}
+
+func (b *Brightness) copyValues() map[string]float64 {
+	values := make(map[string]float64, len(b.values))
+	for name, value := range b.values {
+		values[name] = value
+	}
+	return values
+}
+
+// Values 返回所有亮度的副本
+func (b *Brightness) Values() map[string]float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.copyValues()
+}
+
+func (b *Brightness) Get(name string) (float64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, ok := b.values[name]
+	return value, ok
+}
+
+// GetOrInit 返回输出设备的亮度，没有时设为 value 并返回
+func (b *Brightness) GetOrInit(name string, value float64) float64 {
+	b.mu.Lock()
+	current, ok := b.values[name]
+	if ok {
+		b.mu.Unlock()
+		return current
+	}
+	b.values[name] = value
+	values := b.copyValues()
+	b.mu.Unlock()
+	b.emitChanged(values)
+	return value
+}
+
+func (b *Brightness) emitChanged(values map[string]float64) {
+	if b.Changed != nil {
+		b.Changed(values)
+	}
+}
+
+func (b *Brightness) set(fake bool, name string, value float64) error {
+	enabled, ok := b.Backend.OutputEnabled(name)
+	if !ok {
+		return InvalidOutputNameError{Name: name}
+	}
+	value = RoundBrightness(value)
+
+	b.setMu.Lock()
+	defer b.setMu.Unlock()
+	// DDC/CI 等方式设置硬件亮度可能很慢，不持有 mu
+	if !fake && enabled {
+		err := b.Backend.SetOutputBrightness(name, value)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	old, ok := b.values[name]
+	if ok && old == value {
+		b.mu.Unlock()
+		return nil
+	}
+	b.values[name] = value
+	values := b.copyValues()
+	b.mu.Unlock()
+
+	b.emitChanged(values)
+	return nil
+}
+
+// Set 设置输出设备的亮度，输出设备没有启用时只记录亮度，启用时再设置
+func (b *Brightness) Set(name string, value float64) error {
+	return b.set(false, name, value)
+}
+
+// SetFake 只记录亮度，不设置硬件，用于和硬件当前的亮度同步
+func (b *Brightness) SetFake(name string, value float64) error {
+	return b.set(true, name, value)
+}
+
+func (b *Brightness) SaveAll() {
+	if b.Save != nil {
+		b.Save(b.Values())
+	}
+}
+
+func (b *Brightness) SetAndSave(name string, value float64) error {
+	err := b.Set(name, value)
+	if err != nil {
+		return err
+	}
+	b.SaveAll()
+	return nil
+}
+
+// Refresh 重新设置所有已连接的输出设备的亮度，返回第一个错误
+func (b *Brightness) Refresh() error {
+	var firstErr error
+	for name, value := range b.Values() {
+		if _, ok := b.Backend.OutputEnabled(name); !ok {
+			continue
+		}
+		err := b.Set(name, value)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
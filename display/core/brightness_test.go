@@ -0,0 +1,126 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBrightnessBackend struct {
+	enabled map[string]bool
+	err     error
+	calls   []string
+	// 不为 nil 时 SetOutputBrightness 发送到 started，然后等待 block 关闭
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (b *fakeBrightnessBackend) OutputEnabled(name string) (enabled, ok bool) {
+	enabled, ok = b.enabled[name]
+	return
+}
+
+func (b *fakeBrightnessBackend) SetOutputBrightness(name string, value float64) error {
+	if b.block != nil {
+		b.started <- struct{}{}
+		<-b.block
+	}
+	if b.err != nil {
+		return b.err
+	}
+	b.calls = append(b.calls, fmt.Sprintf("%s %v", name, value))
+	return nil
+}
+
+func TestBrightness(t *testing.T) {
+	backend := &fakeBrightnessBackend{enabled: map[string]bool{"eDP-1": true, "HDMI-1": false}}
+	b := NewBrightness(backend, map[string]float64{"eDP-1": 0.5, "DP-1": 0.8})
+	var changed []map[string]float64
+	b.Changed = func(values map[string]float64) {
+		changed = append(changed, values)
+	}
+	var saved map[string]float64
+	b.Save = func(values map[string]float64) {
+		saved = values
+	}
+
+	require.NoError(t, b.Set("eDP-1", 0.66666))
+	assert.Equal(t, []string{"eDP-1 0.667"}, backend.calls)
+	value, ok := b.Get("eDP-1")
+	assert.True(t, ok)
+	assert.Equal(t, 0.667, value)
+	assert.Len(t, changed, 1)
+	assert.Nil(t, saved)
+
+	// 没有变化时不更新属性
+	require.NoError(t, b.Set("eDP-1", 0.667))
+	assert.Len(t, changed, 1)
+
+	// 没有启用的输出设备只记录亮度
+	backend.calls = nil
+	require.NoError(t, b.SetAndSave("HDMI-1", 0.3))
+	assert.Empty(t, backend.calls)
+	assert.Equal(t, map[string]float64{"eDP-1": 0.667, "HDMI-1": 0.3, "DP-1": 0.8}, saved)
+
+	err := b.Set("VGA-1", 1)
+	assert.IsType(t, InvalidOutputNameError{}, err)
+
+	// 刷新时跳过没有连接的输出设备
+	require.NoError(t, b.Refresh())
+	assert.Equal(t, []string{"eDP-1 0.667"}, backend.calls)
+
+	assert.Equal(t, 1.0, b.GetOrInit("HDMI-2", 1))
+	assert.Equal(t, 0.3, b.GetOrInit("HDMI-1", 1))
+}
+
+func TestBrightness_error(t *testing.T) {
+	backend := &fakeBrightnessBackend{
+		enabled: map[string]bool{"eDP-1": true},
+		err:     errors.New("failed"),
+	}
+	b := NewBrightness(backend, map[string]float64{"eDP-1": 0.5})
+	assert.Error(t, b.Set("eDP-1", 0.8))
+	value, _ := b.Get("eDP-1")
+	assert.Equal(t, 0.5, value)
+}
+
+func TestBrightness_setNotBlockingGet(t *testing.T) {
+	backend := &fakeBrightnessBackend{
+		enabled: map[string]bool{"eDP-1": true},
+		started: make(chan struct{}),
+		block:   make(chan struct{}),
+	}
+	b := NewBrightness(backend, map[string]float64{"eDP-1": 0.5})
+	done := make(chan error)
+	go func() {
+		done <- b.Set("eDP-1", 0.8)
+	}()
+	<-backend.started
+
+	// 设置硬件亮度期间可以读取亮度，读到的是旧值
+	value, ok := b.Get("eDP-1")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, value)
+	assert.Equal(t, map[string]float64{"eDP-1": 0.5}, b.Values())
+
+	close(backend.block)
+	require.NoError(t, <-done)
+	value, _ = b.Get("eDP-1")
+	assert.Equal(t, 0.8, value)
+}
+
+func TestParseBrightnessTable(t *testing.T) {
+	values, err := ParseBrightnessTable("")
+	require.NoError(t, err)
+	assert.Nil(t, values)
+
+	values, err = ParseBrightnessTable(MarshalBrightnessTable(map[string]float64{"eDP-1": 0.5}))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"eDP-1": 0.5}, values)
+
+	_, err = ParseBrightnessTable("{")
+	assert.Error(t, err)
+}
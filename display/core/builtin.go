@@ -0,0 +1,39 @@
+package core
+
+import "strings"
+
+// GuessBuiltinOutput 在已连接的输出设备中猜测内置显示器。
+// savedName 是之前保存的内置显示器名称，它存在时直接使用。
+// 无法确定时返回 ID 最小的作为内置显示器，并通过 candidates 返回所有的候补，
+// 这种情况下不应该保存内置显示器的名称。
+func GuessBuiltinOutput(outputs []*Output, savedName string) (builtin *Output, candidates []*Output) {
+	outputs = ConnectedOutputs(outputs)
+	if savedName != "" {
+		if o := GetOutputByName(outputs, savedName); o != nil {
+			return o, nil
+		}
+	}
+
+	var rest []*Output
+	for _, o := range outputs {
+		name := strings.ToLower(o.Name)
+		if strings.HasPrefix(name, "vga") {
+			// ignore VGA
+		} else if strings.HasPrefix(name, "edp") {
+			// 如果是 edp 开头，直接成为内置显示器
+			rest = []*Output{o}
+			break
+		} else {
+			rest = append(rest, o)
+		}
+	}
+
+	switch len(rest) {
+	case 0:
+		return nil, nil
+	case 1:
+		return rest[0], nil
+	default:
+		return getMinIDOutput(rest), rest
+	}
+}
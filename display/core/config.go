@@ -0,0 +1,346 @@
+package core
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"pkg.deepin.io/dde/startdde/display/configfile"
+)
+
+const (
+	DisplayModeCustom uint8 = iota
+	DisplayModeMirror
+	DisplayModeExtend
+	DisplayModeOnlyOne
+	DisplayModeUnknow
+)
+
+const MonitorsIdDelimiter = ","
+
+// Config 是保存在 display.json 中的显示配置，键为已连接显示器的 UUID 排序后用逗号连接起来的字符串
+type Config map[string]*ScreenConfig
+
+type ScreenConfig struct {
+	Custom  []*CustomModeConfig `json:",omitempty"`
+	Mirror  *MirrorModeConfig   `json:",omitempty"`
+	Extend  *ExtendModeConfig   `json:",omitempty"`
+	OnlyOne *OnlyOneModeConfig  `json:",omitempty"`
+	Single  *MonitorConfig      `json:",omitempty"`
+}
+
+type CustomModeConfig struct {
+	Name     string
+	Monitors []*MonitorConfig
+}
+
+type MirrorModeConfig struct {
+	Monitors []*MonitorConfig
+}
+
+type ExtendModeConfig struct {
+	Monitors []*MonitorConfig
+}
+
+type OnlyOneModeConfig struct {
+	Monitors []*MonitorConfig
+}
+
+// MonitorConfig 中的 Width 和 Height 是模式旋转之后的大小，不受缩放影响
+type MonitorConfig struct {
+	UUID        string
+	Name        string
+	Enabled     bool
+	X           int16
+	Y           int16
+	Width       uint16
+	Height      uint16
+	Rotation    uint16
+	Reflect     uint16
+	RefreshRate float64
+	Primary     bool
+	// 缩放比例，为 0 时不缩放
+	Scale float64 `json:",omitempty"`
+	OutputProps
+}
+
+// OutputProps 是用户对输出设备的设置，和布局无关，包括 RandR 输出属性和自定义模式，
+// 零值表示使用驱动的默认值
+type OutputProps struct {
+	MaxBpc       uint32 `json:",omitempty"`
+	BroadcastRGB string `json:",omitempty"`
+	// 需要在应用布局之前添加到输出设备上
+	CustomModes []CustomMode `json:",omitempty"`
+}
+
+func (p *OutputProps) isZero() bool {
+	return p.MaxBpc == 0 && p.BroadcastRGB == "" && len(p.CustomModes) == 0
+}
+
+// AddCustomMode 添加自定义模式，已经有相同的模式时返回 false
+func (p *OutputProps) AddCustomMode(mode CustomMode) bool {
+	for _, m := range p.CustomModes {
+		if m == mode {
+			return false
+		}
+	}
+	p.CustomModes = append(p.CustomModes, mode)
+	return true
+}
+
+// GetMonitorsId 返回 Config 中使用的键
+func GetMonitorsId(uuids []string) string {
+	if len(uuids) == 0 {
+		return ""
+	}
+	ids := make([]string, len(uuids))
+	copy(ids, uuids)
+	sort.Strings(ids)
+	return strings.Join(ids, MonitorsIdDelimiter)
+}
+
+func (s *ScreenConfig) GetMonitorConfigs(mode uint8, customName string) []*MonitorConfig {
+	switch mode {
+	case DisplayModeCustom:
+		for _, custom := range s.Custom {
+			if custom.Name == customName {
+				return custom.Monitors
+			}
+		}
+	case DisplayModeMirror:
+		if s.Mirror == nil {
+			return nil
+		}
+		return s.Mirror.Monitors
+
+	case DisplayModeExtend:
+		if s.Extend == nil {
+			return nil
+		}
+		return s.Extend.Monitors
+
+	case DisplayModeOnlyOne:
+		if s.OnlyOne == nil {
+			return nil
+		}
+		return s.OnlyOne.Monitors
+	}
+
+	return nil
+}
+
+func (s *ScreenConfig) SetMonitorConfigs(mode uint8, customName string, configs []*MonitorConfig) {
+	s.keepOutputProps(configs)
+	switch mode {
+	case DisplayModeCustom:
+		foundName := false
+		for _, custom := range s.Custom {
+			if custom.Name == customName {
+				foundName = true
+				custom.Monitors = configs
+			}
+		}
+
+		// new custom
+		if !foundName {
+			s.Custom = append(s.Custom, &CustomModeConfig{
+				Name:     customName,
+				Monitors: configs,
+			})
+		}
+
+	case DisplayModeMirror:
+		if s.Mirror == nil {
+			s.Mirror = &MirrorModeConfig{}
+		}
+		s.Mirror.Monitors = configs
+
+	case DisplayModeExtend:
+		if s.Extend == nil {
+			s.Extend = &ExtendModeConfig{}
+		}
+		s.Extend.Monitors = configs
+
+	case DisplayModeOnlyOne:
+		s.setMonitorConfigsOnlyOne(configs)
+	}
+}
+
+func (s *ScreenConfig) setMonitorConfigsOnlyOne(configs []*MonitorConfig) {
+	if s.OnlyOne == nil {
+		s.OnlyOne = &OnlyOneModeConfig{}
+	}
+	oldConfigs := s.OnlyOne.Monitors
+	var newConfigs []*MonitorConfig
+	for _, cfg := range configs {
+		if !cfg.Enabled {
+			oldCfg := GetMonitorConfigByUuid(oldConfigs, cfg.UUID)
+			if oldCfg != nil {
+				// 不设置 X,Y 是因为它们总是 0
+				cfg.Width = oldCfg.Width
+				cfg.Height = oldCfg.Height
+				cfg.RefreshRate = oldCfg.RefreshRate
+				cfg.Rotation = oldCfg.Rotation
+				cfg.Reflect = oldCfg.Reflect
+			} else {
+				continue
+			}
+		}
+		newConfigs = append(newConfigs, cfg)
+	}
+	s.OnlyOne.Monitors = newConfigs
+}
+
+// 所有模式中的显示器配置
+func (s *ScreenConfig) allMonitorConfigs() []*MonitorConfig {
+	var result []*MonitorConfig
+	for _, custom := range s.Custom {
+		result = append(result, custom.Monitors...)
+	}
+	if s.Mirror != nil {
+		result = append(result, s.Mirror.Monitors...)
+	}
+	if s.Extend != nil {
+		result = append(result, s.Extend.Monitors...)
+	}
+	if s.OnlyOne != nil {
+		result = append(result, s.OnlyOne.Monitors...)
+	}
+	if s.Single != nil {
+		result = append(result, s.Single)
+	}
+	return result
+}
+
+// 从当前状态生成的配置中没有输出属性，使用之前保存的
+func (s *ScreenConfig) keepOutputProps(configs []*MonitorConfig) {
+	old := s.allMonitorConfigs()
+	for _, cfg := range configs {
+		if !cfg.OutputProps.isZero() {
+			continue
+		}
+		for _, oldCfg := range old {
+			if oldCfg.UUID == cfg.UUID && !oldCfg.OutputProps.isZero() {
+				cfg.OutputProps = oldCfg.OutputProps
+				break
+			}
+		}
+	}
+}
+
+// GetOutputProps 返回 UUID 为 uuid 的显示器保存的输出属性
+func (c Config) GetOutputProps(uuid string) OutputProps {
+	for _, screenCfg := range c {
+		for _, cfg := range screenCfg.allMonitorConfigs() {
+			if cfg.UUID == uuid && !cfg.OutputProps.isZero() {
+				return cfg.OutputProps
+			}
+		}
+	}
+	return OutputProps{}
+}
+
+// SetOutputProps 修改所有显示器组合中 UUID 为 uuid 的显示器的输出属性，没有这个显示器的配置时返回 false
+func (c Config) SetOutputProps(uuid string, props OutputProps) bool {
+	found := false
+	for _, screenCfg := range c {
+		for _, cfg := range screenCfg.allMonitorConfigs() {
+			if cfg.UUID == uuid {
+				cfg.OutputProps = props
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// RenameMonitors 把配置中的显示器 UUID 按 renames 替换，同时修改显示器组合的键，
+// 替换后的键已经存在时保留已有的配置。返回配置是否被修改。
+func (c Config) RenameMonitors(renames map[string]string) bool {
+	ids := make([]string, 0, len(c))
+	for id := range c {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	changed := false
+	for _, id := range ids {
+		screenCfg := c[id]
+		uuids := strings.Split(id, MonitorsIdDelimiter)
+		renamed := false
+		for i, uuid := range uuids {
+			if newUuid, ok := renames[uuid]; ok {
+				uuids[i] = newUuid
+				renamed = true
+			}
+		}
+		if !renamed {
+			continue
+		}
+		changed = true
+		delete(c, id)
+		newId := GetMonitorsId(uuids)
+		if c[newId] != nil {
+			continue
+		}
+		for _, cfg := range screenCfg.allMonitorConfigs() {
+			if newUuid, ok := renames[cfg.UUID]; ok {
+				cfg.UUID = newUuid
+			}
+		}
+		c[newId] = screenCfg
+	}
+	return changed
+}
+
+func GetMonitorConfigByUuid(configs []*MonitorConfig, uuid string) *MonitorConfig {
+	for _, mc := range configs {
+		if mc.UUID == uuid {
+			return mc
+		}
+	}
+	return nil
+}
+
+func SetMonitorConfigsPrimary(configs []*MonitorConfig, uuid string) {
+	for _, mc := range configs {
+		if mc.UUID == uuid {
+			mc.Primary = true
+		} else {
+			mc.Primary = false
+		}
+	}
+}
+
+// GetCustomIdList 返回显示器组合 id 的所有自定义模式名称
+func (c Config) GetCustomIdList(id string) []string {
+	screenCfg := c[id]
+	if screenCfg == nil {
+		return nil
+	}
+
+	result := make([]string, len(screenCfg.Custom))
+	for idx, custom := range screenCfg.Custom {
+		result[idx] = custom.Name
+	}
+	sort.Strings(result)
+	return result
+}
+
+// LoadConfig 读取配置文件，旧版本的配置会被升级
+func LoadConfig(filename, versionFile string) (Config, error) {
+	data, err := configfile.Load(filename, versionFile)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c Config) Save(filename, versionFile string, indent bool) error {
+	return configfile.Save(filename, versionFile, c, indent)
+}
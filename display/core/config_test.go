@@ -0,0 +1,89 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfig_OutputProps(t *testing.T) {
+	config := Config{
+		"HDMI-1abc,eDP-1def": &ScreenConfig{
+			Extend: &ExtendModeConfig{
+				Monitors: []*MonitorConfig{
+					{UUID: "HDMI-1abc", Name: "HDMI-1", Enabled: true},
+					{UUID: "eDP-1def", Name: "eDP-1", Enabled: true},
+				},
+			},
+		},
+		"HDMI-1abc": &ScreenConfig{
+			Single: &MonitorConfig{UUID: "HDMI-1abc", Name: "HDMI-1", Enabled: true},
+		},
+	}
+	assert.Equal(t, OutputProps{}, config.GetOutputProps("HDMI-1abc"))
+
+	props := OutputProps{MaxBpc: 10, BroadcastRGB: "Full"}
+	assert.True(t, config.SetOutputProps("HDMI-1abc", props))
+	assert.False(t, config.SetOutputProps("DP-1", props))
+	assert.Equal(t, props, config.GetOutputProps("HDMI-1abc"))
+	assert.Equal(t, props, config["HDMI-1abc"].Single.OutputProps)
+	assert.Equal(t, OutputProps{}, config.GetOutputProps("eDP-1def"))
+
+	// 重新保存布局时保留输出属性
+	screenCfg := config["HDMI-1abc,eDP-1def"]
+	screenCfg.SetMonitorConfigs(DisplayModeMirror, "", []*MonitorConfig{
+		{UUID: "HDMI-1abc", Name: "HDMI-1", Enabled: true},
+		{UUID: "eDP-1def", Name: "eDP-1", Enabled: true},
+	})
+	assert.Equal(t, props, screenCfg.Mirror.Monitors[0].OutputProps)
+	assert.Equal(t, OutputProps{}, screenCfg.Mirror.Monitors[1].OutputProps)
+
+	// 嵌入的字段在 JSON 中和其他字段在同一层，零值时省略
+	data, err := json.Marshal(screenCfg.Mirror.Monitors[0])
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"MaxBpc":10,"BroadcastRGB":"Full"`)
+	data, err = json.Marshal(screenCfg.Mirror.Monitors[1])
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "MaxBpc")
+}
+
+func TestConfig_RenameMonitors(t *testing.T) {
+	config := Config{
+		"HDMI-1abc,eDP-1def": &ScreenConfig{
+			Extend: &ExtendModeConfig{
+				Monitors: []*MonitorConfig{
+					{UUID: "HDMI-1abc", Name: "HDMI-1", Enabled: true},
+					{UUID: "eDP-1def", Name: "eDP-1", Enabled: true},
+				},
+			},
+		},
+		"HDMI-1abc": &ScreenConfig{
+			Single: &MonitorConfig{UUID: "HDMI-1abc", Name: "HDMI-1", Enabled: true},
+		},
+		"HDMI-1:DEL-A0BC": &ScreenConfig{
+			Single: &MonitorConfig{UUID: "HDMI-1:DEL-A0BC", Name: "HDMI-1", Enabled: true, Rotation: 2},
+		},
+	}
+	assert.False(t, config.RenameMonitors(map[string]string{"DP-1abc": "DP-1:DEL-A0BC"}))
+
+	assert.True(t, config.RenameMonitors(map[string]string{"HDMI-1abc": "HDMI-1:DEL-A0BC"}))
+	assert.Len(t, config, 2)
+	screenCfg := config["HDMI-1:DEL-A0BC,eDP-1def"]
+	require.NotNil(t, screenCfg)
+	assert.Equal(t, "HDMI-1:DEL-A0BC", screenCfg.Extend.Monitors[0].UUID)
+	assert.Equal(t, "eDP-1def", screenCfg.Extend.Monitors[1].UUID)
+	// 已经有新 UUID 的配置时不覆盖
+	assert.Equal(t, uint16(2), config["HDMI-1:DEL-A0BC"].Single.Rotation)
+}
+
+func TestOutputProps_AddCustomMode(t *testing.T) {
+	var props OutputProps
+	mode := CustomMode{Width: 1920, Height: 1080, Rate: 60}
+	assert.True(t, props.AddCustomMode(mode))
+	assert.False(t, props.AddCustomMode(mode))
+	mode.ReducedBlanking = true
+	assert.True(t, props.AddCustomMode(mode))
+	assert.Len(t, props.CustomModes, 2)
+}
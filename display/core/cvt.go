@@ -0,0 +1,150 @@
+package core
+
+import (
+	"fmt"
+	"math"
+)
+
+// ModeLine 是显示模式的时序，PixelClock 的单位是 kHz
+type ModeLine struct {
+	Name          string
+	PixelClock    uint32
+	HDisplay      uint16
+	HSyncStart    uint16
+	HSyncEnd      uint16
+	HTotal        uint16
+	VDisplay      uint16
+	VSyncStart    uint16
+	VSyncEnd      uint16
+	VTotal        uint16
+	HSyncPositive bool
+	VSyncPositive bool
+}
+
+// Rate 返回刷新率，单位 Hz
+func (l *ModeLine) Rate() float64 {
+	if l.HTotal == 0 || l.VTotal == 0 {
+		return 0
+	}
+	return float64(l.PixelClock) * 1000 / (float64(l.HTotal) * float64(l.VTotal))
+}
+
+// CustomMode 是用户添加的显示模式，保存生成时序的参数
+type CustomMode struct {
+	Width           uint16
+	Height          uint16
+	Rate            float64
+	ReducedBlanking bool
+}
+
+// VESA CVT 1.1 中的常量，和 cvt 命令的实现相同
+const (
+	cvtHGranularity = 8
+	cvtMinVPorch    = 3
+	cvtMinVBPorch   = 6
+	cvtClockStep    = 250 // kHz
+
+	cvtMinVSyncBP   = 550.0 // 微秒
+	cvtHSyncPercent = 8
+	cvtMPrime       = 600 * 128 / 256
+	cvtCPrime       = (40-20)*128/256 + 20
+
+	cvtRBMinVBlank = 460.0 // 微秒
+	cvtRBHSync     = 32
+	cvtRBHBlank    = 160
+	cvtRBVFPorch   = 3
+)
+
+// 按宽高比决定垂直同步的行数
+func cvtVSync(width, height int) int {
+	switch {
+	case height%3 == 0 && height*4/3 == width:
+		return 4
+	case height%9 == 0 && height*16/9 == width:
+		return 5
+	case height%10 == 0 && height*16/10 == width:
+		return 6
+	case height%4 == 0 && height*5/4 == width:
+		return 7
+	case height%9 == 0 && height*15/9 == width:
+		return 7
+	default:
+		return 10
+	}
+}
+
+// CVTModeLine 按 VESA CVT 标准生成显示模式的时序，宽度会向下取整到 8 的倍数
+func CVTModeLine(width, height uint16, rate float64, reducedBlanking bool) (*ModeLine, error) {
+	hDisplay := int(width) - int(width)%cvtHGranularity
+	vDisplay := int(height)
+	if hDisplay <= 0 || vDisplay <= 0 {
+		return nil, fmt.Errorf("invalid size %dx%d", width, height)
+	}
+	if rate <= 0 || rate > 500 || math.IsNaN(rate) {
+		return nil, fmt.Errorf("invalid refresh rate %v", rate)
+	}
+	vSync := cvtVSync(hDisplay, vDisplay)
+	l := &ModeLine{
+		HDisplay: uint16(hDisplay),
+		VDisplay: uint16(vDisplay),
+	}
+
+	var hTotal, vTotal int
+	var clock float64
+	if !reducedBlanking {
+		// 行周期，单位微秒
+		hPeriod := (1000000.0/rate - cvtMinVSyncBP) / float64(vDisplay+cvtMinVPorch)
+		vSyncAndBackPorch := int(cvtMinVSyncBP/hPeriod) + 1
+		if vSyncAndBackPorch < vSync+cvtMinVPorch {
+			vSyncAndBackPorch = vSync + cvtMinVPorch
+		}
+		vTotal = vDisplay + vSyncAndBackPorch + cvtMinVPorch
+
+		hBlankPercent := cvtCPrime - cvtMPrime*hPeriod/1000
+		if hBlankPercent < 20 {
+			hBlankPercent = 20
+		}
+		hBlank := int(float64(hDisplay) * hBlankPercent / (100 - hBlankPercent))
+		hBlank -= hBlank % (2 * cvtHGranularity)
+		hTotal = hDisplay + hBlank
+
+		hSyncWidth := hTotal * cvtHSyncPercent / 100
+		hSyncWidth -= hSyncWidth % cvtHGranularity
+		l.HSyncEnd = uint16(hDisplay + hBlank/2)
+		l.HSyncStart = l.HSyncEnd - uint16(hSyncWidth)
+		l.VSyncStart = uint16(vDisplay + cvtMinVPorch)
+		l.VSyncEnd = l.VSyncStart + uint16(vSync)
+		clock = float64(hTotal) * 1000 / hPeriod
+		l.VSyncPositive = true
+	} else {
+		hPeriod := (1000000.0/rate - cvtRBMinVBlank) / float64(vDisplay)
+		vbiLines := int(cvtRBMinVBlank/hPeriod) + 1
+		if vbiLines < cvtRBVFPorch+vSync+cvtMinVBPorch {
+			vbiLines = cvtRBVFPorch + vSync + cvtMinVBPorch
+		}
+		vTotal = vDisplay + vbiLines
+		hTotal = hDisplay + cvtRBHBlank
+
+		l.HSyncEnd = uint16(hDisplay + cvtRBHBlank/2)
+		l.HSyncStart = l.HSyncEnd - cvtRBHSync
+		l.VSyncStart = uint16(vDisplay + cvtRBVFPorch)
+		l.VSyncEnd = l.VSyncStart + uint16(vSync)
+		clock = rate * float64(vTotal) * float64(hTotal) / 1000
+		l.HSyncPositive = true
+	}
+	if hTotal > math.MaxUint16 || vTotal > math.MaxUint16 {
+		return nil, fmt.Errorf("size %dx%d is too large", width, height)
+	}
+	l.HTotal = uint16(hTotal)
+	l.VTotal = uint16(vTotal)
+	pixelClock := uint32(clock)
+	l.PixelClock = pixelClock - pixelClock%cvtClockStep
+
+	// 和 cvt 命令生成的名称相同
+	suffix := ""
+	if reducedBlanking {
+		suffix = "R"
+	}
+	l.Name = fmt.Sprintf("%dx%d%s_%.2f", hDisplay, vDisplay, suffix, rate)
+	return l, nil
+}
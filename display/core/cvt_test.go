@@ -0,0 +1,56 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCVTModeLine(t *testing.T) {
+	// 和 cvt 1920 1080 60 的结果相同
+	l, err := CVTModeLine(1920, 1080, 60, false)
+	require.NoError(t, err)
+	assert.Equal(t, &ModeLine{
+		Name:          "1920x1080_60.00",
+		PixelClock:    173000,
+		HDisplay:      1920,
+		HSyncStart:    2048,
+		HSyncEnd:      2248,
+		HTotal:        2576,
+		VDisplay:      1080,
+		VSyncStart:    1083,
+		VSyncEnd:      1088,
+		VTotal:        1120,
+		VSyncPositive: true,
+	}, l)
+	assert.InDelta(t, 59.96, l.Rate(), 0.01)
+
+	// cvt -r 1920 1080 60
+	l, err = CVTModeLine(1920, 1080, 60, true)
+	require.NoError(t, err)
+	assert.Equal(t, &ModeLine{
+		Name:          "1920x1080R_60.00",
+		PixelClock:    138500,
+		HDisplay:      1920,
+		HSyncStart:    1968,
+		HSyncEnd:      2000,
+		HTotal:        2080,
+		VDisplay:      1080,
+		VSyncStart:    1083,
+		VSyncEnd:      1088,
+		VTotal:        1111,
+		HSyncPositive: true,
+	}, l)
+
+	// 宽度向下取整到 8 的倍数，宽高比不标准时垂直同步是 10 行
+	l, err = CVTModeLine(1366, 768, 60, false)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(1360), l.HDisplay)
+	assert.Equal(t, l.VSyncStart+10, l.VSyncEnd)
+
+	_, err = CVTModeLine(4, 768, 60, false)
+	assert.Error(t, err)
+	_, err = CVTModeLine(1920, 1080, 0, false)
+	assert.Error(t, err)
+}
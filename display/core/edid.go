@@ -0,0 +1,71 @@
+package core
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"strconv"
+
+	"pkg.deepin.io/dde/startdde/display/edid"
+)
+
+// ParseEDID 从 EDID 中解析出厂商和型号，无法解析厂商时返回 "DEFAULT"
+func ParseEDID(edid []byte) (manufacturer, model string) {
+	if len(edid) < 16 {
+		return "DEFAULT", ""
+	}
+	var brandInf = edid[8:12]
+	var bInf = uint64(brandInf[0])<<8 + uint64(brandInf[1])
+	var maInf []byte
+	var k uint
+	for k = 1; k <= 3; k++ {
+		m := byte(((bInf >> (15 - 5*k)) & 31) + 'A' - 1)
+		if m >= 'A' && m <= 'Z' {
+			maInf = append(maInf, m)
+		} else {
+			return "DEFAULT", ""
+		}
+	}
+
+	// 截取显示器型号信息
+	if len(edid) < 128 {
+		return string(maInf), ""
+	}
+	modelInf := edid[88:112]
+	var moInf []byte
+	var isHaveInf = false
+	for _, m := range modelInf {
+		if m >= '!' && m <= '~' {
+			moInf = append(moInf, m)
+			isHaveInf = true
+		}
+		if isHaveInf && (m < '!' || m > '~') { // 截取型号信息终止
+			break
+		}
+	}
+	if !isHaveInf { // 如果没有型号信息，则解析厂家内部小版本号作为类型信息
+		for i := 2; i <= 3; i++ {
+			moInf = append(moInf, strconv.Itoa(int(brandInf[i]))...)
+		}
+	}
+	return string(maInf), string(moInf)
+}
+
+// MonitorUUID 返回输出设备的 UUID，是接口名称加上 EDID 中的 Identity，EDID 无效时就是名称。
+// 有序列号的显示器换了接口也能识别出来，没有序列号的相同显示器按接口区分。
+func MonitorUUID(name string, data []byte) string {
+	e, err := edid.Parse(data)
+	if err != nil {
+		return name
+	}
+	return name + ":" + e.Identity()
+}
+
+// OutputUUID 返回旧版本使用的 UUID，是名称加上 EDID 前 128 字节的 md5，没有 EDID 时就是名称，
+// 只用来把旧的配置迁移到 MonitorUUID
+func OutputUUID(name string, edid []byte) string {
+	if len(edid) < 128 {
+		return name
+	}
+	sum := md5.Sum(edid[:128])
+	return name + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+package core
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEDID(t *testing.T) {
+	edid, err := hex.DecodeString("00ffffffffffff0010acbca0000000000000010400000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000fc0044454c4c205532343134480a20000000000000000000000000000000000000001a")
+	require.NoError(t, err)
+	manufacturer, model := ParseEDID(edid)
+	assert.Equal(t, "DEL", manufacturer)
+	assert.Equal(t, "DELL", model)
+	assert.Equal(t, "HDMI-1d61ee06c18ff6f19bc39029311a7531e", OutputUUID("HDMI-1", edid))
+
+	// 没有型号信息时使用产品代码
+	edid[93] = 0
+	copy(edid[95:108], make([]byte, 13))
+	_, model = ParseEDID(edid)
+	assert.Equal(t, "188160", model)
+
+	manufacturer, model = ParseEDID(edid[:20])
+	assert.Equal(t, "DEL", manufacturer)
+	assert.Equal(t, "", model)
+	assert.Equal(t, "HDMI-1", OutputUUID("HDMI-1", edid[:20]))
+
+	manufacturer, _ = ParseEDID(nil)
+	assert.Equal(t, "DEFAULT", manufacturer)
+}
+
+func TestGuessBuiltinOutput(t *testing.T) {
+	outputs := []*Output{
+		{ID: 70, Name: "HDMI-1", Connected: true},
+		{ID: 60, Name: "DP-1", Connected: true},
+		{ID: 80, Name: "VGA-1", Connected: true},
+	}
+	builtin, candidates := GuessBuiltinOutput(outputs, "")
+	assert.Equal(t, "DP-1", builtin.Name)
+	assert.Len(t, candidates, 2)
+
+	builtin, candidates = GuessBuiltinOutput(outputs, "HDMI-1")
+	assert.Equal(t, "HDMI-1", builtin.Name)
+	assert.Nil(t, candidates)
+
+	outputs = append(outputs, &Output{ID: 90, Name: "eDP-1", Connected: true})
+	builtin, candidates = GuessBuiltinOutput(outputs, "LVDS-1")
+	assert.Equal(t, "eDP-1", builtin.Name)
+	assert.Nil(t, candidates)
+
+	builtin, _ = GuessBuiltinOutput(outputs[2:3], "")
+	assert.Nil(t, builtin)
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeBackend 是内存中的 OutputBackend 实现，用于单元测试
+type FakeBackend struct {
+	HotplugHandlers
+
+	mu      sync.Mutex
+	outputs map[uint32]*Output
+	primary uint32
+
+	// 成功应用的布局，按应用的顺序
+	Layouts []*Layout
+	// 不为 nil 时 ApplyLayout 返回这个错误，并且不改变输出设备的状态
+	ApplyErr error
+}
+
+func NewFakeBackend(outputs ...*Output) *FakeBackend {
+	b := &FakeBackend{
+		outputs: make(map[uint32]*Output),
+	}
+	for _, o := range outputs {
+		b.outputs[o.ID] = copyOutput(o)
+	}
+	return b
+}
+
+func copyOutput(o *Output) *Output {
+	o0 := *o
+	o0.Modes = append([]Mode(nil), o.Modes...)
+	return &o0
+}
+
+func (b *FakeBackend) ListOutputs() ([]*Output, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := make([]*Output, 0, len(b.outputs))
+	for _, o := range b.outputs {
+		result = append(result, copyOutput(o))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+	return result, nil
+}
+
+func hasMode(modes []Mode, mode Mode) bool {
+	for _, m := range modes {
+		if m.ID == mode.ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *FakeBackend) ApplyLayout(layout *Layout) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.ApplyErr != nil {
+		return b.ApplyErr
+	}
+	// 先检查，保证不会只应用了一部分
+	for _, cfg := range layout.Outputs {
+		o := b.outputs[cfg.ID]
+		if o == nil {
+			return fmt.Errorf("invalid output %d", cfg.ID)
+		}
+		if !cfg.Enabled {
+			continue
+		}
+		if !o.Connected {
+			return fmt.Errorf("output %s is not connected", o.Name)
+		}
+		if !hasMode(o.Modes, cfg.Mode) {
+			return fmt.Errorf("output %s has no mode %d", o.Name, cfg.Mode.ID)
+		}
+	}
+	if layout.Primary != 0 {
+		cfg := layout.Get(layout.Primary)
+		if cfg == nil || !cfg.Enabled {
+			return fmt.Errorf("primary output %d is not enabled", layout.Primary)
+		}
+	}
+
+	for id, o := range b.outputs {
+		cfg := layout.Get(id)
+		if cfg == nil || !cfg.Enabled {
+			o.Enabled = false
+			o.X, o.Y = 0, 0
+			o.Mode = Mode{}
+			o.Rotation = RotationRotate0
+			o.Reflect = 0
+			o.Scale = 0
+			continue
+		}
+		o.Enabled = true
+		o.X, o.Y = cfg.X, cfg.Y
+		o.Mode = cfg.Mode
+		o.Rotation = cfg.Rotation
+		o.Reflect = cfg.Reflect
+		o.Scale = cfg.Scale
+	}
+	if layout.Primary != 0 {
+		b.primary = layout.Primary
+	}
+
+	l := *layout
+	l.Outputs = append([]OutputConfig(nil), layout.Outputs...)
+	b.Layouts = append(b.Layouts, &l)
+	return nil
+}
+
+func (b *FakeBackend) SetPrimary(id uint32) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o := b.outputs[id]
+	if o == nil || !o.Enabled {
+		return fmt.Errorf("output %d is not enabled", id)
+	}
+	b.primary = id
+	return nil
+}
+
+func (b *FakeBackend) Primary() uint32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.primary
+}
+
+// Connect 连接输出设备，没有这个输出设备时添加它
+func (b *FakeBackend) Connect(o *Output) {
+	b.mu.Lock()
+	o0 := copyOutput(o)
+	o0.Connected = true
+	if o0.ConnectedTime.IsZero() {
+		o0.ConnectedTime = time.Now()
+	}
+	b.outputs[o0.ID] = o0
+	b.mu.Unlock()
+	b.NotifyHotplug()
+}
+
+func (b *FakeBackend) Disconnect(id uint32) {
+	b.mu.Lock()
+	o := b.outputs[id]
+	if o == nil {
+		b.mu.Unlock()
+		return
+	}
+	o.Connected = false
+	o.Enabled = false
+	o.Mode = Mode{}
+	if b.primary == id {
+		b.primary = 0
+	}
+	b.mu.Unlock()
+	b.NotifyHotplug()
+}
+
+func (b *FakeBackend) Output(id uint32) *Output {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	o := b.outputs[id]
+	if o == nil {
+		return nil
+	}
+	return copyOutput(o)
+}
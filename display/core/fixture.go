@@ -0,0 +1,145 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Fixture 描述测试用的输出设备和热插拔等操作序列，从 JSON 文件中加载
+type Fixture struct {
+	// 为 true 时按笔记本的规则猜测内置显示器
+	Laptop bool
+	// 之前保存的内置显示器名称
+	BuiltinMonitor  string
+	DisplayMode     uint8
+	CurrentCustomId string
+	// 初始的显示配置
+	Config Config
+	// 用户保存的显示配置方案
+	Profiles []*DisplayProfile
+	Outputs  []*FixtureOutput
+	Steps    []*FixtureStep
+}
+
+// FixtureOutput 是一个输出设备，EDID 是十六进制的字符串，
+// PreferredMode 是首选模式的 ID，为 0 时使用第一个模式
+type FixtureOutput struct {
+	ID            uint32
+	Name          string
+	EDID          string
+	MmWidth       uint32
+	MmHeight      uint32
+	Connected     bool
+	Modes         []Mode
+	PreferredMode uint32
+}
+
+// 操作的类型
+const (
+	FixtureActionConnect    = "connect"
+	FixtureActionDisconnect = "disconnect"
+	FixtureActionSwitchMode = "switch-mode"
+	FixtureActionSetPrimary = "set-primary"
+	FixtureActionLidClose   = "lid-close"
+	FixtureActionLidOpen    = "lid-open"
+)
+
+// FixtureStep 是一个操作，Output 是输出设备的名称，
+// Mode 和 Name 是 switch-mode 的参数
+type FixtureStep struct {
+	Action string
+	Output string
+	Mode   uint8
+	Name   string
+}
+
+// 输出设备的连接时间从这个时间开始，保证结果是确定的
+var fixtureBaseTime = time.Unix(1500000000, 0)
+
+func LoadFixture(filename string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %v", filename, err)
+	}
+	for _, step := range f.Steps {
+		switch step.Action {
+		case FixtureActionConnect, FixtureActionDisconnect, FixtureActionSetPrimary:
+			if f.GetOutput(step.Output) == nil {
+				return nil, fmt.Errorf("step %s: not found output %q", step.Action, step.Output)
+			}
+		case FixtureActionSwitchMode, FixtureActionLidClose, FixtureActionLidOpen:
+		default:
+			return nil, fmt.Errorf("unknown step action %q", step.Action)
+		}
+	}
+	return &f, nil
+}
+
+func (f *Fixture) GetOutput(name string) *FixtureOutput {
+	for _, fo := range f.Outputs {
+		if fo.Name == name {
+			return fo
+		}
+	}
+	return nil
+}
+
+// index 决定连接时间的先后
+func (fo *FixtureOutput) toOutput(index int) (*Output, error) {
+	edid, err := hex.DecodeString(strings.Join(strings.Fields(fo.EDID), ""))
+	if err != nil {
+		return nil, fmt.Errorf("output %s: invalid edid: %v", fo.Name, err)
+	}
+	manufacturer, model := ParseEDID(edid)
+	o := &Output{
+		ID:           fo.ID,
+		Name:         fo.Name,
+		UUID:         MonitorUUID(fo.Name, edid),
+		Connected:    fo.Connected,
+		Manufacturer: manufacturer,
+		Model:        model,
+		MmWidth:      fo.MmWidth,
+		MmHeight:     fo.MmHeight,
+		Modes:        append([]Mode(nil), fo.Modes...),
+	}
+	if len(fo.Modes) > 0 {
+		o.BestMode = fo.Modes[0]
+	}
+	for _, mode := range fo.Modes {
+		if mode.ID == fo.PreferredMode {
+			o.BestMode = mode
+			break
+		}
+	}
+	if fo.Connected {
+		o.ConnectedTime = fixtureBaseTime.Add(time.Duration(index) * time.Second)
+	}
+	return o, nil
+}
+
+// NewBackend 用所有输出设备的初始状态创建 FakeBackend，Laptop 为 true 时设置内置显示器
+func (f *Fixture) NewBackend() (*FakeBackend, error) {
+	outputs := make([]*Output, len(f.Outputs))
+	for i, fo := range f.Outputs {
+		o, err := fo.toOutput(i)
+		if err != nil {
+			return nil, err
+		}
+		outputs[i] = o
+	}
+	if f.Laptop {
+		if builtin, _ := GuessBuiltinOutput(outputs, f.BuiltinMonitor); builtin != nil {
+			builtin.Builtin = true
+		}
+	}
+	return NewFakeBackend(outputs...), nil
+}
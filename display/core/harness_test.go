@@ -0,0 +1,307 @@
+package core
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// crtcState 是一个输出设备应用布局之后的状态
+type crtcState struct {
+	Name     string
+	Enabled  bool
+	X        int16
+	Y        int16
+	Width    uint16
+	Height   uint16
+	Rate     float64
+	Rotation uint16
+	Reflect  uint16
+	Scale    float64 `json:",omitempty"`
+	Primary  bool
+}
+
+type stepResult struct {
+	Step        string
+	Error       string `json:",omitempty"`
+	DisplayMode uint8
+	Crtcs       []crtcState
+}
+
+type scenarioResult struct {
+	Builtin string
+	Steps   []*stepResult
+	// 最后保存到文件中的配置
+	Config Config
+}
+
+// harness 模拟 display.Manager 中和显示模式相关的逻辑，输出设备由 fixture 提供
+type harness struct {
+	fixture     *Fixture
+	backend     *FakeBackend
+	switcher    *ModeSwitcher
+	lid         *LidHandler
+	config      Config
+	configFile  string
+	versionFile string
+	displayMode uint8
+	customId    string
+	// 热插拔时 applyDisplayMode 返回的错误
+	hotplugErr error
+}
+
+func newHarness(t *testing.T, fixtureFile string) *harness {
+	fixture, err := LoadFixture(fixtureFile)
+	require.NoError(t, err)
+	backend, err := fixture.NewBackend()
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "display-harness")
+	require.NoError(t, err)
+	h := &harness{
+		fixture:     fixture,
+		backend:     backend,
+		configFile:  filepath.Join(dir, "display.json"),
+		versionFile: filepath.Join(dir, "config.version"),
+		displayMode: fixture.DisplayMode,
+		customId:    fixture.CurrentCustomId,
+	}
+	config := fixture.Config
+	if config == nil {
+		config = make(Config)
+	}
+	err = config.Save(h.configFile, h.versionFile, true)
+	require.NoError(t, err)
+	h.config, err = LoadConfig(h.configFile, h.versionFile)
+	require.NoError(t, err)
+
+	h.lid = &LidHandler{
+		Backend:    backend,
+		GetPrimary: h.getPrimary,
+	}
+	h.switcher = &ModeSwitcher{
+		Backend:    backend,
+		GetPrimary: h.getPrimary,
+		SaveConfig: func() error {
+			return h.config.Save(h.configFile, h.versionFile, true)
+		},
+		FixConfigs: h.lid.FixConfigs,
+	}
+	_, err = h.lid.SetPolicy(LidPolicyDisableBuiltin)
+	require.NoError(t, err)
+	backend.SubscribeHotplug(func() {
+		h.hotplugErr = h.applyDisplayMode()
+		// 和 Manager 相同，盖子合上时热插拔之后再次禁用内置显示器
+		if h.hotplugErr == nil {
+			_, h.hotplugErr = h.lid.HandleHotplug()
+		}
+	})
+	return h
+}
+
+func (h *harness) cleanup() {
+	_ = os.RemoveAll(filepath.Dir(h.configFile))
+}
+
+func (h *harness) getPrimary() string {
+	if o := h.backend.Output(h.backend.Primary()); o != nil {
+		return o.Name
+	}
+	return ""
+}
+
+func (h *harness) getScreenConfig() *ScreenConfig {
+	outputs, _ := h.backend.ListOutputs()
+	var uuids []string
+	for _, o := range ConnectedOutputs(outputs) {
+		uuids = append(uuids, o.UUID)
+	}
+	return getScreenConfig(h.config, GetMonitorsId(uuids))
+}
+
+func (h *harness) switchMode(mode uint8, name string) error {
+	screenCfg := h.getScreenConfig()
+	var err error
+	switch mode {
+	case DisplayModeMirror:
+		err = h.switcher.SwitchModeMirror(screenCfg)
+	case DisplayModeExtend:
+		err = h.switcher.SwitchModeExtend(screenCfg)
+	case DisplayModeOnlyOne:
+		err = h.switcher.SwitchModeOnlyOne(screenCfg, name)
+	case DisplayModeCustom:
+		_, err = h.switcher.SwitchModeCustom(screenCfg, name)
+		if err == nil {
+			h.customId = name
+		}
+	default:
+		err = fmt.Errorf("invalid mode %d", mode)
+	}
+	if err == nil {
+		h.displayMode = mode
+	}
+	return err
+}
+
+// 和 Manager.applyDisplayMode 相同，套用方案或者相似布局时的错误也记录在结果中
+func (h *harness) applyDisplayMode() error {
+	result, err := h.switcher.ApplyDisplayMode(h.config, h.fixture.Profiles, h.displayMode, h.customId)
+	if err != nil {
+		return err
+	}
+	h.displayMode = result.Mode
+	h.customId = result.CustomId
+	return result.FallbackErr
+}
+
+func (h *harness) connect(name string, index int) {
+	fo := h.fixture.GetOutput(name)
+	o := h.backend.Output(fo.ID)
+	// 比初始的输出设备连接得晚
+	o.ConnectedTime = fixtureBaseTime.Add(time.Duration(len(h.fixture.Outputs)+index) * time.Second)
+	h.backend.Connect(o)
+}
+
+func (h *harness) runStep(index int, step *FixtureStep) error {
+	h.hotplugErr = nil
+	switch step.Action {
+	case FixtureActionConnect:
+		h.connect(step.Output, index)
+		return h.hotplugErr
+	case FixtureActionDisconnect:
+		h.backend.Disconnect(h.fixture.GetOutput(step.Output).ID)
+		return h.hotplugErr
+	case FixtureActionSwitchMode:
+		// 和 Manager 相同，用户切换模式之后按盖子的状态重新应用策略
+		err := h.switchMode(step.Mode, step.Name)
+		if err != nil {
+			return err
+		}
+		_, err = h.lid.HandleModeSwitched()
+		return err
+	case FixtureActionSetPrimary:
+		err := h.switcher.SetPrimary(h.getScreenConfig(), h.displayMode, h.customId, step.Output)
+		if err != nil {
+			return err
+		}
+		_, err = h.lid.HandleLayoutEdited()
+		return err
+	case FixtureActionLidClose, FixtureActionLidOpen:
+		closed := step.Action == FixtureActionLidClose
+		_, err := h.lid.HandleLidChanged(closed)
+		if err != nil && !closed {
+			// 不能恢复合上之前的布局时按配置重新应用
+			return h.applyDisplayMode()
+		}
+		return err
+	}
+	return fmt.Errorf("unknown step action %q", step.Action)
+}
+
+func (h *harness) crtcStates() []crtcState {
+	outputs, _ := h.backend.ListOutputs()
+	primary := h.backend.Primary()
+	var result []crtcState
+	for _, o := range ConnectedOutputs(outputs) {
+		width, height := o.size()
+		result = append(result, crtcState{
+			Name:     o.Name,
+			Enabled:  o.Enabled,
+			X:        o.X,
+			Y:        o.Y,
+			Width:    width,
+			Height:   height,
+			Rate:     o.Mode.Rate,
+			Rotation: o.Rotation,
+			Reflect:  o.Reflect,
+			Scale:    o.Scale,
+			Primary:  o.ID == primary,
+		})
+	}
+	return result
+}
+
+func stepName(step *FixtureStep) string {
+	parts := []string{step.Action}
+	if step.Output != "" {
+		parts = append(parts, step.Output)
+	}
+	if step.Action == FixtureActionSwitchMode {
+		parts = append(parts, fmt.Sprint(step.Mode))
+		if step.Name != "" {
+			parts = append(parts, step.Name)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (h *harness) run(t *testing.T) *scenarioResult {
+	result := &scenarioResult{}
+	outputs, err := h.backend.ListOutputs()
+	require.NoError(t, err)
+	for _, o := range outputs {
+		if o.Builtin {
+			result.Builtin = o.Name
+		}
+	}
+
+	addResult := func(name string, err error) {
+		r := &stepResult{
+			Step:        name,
+			DisplayMode: h.displayMode,
+			Crtcs:       h.crtcStates(),
+		}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		result.Steps = append(result.Steps, r)
+	}
+
+	addResult("init", h.applyDisplayMode())
+	for i, step := range h.fixture.Steps {
+		addResult(stepName(step), h.runStep(i, step))
+	}
+
+	// 从文件中重新加载，检查保存的配置
+	result.Config, err = LoadConfig(h.configFile, h.versionFile)
+	require.NoError(t, err)
+	return result
+}
+
+func TestScenarios(t *testing.T) {
+	files, err := filepath.Glob("testdata/scenarios/*.fixture.json")
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".fixture.json")
+		t.Run(name, func(t *testing.T) {
+			h := newHarness(t, file)
+			defer h.cleanup()
+			result := h.run(t)
+
+			data, err := json.MarshalIndent(result, "", "  ")
+			require.NoError(t, err)
+			data = append(data, '\n')
+			goldenFile := filepath.Join("testdata", "scenarios", name+".golden.json")
+			if *update {
+				err = ioutil.WriteFile(goldenFile, data, 0644)
+				require.NoError(t, err)
+			}
+			expected, err := ioutil.ReadFile(goldenFile)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(data))
+		})
+	}
+}
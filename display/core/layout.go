@@ -0,0 +1,376 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"strings"
+)
+
+const (
+	priorityEDP = iota
+	priorityDP
+	priorityHDMI
+	priorityDVI
+	priorityVGA
+	priorityOther
+)
+
+var monitorPriority = map[string]int{
+	"edp":  priorityEDP,
+	"dp":   priorityDP,
+	"hdmi": priorityHDMI,
+	"dvi":  priorityDVI,
+	"vga":  priorityVGA,
+}
+
+// ConnectedOutputs 返回已连接的输出设备，保持原来的顺序
+func ConnectedOutputs(outputs []*Output) []*Output {
+	var result []*Output
+	for _, o := range outputs {
+		if o.Connected {
+			result = append(result, o)
+		}
+	}
+	return result
+}
+
+func GetOutputByName(outputs []*Output, name string) *Output {
+	for _, o := range outputs {
+		if o.Name == name {
+			return o
+		}
+	}
+	return nil
+}
+
+func getOutputByUuid(outputs []*Output, uuid string) *Output {
+	for _, o := range outputs {
+		if o.UUID == uuid {
+			return o
+		}
+	}
+	return nil
+}
+
+func getFirstModeBySize(modes []Mode, width, height uint16) Mode {
+	for _, mode := range modes {
+		if mode.Width == width && mode.Height == height {
+			return mode
+		}
+	}
+	return Mode{}
+}
+
+func getFirstModeBySizeRate(modes []Mode, width, height uint16, rate float64) Mode {
+	for _, mode := range modes {
+		if mode.Width == width && mode.Height == height &&
+			math.Abs(mode.Rate-rate) <= 0.01 {
+			return mode
+		}
+	}
+	return Mode{}
+}
+
+// SelectMode 优先选择大小和刷新率都相同的模式，其次是大小相同的，都没有时使用最佳模式
+func SelectMode(o *Output, width, height uint16, rate float64) Mode {
+	mode := getFirstModeBySizeRate(o.Modes, width, height, rate)
+	if mode.ID != 0 {
+		return mode
+	}
+	mode = getFirstModeBySize(o.Modes, width, height)
+	if mode.ID != 0 {
+		return mode
+	}
+	return o.BestMode
+}
+
+type size struct {
+	width  uint16
+	height uint16
+}
+
+// 所有输出设备都支持的面积最大的大小
+func getMaxCommonSize(outputs []*Output) (size, bool) {
+	count := make(map[size]int)
+	for _, o := range outputs {
+		sizes := make(map[size]struct{})
+		for _, mode := range o.Modes {
+			sizes[size{mode.Width, mode.Height}] = struct{}{}
+		}
+		for s := range sizes {
+			count[s]++
+		}
+	}
+
+	var maxS size
+	found := false
+	for s, n := range count {
+		if n != len(outputs) {
+			continue
+		}
+		area := int(s.width) * int(s.height)
+		maxArea := int(maxS.width) * int(maxS.height)
+		// 面积相同时比较宽度，保证结果稳定
+		if !found || area > maxArea || (area == maxArea && s.width > maxS.width) {
+			maxS = s
+			found = true
+		}
+	}
+	return maxS, found
+}
+
+func getPortType(name string) string {
+	i := strings.IndexRune(name, '-')
+	if i != -1 {
+		name = name[:i]
+	}
+	return strings.ToLower(name)
+}
+
+func getPriorOutput(outputs []*Output, currentPrimary string) *Output {
+	var result *Output
+	priority := priorityOther
+	for _, o := range outputs {
+		p, ok := monitorPriority[getPortType(o.Name)]
+
+		// 不在列表中的话，留空，以便最后通过连接时间来设置主屏幕
+		if !ok {
+			continue
+		}
+
+		if p < priority {
+			result = o
+			priority = p
+			continue
+		}
+
+		// 当接口类型相同，若一个是默认显示器，继续让它作为默认显示器
+		if p == priority && currentPrimary == o.Name {
+			result = o
+		}
+	}
+	return result
+}
+
+// 获取最早连接的显示器
+func getMinConnectedTimeOutput(outputs []*Output) *Output {
+	if len(outputs) == 0 {
+		return nil
+	}
+	result := outputs[0]
+	for _, o := range outputs[1:] {
+		if result.ConnectedTime.After(o.ConnectedTime) {
+			result = o
+		}
+	}
+	return result
+}
+
+func getMinIDOutput(outputs []*Output) *Output {
+	if len(outputs) == 0 {
+		return nil
+	}
+	result := outputs[0]
+	for _, o := range outputs[1:] {
+		if result.ID > o.ID {
+			result = o
+		}
+	}
+	return result
+}
+
+// DefaultPrimary 选择默认的主屏幕：内置显示器优先，其次按接口类型，最后是最早连接的
+func DefaultPrimary(outputs []*Output, currentPrimary string) *Output {
+	outputs = ConnectedOutputs(outputs)
+	if len(outputs) == 0 {
+		return nil
+	}
+	for _, o := range outputs {
+		if o.Builtin {
+			return o
+		}
+	}
+	if o := getPriorOutput(outputs, currentPrimary); o != nil {
+		return o
+	}
+	return getMinConnectedTimeOutput(outputs)
+}
+
+// ExtendLayout 按 outputs 的顺序从左到右排列所有已连接的输出设备，
+// configs 中有的使用保存的模式，并且其中的主屏幕优先
+func ExtendLayout(outputs []*Output, configs []*MonitorConfig, currentPrimary string) *Layout {
+	layout := &Layout{}
+	var xOffset int
+	var primary *Output
+	for _, o := range ConnectedOutputs(outputs) {
+		cfg := GetMonitorConfigByUuid(configs, o.UUID)
+		var mode Mode
+		var scale float64
+		if cfg != nil {
+			mode = SelectMode(o, cfg.Width, cfg.Height, cfg.RefreshRate)
+			scale = cfg.Scale
+			if primary == nil && cfg.Primary {
+				primary = o
+			}
+		} else {
+			mode = o.BestMode
+		}
+
+		if xOffset > math.MaxInt16 {
+			xOffset = math.MaxInt16
+		}
+		layout.Outputs = append(layout.Outputs, OutputConfig{
+			ID:       o.ID,
+			Enabled:  true,
+			X:        int16(xOffset),
+			Mode:     mode,
+			Rotation: RotationRotate0,
+			Scale:    scale,
+		})
+		width, _ := ScaledSize(mode.Width, mode.Height, scale)
+		xOffset += int(width)
+	}
+
+	if primary == nil {
+		primary = DefaultPrimary(outputs, currentPrimary)
+	}
+	if primary != nil {
+		layout.Primary = primary.ID
+	}
+	return layout
+}
+
+// MirrorLayout 让所有已连接的输出设备显示相同的内容，没有保存的模式时使用共同的最大分辨率
+func MirrorLayout(outputs []*Output, configs []*MonitorConfig, currentPrimary string) (*Layout, error) {
+	connected := ConnectedOutputs(outputs)
+	maxSize, ok := getMaxCommonSize(connected)
+	if !ok {
+		return nil, errors.New("not found common size")
+	}
+
+	layout := &Layout{}
+	for _, o := range connected {
+		cfg := GetMonitorConfigByUuid(configs, o.UUID)
+		var mode Mode
+		if cfg != nil {
+			mode = SelectMode(o, cfg.Width, cfg.Height, cfg.RefreshRate)
+		} else {
+			mode = getFirstModeBySize(o.Modes, maxSize.width, maxSize.height)
+		}
+		layout.Outputs = append(layout.Outputs, OutputConfig{
+			ID:       o.ID,
+			Enabled:  true,
+			Mode:     mode,
+			Rotation: RotationRotate0,
+		})
+	}
+
+	primary := DefaultPrimary(outputs, currentPrimary)
+	if primary != nil {
+		layout.Primary = primary.ID
+	}
+	return layout, nil
+}
+
+// OnlyOneLayout 只启用 o，其他输出设备都被禁用
+func OnlyOneLayout(o *Output, configs []*MonitorConfig) *Layout {
+	cfg := GetMonitorConfigByUuid(configs, o.UUID)
+	var mode Mode
+	rotation := RotationRotate0
+	var reflect uint16
+	var scale float64
+	if cfg != nil {
+		mode = SelectMode(o, cfg.Width, cfg.Height, cfg.RefreshRate)
+		rotation = cfg.Rotation
+		reflect = cfg.Reflect
+		scale = cfg.Scale
+	} else {
+		mode = o.BestMode
+	}
+	return &Layout{
+		Outputs: []OutputConfig{{
+			ID:       o.ID,
+			Enabled:  true,
+			Mode:     mode,
+			Rotation: rotation,
+			Reflect:  reflect,
+			Scale:    scale,
+		}},
+		Primary: o.ID,
+	}
+}
+
+// ConfigsLayout 按保存的配置生成布局，配置中没有的输出设备被禁用
+func ConfigsLayout(outputs []*Output, configs []*MonitorConfig, currentPrimary string) *Layout {
+	layout := &Layout{}
+	var enabledOutputs []*Output
+	for _, o := range ConnectedOutputs(outputs) {
+		cfg := GetMonitorConfigByUuid(configs, o.UUID)
+		if cfg == nil || !cfg.Enabled {
+			continue
+		}
+		enabledOutputs = append(enabledOutputs, o)
+		if cfg.Primary && layout.Primary == 0 {
+			layout.Primary = o.ID
+		}
+
+		// 配置中是旋转之后的大小
+		width, height := cfg.Width, cfg.Height
+		if NeedSwapWidthHeight(cfg.Rotation) {
+			width, height = height, width
+		}
+		layout.Outputs = append(layout.Outputs, OutputConfig{
+			ID:       o.ID,
+			Enabled:  true,
+			X:        cfg.X,
+			Y:        cfg.Y,
+			Mode:     SelectMode(o, width, height, cfg.RefreshRate),
+			Rotation: cfg.Rotation,
+			Reflect:  cfg.Reflect,
+			Scale:    cfg.Scale,
+		})
+	}
+
+	if layout.Primary == 0 {
+		// 主屏幕只能是启用的
+		primary := DefaultPrimary(enabledOutputs, currentPrimary)
+		if primary != nil {
+			layout.Primary = primary.ID
+		}
+	}
+	return layout
+}
+
+// OutputToConfig 保存输出设备的当前状态，Width 和 Height 是模式旋转之后的大小，不受缩放影响
+func OutputToConfig(o *Output) *MonitorConfig {
+	width, height := o.size()
+	return &MonitorConfig{
+		UUID:        o.UUID,
+		Name:        o.Name,
+		Enabled:     o.Enabled,
+		X:           o.X,
+		Y:           o.Y,
+		Width:       width,
+		Height:      height,
+		Rotation:    o.Rotation,
+		Reflect:     o.Reflect,
+		RefreshRate: o.Mode.Rate,
+		Scale:       o.Scale,
+	}
+}
+
+// ToMonitorConfigs 保存所有已连接输出设备的当前状态，名称为 primary 的是主屏幕
+func ToMonitorConfigs(outputs []*Output, primary string) []*MonitorConfig {
+	connected := ConnectedOutputs(outputs)
+	found := false
+	result := make([]*MonitorConfig, len(connected))
+	for i, o := range connected {
+		cfg := OutputToConfig(o)
+		if !found && o.Name == primary {
+			cfg.Primary = true
+			found = true
+		}
+		result[i] = cfg
+	}
+	return result
+}
@@ -0,0 +1,233 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 和 Monitor.SetScale 允许的范围相同，0 表示不缩放
+const (
+	minLayoutScale = 0.5
+	maxLayoutScale = 3
+)
+
+// LayoutFile 是 display-layout 命令读写的布局文件，显示器的设置和 display.json 中的相同。
+// 显示器按 UUID 匹配，UUID 为空时按接口名称匹配，一个文件可以包含多台机器的显示器。
+type LayoutFile struct {
+	Monitors []*MonitorConfig
+}
+
+// ParseLayoutFile 解析 JSON 格式的布局文件并检查，不允许未知的字段，避免写错的字段被忽略
+func ParseLayoutFile(data []byte) (*LayoutFile, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var f LayoutFile
+	err := dec.Decode(&f)
+	if err != nil {
+		return nil, err
+	}
+	err = f.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// CurrentLayoutFile 返回已连接输出设备的当前布局，名称为 primary 的是主屏幕
+func CurrentLayoutFile(outputs []*Output, primary string) *LayoutFile {
+	return &LayoutFile{Monitors: ToMonitorConfigs(outputs, primary)}
+}
+
+func isValidRotation(rotation uint16) bool {
+	switch rotation {
+	case RotationRotate0, RotationRotate90, RotationRotate180, RotationRotate270:
+		return true
+	}
+	return false
+}
+
+func monitorConfigName(cfg *MonitorConfig) string {
+	if cfg.Name != "" {
+		return cfg.Name
+	}
+	return cfg.UUID
+}
+
+// Validate 检查和输出设备无关的错误
+func (f *LayoutFile) Validate() error {
+	if len(f.Monitors) == 0 {
+		return errors.New("no monitors in layout")
+	}
+	uuids := make(map[string]bool)
+	names := make(map[string]bool)
+	var enabled, primary int
+	for i, cfg := range f.Monitors {
+		if cfg == nil || (cfg.UUID == "" && cfg.Name == "") {
+			return fmt.Errorf("monitor %d has neither UUID nor Name", i)
+		}
+		name := monitorConfigName(cfg)
+		// Resolve 只应用布局，输出属性和自定义模式仍然在控制中心中设置，不允许写了却不生效
+		if !cfg.OutputProps.isZero() {
+			return fmt.Errorf("monitor %s: MaxBpc, BroadcastRGB and CustomModes are not supported in layout files", name)
+		}
+		if cfg.UUID != "" {
+			if uuids[cfg.UUID] {
+				return fmt.Errorf("duplicate monitor UUID %q", cfg.UUID)
+			}
+			uuids[cfg.UUID] = true
+		} else {
+			if names[cfg.Name] {
+				return fmt.Errorf("duplicate monitor name %q", cfg.Name)
+			}
+			names[cfg.Name] = true
+		}
+		if !cfg.Enabled {
+			continue
+		}
+		enabled++
+		if cfg.Primary {
+			primary++
+		}
+		if cfg.Width == 0 || cfg.Height == 0 {
+			return fmt.Errorf("monitor %s has no size", name)
+		}
+		// 旋转可以省略
+		if cfg.Rotation != 0 && !isValidRotation(cfg.Rotation) {
+			return fmt.Errorf("monitor %s has invalid rotation %d", name, cfg.Rotation)
+		}
+		if cfg.Reflect&^(ReflectX|ReflectY) != 0 {
+			return fmt.Errorf("monitor %s has invalid reflect %d", name, cfg.Reflect)
+		}
+		if cfg.Scale != 0 && (cfg.Scale < minLayoutScale || cfg.Scale > maxLayoutScale) {
+			return fmt.Errorf("monitor %s has invalid scale %v", name, cfg.Scale)
+		}
+	}
+	if enabled == 0 {
+		return errors.New("no monitors enabled in layout")
+	}
+	if primary > 1 {
+		return errors.New("more than one primary monitor in layout")
+	}
+	return nil
+}
+
+// 优先按 UUID 匹配，配置中有 UUID 时不再按名称匹配
+func (f *LayoutFile) getConfig(o *Output) *MonitorConfig {
+	for _, cfg := range f.Monitors {
+		if cfg.UUID != "" && cfg.UUID == o.UUID {
+			return cfg
+		}
+	}
+	for _, cfg := range f.Monitors {
+		if cfg.UUID == "" && cfg.Name == o.Name {
+			return cfg
+		}
+	}
+	return nil
+}
+
+type rect struct {
+	x, y          int
+	width, height int
+}
+
+func (a rect) overlaps(b rect) bool {
+	return a.x < b.x+b.width && b.x < a.x+a.width &&
+		a.y < b.y+b.height && b.y < a.y+a.height
+}
+
+// Resolve 把布局文件对应到已连接的输出设备上，返回要应用的布局。
+// 文件中没有的输出设备被禁用，没有连接的显示器的设置被忽略。
+// 模式必须和文件中的大小相同，刷新率为 0 时使用该大小的第一个模式；
+// 启用的显示器不能重叠，位置和大小都相同的除外，即复制。
+func (f *LayoutFile) Resolve(outputs []*Output) (*Layout, error) {
+	err := f.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &Layout{}
+	var enabledOutputs []*Output
+	var rects []rect
+	for _, o := range ConnectedOutputs(outputs) {
+		cfg := f.getConfig(o)
+		if cfg == nil || !cfg.Enabled {
+			continue
+		}
+
+		rotation := cfg.Rotation
+		if rotation == 0 {
+			rotation = RotationRotate0
+		}
+		width, height := cfg.Width, cfg.Height
+		if NeedSwapWidthHeight(rotation) {
+			width, height = height, width
+		}
+		var mode Mode
+		if cfg.RefreshRate == 0 {
+			mode = getFirstModeBySize(o.Modes, width, height)
+		} else {
+			mode = getFirstModeBySizeRate(o.Modes, width, height, cfg.RefreshRate)
+		}
+		if mode.ID == 0 {
+			return nil, fmt.Errorf("monitor %s has no mode %dx%d@%.2f", o.Name, width, height, cfg.RefreshRate)
+		}
+
+		w, h := ScaledSize(cfg.Width, cfg.Height, cfg.Scale)
+		r := rect{x: int(cfg.X), y: int(cfg.Y), width: int(w), height: int(h)}
+		for i, other := range rects {
+			if r != other && r.overlaps(other) {
+				return nil, fmt.Errorf("monitor %s overlaps %s", o.Name, enabledOutputs[i].Name)
+			}
+		}
+		rects = append(rects, r)
+		enabledOutputs = append(enabledOutputs, o)
+
+		if cfg.Primary {
+			layout.Primary = o.ID
+		}
+		layout.Outputs = append(layout.Outputs, OutputConfig{
+			ID:       o.ID,
+			Enabled:  true,
+			X:        cfg.X,
+			Y:        cfg.Y,
+			Mode:     mode,
+			Rotation: rotation,
+			Reflect:  cfg.Reflect,
+			Scale:    cfg.Scale,
+		})
+	}
+	if len(enabledOutputs) == 0 {
+		return nil, errors.New("no monitors in layout are connected")
+	}
+
+	if layout.Primary == 0 {
+		layout.Primary = DefaultPrimary(enabledOutputs, "").ID
+	}
+	return layout, nil
+}
+
+// ToLayoutFile 返回已连接的输出设备应用 l 之后的布局，用于预览
+func (l *Layout) ToLayoutFile(outputs []*Output) *LayoutFile {
+	f := &LayoutFile{}
+	for _, o := range ConnectedOutputs(outputs) {
+		out := *o
+		cfg := l.Get(o.ID)
+		if cfg == nil || !cfg.Enabled {
+			out.Enabled = false
+		} else {
+			out.Enabled = true
+			out.X, out.Y = cfg.X, cfg.Y
+			out.Mode = cfg.Mode
+			out.Rotation = cfg.Rotation
+			out.Reflect = cfg.Reflect
+			out.Scale = cfg.Scale
+		}
+		mc := OutputToConfig(&out)
+		mc.Primary = out.Enabled && o.ID == l.Primary
+		f.Monitors = append(f.Monitors, mc)
+	}
+	return f
+}
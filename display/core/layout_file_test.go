@@ -0,0 +1,128 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLayoutFile(t *testing.T) {
+	f, err := ParseLayoutFile([]byte(`{"Monitors": [
+		{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080, "Primary": true},
+		{"UUID": "eDP-1bbbb", "Enabled": false}
+	]}`))
+	require.NoError(t, err)
+	assert.Len(t, f.Monitors, 2)
+
+	for _, data := range []string{
+		`{"Monitors": []}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Widht": 1920, "Height": 1080}]}`,
+		`{"Monitors": [{"Enabled": true, "Width": 1920, "Height": 1080}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": false}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080, "Rotation": 3}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080, "Reflect": 1}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080, "Scale": 5}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080},
+			{"Name": "HDMI-1", "Enabled": false}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080, "Primary": true},
+			{"Name": "eDP-1", "Enabled": true, "Width": 1920, "Height": 1080, "Primary": true}]}`,
+		// 不支持输出属性
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080, "MaxBpc": 8}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": false, "BroadcastRGB": "Full"}]}`,
+		`{"Monitors": [{"Name": "HDMI-1", "Enabled": true, "Width": 1920, "Height": 1080,
+			"CustomModes": [{"Width": 1920, "Height": 1080, "Rate": 75}]}]}`,
+	} {
+		_, err = ParseLayoutFile([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestLayoutFile_Resolve(t *testing.T) {
+	outputs := newTestOutputs()
+	f := &LayoutFile{Monitors: []*MonitorConfig{
+		{UUID: "eDP-1bbbb", Enabled: true, X: 0, Y: 0, Width: 768, Height: 1366,
+			Rotation: RotationRotate90},
+		// UUID 优先，名称相同但 UUID 不同的不匹配
+		{UUID: "HDMI-1cccc", Name: "HDMI-1", Enabled: false},
+		{Name: "HDMI-1", Enabled: true, X: 768, Y: 0, Width: 1920, Height: 1080, RefreshRate: 50,
+			Primary: true},
+		// 没有连接，忽略
+		{Name: "DP-2", Enabled: true, Width: 1920, Height: 1080},
+	}}
+	layout, err := f.Resolve(outputs)
+	require.NoError(t, err)
+	assert.Equal(t, &Layout{
+		Outputs: []OutputConfig{
+			{ID: 66, Enabled: true, Mode: mode768p60, Rotation: RotationRotate90},
+			{ID: 70, Enabled: true, X: 768, Mode: mode1080p50, Rotation: RotationRotate0},
+		},
+		Primary: 70,
+	}, layout)
+
+	preview := layout.ToLayoutFile(outputs)
+	require.Len(t, preview.Monitors, 2)
+	assert.Equal(t, uint16(768), preview.Monitors[0].Width)
+	assert.Equal(t, uint16(1366), preview.Monitors[0].Height)
+	assert.False(t, preview.Monitors[0].Primary)
+	assert.True(t, preview.Monitors[1].Primary)
+	assert.Equal(t, 50.0, preview.Monitors[1].RefreshRate)
+
+	// 复制，没有设置主屏幕时使用默认的
+	f = &LayoutFile{Monitors: []*MonitorConfig{
+		{Name: "eDP-1", Enabled: true, Width: 1920, Height: 1080},
+		{Name: "HDMI-1", Enabled: true, Width: 1920, Height: 1080, RefreshRate: 60},
+	}}
+	layout, err = f.Resolve(outputs)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(66), layout.Primary)
+	assert.Len(t, layout.Outputs, 2)
+
+	// 文件中没有的输出设备被禁用
+	f = &LayoutFile{Monitors: []*MonitorConfig{
+		{Name: "HDMI-1", Enabled: true, Width: 1280, Height: 1024},
+	}}
+	layout, err = f.Resolve(outputs)
+	require.NoError(t, err)
+	assert.Nil(t, layout.Get(66))
+	preview = layout.ToLayoutFile(outputs)
+	assert.False(t, preview.Monitors[0].Enabled)
+	assert.True(t, preview.Monitors[1].Enabled)
+
+	backend := NewFakeBackend(outputs...)
+	require.NoError(t, backend.ApplyLayout(layout))
+	current, err := backend.ListOutputs()
+	require.NoError(t, err)
+	// 预览和应用之后的布局相同
+	assert.Equal(t, preview.Monitors[1], CurrentLayoutFile(current, "HDMI-1").Monitors[1])
+}
+
+func TestLayoutFile_ResolveError(t *testing.T) {
+	outputs := newTestOutputs()
+	for _, monitors := range [][]*MonitorConfig{
+		// 没有这个模式
+		{{Name: "HDMI-1", Enabled: true, Width: 1920, Height: 1080, RefreshRate: 75}},
+		{{Name: "eDP-1", Enabled: true, Width: 1280, Height: 1024}},
+		// 重叠
+		{
+			{Name: "eDP-1", Enabled: true, Width: 1366, Height: 768},
+			{Name: "HDMI-1", Enabled: true, X: 1000, Width: 1920, Height: 1080},
+		},
+		// 都没有连接
+		{{Name: "DP-2", Enabled: true, Width: 1920, Height: 1080}},
+		{{Name: "VGA-1", Enabled: true, Width: 1920, Height: 1080}},
+	} {
+		f := &LayoutFile{Monitors: monitors}
+		_, err := f.Resolve(outputs)
+		assert.Error(t, err)
+	}
+
+	// 缩放之后不重叠
+	f := &LayoutFile{Monitors: []*MonitorConfig{
+		{Name: "eDP-1", Enabled: true, Width: 1920, Height: 1080, Scale: 2},
+		{Name: "HDMI-1", Enabled: true, X: 960, Width: 1920, Height: 1080},
+	}}
+	_, err := f.Resolve(outputs)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,172 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	mode1080p60 = Mode{ID: 1, Width: 1920, Height: 1080, Rate: 60}
+	mode1080p50 = Mode{ID: 2, Width: 1920, Height: 1080, Rate: 50}
+	mode768p60  = Mode{ID: 3, Width: 1366, Height: 768, Rate: 60}
+	mode1024p60 = Mode{ID: 4, Width: 1280, Height: 1024, Rate: 60}
+)
+
+func newTestOutputs() []*Output {
+	t0 := time.Unix(1000, 0)
+	return []*Output{
+		{
+			ID:            66,
+			Name:          "eDP-1",
+			UUID:          "eDP-1bbbb",
+			Connected:     true,
+			Builtin:       true,
+			ConnectedTime: t0,
+			Modes:         []Mode{mode1080p60, mode768p60},
+			BestMode:      mode768p60,
+		},
+		{
+			ID:            70,
+			Name:          "HDMI-1",
+			UUID:          "HDMI-1aaaa",
+			Connected:     true,
+			ConnectedTime: t0.Add(time.Second),
+			Modes:         []Mode{mode1080p60, mode1080p50, mode1024p60},
+			BestMode:      mode1080p60,
+		},
+		{
+			ID:   80,
+			Name: "VGA-1",
+			UUID: "VGA-1",
+		},
+	}
+}
+
+func TestSelectMode(t *testing.T) {
+	o := newTestOutputs()[1]
+	assert.Equal(t, mode1080p50, SelectMode(o, 1920, 1080, 50.005))
+	assert.Equal(t, mode1080p60, SelectMode(o, 1920, 1080, 75))
+	assert.Equal(t, mode1080p60, SelectMode(o, 800, 600, 60))
+}
+
+func TestDefaultPrimary(t *testing.T) {
+	outputs := newTestOutputs()
+	assert.Equal(t, "eDP-1", DefaultPrimary(outputs, "").Name)
+
+	// 没有内置显示器时按接口类型选择
+	outputs[0].Builtin = false
+	outputs[0].Name = "DP-1"
+	assert.Equal(t, "DP-1", DefaultPrimary(outputs, "").Name)
+
+	// 接口类型相同时保持当前的主屏幕
+	outputs[1].Name = "DP-2"
+	assert.Equal(t, "DP-1", DefaultPrimary(outputs, "").Name)
+	assert.Equal(t, "DP-2", DefaultPrimary(outputs, "DP-2").Name)
+
+	// 接口类型未知时使用最早连接的
+	outputs[1].Name = "X-1"
+	outputs[0].Name = "X-2"
+	assert.Equal(t, "X-2", DefaultPrimary(outputs, "").Name)
+
+	assert.Nil(t, DefaultPrimary(outputs[2:], ""))
+}
+
+func TestExtendLayout(t *testing.T) {
+	outputs := newTestOutputs()
+	layout := ExtendLayout(outputs, nil, "")
+	assert.Equal(t, &Layout{
+		Outputs: []OutputConfig{
+			{ID: 66, Enabled: true, X: 0, Mode: mode768p60, Rotation: RotationRotate0},
+			{ID: 70, Enabled: true, X: 1366, Mode: mode1080p60, Rotation: RotationRotate0},
+		},
+		Primary: 66,
+	}, layout)
+
+	configs := []*MonitorConfig{
+		{UUID: "HDMI-1aaaa", Width: 1280, Height: 1024, RefreshRate: 60, Primary: true},
+	}
+	layout = ExtendLayout(outputs, configs, "")
+	assert.Equal(t, uint32(70), layout.Primary)
+	assert.Equal(t, mode1024p60, layout.Get(70).Mode)
+	assert.Equal(t, int16(1366), layout.Get(70).X)
+
+	// 缩放之后占用的区域变小
+	configs = append(configs, &MonitorConfig{UUID: "eDP-1bbbb", Width: 1920, Height: 1080,
+		RefreshRate: 60, Scale: 1.5})
+	layout = ExtendLayout(outputs, configs, "")
+	assert.Equal(t, 1.5, layout.Get(66).Scale)
+	assert.Equal(t, int16(1280), layout.Get(70).X)
+}
+
+func TestScaledSize(t *testing.T) {
+	w, h := ScaledSize(1920, 1080, 1.25)
+	assert.Equal(t, uint16(1536), w)
+	assert.Equal(t, uint16(864), h)
+	w, h = ScaledSize(1366, 768, 0)
+	assert.Equal(t, uint16(1366), w)
+	assert.Equal(t, uint16(768), h)
+}
+
+func TestMirrorLayout(t *testing.T) {
+	outputs := newTestOutputs()
+	layout, err := MirrorLayout(outputs, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, &Layout{
+		Outputs: []OutputConfig{
+			{ID: 66, Enabled: true, Mode: mode1080p60, Rotation: RotationRotate0},
+			{ID: 70, Enabled: true, Mode: mode1080p60, Rotation: RotationRotate0},
+		},
+		Primary: 66,
+	}, layout)
+
+	outputs[1].Modes = []Mode{mode1024p60}
+	_, err = MirrorLayout(outputs, nil, "")
+	assert.Error(t, err)
+}
+
+func TestConfigsLayout(t *testing.T) {
+	outputs := newTestOutputs()
+	configs := []*MonitorConfig{
+		{UUID: "eDP-1bbbb", Enabled: true, Width: 768, Height: 1366, RefreshRate: 60,
+			Rotation: RotationRotate90},
+		{UUID: "HDMI-1aaaa", Enabled: true, X: 768, Width: 1920, Height: 1080,
+			RefreshRate: 50, Rotation: RotationRotate0, Primary: true},
+		{UUID: "VGA-1", Enabled: true},
+	}
+	layout := ConfigsLayout(outputs, configs, "")
+	assert.Equal(t, &Layout{
+		Outputs: []OutputConfig{
+			{ID: 66, Enabled: true, Mode: mode768p60, Rotation: RotationRotate90},
+			{ID: 70, Enabled: true, X: 768, Mode: mode1080p50, Rotation: RotationRotate0},
+		},
+		Primary: 70,
+	}, layout)
+
+	configs[1].Enabled = false
+	layout = ConfigsLayout(outputs, configs, "")
+	assert.Len(t, layout.Outputs, 1)
+	assert.Equal(t, uint32(66), layout.Primary)
+}
+
+func TestToMonitorConfigs(t *testing.T) {
+	outputs := newTestOutputs()
+	outputs[0].Enabled = true
+	outputs[0].Mode = mode768p60
+	outputs[0].Rotation = RotationRotate270
+	configs := ToMonitorConfigs(outputs, "eDP-1")
+	require.Len(t, configs, 2)
+	assert.Equal(t, &MonitorConfig{
+		UUID:        "eDP-1bbbb",
+		Name:        "eDP-1",
+		Enabled:     true,
+		Width:       768,
+		Height:      1366,
+		Rotation:    RotationRotate270,
+		RefreshRate: 60,
+		Primary:     true,
+	}, configs[0])
+	assert.False(t, configs[1].Primary)
+}
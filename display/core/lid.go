@@ -0,0 +1,367 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+
+	"pkg.deepin.io/dde/startdde/display/configfile"
+)
+
+// 合上笔记本盖子时的策略
+const (
+	// 什么都不做
+	LidPolicyIgnore uint8 = iota
+	// 连接了外接显示器时禁用内置显示器，打开盖子时恢复合上之前的布局
+	LidPolicyDisableBuiltin
+)
+
+func IsValidLidPolicy(policy uint8) bool {
+	return policy <= LidPolicyDisableBuiltin
+}
+
+type lidConfig struct {
+	ClosePolicy uint8
+}
+
+// LoadLidPolicy 从文件中读取合上盖子时的策略，出错时返回默认的 LidPolicyDisableBuiltin
+func LoadLidPolicy(filename string) (uint8, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return LidPolicyDisableBuiltin, err
+	}
+	var cfg lidConfig
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return LidPolicyDisableBuiltin, err
+	}
+	if !IsValidLidPolicy(cfg.ClosePolicy) {
+		return LidPolicyDisableBuiltin, fmt.Errorf("invalid lid policy %d", cfg.ClosePolicy)
+	}
+	return cfg.ClosePolicy, nil
+}
+
+func SaveLidPolicy(filename string, policy uint8) error {
+	data, err := json.Marshal(&lidConfig{ClosePolicy: policy})
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, data, 0644, 0)
+}
+
+// ErrLidLayoutChanged 表示盖子合上期间布局改变了，打开时不能恢复合上之前的布局
+var ErrLidLayoutChanged = errors.New("layout changed while the lid was closed")
+
+// LidHandler 根据笔记本盖子的状态和策略禁用或恢复内置显示器，X11 和 Wayland 共用。
+// 禁用内置显示器只是临时的，不保存到配置中，保存之前要调用 FixConfigs。
+// 用户修改布局之后要调用 HandleModeSwitched 或者 HandleLayoutEdited 重新应用策略。
+type LidHandler struct {
+	Backend OutputBackend
+	// 返回当前主屏幕的名称
+	GetPrimary func() string
+
+	mu     sync.Mutex
+	policy uint8
+	closed bool
+	// 内置显示器因为合上盖子被禁用
+	disabled bool
+	// 禁用之前内置显示器的设置，保存配置时代替禁用的状态
+	builtinCfg *MonitorConfig
+	// 打开时恢复的布局，合上期间用户修改了布局时为 nil，这时由调用者按配置重新应用
+	saved *Layout
+}
+
+func (h *LidHandler) currentPrimary() string {
+	if h.GetPrimary == nil {
+		return ""
+	}
+	return h.GetPrimary()
+}
+
+func (h *LidHandler) Policy() uint8 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.policy
+}
+
+// SetPolicy 修改策略，盖子合上时立即按新的策略禁用或恢复内置显示器，返回是否改变了布局
+func (h *LidHandler) SetPolicy(policy uint8) (bool, error) {
+	if !IsValidLidPolicy(policy) {
+		return false, fmt.Errorf("invalid lid policy %d", policy)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = policy
+	if !h.closed {
+		return false, nil
+	}
+	if policy == LidPolicyDisableBuiltin {
+		return h.disableBuiltin()
+	}
+	return h.restore()
+}
+
+// HandleLidChanged 在盖子合上或者打开时调用，返回是否改变了布局。
+// 打开时不能恢复合上之前的布局会返回错误，调用者需要按配置重新应用显示模式。
+func (h *LidHandler) HandleLidChanged(closed bool) (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = closed
+	if !closed {
+		return h.restore()
+	}
+	if h.policy != LidPolicyDisableBuiltin {
+		return false, nil
+	}
+	return h.disableBuiltin()
+}
+
+// HandleHotplug 在热插拔重新应用显示模式之后调用，
+// 重新应用的显示模式会启用内置显示器，盖子合上时需要再次禁用
+func (h *LidHandler) HandleHotplug() (bool, error) {
+	return h.HandleModeSwitched()
+}
+
+// HandleModeSwitched 在切换显示模式、应用方案或者布局文件等按配置生成整个布局之后调用。
+// 新的布局就是用户想要的，内置显示器是禁用的也不再由盖子恢复；
+// 新的布局启用了内置显示器时，盖子合上就按策略再次禁用，打开时恢复成新的布局。
+func (h *LidHandler) HandleModeSwitched() (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.disabled = false
+	h.builtinCfg = nil
+	h.saved = nil
+	if !h.closed || h.policy != LidPolicyDisableBuiltin {
+		return false, nil
+	}
+	return h.disableBuiltin()
+}
+
+// HandleLayoutEdited 在设置主屏幕、应用修改等基于当前状态修改布局之后调用。
+// 合上之前的布局已经过时，打开盖子时改为按配置重新应用；修改启用了内置显示器时按策略再次禁用。
+func (h *LidHandler) HandleLayoutEdited() (bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.disabled {
+		return false, nil
+	}
+	h.saved = nil
+	outputs, err := h.Backend.ListOutputs()
+	if err != nil {
+		return false, err
+	}
+	builtin := getBuiltinOutput(ConnectedOutputs(outputs))
+	if builtin != nil && !builtin.Enabled {
+		return false, nil
+	}
+	h.disabled = false
+	h.builtinCfg = nil
+	if !h.closed || h.policy != LidPolicyDisableBuiltin {
+		return false, nil
+	}
+	return h.disableBuiltin()
+}
+
+// Disabled 返回内置显示器是否因为合上盖子被禁用了
+func (h *LidHandler) Disabled() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.disabled
+}
+
+// Closed 返回盖子是否合上了
+func (h *LidHandler) Closed() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.closed
+}
+
+// FixConfigs 在保存当前状态之前调用。内置显示器因为合上盖子被禁用时，
+// 把 configs 中的内置显示器恢复成禁用之前的设置，和其他显示器重叠时放到最右边。
+func (h *LidHandler) FixConfigs(configs []*MonitorConfig) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.disabled || h.builtinCfg == nil {
+		return
+	}
+	cfg := GetMonitorConfigByUuid(configs, h.builtinCfg.UUID)
+	if cfg == nil || cfg.Enabled {
+		return
+	}
+	fixed := *h.builtinCfg
+	fixed.Name = cfg.Name
+	fixed.Primary = cfg.Primary
+	fixed.OutputProps = cfg.OutputProps
+
+	right := 0
+	overlaps := false
+	builtinRect := monitorConfigRect(&fixed)
+	for _, other := range configs {
+		if other == cfg || !other.Enabled {
+			continue
+		}
+		r := monitorConfigRect(other)
+		if r.overlaps(builtinRect) {
+			overlaps = true
+		}
+		if r.x+r.width > right {
+			right = r.x + r.width
+		}
+	}
+	if overlaps {
+		if right > math.MaxInt16 {
+			right = math.MaxInt16
+		}
+		fixed.X = int16(right)
+		fixed.Y = 0
+	}
+	*cfg = fixed
+}
+
+// 配置中的 Width 和 Height 是旋转之后的大小
+func monitorConfigRect(cfg *MonitorConfig) rect {
+	width, height := ScaledSize(cfg.Width, cfg.Height, cfg.Scale)
+	return rect{x: int(cfg.X), y: int(cfg.Y), width: int(width), height: int(height)}
+}
+
+func (h *LidHandler) disableBuiltin() (bool, error) {
+	outputs, err := h.Backend.ListOutputs()
+	if err != nil {
+		return false, err
+	}
+	connected := ConnectedOutputs(outputs)
+	builtin := getBuiltinOutput(connected)
+	if builtin == nil || !builtin.Enabled {
+		return false, nil
+	}
+	var externals []*Output
+	for _, o := range connected {
+		if !o.Builtin {
+			externals = append(externals, o)
+		}
+	}
+	if len(externals) == 0 {
+		return false, nil
+	}
+
+	current := currentLayout(connected, h.currentPrimary())
+	layout := lidClosedLayout(builtin, externals, h.currentPrimary())
+	err = h.Backend.ApplyLayout(layout)
+	if err != nil {
+		return false, err
+	}
+	h.disabled = true
+	h.builtinCfg = OutputToConfig(builtin)
+	h.saved = current
+	return true, nil
+}
+
+func (h *LidHandler) restore() (bool, error) {
+	if !h.disabled {
+		return false, nil
+	}
+	saved := h.saved
+	h.disabled = false
+	h.builtinCfg = nil
+	h.saved = nil
+	if saved == nil {
+		return false, ErrLidLayoutChanged
+	}
+
+	outputs, err := h.Backend.ListOutputs()
+	if err != nil {
+		return false, err
+	}
+	// 合上期间拔掉了显示器，之前的布局已经不能用了，由调用者按配置重新应用
+	for _, cfg := range saved.Outputs {
+		var found bool
+		for _, o := range ConnectedOutputs(outputs) {
+			if o.ID == cfg.ID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, ErrLidLayoutChanged
+		}
+	}
+	err = h.Backend.ApplyLayout(saved)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func currentLayout(outputs []*Output, primary string) *Layout {
+	layout := &Layout{}
+	for _, o := range outputs {
+		if !o.Enabled {
+			continue
+		}
+		layout.Outputs = append(layout.Outputs, OutputConfig{
+			ID:       o.ID,
+			Enabled:  true,
+			X:        o.X,
+			Y:        o.Y,
+			Mode:     o.Mode,
+			Rotation: o.Rotation,
+			Reflect:  o.Reflect,
+			Scale:    o.Scale,
+		})
+		if o.Name == primary {
+			layout.Primary = o.ID
+		}
+	}
+	return layout
+}
+
+// 禁用内置显示器，它右边和下边的输出设备跟着移动，避免出现空隙。
+// 外接显示器都没有启用时启用第一个。
+func lidClosedLayout(builtin *Output, externals []*Output, primary string) *Layout {
+	var enabled []*Output
+	for _, o := range externals {
+		if o.Enabled {
+			enabled = append(enabled, o)
+		}
+	}
+	if len(enabled) == 0 {
+		return OnlyOneLayout(externals[0], nil)
+	}
+
+	width, height := builtin.size()
+	width, height = ScaledSize(width, height, builtin.Scale)
+	right := int(builtin.X) + int(width)
+	bottom := int(builtin.Y) + int(height)
+
+	layout := currentLayout(enabled, primary)
+	minX, minY := math.MaxInt16, math.MaxInt16
+	for i := range layout.Outputs {
+		cfg := &layout.Outputs[i]
+		if int(cfg.X) >= right {
+			cfg.X -= int16(width)
+		}
+		if int(cfg.Y) >= bottom {
+			cfg.Y -= int16(height)
+		}
+		if int(cfg.X) < minX {
+			minX = int(cfg.X)
+		}
+		if int(cfg.Y) < minY {
+			minY = int(cfg.Y)
+		}
+	}
+	for i := range layout.Outputs {
+		layout.Outputs[i].X -= int16(minX)
+		layout.Outputs[i].Y -= int16(minY)
+	}
+
+	if layout.Primary == 0 {
+		if o := DefaultPrimary(enabled, primary); o != nil {
+			layout.Primary = o.ID
+		}
+	}
+	return layout
+}
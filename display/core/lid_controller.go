@@ -0,0 +1,111 @@
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// LidSwitch 提供盖子的状态，由 logind 的 LidClosed 属性实现
+type LidSwitch interface {
+	LidClosed() (bool, error)
+	// 盖子的状态改变时调用 cb
+	ConnectLidClosedChanged(cb func(closed bool)) error
+}
+
+// LidCallbacks 是 LidController 需要的 Manager 的操作，X11 和 Wayland 各自实现
+type LidCallbacks interface {
+	// 按配置重新应用显示模式
+	ApplyDisplayMode()
+	// 丢弃没有保存的修改
+	MarkClean()
+	SetPropLidClosePolicy(policy uint8)
+	// 记录处理过程中的错误，这些错误不影响后面的处理
+	ReportError(err error)
+}
+
+// LidController 把 LidHandler 接到盖子的状态和 Manager 上：读取和保存策略，监听盖子的状态，
+// 不能恢复合上之前的布局时按配置重新应用显示模式。
+type LidController struct {
+	Handler   *LidHandler
+	Callbacks LidCallbacks
+	// 保存策略的文件
+	ConfigFile string
+}
+
+// Init 读取策略，开始监听盖子的状态，盖子已经合上时立即处理。sw 为 nil 时只读取策略。
+func (c *LidController) Init(sw LidSwitch) {
+	policy, err := LoadLidPolicy(c.ConfigFile)
+	if err != nil && !os.IsNotExist(err) {
+		c.Callbacks.ReportError(fmt.Errorf("failed to load lid policy: %v", err))
+	}
+	_, err = c.Handler.SetPolicy(policy)
+	if err != nil {
+		c.Callbacks.ReportError(err)
+	}
+	c.Callbacks.SetPropLidClosePolicy(policy)
+
+	if sw == nil {
+		return
+	}
+	err = sw.ConnectLidClosedChanged(c.HandleLidChanged)
+	if err != nil {
+		c.Callbacks.ReportError(fmt.Errorf("failed to connect LidClosed changed: %v", err))
+	}
+	closed, err := sw.LidClosed()
+	if err != nil {
+		c.Callbacks.ReportError(err)
+		return
+	}
+	if closed {
+		c.HandleLidChanged(true)
+	}
+}
+
+// HandleLidChanged 在盖子合上或者打开时调用
+func (c *LidController) HandleLidChanged(closed bool) {
+	if closed || c.Handler.Disabled() {
+		c.Callbacks.MarkClean()
+	}
+	_, err := c.Handler.HandleLidChanged(closed)
+	if err != nil {
+		c.Callbacks.ReportError(fmt.Errorf("failed to handle lid changed: %v", err))
+		if !closed {
+			// 不能恢复合上之前的布局，按配置重新应用
+			c.Callbacks.ApplyDisplayMode()
+		}
+	}
+}
+
+// HandleLayoutChanged 在用户修改布局之后调用，modeSwitched 为 true 表示按配置生成了整个布局，
+// 比如切换显示模式、应用方案，否则是在当前状态上修改，比如设置主屏幕、应用修改
+func (c *LidController) HandleLayoutChanged(modeSwitched bool) {
+	var err error
+	if modeSwitched {
+		_, err = c.Handler.HandleModeSwitched()
+	} else {
+		_, err = c.Handler.HandleLayoutEdited()
+	}
+	if err != nil {
+		c.Callbacks.ReportError(fmt.Errorf("failed to apply lid policy: %v", err))
+	}
+}
+
+// SetPolicy 修改并保存策略，只有 policy 无效时返回错误
+func (c *LidController) SetPolicy(policy uint8) error {
+	if !IsValidLidPolicy(policy) {
+		return fmt.Errorf("invalid lid policy %d", policy)
+	}
+	_, err := c.Handler.SetPolicy(policy)
+	if err == ErrLidLayoutChanged {
+		// 不能恢复合上之前的布局，按配置重新应用
+		c.Callbacks.ApplyDisplayMode()
+	} else if err != nil {
+		c.Callbacks.ReportError(fmt.Errorf("failed to apply lid policy: %v", err))
+	}
+	err = SaveLidPolicy(c.ConfigFile, policy)
+	if err != nil {
+		c.Callbacks.ReportError(fmt.Errorf("failed to save lid policy: %v", err))
+	}
+	c.Callbacks.SetPropLidClosePolicy(policy)
+	return nil
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLidSwitch struct {
+	closed bool
+	cb     func(closed bool)
+}
+
+func (s *fakeLidSwitch) LidClosed() (bool, error) {
+	return s.closed, nil
+}
+
+func (s *fakeLidSwitch) ConnectLidClosedChanged(cb func(closed bool)) error {
+	s.cb = cb
+	return nil
+}
+
+func (s *fakeLidSwitch) set(closed bool) {
+	s.closed = closed
+	s.cb(closed)
+}
+
+type fakeLidCallbacks struct {
+	applyDisplayMode int
+	markClean        int
+	policy           uint8
+	errs             []error
+}
+
+func (c *fakeLidCallbacks) ApplyDisplayMode() {
+	c.applyDisplayMode++
+}
+
+func (c *fakeLidCallbacks) MarkClean() {
+	c.markClean++
+}
+
+func (c *fakeLidCallbacks) SetPropLidClosePolicy(policy uint8) {
+	c.policy = policy
+}
+
+func (c *fakeLidCallbacks) ReportError(err error) {
+	c.errs = append(c.errs, err)
+}
+
+func TestLidController(t *testing.T) {
+	dir, err := ioutil.TempDir("", "display-lid")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	backend := newLidTestBackend()
+	callbacks := &fakeLidCallbacks{policy: LidPolicyIgnore}
+	c := &LidController{
+		Handler:    &LidHandler{Backend: backend},
+		Callbacks:  callbacks,
+		ConfigFile: filepath.Join(dir, "lid.json"),
+	}
+
+	// 没有保存过策略时使用默认策略，盖子已经合上时立即禁用内置显示器
+	sw := &fakeLidSwitch{closed: true}
+	c.Init(sw)
+	assert.Empty(t, callbacks.errs)
+	assert.Equal(t, LidPolicyDisableBuiltin, callbacks.policy)
+	assert.Equal(t, 1, callbacks.markClean)
+	assert.False(t, backend.Output(66).Enabled)
+
+	// 合上期间修改了布局，打开时按配置重新应用
+	c.HandleLayoutChanged(false)
+	sw.set(false)
+	assert.Equal(t, 1, callbacks.applyDisplayMode)
+	assert.Len(t, callbacks.errs, 1)
+
+	err = c.SetPolicy(LidPolicyIgnore)
+	require.NoError(t, err)
+	assert.Equal(t, LidPolicyIgnore, callbacks.policy)
+	policy, err := LoadLidPolicy(c.ConfigFile)
+	require.NoError(t, err)
+	assert.Equal(t, LidPolicyIgnore, policy)
+
+	assert.Error(t, c.SetPolicy(10))
+}
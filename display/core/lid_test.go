@@ -0,0 +1,172 @@
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLidTestBackend() *FakeBackend {
+	mode := Mode{ID: 100, Width: 1920, Height: 1080, Rate: 60}
+	return NewFakeBackend(
+		&Output{ID: 66, Name: "eDP-1", Connected: true, Builtin: true, Modes: []Mode{mode},
+			Enabled: true, Mode: mode, Rotation: RotationRotate0},
+		&Output{ID: 70, Name: "HDMI-1", Connected: true, Modes: []Mode{mode},
+			Enabled: true, X: 1920, Mode: mode, Rotation: RotationRotate0},
+		&Output{ID: 72, Name: "DP-1", Connected: true, Modes: []Mode{mode},
+			Enabled: true, X: 3840, Mode: mode, Rotation: RotationRotate0},
+	)
+}
+
+func TestLidHandler(t *testing.T) {
+	backend := newLidTestBackend()
+	require.NoError(t, backend.SetPrimary(66))
+	h := &LidHandler{
+		Backend: backend,
+		GetPrimary: func() string {
+			return backend.Output(backend.Primary()).Name
+		},
+	}
+
+	changed, err := h.HandleLidChanged(true)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.True(t, backend.Output(66).Enabled)
+
+	// 合上时修改策略立即生效，内置显示器被禁用，右边的显示器向左移动，主屏幕换成外接显示器
+	changed, err = h.SetPolicy(LidPolicyDisableBuiltin)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, h.Disabled())
+	assert.False(t, backend.Output(66).Enabled)
+	assert.Equal(t, int16(0), backend.Output(70).X)
+	assert.Equal(t, int16(1920), backend.Output(72).X)
+	assert.NotEqual(t, uint32(66), backend.Primary())
+
+	// 打开时恢复
+	changed, err = h.HandleLidChanged(false)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, h.Disabled())
+	assert.True(t, backend.Output(66).Enabled)
+	assert.Equal(t, int16(1920), backend.Output(70).X)
+	assert.Equal(t, uint32(66), backend.Primary())
+
+	// 合上期间拔掉了显示器，不能恢复
+	_, err = h.HandleLidChanged(true)
+	require.NoError(t, err)
+	backend.Disconnect(72)
+	_, err = h.HandleLidChanged(false)
+	assert.Error(t, err)
+	assert.False(t, h.Disabled())
+}
+
+func TestLidHandler_SetPolicy(t *testing.T) {
+	backend := newLidTestBackend()
+	h := &LidHandler{Backend: backend}
+	_, err := h.SetPolicy(LidPolicyDisableBuiltin)
+	require.NoError(t, err)
+	_, err = h.HandleLidChanged(true)
+	require.NoError(t, err)
+	assert.False(t, backend.Output(66).Enabled)
+
+	// 改成忽略时恢复
+	changed, err := h.SetPolicy(LidPolicyIgnore)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, backend.Output(66).Enabled)
+
+	_, err = h.SetPolicy(10)
+	assert.Error(t, err)
+}
+
+func TestLidHandler_noExternal(t *testing.T) {
+	backend := newLidTestBackend()
+	backend.Disconnect(70)
+	backend.Disconnect(72)
+	h := &LidHandler{Backend: backend}
+	_, err := h.SetPolicy(LidPolicyDisableBuiltin)
+	require.NoError(t, err)
+	changed, err := h.HandleLidChanged(true)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.True(t, backend.Output(66).Enabled)
+}
+
+func TestLidHandler_layoutChanged(t *testing.T) {
+	backend := newLidTestBackend()
+	require.NoError(t, backend.SetPrimary(66))
+	h := &LidHandler{Backend: backend}
+	_, err := h.SetPolicy(LidPolicyDisableBuiltin)
+	require.NoError(t, err)
+	_, err = h.HandleLidChanged(true)
+	require.NoError(t, err)
+	require.True(t, h.Disabled())
+
+	// 保存的配置中内置显示器是启用的，和其他显示器重叠时放到最右边
+	outputs, err := backend.ListOutputs()
+	require.NoError(t, err)
+	configs := ToMonitorConfigs(outputs, "HDMI-1")
+	require.False(t, configs[0].Enabled)
+	h.FixConfigs(configs)
+	assert.True(t, configs[0].Enabled)
+	assert.Equal(t, uint16(1920), configs[0].Width)
+	assert.Equal(t, int16(3840), configs[0].X)
+	assert.False(t, configs[0].Primary)
+
+	// 合上期间修改了布局，内置显示器保持禁用，打开时不能恢复合上之前的布局
+	changed, err := h.HandleLayoutEdited()
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.True(t, h.Disabled())
+	_, err = h.HandleLidChanged(false)
+	assert.Equal(t, ErrLidLayoutChanged, err)
+	assert.False(t, h.Disabled())
+
+	// 切换模式启用了内置显示器，合上时再次禁用，打开时恢复成新的布局
+	_, err = h.HandleLidChanged(true)
+	require.NoError(t, err)
+	require.NoError(t, backend.ApplyLayout(ConfigsLayout(outputs, configs, "")))
+	assert.True(t, backend.Output(66).Enabled)
+	changed, err = h.HandleModeSwitched()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, backend.Output(66).Enabled)
+	_, err = h.HandleLidChanged(false)
+	require.NoError(t, err)
+	assert.True(t, backend.Output(66).Enabled)
+
+	// 切换到只启用外接显示器，打开盖子时不启用内置显示器
+	_, err = h.HandleLidChanged(true)
+	require.NoError(t, err)
+	require.NoError(t, backend.ApplyLayout(OnlyOneLayout(backend.Output(70), configs)))
+	changed, err = h.HandleModeSwitched()
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.False(t, h.Disabled())
+	changed, err = h.HandleLidChanged(false)
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.False(t, backend.Output(66).Enabled)
+}
+
+func TestLoadLidPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "display-lid")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "lid.json")
+	policy, err := LoadLidPolicy(filename)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, LidPolicyDisableBuiltin, policy)
+
+	err = SaveLidPolicy(filename, LidPolicyIgnore)
+	require.NoError(t, err)
+	policy, err = LoadLidPolicy(filename)
+	require.NoError(t, err)
+	assert.Equal(t, LidPolicyIgnore, policy)
+}
@@ -0,0 +1,106 @@
+package core
+
+import (
+	"sync"
+	"time"
+)
+
+// iio-sensor-proxy 的 AccelerometerOrientation 属性的值
+const (
+	OrientationUndefined = "undefined"
+	OrientationNormal    = "normal"
+	OrientationBottomUp  = "bottom-up"
+	OrientationLeftUp    = "left-up"
+	OrientationRightUp   = "right-up"
+)
+
+// OrientationToRotation 返回设备处于 orientation 方向时显示器需要的旋转，
+// 方向未知时返回 false。RandR 的旋转是逆时针的，左边朝上时需要逆时针旋转 90 度。
+func OrientationToRotation(orientation string) (uint16, bool) {
+	switch orientation {
+	case OrientationNormal:
+		return RotationRotate0, true
+	case OrientationBottomUp:
+		return RotationRotate180, true
+	case OrientationLeftUp:
+		return RotationRotate90, true
+	case OrientationRightUp:
+		return RotationRotate270, true
+	}
+	return 0, false
+}
+
+// OrientationDebouncer 过滤方向的抖动，方向保持 delay 时间不变才调用 apply。
+// 设备在两个方向之间来回晃动时不会反复旋转。
+type OrientationDebouncer struct {
+	mu      sync.Mutex
+	delay   time.Duration
+	timer   *time.Timer
+	seq     uint64
+	pending string
+	current string // 最后一次应用的方向
+	apply   func(orientation string)
+}
+
+func NewOrientationDebouncer(delay time.Duration, apply func(orientation string)) *OrientationDebouncer {
+	return &OrientationDebouncer{delay: delay, apply: apply}
+}
+
+// Update 在方向传感器报告新的方向时调用，方向未知或者回到当前方向时取消等待中的旋转
+func (d *OrientationDebouncer) Update(orientation string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := OrientationToRotation(orientation); !ok || orientation == d.current {
+		d.stop()
+		return
+	}
+	if d.timer != nil && d.pending == orientation {
+		return
+	}
+	d.stop()
+	d.seq++
+	seq := d.seq
+	d.pending = orientation
+	d.timer = time.AfterFunc(d.delay, func() {
+		d.fire(seq)
+	})
+}
+
+func (d *OrientationDebouncer) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.pending = ""
+}
+
+// seq 用来忽略已经被取消但仍然触发了的定时器
+func (d *OrientationDebouncer) fire(seq uint64) {
+	d.mu.Lock()
+	if d.timer == nil || d.seq != seq {
+		d.mu.Unlock()
+		return
+	}
+	orientation := d.pending
+	d.timer = nil
+	d.pending = ""
+	d.current = orientation
+	d.mu.Unlock()
+	d.apply(orientation)
+}
+
+// Reset 取消等待中的旋转并忘记当前方向，之后的 Update 即使方向没变也会应用，
+// 用于重新开启自动旋转或者解除旋转锁定
+func (d *OrientationDebouncer) Reset() {
+	d.mu.Lock()
+	d.stop()
+	d.current = ""
+	d.mu.Unlock()
+}
+
+// Stop 取消等待中的旋转
+func (d *OrientationDebouncer) Stop() {
+	d.mu.Lock()
+	d.stop()
+	d.mu.Unlock()
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrientationToRotation(t *testing.T) {
+	rotation, ok := OrientationToRotation(OrientationLeftUp)
+	assert.True(t, ok)
+	assert.Equal(t, RotationRotate90, rotation)
+
+	rotation, ok = OrientationToRotation(OrientationRightUp)
+	assert.True(t, ok)
+	assert.Equal(t, RotationRotate270, rotation)
+
+	_, ok = OrientationToRotation(OrientationUndefined)
+	assert.False(t, ok)
+}
+
+func newTestOrientationDebouncer(delay time.Duration) (*OrientationDebouncer, chan string) {
+	applied := make(chan string, 10)
+	d := NewOrientationDebouncer(delay, func(orientation string) {
+		applied <- orientation
+	})
+	return d, applied
+}
+
+func TestOrientationDebouncer(t *testing.T) {
+	d, applied := newTestOrientationDebouncer(20 * time.Millisecond)
+	d.Update(OrientationLeftUp)
+	select {
+	case orientation := <-applied:
+		assert.Equal(t, OrientationLeftUp, orientation)
+	case <-time.After(time.Second):
+		t.Fatal("not applied")
+	}
+
+	// 方向没变不再应用
+	d.Update(OrientationLeftUp)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, applied, 0)
+
+	// 重置之后相同的方向也会应用
+	d.Reset()
+	d.Update(OrientationLeftUp)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, applied, 1)
+	<-applied
+}
+
+func TestOrientationDebouncer_flapping(t *testing.T) {
+	d, applied := newTestOrientationDebouncer(40 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		d.Update(OrientationLeftUp)
+		time.Sleep(10 * time.Millisecond)
+		d.Update(OrientationNormal)
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(t, applied, 0)
+
+	// 回到未知方向时取消
+	d.Update(OrientationBottomUp)
+	d.Update(OrientationUndefined)
+	time.Sleep(80 * time.Millisecond)
+	assert.Len(t, applied, 0)
+
+	d.Update(OrientationBottomUp)
+	d.Stop()
+	time.Sleep(80 * time.Millisecond)
+	assert.Len(t, applied, 0)
+}
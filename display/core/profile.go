@@ -0,0 +1,404 @@
+package core
+
+import (
+	"math"
+	"path"
+	"sort"
+	"strings"
+)
+
+// 按尺寸匹配时允许的误差，单位英寸
+const profileSizeTolerance = 0.5
+
+// DisplayProfile 是用户保存的显示配置方案。
+// 和 Config 不同，它不要求连接的显示器和保存时完全相同，
+// 每个 ProfileOutput 通过 Match 匹配一个显示器，比如“笔记本内置屏 + 任意 27 寸显示器”。
+type DisplayProfile struct {
+	Name    string
+	Outputs []*ProfileOutput
+}
+
+type ProfileOutput struct {
+	Match ProfileMatcher
+	// 其中的 UUID 被忽略，Name 只用于在多个显示器都能匹配时优先选择相同接口的
+	Config MonitorConfig
+}
+
+// ProfileMatcher 的所有非空字段都要满足才算匹配，
+// Name、Vendor 和 Model 支持 path.Match 的通配符，不区分大小写。
+type ProfileMatcher struct {
+	UUID    string  `json:",omitempty"`
+	Name    string  `json:",omitempty"`
+	Vendor  string  `json:",omitempty"`
+	Model   string  `json:",omitempty"`
+	Builtin *bool   `json:",omitempty"`
+	Size    float64 `json:",omitempty"` // 对角线尺寸，单位英寸
+}
+
+// 用于匹配的显示器信息
+type monitorInfo struct {
+	uuid         string
+	name         string
+	manufacturer string
+	model        string
+	size         float64
+	builtin      bool
+}
+
+// 已连接的输出设备的信息，按 ID 排序
+func getMonitorInfos(outputs []*Output) []*monitorInfo {
+	connected := ConnectedOutputs(outputs)
+	sort.Slice(connected, func(i, j int) bool {
+		return connected[i].ID < connected[j].ID
+	})
+	infos := make([]*monitorInfo, len(connected))
+	for i, o := range connected {
+		infos[i] = &monitorInfo{
+			uuid:         o.UUID,
+			name:         o.Name,
+			manufacturer: o.Manufacturer,
+			model:        o.Model,
+			size:         getMonitorSize(o.MmWidth, o.MmHeight),
+			builtin:      o.Builtin,
+		}
+	}
+	return infos
+}
+
+func getMonitorSize(mmWidth, mmHeight uint32) float64 {
+	return math.Hypot(float64(mmWidth), float64(mmHeight)) / 25.4
+}
+
+func matchWildcard(pattern, str string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(str))
+	return err == nil && ok
+}
+
+// 返回是否匹配和匹配程度，越具体的条件分数越高
+func (pm *ProfileMatcher) match(info *monitorInfo) (score int, ok bool) {
+	if pm.UUID != "" {
+		if pm.UUID != info.uuid {
+			return 0, false
+		}
+		score += 8
+	}
+	if pm.Vendor != "" {
+		if !matchWildcard(pm.Vendor, info.manufacturer) {
+			return 0, false
+		}
+		score += 2
+	}
+	if pm.Model != "" {
+		if !matchWildcard(pm.Model, info.model) {
+			return 0, false
+		}
+		score += 2
+	}
+	if pm.Name != "" {
+		if !matchWildcard(pm.Name, info.name) {
+			return 0, false
+		}
+		score++
+	}
+	if pm.Builtin != nil {
+		if *pm.Builtin != info.builtin {
+			return 0, false
+		}
+		score++
+	}
+	if pm.Size > 0 {
+		if math.Abs(pm.Size-info.size) > profileSizeTolerance {
+			return 0, false
+		}
+		score++
+	}
+	return score, true
+}
+
+// 为每个 i 找一个不同的 j，使得 scoreFn 的总和最大，找不到时 ok 为 false。
+// 显示器的数量很少，直接回溯搜索。
+func findBestAssignment(n, m int, scoreFn func(i, j int) (int, bool)) (result []int, total int, ok bool) {
+	current := make([]int, n)
+	used := make([]bool, m)
+	total = -1
+
+	var search func(i, sum int)
+	search = func(i, sum int) {
+		if i == n {
+			if sum > total {
+				total = sum
+				result = append(result[:0], current...)
+			}
+			return
+		}
+		for j := 0; j < m; j++ {
+			if used[j] {
+				continue
+			}
+			score, ok := scoreFn(i, j)
+			if !ok {
+				continue
+			}
+			used[j] = true
+			current[i] = j
+			search(i+1, sum+score)
+			used[j] = false
+		}
+	}
+	search(0, 0)
+
+	if total < 0 {
+		return nil, 0, false
+	}
+	return result, total, true
+}
+
+// 把方案应用到 infos 表示的显示器上，要求显示器和 Outputs 一一对应
+func (p *DisplayProfile) resolve(infos []*monitorInfo) (configs []*MonitorConfig, score int, ok bool) {
+	if len(infos) == 0 || len(infos) != len(p.Outputs) {
+		return nil, 0, false
+	}
+	assignment, score, ok := findBestAssignment(len(infos), len(p.Outputs), func(i, j int) (int, bool) {
+		output := p.Outputs[j]
+		score, ok := output.Match.match(infos[i])
+		if !ok {
+			return 0, false
+		}
+		if output.Config.Name == infos[i].name {
+			score++
+		}
+		return score, true
+	})
+	if !ok {
+		return nil, 0, false
+	}
+
+	configs = make([]*MonitorConfig, len(infos))
+	for i, j := range assignment {
+		cfg := p.Outputs[j].Config
+		cfg.UUID = infos[i].uuid
+		cfg.Name = infos[i].name
+		configs[i] = &cfg
+	}
+	return configs, score, true
+}
+
+// Resolve 把方案应用到已连接的输出设备上，方案和输出设备不能一一对应时 ok 为 false
+func (p *DisplayProfile) Resolve(outputs []*Output) (configs []*MonitorConfig, ok bool) {
+	configs, _, ok = p.resolve(getMonitorInfos(outputs))
+	return
+}
+
+// 在 profiles 中找到和 infos 匹配程度最高的方案
+func findBestProfile(profiles []*DisplayProfile, infos []*monitorInfo) (*DisplayProfile, []*MonitorConfig) {
+	var bestProfile *DisplayProfile
+	var bestConfigs []*MonitorConfig
+	bestScore := -1
+	for _, p := range profiles {
+		configs, score, ok := p.resolve(infos)
+		if ok && score > bestScore {
+			bestProfile = p
+			bestConfigs = configs
+			bestScore = score
+		}
+	}
+	return bestProfile, bestConfigs
+}
+
+// NewDisplayProfile 用已连接的输出设备和它们的配置创建方案
+func NewDisplayProfile(name string, outputs []*Output, configs []*MonitorConfig) *DisplayProfile {
+	return newDisplayProfile(name, getMonitorInfos(outputs), configs)
+}
+
+func newDisplayProfile(name string, infos []*monitorInfo, configs []*MonitorConfig) *DisplayProfile {
+	p := &DisplayProfile{Name: name}
+	for _, info := range infos {
+		cfg := GetMonitorConfigByUuid(configs, info.uuid)
+		if cfg == nil {
+			continue
+		}
+		builtin := info.builtin
+		matcher := ProfileMatcher{Builtin: &builtin}
+		if !builtin {
+			if info.manufacturer != "" && info.manufacturer != "DEFAULT" {
+				matcher.Vendor = info.manufacturer
+				matcher.Model = info.model
+			} else {
+				// 没有 EDID 信息时只能按 UUID 匹配
+				matcher.UUID = info.uuid
+			}
+		}
+		outputCfg := *cfg
+		outputCfg.UUID = ""
+		p.Outputs = append(p.Outputs, &ProfileOutput{
+			Match:  matcher,
+			Config: outputCfg,
+		})
+	}
+	return p
+}
+
+// UUID 由接口名称和 EDID 中的 Identity 组成，去掉接口名称后可以识别出换了接口的同一个显示器
+func getUuidEdidPart(uuid, name string) string {
+	if strings.HasPrefix(uuid, name) && len(uuid) > len(name) {
+		return uuid[len(name):]
+	}
+	return ""
+}
+
+// 把已保存的布局 configs 套用到 infos 表示的显示器上，返回套用后的配置和相似程度。
+// 每个显示器都要在 configs 中找到对应的，configs 中多余的显示器会降低相似程度。
+func adaptMonitorConfigs(configs []*MonitorConfig, infos []*monitorInfo) ([]*MonitorConfig, int, bool) {
+	if len(infos) == 0 || len(configs) < len(infos) {
+		return nil, 0, false
+	}
+	assignment, score, ok := findBestAssignment(len(infos), len(configs), func(i, j int) (int, bool) {
+		cfg := configs[j]
+		info := infos[i]
+		if cfg.UUID == info.uuid {
+			return 4, true
+		}
+		edidPart := getUuidEdidPart(info.uuid, info.name)
+		if edidPart != "" && edidPart == getUuidEdidPart(cfg.UUID, cfg.Name) {
+			return 3, true
+		}
+		if cfg.Name == info.name {
+			return 1, true
+		}
+		return 0, false
+	})
+	if !ok {
+		return nil, 0, false
+	}
+
+	result := make([]*MonitorConfig, len(infos))
+	for i, j := range assignment {
+		cfg := *configs[j]
+		cfg.UUID = infos[i].uuid
+		cfg.Name = infos[i].name
+		result[i] = &cfg
+	}
+	fixAdaptedConfigs(result, infos)
+	score -= 2 * (len(configs) - len(infos))
+	return result, score, true
+}
+
+// 去掉多余的显示器之后，套用的布局可能没有启用的显示器，或者留下空隙、不从 (0, 0) 开始。
+// 没有启用的显示器时依次启用主屏幕、内置显示器、ID 最小的显示器，主屏幕必须是启用的。
+// infos 按 ID 排序。
+func fixAdaptedConfigs(configs []*MonitorConfig, infos []*monitorInfo) {
+	primary := -1
+	builtin := -1
+	hasEnabled := false
+	for i, cfg := range configs {
+		if cfg.Primary && primary < 0 {
+			primary = i
+		}
+		if infos[i].builtin && builtin < 0 {
+			builtin = i
+		}
+		if cfg.Enabled {
+			hasEnabled = true
+		}
+	}
+	if !hasEnabled {
+		idx := 0
+		if primary >= 0 {
+			idx = primary
+		} else if builtin >= 0 {
+			idx = builtin
+		}
+		configs[idx].Enabled = true
+	}
+
+	if primary < 0 || !configs[primary].Enabled {
+		primary = -1
+		for i, cfg := range configs {
+			if cfg.Enabled {
+				primary = i
+				break
+			}
+		}
+	}
+	var enabled []*MonitorConfig
+	for i, cfg := range configs {
+		cfg.Primary = i == primary
+		if cfg.Enabled {
+			enabled = append(enabled, cfg)
+		}
+	}
+	removeLayoutGaps(enabled, func(cfg *MonitorConfig) (*int16, uint16) {
+		width, _ := ScaledSize(cfg.Width, cfg.Height, cfg.Scale)
+		return &cfg.X, width
+	})
+	removeLayoutGaps(enabled, func(cfg *MonitorConfig) (*int16, uint16) {
+		_, height := ScaledSize(cfg.Width, cfg.Height, cfg.Scale)
+		return &cfg.Y, height
+	})
+}
+
+// 沿一个方向去掉去除显示器后留下的空隙，并让坐标从 0 开始，
+// axis 返回这个方向上的坐标和占用的长度
+func removeLayoutGaps(configs []*MonitorConfig, axis func(cfg *MonitorConfig) (*int16, uint16)) {
+	if len(configs) == 0 {
+		return
+	}
+	sorted := make([]*MonitorConfig, len(configs))
+	copy(sorted, configs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		pi, _ := axis(sorted[i])
+		pj, _ := axis(sorted[j])
+		return *pi < *pj
+	})
+
+	first, _ := axis(sorted[0])
+	offset := int(*first)
+	edge := 0
+	for _, cfg := range sorted {
+		p, length := axis(cfg)
+		pos := int(*p) - offset
+		if pos > edge {
+			// 前面的显示器都到不了这里，后面的一起移过来
+			offset += pos - edge
+			pos = edge
+		}
+		*p = int16(pos)
+		if end := pos + int(length); end > edge {
+			edge = end
+		}
+	}
+}
+
+// 在所有已保存的扩展和自定义布局中找到和 infos 最相似的
+func findSimilarLayout(c Config, infos []*monitorInfo) []*MonitorConfig {
+	ids := make([]string, 0, len(c))
+	for id := range c {
+		ids = append(ids, id)
+	}
+	// 保证结果稳定
+	sort.Strings(ids)
+
+	var best []*MonitorConfig
+	bestScore := 0
+	tryLayout := func(configs []*MonitorConfig) {
+		result, score, ok := adaptMonitorConfigs(configs, infos)
+		if ok && score > bestScore {
+			best = result
+			bestScore = score
+		}
+	}
+
+	for _, id := range ids {
+		screenCfg := c[id]
+		if screenCfg == nil {
+			continue
+		}
+		if screenCfg.Extend != nil {
+			tryLayout(screenCfg.Extend.Monitors)
+		}
+		for _, custom := range screenCfg.Custom {
+			tryLayout(custom.Monitors)
+		}
+	}
+	return best
+}
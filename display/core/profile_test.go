@@ -0,0 +1,260 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+func TestProfileMatcher_match(t *testing.T) {
+	info := &monitorInfo{
+		uuid:         "HDMI-1abc",
+		name:         "HDMI-1",
+		manufacturer: "DEL",
+		model:        "DELLU2720Q",
+		size:         27.0,
+	}
+
+	score, ok := (&ProfileMatcher{}).match(info)
+	assert.True(t, ok)
+	assert.Equal(t, 0, score)
+
+	score, ok = (&ProfileMatcher{Vendor: "del", Model: "DELL*"}).match(info)
+	assert.True(t, ok)
+	assert.Equal(t, 4, score)
+
+	_, ok = (&ProfileMatcher{Vendor: "SAM"}).match(info)
+	assert.False(t, ok)
+
+	_, ok = (&ProfileMatcher{Size: 27.4}).match(info)
+	assert.True(t, ok)
+	_, ok = (&ProfileMatcher{Size: 24}).match(info)
+	assert.False(t, ok)
+
+	_, ok = (&ProfileMatcher{Builtin: boolPtr(true)}).match(info)
+	assert.False(t, ok)
+	_, ok = (&ProfileMatcher{Name: "HDMI-*", Builtin: boolPtr(false)}).match(info)
+	assert.True(t, ok)
+}
+
+func TestDisplayProfile_resolve(t *testing.T) {
+	// 笔记本内置屏 + 任意 27 寸显示器
+	profile := &DisplayProfile{
+		Name: "desk",
+		Outputs: []*ProfileOutput{
+			{
+				Match:  ProfileMatcher{Size: 27},
+				Config: MonitorConfig{Enabled: true, Width: 2560, Height: 1440, Primary: true},
+			},
+			{
+				Match:  ProfileMatcher{Builtin: boolPtr(true)},
+				Config: MonitorConfig{Enabled: true, X: 2560, Width: 1920, Height: 1080},
+			},
+		},
+	}
+	infos := []*monitorInfo{
+		{uuid: "eDP-1aaa", name: "eDP-1", size: 14, builtin: true},
+		{uuid: "DP-2bbb", name: "DP-2", size: 27.2},
+	}
+
+	configs, _, ok := profile.resolve(infos)
+	require.True(t, ok)
+	assert.Equal(t, []*MonitorConfig{
+		{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: true, X: 2560, Width: 1920, Height: 1080},
+		{UUID: "DP-2bbb", Name: "DP-2", Enabled: true, Width: 2560, Height: 1440, Primary: true},
+	}, configs)
+
+	infos[1].size = 24
+	_, _, ok = profile.resolve(infos)
+	assert.False(t, ok)
+
+	_, _, ok = profile.resolve(infos[:1])
+	assert.False(t, ok)
+}
+
+func Test_findBestProfile(t *testing.T) {
+	profiles := []*DisplayProfile{
+		{
+			Name: "any",
+			Outputs: []*ProfileOutput{
+				{Match: ProfileMatcher{Builtin: boolPtr(true)}},
+				{Match: ProfileMatcher{}},
+			},
+		},
+		{
+			Name: "dock",
+			Outputs: []*ProfileOutput{
+				{Match: ProfileMatcher{Builtin: boolPtr(true)}},
+				{Match: ProfileMatcher{Vendor: "LEN", Model: "T24*"}},
+			},
+		},
+	}
+	infos := []*monitorInfo{
+		{uuid: "eDP-1aaa", name: "eDP-1", builtin: true},
+		{uuid: "DP-2bbb", name: "DP-2", manufacturer: "LEN", model: "T24d-10"},
+	}
+
+	p, configs := findBestProfile(profiles, infos)
+	require.NotNil(t, p)
+	assert.Equal(t, "dock", p.Name)
+	assert.Len(t, configs, 2)
+
+	infos[1].manufacturer = "SAM"
+	p, _ = findBestProfile(profiles, infos)
+	require.NotNil(t, p)
+	assert.Equal(t, "any", p.Name)
+
+	p, _ = findBestProfile(profiles, infos[:1])
+	assert.Nil(t, p)
+}
+
+func Test_newDisplayProfile(t *testing.T) {
+	infos := []*monitorInfo{
+		{uuid: "eDP-1aaa", name: "eDP-1", builtin: true},
+		{uuid: "DP-2bbb", name: "DP-2", manufacturer: "LEN", model: "T24d-10"},
+		{uuid: "VGA-1", name: "VGA-1", manufacturer: "DEFAULT"},
+	}
+	configs := []*MonitorConfig{
+		{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: true},
+		{UUID: "DP-2bbb", Name: "DP-2", Enabled: true, Primary: true},
+		{UUID: "VGA-1", Name: "VGA-1"},
+	}
+	p := newDisplayProfile("work", infos, configs)
+	require.Len(t, p.Outputs, 3)
+	assert.Equal(t, ProfileMatcher{Builtin: boolPtr(true)}, p.Outputs[0].Match)
+	assert.Equal(t, ProfileMatcher{Builtin: boolPtr(false), Vendor: "LEN", Model: "T24d-10"},
+		p.Outputs[1].Match)
+	assert.Equal(t, ProfileMatcher{Builtin: boolPtr(false), UUID: "VGA-1"}, p.Outputs[2].Match)
+	assert.Equal(t, "", p.Outputs[1].Config.UUID)
+	assert.True(t, p.Outputs[1].Config.Primary)
+
+	resolved, _, ok := p.resolve(infos)
+	require.True(t, ok)
+	assert.Equal(t, configs, resolved)
+}
+
+func Test_findSimilarLayout(t *testing.T) {
+	cfg := Config{
+		"DP-2bbb,eDP-1aaa": &ScreenConfig{
+			Extend: &ExtendModeConfig{
+				Monitors: []*MonitorConfig{
+					{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: true, Y: 1440, Width: 1920, Height: 1080},
+					{UUID: "DP-2bbb", Name: "DP-2", Enabled: true, Width: 2560, Height: 1440, Primary: true},
+				},
+			},
+		},
+		"DP-2bbb,HDMI-1ccc,eDP-1aaa": &ScreenConfig{
+			Extend: &ExtendModeConfig{
+				Monitors: []*MonitorConfig{
+					{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: true, Width: 1920, Height: 1080},
+					{UUID: "DP-2bbb", Name: "DP-2", Enabled: true, X: 1920, Width: 2560, Height: 1440},
+					{UUID: "HDMI-1ccc", Name: "HDMI-1", Enabled: true, X: 4480, Width: 1920, Height: 1080,
+						Primary: true},
+				},
+			},
+		},
+	}
+
+	// 同一个显示器换到了另一个接口上
+	infos := []*monitorInfo{
+		{uuid: "eDP-1aaa", name: "eDP-1", builtin: true},
+		{uuid: "DP-1bbb", name: "DP-1"},
+	}
+	configs := findSimilarLayout(cfg, infos)
+	assert.Equal(t, []*MonitorConfig{
+		{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: true, Y: 1440, Width: 1920, Height: 1080},
+		{UUID: "DP-1bbb", Name: "DP-1", Enabled: true, Width: 2560, Height: 1440, Primary: true},
+	}, configs)
+
+	// 接口相同的显示器也能对应上，多余的显示器被忽略，不留空隙
+	infos = []*monitorInfo{
+		{uuid: "eDP-1aaa", name: "eDP-1", builtin: true},
+		{uuid: "HDMI-1ddd", name: "HDMI-1"},
+	}
+	configs = findSimilarLayout(cfg, infos)
+	require.Len(t, configs, 2)
+	assert.Equal(t, int16(1920), configs[1].X)
+	assert.False(t, configs[0].Primary)
+
+	infos = []*monitorInfo{
+		{uuid: "DP-3eee", name: "DP-3"},
+		{uuid: "DP-4fff", name: "DP-4"},
+	}
+	assert.Nil(t, findSimilarLayout(cfg, infos))
+}
+
+func Test_adaptMonitorConfigs(t *testing.T) {
+	// 唯一启用的显示器没有连接，启用主屏幕
+	configs := []*MonitorConfig{
+		{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: false, X: 1920},
+		{UUID: "HDMI-1bbb", Name: "HDMI-1", Enabled: false, X: 1920, Primary: true},
+		{UUID: "DP-2ccc", Name: "DP-2", Enabled: true},
+	}
+	infos := []*monitorInfo{
+		{uuid: "eDP-1aaa", name: "eDP-1", builtin: true},
+		{uuid: "HDMI-1bbb", name: "HDMI-1"},
+	}
+	result, _, ok := adaptMonitorConfigs(configs, infos)
+	require.True(t, ok)
+	assert.Equal(t, []*MonitorConfig{
+		{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: false, X: 1920},
+		{UUID: "HDMI-1bbb", Name: "HDMI-1", Enabled: true, Primary: true},
+	}, result)
+	// 不修改原来的配置
+	assert.False(t, configs[1].Enabled)
+
+	// 没有主屏幕时启用内置显示器
+	configs[1].Primary = false
+	result, _, ok = adaptMonitorConfigs(configs, infos)
+	require.True(t, ok)
+	assert.True(t, result[0].Enabled)
+	assert.True(t, result[0].Primary)
+	assert.False(t, result[1].Enabled)
+	assert.Equal(t, int16(0), result[0].X)
+
+	// 没有内置显示器时启用 ID 最小的
+	infos[0].builtin = false
+	result, _, ok = adaptMonitorConfigs(configs, infos)
+	require.True(t, ok)
+	assert.True(t, result[0].Enabled)
+	assert.False(t, result[1].Enabled)
+
+	// 坐标从 (0, 0) 开始，主屏幕必须是启用的
+	configs = []*MonitorConfig{
+		{UUID: "eDP-1aaa", Name: "eDP-1", Enabled: false, Primary: true},
+		{UUID: "HDMI-1bbb", Name: "HDMI-1", Enabled: true, X: 1366, Y: 200, Width: 1920, Height: 1080},
+		{UUID: "DP-2ccc", Name: "DP-2", Enabled: true, X: 3286, Width: 1920, Height: 1080},
+	}
+	infos = []*monitorInfo{
+		{uuid: "HDMI-1bbb", name: "HDMI-1"},
+		{uuid: "DP-2ccc", name: "DP-2"},
+	}
+	result, _, ok = adaptMonitorConfigs(configs, infos)
+	require.True(t, ok)
+	assert.Equal(t, []*MonitorConfig{
+		{UUID: "HDMI-1bbb", Name: "HDMI-1", Enabled: true, X: 0, Y: 200, Width: 1920, Height: 1080,
+			Primary: true},
+		{UUID: "DP-2ccc", Name: "DP-2", Enabled: true, X: 1920, Width: 1920, Height: 1080},
+	}, result)
+
+	// 去掉中间的显示器后不留空隙，缩放之后占用的区域变小
+	configs = []*MonitorConfig{
+		{UUID: "DP-1aaa", Name: "DP-1", Enabled: true, Width: 3840, Height: 2160, Scale: 2, Primary: true},
+		{UUID: "HDMI-1bbb", Name: "HDMI-1", Enabled: true, X: 1920, Width: 1920, Height: 1080},
+		{UUID: "VGA-1", Name: "VGA-1", Enabled: true, X: 3840, Width: 1024, Height: 768},
+	}
+	infos = []*monitorInfo{
+		{uuid: "DP-1aaa", name: "DP-1"},
+		{uuid: "VGA-1", name: "VGA-1"},
+	}
+	result, _, ok = adaptMonitorConfigs(configs, infos)
+	require.True(t, ok)
+	assert.Equal(t, int16(0), result[0].X)
+	assert.Equal(t, int16(1920), result[1].X)
+	assert.Equal(t, int16(0), result[1].Y)
+}
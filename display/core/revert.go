@@ -0,0 +1,191 @@
+package core
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RevertTimer 在应用修改后开始倒计时，超时前没有确认就调用 revert 恢复修改之前的状态。
+// 发起修改的 D-Bus 客户端退出时，比如控制中心崩溃了，立即恢复。
+type RevertTimer struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	owner  string // 发起修改的客户端的 D-Bus 唯一名称
+	seq    uint64
+	revert func()
+}
+
+func NewRevertTimer(revert func()) *RevertTimer {
+	return &RevertTimer{revert: revert}
+}
+
+// Start 开始倒计时，之前的倒计时会被取消
+func (t *RevertTimer) Start(timeout time.Duration, owner string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stop()
+	t.seq++
+	seq := t.seq
+	t.owner = owner
+	t.timer = time.AfterFunc(timeout, func() {
+		t.fire(seq)
+	})
+}
+
+func (t *RevertTimer) stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	t.owner = ""
+}
+
+// seq 用来忽略已经被取消但仍然触发了的定时器
+func (t *RevertTimer) fire(seq uint64) {
+	t.mu.Lock()
+	if t.timer == nil || t.seq != seq {
+		t.mu.Unlock()
+		return
+	}
+	t.stop()
+	t.mu.Unlock()
+	t.revert()
+}
+
+// Confirm 确认修改并停止倒计时，没有在倒计时时返回 false
+func (t *RevertTimer) Confirm() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timer == nil {
+		return false
+	}
+	t.stop()
+	return true
+}
+
+// Cancel 停止倒计时但不恢复，用于修改已经被保存或者丢弃的情况
+func (t *RevertTimer) Cancel() {
+	t.mu.Lock()
+	t.stop()
+	t.mu.Unlock()
+}
+
+func (t *RevertTimer) Pending() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timer != nil
+}
+
+// HandleNameLost 在 D-Bus 客户端退出时调用，发起修改的客户端退出了就立即恢复
+func (t *RevertTimer) HandleNameLost(name string) {
+	t.mu.Lock()
+	if t.timer == nil || t.owner == "" || t.owner != name {
+		t.mu.Unlock()
+		return
+	}
+	t.stop()
+	t.mu.Unlock()
+	t.revert()
+}
+
+// 等待确认的时间，单位秒，超过上限时使用上限，避免黑屏太久
+const (
+	DefaultRevertTimeout = 15
+	MaxRevertTimeout     = 60
+)
+
+var ErrNoPendingChanges = errors.New("no changes waiting for confirmation")
+
+// ChangesHandler 是 ChangesManager 需要的 Manager 的操作，X11 和 Wayland 各自实现
+type ChangesHandler interface {
+	// 是否有没有应用或者没有保存的修改
+	HasChanged() bool
+	SetHasChanged(changed bool)
+	// 应用所有显示器的修改
+	ApplyChanges() error
+	// 把所有显示器恢复到修改之前的状态，之后会调用 ApplyChanges
+	ResetMonitors()
+	// 应用或者恢复修改之后调用，比如按盖子的状态重新应用策略
+	LayoutChanged()
+	// 超时或者客户端退出自动恢复修改之后调用，err 是恢复时的错误
+	ChangesReverted(err error)
+}
+
+// ChangesManager 实现修改的应用、确认和恢复，应用修改后等待确认，超时或者客户端退出时自动恢复
+type ChangesManager struct {
+	handler ChangesHandler
+	timer   *RevertTimer
+}
+
+func NewChangesManager(handler ChangesHandler) *ChangesManager {
+	cm := &ChangesManager{handler: handler}
+	cm.timer = NewRevertTimer(cm.revert)
+	return cm
+}
+
+// ApplyWithTimeout 应用修改，seconds 秒内没有调用 Confirm 就自动恢复，seconds 为 0 时使用默认值
+func (cm *ChangesManager) ApplyWithTimeout(sender string, seconds uint32) error {
+	if seconds == 0 {
+		seconds = DefaultRevertTimeout
+	} else if seconds > MaxRevertTimeout {
+		seconds = MaxRevertTimeout
+	}
+	if !cm.handler.HasChanged() {
+		return nil
+	}
+	err := cm.handler.ApplyChanges()
+	if err != nil {
+		return err
+	}
+	cm.handler.LayoutChanged()
+	cm.timer.Start(time.Duration(seconds)*time.Second, sender)
+	return nil
+}
+
+func (cm *ChangesManager) Confirm() error {
+	if !cm.timer.Confirm() {
+		return ErrNoPendingChanges
+	}
+	return nil
+}
+
+// Reset 停止倒计时并恢复到修改之前的状态
+func (cm *ChangesManager) Reset() error {
+	cm.timer.Cancel()
+	if !cm.handler.HasChanged() {
+		return nil
+	}
+	return cm.reset()
+}
+
+// Cancel 停止倒计时但不恢复，用于修改已经被保存或者丢弃的情况
+func (cm *ChangesManager) Cancel() {
+	cm.timer.Cancel()
+}
+
+func (cm *ChangesManager) reset() error {
+	cm.handler.ResetMonitors()
+	err := cm.handler.ApplyChanges()
+	if err != nil {
+		return err
+	}
+	cm.handler.LayoutChanged()
+	cm.handler.SetHasChanged(false)
+	return nil
+}
+
+// 由 timer 调用
+func (cm *ChangesManager) revert() {
+	cm.handler.ChangesReverted(cm.reset())
+}
+
+// HandleNameOwnerChanged 处理 D-Bus 的 NameOwnerChanged 信号，发起修改的客户端崩溃时恢复修改
+func (cm *ChangesManager) HandleNameOwnerChanged(name, oldOwner, newOwner string) {
+	if newOwner == "" && oldOwner != "" && name == oldOwner &&
+		strings.HasPrefix(name, ":") {
+		// uniq name lost
+		cm.timer.HandleNameLost(name)
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRevertTimer() (*RevertTimer, chan struct{}) {
+	reverted := make(chan struct{}, 10)
+	t := NewRevertTimer(func() {
+		reverted <- struct{}{}
+	})
+	return t, reverted
+}
+
+func TestRevertTimer_timeout(t *testing.T) {
+	timer, reverted := newTestRevertTimer()
+	timer.Start(10*time.Millisecond, ":1.10")
+	assert.True(t, timer.Pending())
+	select {
+	case <-reverted:
+	case <-time.After(time.Second):
+		t.Fatal("not reverted")
+	}
+	assert.False(t, timer.Pending())
+	assert.False(t, timer.Confirm())
+}
+
+func TestRevertTimer_Confirm(t *testing.T) {
+	timer, reverted := newTestRevertTimer()
+	timer.Start(20*time.Millisecond, ":1.10")
+	assert.True(t, timer.Confirm())
+	assert.False(t, timer.Pending())
+
+	// 重新开始倒计时会取消之前的
+	timer.Start(20*time.Millisecond, ":1.10")
+	timer.Start(time.Hour, ":1.10")
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, reverted, 0)
+	timer.Cancel()
+	assert.False(t, timer.Pending())
+}
+
+func TestRevertTimer_HandleNameLost(t *testing.T) {
+	timer, reverted := newTestRevertTimer()
+	timer.Start(time.Hour, ":1.10")
+	timer.HandleNameLost(":1.11")
+	assert.Len(t, reverted, 0)
+	assert.True(t, timer.Pending())
+
+	timer.HandleNameLost(":1.10")
+	assert.Len(t, reverted, 1)
+	assert.False(t, timer.Pending())
+}
+
+type fakeChangesHandler struct {
+	changed  bool
+	applied  int
+	reset    int
+	reverted []error
+}
+
+func (h *fakeChangesHandler) HasChanged() bool {
+	return h.changed
+}
+
+func (h *fakeChangesHandler) SetHasChanged(changed bool) {
+	h.changed = changed
+}
+
+func (h *fakeChangesHandler) ApplyChanges() error {
+	h.applied++
+	return nil
+}
+
+func (h *fakeChangesHandler) ResetMonitors() {
+	h.reset++
+}
+
+func (h *fakeChangesHandler) LayoutChanged() {
+}
+
+func (h *fakeChangesHandler) ChangesReverted(err error) {
+	h.reverted = append(h.reverted, err)
+}
+
+func TestChangesManager(t *testing.T) {
+	h := &fakeChangesHandler{}
+	cm := NewChangesManager(h)
+
+	// 没有修改时什么都不做
+	assert.NoError(t, cm.ApplyWithTimeout(":1.10", 0))
+	assert.Equal(t, 0, h.applied)
+	assert.Equal(t, ErrNoPendingChanges, cm.Confirm())
+
+	h.changed = true
+	assert.NoError(t, cm.ApplyWithTimeout(":1.10", 0))
+	assert.Equal(t, 1, h.applied)
+	assert.NoError(t, cm.Confirm())
+
+	// 发起修改的客户端退出时恢复
+	assert.NoError(t, cm.ApplyWithTimeout(":1.10", 1000))
+	cm.HandleNameOwnerChanged(":1.11", ":1.11", "")
+	assert.Len(t, h.reverted, 0)
+	cm.HandleNameOwnerChanged(":1.10", ":1.10", "")
+	assert.Equal(t, []error{nil}, h.reverted)
+	assert.Equal(t, 1, h.reset)
+	assert.False(t, h.changed)
+	assert.Equal(t, ErrNoPendingChanges, cm.Confirm())
+
+	// 没有修改时 Reset 只停止倒计时
+	assert.NoError(t, cm.Reset())
+	assert.Equal(t, 1, h.reset)
+}
@@ -0,0 +1,348 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"pkg.deepin.io/dde/startdde/display/configfile"
+)
+
+// 屏幕电源策略：空闲一段时间后调暗屏幕，更长时间后用 DPMS 关闭屏幕，
+// 用户有输入时打开屏幕并渐变地恢复亮度。策略和显示服务器无关，目前只有 X11 下实现了 ScreenPowerBackend。
+// 关机、挂起等需要立即关闭屏幕时也通过这里，保证只有一处控制 DPMS。
+
+// ScreenPowerTimeouts 是一种供电方式下的设置，延迟的单位是秒，为 0 时不调暗或者不关闭
+type ScreenPowerTimeouts struct {
+	DimDelay uint32
+	OffDelay uint32
+	// 调暗后的亮度，当前亮度更低时不调节
+	DimLevel float64
+}
+
+func (t ScreenPowerTimeouts) Validate() error {
+	if t.DimLevel < 0 || t.DimLevel > 1 {
+		return fmt.Errorf("invalid dim level %v", t.DimLevel)
+	}
+	if t.DimDelay != 0 && t.OffDelay != 0 && t.OffDelay <= t.DimDelay {
+		return fmt.Errorf("off delay %d must be longer than dim delay %d", t.OffDelay, t.DimDelay)
+	}
+	return nil
+}
+
+// ScreenPowerConfig 分别设置使用交流电和电池时的延迟，供电方式从 UPower 读取
+type ScreenPowerConfig struct {
+	AC      ScreenPowerTimeouts
+	Battery ScreenPowerTimeouts
+	// 锁屏之后空闲这么长时间关闭屏幕，单位秒，为 0 时和没有锁屏时相同。
+	// 锁屏时不考虑抑制空闲的程序。
+	LockedOffDelay uint32 `json:",omitempty"`
+}
+
+// DefaultScreenPowerConfig 默认不调暗也不关闭屏幕，由用户或者电源管理的设置开启
+var DefaultScreenPowerConfig = ScreenPowerConfig{
+	AC:      ScreenPowerTimeouts{DimLevel: 0.3},
+	Battery: ScreenPowerTimeouts{DimLevel: 0.2},
+}
+
+func (c ScreenPowerConfig) Validate() error {
+	err := c.AC.Validate()
+	if err != nil {
+		return fmt.Errorf("ac: %v", err)
+	}
+	err = c.Battery.Validate()
+	if err != nil {
+		return fmt.Errorf("battery: %v", err)
+	}
+	return nil
+}
+
+// LoadScreenPowerConfig 从文件中读取屏幕电源策略，出错时返回 DefaultScreenPowerConfig
+func LoadScreenPowerConfig(filename string) (ScreenPowerConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return DefaultScreenPowerConfig, err
+	}
+	var cfg ScreenPowerConfig
+	err = json.Unmarshal(data, &cfg)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return DefaultScreenPowerConfig, err
+	}
+	return cfg, nil
+}
+
+func SaveScreenPowerConfig(filename string, cfg ScreenPowerConfig) error {
+	data, err := json.Marshal(&cfg)
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, data, 0644, 0)
+}
+
+// ScreenPowerBackend 调节亮度和 DPMS，调用时持有 ScreenPower 的锁，不能长时间阻塞
+type ScreenPowerBackend interface {
+	// Dim 把亮度调暗到 level，不修改保存的亮度，正在恢复亮度时先停止渐变
+	Dim(level float64) error
+	// Restore 渐变地恢复调暗之前的亮度，渐变在后台进行，比如使用 Fader
+	Restore() error
+	SetDPMS(on bool) error
+}
+
+// ScreenPowerRetryInterval 是调节亮度或者 DPMS 出错之后重试的间隔
+const ScreenPowerRetryInterval = time.Second
+
+// ScreenPower 根据空闲时间决定屏幕的状态，空闲时间由调用者提供。
+// 屏幕调暗或者关闭之后，调用者监听用户的输入，有输入时再调用 Update 恢复，不需要轮询。
+type ScreenPower struct {
+	Backend ScreenPowerBackend
+
+	mu        sync.Mutex
+	cfg       ScreenPowerConfig
+	onBattery bool
+	// 有抑制空闲的程序，比如正在播放视频，不调暗也不关闭屏幕
+	inhibited bool
+	locked    bool
+	dimmed    bool
+	off       bool
+	// 由 ForceOff 关闭了屏幕，空闲时间小于 forcedIdle 表示之后用户有输入
+	forced     bool
+	forcedIdle time.Duration
+}
+
+func NewScreenPower(backend ScreenPowerBackend, cfg ScreenPowerConfig) *ScreenPower {
+	return &ScreenPower{Backend: backend, cfg: cfg}
+}
+
+func (p *ScreenPower) Config() ScreenPowerConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.cfg
+}
+
+// SetConfig 修改设置，之后需要调用 Update 使其生效
+func (p *ScreenPower) SetConfig(cfg ScreenPowerConfig) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.cfg = cfg
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *ScreenPower) SetOnBattery(onBattery bool) {
+	p.mu.Lock()
+	p.onBattery = onBattery
+	p.mu.Unlock()
+}
+
+func (p *ScreenPower) SetInhibited(inhibited bool) {
+	p.mu.Lock()
+	p.inhibited = inhibited
+	p.mu.Unlock()
+}
+
+// SetLocked 在锁屏和解锁时调用，之后需要调用 Update 使其生效
+func (p *ScreenPower) SetLocked(locked bool) {
+	p.mu.Lock()
+	p.locked = locked
+	p.mu.Unlock()
+}
+
+func (p *ScreenPower) Dimmed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dimmed
+}
+
+func (p *ScreenPower) Off() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.off
+}
+
+// 当前供电方式下的设置，调用时需要持有 p.mu
+func (p *ScreenPower) timeouts() ScreenPowerTimeouts {
+	if p.onBattery {
+		return p.cfg.Battery
+	}
+	return p.cfg.AC
+}
+
+func secondsToDuration(seconds uint32) time.Duration {
+	return time.Duration(seconds) * time.Second
+}
+
+// WaitingForInput 返回屏幕是否调暗或者关闭了，这时调用者需要在用户有输入时调用 Update
+func (p *ScreenPower) WaitingForInput() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dimmed || p.off
+}
+
+// ForceOff 立即关闭屏幕，用于关机、挂起等，idle 是当前的空闲时间。
+// 用户之后有输入时由 Update 打开屏幕。
+func (p *ScreenPower) ForceOff(idle time.Duration) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.off {
+		err := p.Backend.SetDPMS(false)
+		if err != nil {
+			return err
+		}
+		p.off = true
+	}
+	p.forced = true
+	p.forcedIdle = idle
+	return nil
+}
+
+// 当前生效的延迟，锁屏时使用较短的关闭延迟，调用时需要持有 p.mu
+func (p *ScreenPower) delays() (dimDelay, offDelay uint32) {
+	t := p.timeouts()
+	if !p.locked {
+		if p.inhibited {
+			return 0, 0
+		}
+		return t.DimDelay, t.OffDelay
+	}
+	dimDelay, offDelay = t.DimDelay, t.OffDelay
+	if p.cfg.LockedOffDelay > 0 && (offDelay == 0 || p.cfg.LockedOffDelay < offDelay) {
+		offDelay = p.cfg.LockedOffDelay
+	}
+	// 关闭之前来不及调暗
+	if offDelay > 0 && dimDelay >= offDelay {
+		dimDelay = 0
+	}
+	return dimDelay, offDelay
+}
+
+// Update 按空闲时间 idle 调暗、关闭或者恢复屏幕，返回距离下一次需要调用 Update 的时间，
+// 为 0 时表示不需要定时检查，直到用户有输入，或者设置、供电方式、抑制和锁屏状态变化。
+// 出错时状态不变，返回 ScreenPowerRetryInterval。
+func (p *ScreenPower) Update(idle time.Duration) (time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// 强制关闭之后空闲时间变小了，表示用户有输入
+	if p.forced {
+		if idle < p.forcedIdle {
+			p.forced = false
+		} else {
+			p.forcedIdle = idle
+		}
+	}
+	t := p.timeouts()
+	dimDelay, offDelay := p.delays()
+	wantDim := dimDelay > 0 && idle >= secondsToDuration(dimDelay)
+	wantOff := p.forced || (offDelay > 0 && idle >= secondsToDuration(offDelay))
+
+	// 恢复时先打开屏幕再恢复亮度，关闭时先调暗再关闭屏幕
+	if p.off && !wantOff {
+		err := p.Backend.SetDPMS(true)
+		if err != nil {
+			return ScreenPowerRetryInterval, err
+		}
+		p.off = false
+	}
+	if wantDim && !p.dimmed {
+		err := p.Backend.Dim(t.DimLevel)
+		if err != nil {
+			return ScreenPowerRetryInterval, err
+		}
+		p.dimmed = true
+	} else if !wantDim && !wantOff && p.dimmed {
+		err := p.Backend.Restore()
+		if err != nil {
+			return ScreenPowerRetryInterval, err
+		}
+		p.dimmed = false
+	}
+	if wantOff && !p.off {
+		err := p.Backend.SetDPMS(false)
+		if err != nil {
+			return ScreenPowerRetryInterval, err
+		}
+		p.off = true
+	}
+
+	if p.off {
+		return 0, nil
+	}
+	var next time.Duration
+	for _, delay := range []uint32{dimDelay, offDelay} {
+		d := secondsToDuration(delay)
+		if delay == 0 || d <= idle {
+			continue
+		}
+		if next == 0 || d-idle < next {
+			next = d - idle
+		}
+	}
+	return next, nil
+}
+
+// BrightnessFade 返回从 from 渐变到 to 的 steps 个亮度值，最后一个是 to
+func BrightnessFade(from, to float64, steps int) []float64 {
+	if steps < 1 {
+		steps = 1
+	}
+	result := make([]float64, steps)
+	for i := range result {
+		result[i] = from + (to-from)*float64(i+1)/float64(steps)
+	}
+	result[steps-1] = to
+	return result
+}
+
+// Fader 在后台按固定的间隔执行渐变的每一步，可以随时停止
+type Fader struct {
+	mu     sync.Mutex
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+// Start 停止之前的渐变，然后开始新的渐变，立即执行第一步，之后每隔 interval 执行一步
+func (f *Fader) Start(steps int, interval time.Duration, step func(i int)) {
+	f.Stop()
+	cancel := make(chan struct{})
+	done := make(chan struct{})
+	f.mu.Lock()
+	f.cancel = cancel
+	f.done = done
+	f.mu.Unlock()
+
+	go func() {
+		defer close(done)
+		for i := 0; i < steps; i++ {
+			if i > 0 {
+				select {
+				case <-cancel:
+					return
+				case <-time.After(interval):
+				}
+			}
+			step(i)
+		}
+	}()
+}
+
+// Stop 停止正在进行的渐变，返回之后不会再执行任何一步
+func (f *Fader) Stop() {
+	f.mu.Lock()
+	cancel, done := f.cancel, f.done
+	f.cancel = nil
+	f.done = nil
+	f.mu.Unlock()
+	if cancel == nil {
+		return
+	}
+	close(cancel)
+	<-done
+}
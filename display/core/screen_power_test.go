@@ -0,0 +1,278 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 记录调用的假后端
+type fakeScreenPowerBackend struct {
+	calls []string
+	err   error
+}
+
+func (b *fakeScreenPowerBackend) Dim(level float64) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.calls = append(b.calls, fmt.Sprintf("dim %v", level))
+	return nil
+}
+
+func (b *fakeScreenPowerBackend) Restore() error {
+	if b.err != nil {
+		return b.err
+	}
+	b.calls = append(b.calls, "restore")
+	return nil
+}
+
+func (b *fakeScreenPowerBackend) SetDPMS(on bool) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.calls = append(b.calls, fmt.Sprintf("dpms %v", on))
+	return nil
+}
+
+func (b *fakeScreenPowerBackend) takeCalls() []string {
+	calls := b.calls
+	b.calls = nil
+	return calls
+}
+
+var testScreenPowerConfig = ScreenPowerConfig{
+	AC:      ScreenPowerTimeouts{DimDelay: 300, OffDelay: 600, DimLevel: 0.3},
+	Battery: ScreenPowerTimeouts{DimDelay: 120, OffDelay: 300, DimLevel: 0.2},
+}
+
+func TestScreenPower(t *testing.T) {
+	backend := &fakeScreenPowerBackend{}
+	p := NewScreenPower(backend, ScreenPowerConfig{
+		AC:      ScreenPowerTimeouts{DimDelay: 60, OffDelay: 120, DimLevel: 0.3},
+		Battery: ScreenPowerTimeouts{DimDelay: 30, OffDelay: 0, DimLevel: 0.1},
+	})
+
+	next, err := p.Update(10 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 50*time.Second, next)
+	assert.Empty(t, backend.takeCalls())
+
+	// 调暗之后还要定时关闭屏幕，恢复由用户的输入触发
+	next, err = p.Update(60 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 60*time.Second, next)
+	assert.Equal(t, []string{"dim 0.3"}, backend.takeCalls())
+	assert.True(t, p.Dimmed())
+	assert.True(t, p.WaitingForInput())
+
+	// 关闭之后不需要定时检查
+	next, err = p.Update(125 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), next)
+	assert.Equal(t, []string{"dpms false"}, backend.takeCalls())
+	assert.True(t, p.Off())
+
+	// 用户有输入，先打开屏幕再恢复亮度
+	next, err = p.Update(0)
+	require.NoError(t, err)
+	assert.Equal(t, 60*time.Second, next)
+	assert.Equal(t, []string{"dpms true", "restore"}, backend.takeCalls())
+	assert.False(t, p.Dimmed())
+	assert.False(t, p.Off())
+
+	// 使用电池时按电池的设置，不关闭屏幕
+	p.SetOnBattery(true)
+	next, err = p.Update(20 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Second, next)
+	next, err = p.Update(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), next)
+	assert.Equal(t, []string{"dim 0.1"}, backend.takeCalls())
+	assert.False(t, p.Off())
+}
+
+func TestScreenPower_Locked(t *testing.T) {
+	backend := &fakeScreenPowerBackend{}
+	cfg := testScreenPowerConfig
+	cfg.LockedOffDelay = 60
+	p := NewScreenPower(backend, cfg)
+
+	// 锁屏时不考虑抑制空闲的程序，使用较短的关闭延迟，来不及调暗
+	p.SetInhibited(true)
+	p.SetLocked(true)
+	next, err := p.Update(10 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 50*time.Second, next)
+	_, err = p.Update(60 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dpms false"}, backend.takeCalls())
+
+	// 解锁之后恢复
+	p.SetLocked(false)
+	next, err = p.Update(0)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), next)
+	assert.Equal(t, []string{"dpms true"}, backend.takeCalls())
+
+	// 没有设置锁屏的延迟时和没有锁屏时相同
+	p = NewScreenPower(backend, testScreenPowerConfig)
+	p.SetLocked(true)
+	next, err = p.Update(0)
+	require.NoError(t, err)
+	assert.Equal(t, 300*time.Second, next)
+}
+
+func TestScreenPower_ForceOff(t *testing.T) {
+	backend := &fakeScreenPowerBackend{}
+	p := NewScreenPower(backend, DefaultScreenPowerConfig)
+	require.NoError(t, p.ForceOff(2*time.Second))
+	assert.Equal(t, []string{"dpms false"}, backend.takeCalls())
+
+	// 空闲时间一直增加，保持关闭
+	next, err := p.Update(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), next)
+	assert.True(t, p.Off())
+	assert.Empty(t, backend.takeCalls())
+
+	// 用户有输入时打开
+	_, err = p.Update(0)
+	require.NoError(t, err)
+	assert.False(t, p.Off())
+	assert.Equal(t, []string{"dpms true"}, backend.takeCalls())
+}
+
+func TestScreenPower_Inhibited(t *testing.T) {
+	backend := &fakeScreenPowerBackend{}
+	p := NewScreenPower(backend, testScreenPowerConfig)
+
+	_, err := p.Update(1000 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dim 0.3", "dpms false"}, backend.takeCalls())
+
+	// 抑制空闲时立即恢复，之后不需要定时检查
+	p.SetInhibited(true)
+	next, err := p.Update(1000 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), next)
+	assert.Equal(t, []string{"dpms true", "restore"}, backend.takeCalls())
+
+	p.SetInhibited(false)
+	next, err = p.Update(100 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 200*time.Second, next)
+	assert.Empty(t, backend.takeCalls())
+}
+
+func TestScreenPower_Error(t *testing.T) {
+	backend := &fakeScreenPowerBackend{err: errors.New("failed")}
+	p := NewScreenPower(backend, testScreenPowerConfig)
+
+	next, err := p.Update(400 * time.Second)
+	assert.Error(t, err)
+	assert.Equal(t, ScreenPowerRetryInterval, next)
+	assert.False(t, p.Dimmed())
+
+	// 出错之后重试
+	backend.err = nil
+	_, err = p.Update(400 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dim 0.3"}, backend.takeCalls())
+}
+
+func TestScreenPower_Disabled(t *testing.T) {
+	// 默认不调暗也不关闭屏幕
+	backend := &fakeScreenPowerBackend{}
+	p := NewScreenPower(backend, DefaultScreenPowerConfig)
+	next, err := p.Update(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, time.Duration(0), next)
+	assert.Empty(t, backend.takeCalls())
+}
+
+func TestScreenPowerConfig(t *testing.T) {
+	assert.NoError(t, DefaultScreenPowerConfig.Validate())
+	assert.NoError(t, ScreenPowerConfig{}.Validate())
+	assert.Error(t, ScreenPowerConfig{
+		AC: ScreenPowerTimeouts{DimDelay: 60, OffDelay: 60},
+	}.Validate())
+	assert.Error(t, ScreenPowerConfig{
+		Battery: ScreenPowerTimeouts{DimLevel: 1.5},
+	}.Validate())
+
+	p := NewScreenPower(&fakeScreenPowerBackend{}, DefaultScreenPowerConfig)
+	assert.Error(t, p.SetConfig(ScreenPowerConfig{AC: ScreenPowerTimeouts{DimLevel: -1}}))
+	assert.Equal(t, DefaultScreenPowerConfig, p.Config())
+
+	dir, err := ioutil.TempDir("", "display-core")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "screen-power.json")
+
+	cfg, err := LoadScreenPowerConfig(filename)
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, DefaultScreenPowerConfig, cfg)
+
+	cfg = testScreenPowerConfig
+	cfg.Battery.OffDelay = 0
+	cfg.LockedOffDelay = 30
+	require.NoError(t, SaveScreenPowerConfig(filename, cfg))
+	loaded, err := LoadScreenPowerConfig(filename)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, loaded)
+
+	require.NoError(t, ioutil.WriteFile(filename, []byte(`{"AC":{"DimDelay":60,"OffDelay":30}}`), 0644))
+	loaded, err = LoadScreenPowerConfig(filename)
+	assert.Error(t, err)
+	assert.Equal(t, DefaultScreenPowerConfig, loaded)
+}
+
+func TestBrightnessFade(t *testing.T) {
+	assert.InDeltaSlice(t, []float64{0.4, 0.6, 0.8, 1}, BrightnessFade(0.2, 1, 4), 1e-9)
+	assert.Equal(t, []float64{0.5}, BrightnessFade(0.2, 0.5, 0))
+}
+
+func TestFader(t *testing.T) {
+	var f Fader
+	steps := make(chan int, 10)
+	f.Start(3, time.Millisecond, func(i int) {
+		steps <- i
+	})
+	for i := 0; i < 3; i++ {
+		select {
+		case step := <-steps:
+			assert.Equal(t, i, step)
+		case <-time.After(time.Second):
+			t.Fatal("fade not finished")
+		}
+	}
+	f.Stop()
+
+	// 停止之后不再执行剩下的步骤，新的渐变代替旧的
+	f.Start(10, time.Hour, func(i int) {
+		steps <- i
+	})
+	f.Stop()
+	assert.Len(t, steps, 1)
+	<-steps
+	f.Start(2, time.Hour, func(i int) {
+		steps <- 10 + i
+	})
+	f.Start(1, time.Hour, func(i int) {
+		steps <- 20 + i
+	})
+	f.Stop()
+	assert.Equal(t, 10, <-steps)
+	assert.Equal(t, 20, <-steps)
+	assert.Len(t, steps, 0)
+}
@@ -0,0 +1,361 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ModeSwitcher 实现各个显示模式的切换，通过 Backend 应用布局，修改传入的 ScreenConfig 后调用 SaveConfig 保存
+type ModeSwitcher struct {
+	Backend OutputBackend
+	// 返回当前主屏幕的名称，接口类型相同时用来保持主屏幕不变
+	GetPrimary func() string
+	SaveConfig func() error
+	// 保存输出设备的当前状态之前调用，去掉合上盖子禁用内置显示器等临时的修改
+	FixConfigs func(configs []*MonitorConfig)
+}
+
+func (s *ModeSwitcher) currentPrimary() string {
+	if s.GetPrimary == nil {
+		return ""
+	}
+	return s.GetPrimary()
+}
+
+func (s *ModeSwitcher) saveConfig() error {
+	if s.SaveConfig == nil {
+		return nil
+	}
+	return s.SaveConfig()
+}
+
+func (s *ModeSwitcher) listOutputs() ([]*Output, error) {
+	outputs, err := s.Backend.ListOutputs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outputs: %v", err)
+	}
+	return outputs, nil
+}
+
+// 应用布局后保存所有已连接输出设备的当前状态
+func (s *ModeSwitcher) applyAndSave(screenCfg *ScreenConfig, mode uint8, customName string,
+	layout *Layout) error {
+	err := s.Backend.ApplyLayout(layout)
+	if err != nil {
+		return err
+	}
+	if layout.Primary == 0 {
+		return nil
+	}
+
+	outputs, err := s.listOutputs()
+	if err != nil {
+		return err
+	}
+	var primaryName string
+	for _, o := range outputs {
+		if o.ID == layout.Primary {
+			primaryName = o.Name
+			break
+		}
+	}
+	screenCfg.SetMonitorConfigs(mode, customName, ToMonitorConfigs(outputs, primaryName))
+	return s.saveConfig()
+}
+
+func (s *ModeSwitcher) mirrorLayout(screenCfg *ScreenConfig) (*Layout, error) {
+	outputs, err := s.listOutputs()
+	if err != nil {
+		return nil, err
+	}
+	configs := screenCfg.GetMonitorConfigs(DisplayModeMirror, "")
+	return MirrorLayout(outputs, configs, s.currentPrimary())
+}
+
+func (s *ModeSwitcher) SwitchModeMirror(screenCfg *ScreenConfig) error {
+	layout, err := s.mirrorLayout(screenCfg)
+	if err != nil {
+		return err
+	}
+	return s.applyAndSave(screenCfg, DisplayModeMirror, "", layout)
+}
+
+func (s *ModeSwitcher) SwitchModeExtend(screenCfg *ScreenConfig) error {
+	outputs, err := s.listOutputs()
+	if err != nil {
+		return err
+	}
+	configs := screenCfg.GetMonitorConfigs(DisplayModeExtend, "")
+	layout := ExtendLayout(outputs, configs, s.currentPrimary())
+	return s.applyAndSave(screenCfg, DisplayModeExtend, "", layout)
+}
+
+// SwitchModeOnlyOne 只启用名称为 name 的显示器，name 为空时使用配置中启用的显示器，
+// 没有配置时使用 ID 最小的显示器
+func (s *ModeSwitcher) SwitchModeOnlyOne(screenCfg *ScreenConfig, name string) error {
+	outputs, err := s.listOutputs()
+	if err != nil {
+		return err
+	}
+	configs := screenCfg.GetMonitorConfigs(DisplayModeOnlyOne, "")
+
+	var output0 *Output
+	var needSaveCfg bool
+	if name != "" {
+		needSaveCfg = true
+		output0 = GetOutputByName(outputs, name)
+		if output0 == nil {
+			return errors.New("not found monitor")
+		}
+		if !output0.Connected {
+			return errors.New("monitor is not connected")
+		}
+	} else {
+		for _, cfg := range configs {
+			if cfg.Enabled {
+				output0 = getOutputByUuid(ConnectedOutputs(outputs), cfg.UUID)
+				break
+			}
+		}
+		if output0 == nil {
+			needSaveCfg = true
+			output0 = getMinIDOutput(ConnectedOutputs(outputs))
+		}
+	}
+	if output0 == nil {
+		return errors.New("monitor0 is nil")
+	}
+
+	layout := OnlyOneLayout(output0, configs)
+	if !needSaveCfg {
+		return s.Backend.ApplyLayout(layout)
+	}
+	return s.applyAndSave(screenCfg, DisplayModeOnlyOne, "", layout)
+}
+
+// SwitchModeCustom 应用名称为 name 的自定义配置，配置不存在时使用复制模式并保存为新的自定义配置，
+// 此时 created 为 true
+func (s *ModeSwitcher) SwitchModeCustom(screenCfg *ScreenConfig, name string) (created bool, err error) {
+	if name == "" {
+		return false, errors.New("name is empty")
+	}
+
+	configs := screenCfg.GetMonitorConfigs(DisplayModeCustom, name)
+	if len(configs) > 0 {
+		return false, s.ApplyConfigs(configs)
+	}
+
+	// 自定义配置不存在时，默认使用复制模式，即自定义模式的合并子模式
+	layout, err := s.mirrorLayout(screenCfg)
+	if err != nil {
+		return false, err
+	}
+	err = s.applyAndSave(screenCfg, DisplayModeCustom, name, layout)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ApplyConfigs 按配置设置所有输出设备，配置中没有主屏幕时使用默认的主屏幕
+func (s *ModeSwitcher) ApplyConfigs(configs []*MonitorConfig) error {
+	outputs, err := s.listOutputs()
+	if err != nil {
+		return err
+	}
+	return s.Backend.ApplyLayout(ConfigsLayout(outputs, configs, s.currentPrimary()))
+}
+
+// ApplySingle 只连接了一个显示器时使用 Single 配置，没有配置时使用最佳模式
+func (s *ModeSwitcher) ApplySingle(screenCfg *ScreenConfig) error {
+	config := screenCfg.Single
+	if config == nil {
+		outputs, err := s.listOutputs()
+		if err != nil {
+			return err
+		}
+		connected := ConnectedOutputs(outputs)
+		if len(connected) != 1 {
+			return fmt.Errorf("expect 1 connected output, got %d", len(connected))
+		}
+		o := connected[0]
+		config = &MonitorConfig{
+			UUID:        o.UUID,
+			Name:        o.Name,
+			Enabled:     true,
+			Width:       o.BestMode.Width,
+			Height:      o.BestMode.Height,
+			Rotation:    RotationRotate0,
+			RefreshRate: o.BestMode.Rate,
+			Primary:     true,
+		}
+	}
+	return s.ApplyConfigs([]*MonitorConfig{config})
+}
+
+// DisplayModeResult 是 ApplyDisplayMode 之后的显示模式，调用者据此更新属性
+type DisplayModeResult struct {
+	// 使用了用户的方案时变为自定义模式，CustomId 为方案的名称
+	Mode     uint8
+	CustomId string
+	// 保存了新的配置，自定义配置列表可能已经变化
+	CustomIdListChanged bool
+	// 套用方案或者相似布局时出现的错误，不影响结果，调用者只需要记录下来
+	FallbackErr error
+}
+
+func getScreenConfig(c Config, id string) *ScreenConfig {
+	screenCfg := c[id]
+	if screenCfg == nil {
+		screenCfg = &ScreenConfig{}
+		c[id] = screenCfg
+	}
+	return screenCfg
+}
+
+// ApplyDisplayMode 在启动和热插拔之后应用显示模式，c 是所有显示器组合的配置。
+// 只连接了一个显示器时使用 Single 配置；当前的显示器组合没有保存过配置时，
+// 先尝试匹配 profiles 中的方案，再套用最相似的已保存布局；都不行时按 mode 切换。
+func (s *ModeSwitcher) ApplyDisplayMode(c Config, profiles []*DisplayProfile, mode uint8,
+	customId string) (*DisplayModeResult, error) {
+	outputs, err := s.listOutputs()
+	if err != nil {
+		return nil, err
+	}
+	connected := ConnectedOutputs(outputs)
+	uuids := make([]string, len(connected))
+	for i, o := range connected {
+		uuids[i] = o.UUID
+	}
+	id := GetMonitorsId(uuids)
+
+	result := &DisplayModeResult{Mode: mode, CustomId: customId}
+	if len(connected) == 1 {
+		// 单屏
+		return result, s.ApplySingle(getScreenConfig(c, id))
+	}
+
+	if id != "" && c[id] == nil {
+		var ok bool
+		ok, result.FallbackErr = s.applyFallbackLayout(c, id, profiles, outputs, result)
+		if ok {
+			return result, nil
+		}
+	}
+
+	screenCfg := getScreenConfig(c, id)
+	switch mode {
+	case DisplayModeCustom:
+		result.CustomIdListChanged, err = s.SwitchModeCustom(screenCfg, customId)
+	case DisplayModeMirror:
+		err = s.SwitchModeMirror(screenCfg)
+	case DisplayModeExtend:
+		err = s.SwitchModeExtend(screenCfg)
+	case DisplayModeOnlyOne:
+		err = s.SwitchModeOnlyOne(screenCfg, "")
+	}
+	return result, err
+}
+
+// 当前的显示器组合 id 没有保存过配置时，先尝试匹配用户的方案，再套用最相似的已保存布局。
+// 返回 true 表示已经处理。
+func (s *ModeSwitcher) applyFallbackLayout(c Config, id string, profiles []*DisplayProfile,
+	outputs []*Output, result *DisplayModeResult) (bool, error) {
+	infos := getMonitorInfos(outputs)
+	profile, configs := findBestProfile(profiles, infos)
+	if profile != nil {
+		err := s.ApplyConfigs(configs)
+		if err != nil {
+			return false, fmt.Errorf("failed to apply profile %q: %v", profile.Name, err)
+		}
+		// 以方案的名称保存为当前显示器组合的自定义模式，以后再连接同样的显示器时直接使用
+		getScreenConfig(c, id).SetMonitorConfigs(DisplayModeCustom, profile.Name, configs)
+		err = s.saveConfig()
+		if err != nil {
+			return false, fmt.Errorf("failed to save profile %q: %v", profile.Name, err)
+		}
+		result.Mode = DisplayModeCustom
+		result.CustomId = profile.Name
+		result.CustomIdListChanged = true
+		return true, nil
+	}
+
+	// 复制模式和单屏模式不需要布局
+	if result.Mode != DisplayModeExtend &&
+		!(result.Mode == DisplayModeCustom && result.CustomId != "") {
+		return false, nil
+	}
+	configs = findSimilarLayout(c, infos)
+	if configs == nil {
+		return false, nil
+	}
+	err := s.ApplyConfigs(configs)
+	if err != nil {
+		return false, fmt.Errorf("failed to apply similar layout: %v", err)
+	}
+	getScreenConfig(c, id).SetMonitorConfigs(result.Mode, result.CustomId, configs)
+	result.CustomIdListChanged = true
+	err = s.saveConfig()
+	if err != nil {
+		return true, fmt.Errorf("failed to save config: %v", err)
+	}
+	return true, nil
+}
+
+// UpdateMonitorConfigsName 更新配置中的显示器名称，UUID 相同时名称可能已经变化
+func UpdateMonitorConfigsName(configs []*MonitorConfig, outputs []*Output) {
+	for _, mc := range configs {
+		if o := getOutputByUuid(outputs, mc.UUID); o != nil {
+			mc.Name = o.Name
+		}
+	}
+}
+
+// SetPrimary 设置主屏幕并更新 mode 模式的配置，复制模式下不允许设置
+func (s *ModeSwitcher) SetPrimary(screenCfg *ScreenConfig, mode uint8, customName, name string) error {
+	switch mode {
+	case DisplayModeMirror:
+		return errors.New("not allow set primary in mirror mode")
+
+	case DisplayModeOnlyOne:
+		return s.SwitchModeOnlyOne(screenCfg, name)
+
+	case DisplayModeExtend, DisplayModeCustom:
+		outputs, err := s.listOutputs()
+		if err != nil {
+			return err
+		}
+		output0 := GetOutputByName(outputs, name)
+		if output0 == nil {
+			return errors.New("not found monitor")
+		}
+		if !output0.Connected {
+			return errors.New("monitor is not connected")
+		}
+
+		configs := screenCfg.GetMonitorConfigs(mode, customName)
+		if len(configs) == 0 {
+			if mode == DisplayModeCustom {
+				return errors.New("custom mode configs is empty")
+			}
+			configs = ToMonitorConfigs(outputs, output0.Name)
+			if s.FixConfigs != nil {
+				s.FixConfigs(configs)
+			}
+		} else {
+			UpdateMonitorConfigsName(configs, outputs)
+			SetMonitorConfigsPrimary(configs, output0.UUID)
+		}
+
+		err = s.Backend.SetPrimary(output0.ID)
+		if err != nil {
+			return err
+		}
+
+		screenCfg.SetMonitorConfigs(mode, customName, configs)
+		return s.saveConfig()
+
+	default:
+		return fmt.Errorf("invalid display mode %v", mode)
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSwitcher() (*ModeSwitcher, *FakeBackend, *int) {
+	backend := NewFakeBackend(newTestOutputs()...)
+	saveCount := new(int)
+	s := &ModeSwitcher{
+		Backend: backend,
+		SaveConfig: func() error {
+			*saveCount++
+			return nil
+		},
+	}
+	return s, backend, saveCount
+}
+
+func TestModeSwitcher_SwitchModeExtend(t *testing.T) {
+	s, backend, saveCount := newTestSwitcher()
+	screenCfg := &ScreenConfig{}
+	err := s.SwitchModeExtend(screenCfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, *saveCount)
+	assert.Equal(t, uint32(66), backend.Primary())
+	assert.Equal(t, int16(1366), backend.Output(70).X)
+	assert.False(t, backend.Output(80).Enabled)
+
+	configs := screenCfg.GetMonitorConfigs(DisplayModeExtend, "")
+	require.Len(t, configs, 2)
+	assert.Equal(t, "eDP-1", configs[0].Name)
+	assert.True(t, configs[0].Primary)
+	assert.Equal(t, uint16(1920), configs[1].Width)
+}
+
+func TestModeSwitcher_SwitchModeMirror(t *testing.T) {
+	s, backend, _ := newTestSwitcher()
+	screenCfg := &ScreenConfig{}
+	err := s.SwitchModeMirror(screenCfg)
+	require.NoError(t, err)
+	assert.Equal(t, mode1080p60, backend.Output(66).Mode)
+	assert.Equal(t, mode1080p60, backend.Output(70).Mode)
+	assert.Equal(t, int16(0), backend.Output(70).X)
+	assert.Len(t, screenCfg.GetMonitorConfigs(DisplayModeMirror, ""), 2)
+}
+
+func TestModeSwitcher_SwitchModeOnlyOne(t *testing.T) {
+	s, backend, saveCount := newTestSwitcher()
+	screenCfg := &ScreenConfig{}
+
+	err := s.SwitchModeOnlyOne(screenCfg, "VGA-1")
+	assert.Error(t, err)
+	err = s.SwitchModeOnlyOne(screenCfg, "HDMI-1")
+	require.NoError(t, err)
+	assert.True(t, backend.Output(70).Enabled)
+	assert.False(t, backend.Output(66).Enabled)
+	assert.Equal(t, uint32(70), backend.Primary())
+	assert.Equal(t, 1, *saveCount)
+
+	// 使用配置中启用的显示器，不需要保存
+	err = s.SwitchModeExtend(screenCfg)
+	require.NoError(t, err)
+	*saveCount = 0
+	err = s.SwitchModeOnlyOne(screenCfg, "")
+	require.NoError(t, err)
+	assert.True(t, backend.Output(70).Enabled)
+	assert.False(t, backend.Output(66).Enabled)
+	assert.Equal(t, 0, *saveCount)
+}
+
+func TestModeSwitcher_SwitchModeCustom(t *testing.T) {
+	s, backend, _ := newTestSwitcher()
+	screenCfg := &ScreenConfig{}
+
+	_, err := s.SwitchModeCustom(screenCfg, "")
+	assert.Error(t, err)
+
+	// 不存在时使用复制模式并保存
+	created, err := s.SwitchModeCustom(screenCfg, "abc")
+	require.NoError(t, err)
+	assert.True(t, created)
+	configs := screenCfg.GetMonitorConfigs(DisplayModeCustom, "abc")
+	require.Len(t, configs, 2)
+
+	configs[1].X = 1920
+	created, err = s.SwitchModeCustom(screenCfg, "abc")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, int16(1920), backend.Output(70).X)
+}
+
+func TestModeSwitcher_SetPrimary(t *testing.T) {
+	s, backend, _ := newTestSwitcher()
+	screenCfg := &ScreenConfig{}
+	require.NoError(t, s.SwitchModeExtend(screenCfg))
+
+	err := s.SetPrimary(screenCfg, DisplayModeMirror, "", "HDMI-1")
+	assert.Error(t, err)
+	err = s.SetPrimary(screenCfg, DisplayModeExtend, "", "VGA-1")
+	assert.Error(t, err)
+
+	err = s.SetPrimary(screenCfg, DisplayModeExtend, "", "HDMI-1")
+	require.NoError(t, err)
+	assert.Equal(t, uint32(70), backend.Primary())
+	configs := screenCfg.GetMonitorConfigs(DisplayModeExtend, "")
+	assert.False(t, GetMonitorConfigByUuid(configs, "eDP-1bbbb").Primary)
+	assert.True(t, GetMonitorConfigByUuid(configs, "HDMI-1aaaa").Primary)
+
+	err = s.SetPrimary(screenCfg, DisplayModeCustom, "none", "HDMI-1")
+	assert.Error(t, err)
+}
+
+func TestModeSwitcher_applyFailed(t *testing.T) {
+	s, backend, saveCount := newTestSwitcher()
+	backend.ApplyErr = errors.New("apply failed")
+	screenCfg := &ScreenConfig{}
+	err := s.SwitchModeExtend(screenCfg)
+	assert.Error(t, err)
+	assert.Equal(t, 0, *saveCount)
+	assert.Nil(t, screenCfg.Extend)
+	assert.False(t, backend.Output(70).Enabled)
+}
+
+func TestFakeBackend_Hotplug(t *testing.T) {
+	backend := NewFakeBackend(newTestOutputs()...)
+	count := 0
+	unsubscribe := backend.SubscribeHotplug(func() {
+		count++
+	})
+	backend.Disconnect(70)
+	assert.False(t, backend.Output(70).Connected)
+	backend.Connect(&Output{ID: 80, Name: "VGA-1", UUID: "VGA-1"})
+	assert.True(t, backend.Output(80).Connected)
+	assert.Equal(t, 2, count)
+
+	unsubscribe()
+	backend.Disconnect(80)
+	assert.Equal(t, 2, count)
+
+	// 不能启用没有连接的输出设备
+	err := backend.ApplyLayout(&Layout{Outputs: []OutputConfig{
+		{ID: 80, Enabled: true, Mode: mode1080p60},
+	}})
+	assert.Error(t, err)
+}
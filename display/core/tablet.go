@@ -0,0 +1,23 @@
+package core
+
+// KeepAspectRect 返回输出设备区域中保持数位板宽高比的最大区域，位于中间。
+// x、y、width、height 是输出设备在屏幕中占用的区域，已经包含了旋转；
+// 旋转 90 或 270 度时数位板的宽和高也会交换。数位板的大小未知时返回原区域。
+func KeepAspectRect(x, y int16, width, height uint16, rotation uint16,
+	tabletWidth, tabletHeight float64) (int16, int16, uint16, uint16) {
+	if tabletWidth <= 0 || tabletHeight <= 0 || width == 0 || height == 0 {
+		return x, y, width, height
+	}
+	if rotation == RotationRotate90 || rotation == RotationRotate270 {
+		tabletWidth, tabletHeight = tabletHeight, tabletWidth
+	}
+
+	aspect := tabletWidth / tabletHeight
+	if float64(width)/float64(height) > aspect {
+		// 显示器更宽，左右留空
+		w := uint16(float64(height)*aspect + 0.5)
+		return x + int16((width-w)/2), y, w, height
+	}
+	h := uint16(float64(width)/aspect + 0.5)
+	return x, y + int16((height-h)/2), width, h
+}
@@ -0,0 +1,25 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeepAspectRect(t *testing.T) {
+	// 16:10 的数位板映射到 16:9 的显示器，左右留空
+	x, y, w, h := KeepAspectRect(1920, 0, 1920, 1080, RotationRotate0, 216, 135)
+	assert.Equal(t, []int{2016, 0, 1728, 1080}, []int{int(x), int(y), int(w), int(h)})
+
+	// 4:3 的显示器，上下留空
+	x, y, w, h = KeepAspectRect(0, 0, 1024, 768, RotationRotate0, 216, 135)
+	assert.Equal(t, []int{0, 64, 1024, 640}, []int{int(x), int(y), int(w), int(h)})
+
+	// 旋转 90 度时宽和高都交换了
+	x, y, w, h = KeepAspectRect(0, 0, 1080, 1920, RotationRotate90, 216, 135)
+	assert.Equal(t, []int{0, 96, 1080, 1728}, []int{int(x), int(y), int(w), int(h)})
+
+	// 不知道数位板的大小
+	x, y, w, h = KeepAspectRect(10, 20, 1920, 1080, RotationRotate0, 0, 0)
+	assert.Equal(t, []int{10, 20, 1920, 1080}, []int{int(x), int(y), int(w), int(h)})
+}
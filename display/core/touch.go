@@ -0,0 +1,178 @@
+package core
+
+import (
+	"math"
+	"sort"
+)
+
+// RandR 的反射
+const (
+	ReflectX uint16 = 16
+	ReflectY uint16 = 32
+)
+
+// TouchDevice 是触摸屏的物理信息，来自 udev
+type TouchDevice struct {
+	Serial   string
+	MmWidth  float64 // ID_INPUT_WIDTH_MM
+	MmHeight float64 // ID_INPUT_HEIGHT_MM
+	Bus      string  // ID_BUS
+	Path     string  // ID_PATH，包含 USB 拓扑
+}
+
+// 不是通过 USB 或蓝牙连接的触摸屏认为是内置的，一般是 i2c 连接的
+func (t *TouchDevice) isBuiltin() bool {
+	return t.Bus != "usb" && t.Bus != "bluetooth"
+}
+
+// 物理大小相差不超过 10mm 或 5% 认为匹配，触摸屏可能是旋转安装的
+func touchSizeMatch(t *TouchDevice, o *Output) bool {
+	if t.MmWidth <= 0 || t.MmHeight <= 0 || o.MmWidth == 0 || o.MmHeight == 0 {
+		return false
+	}
+	near := func(a float64, b uint32) bool {
+		tolerance := math.Max(10, float64(b)*0.05)
+		return math.Abs(a-float64(b)) <= tolerance
+	}
+	return (near(t.MmWidth, o.MmWidth) && near(t.MmHeight, o.MmHeight)) ||
+		(near(t.MmWidth, o.MmHeight) && near(t.MmHeight, o.MmWidth))
+}
+
+// MatchTouchscreens 为没有关联的触摸屏选择输出设备，返回触摸屏序列号到输出设备名称的映射。
+// mapped 是已有的关联，其中的输出设备不再关联给外接的触摸屏。依次使用以下规则：
+// 内置触摸屏关联内置显示器；物理大小唯一匹配的；
+// 剩下的 USB 触摸屏按 USB 拓扑的顺序关联剩下的外接显示器，只有数量相同时才关联。
+func MatchTouchscreens(touches []*TouchDevice, outputs []*Output, mapped map[string]string) map[string]string {
+	result := make(map[string]string)
+	used := make(map[string]bool)
+	for _, name := range mapped {
+		used[name] = true
+	}
+	connected := ConnectedOutputs(outputs)
+
+	var rest []*TouchDevice
+	for _, t := range touches {
+		if _, ok := mapped[t.Serial]; ok {
+			continue
+		}
+		if t.isBuiltin() {
+			if o := getBuiltinOutput(connected); o != nil {
+				result[t.Serial] = o.Name
+				used[o.Name] = true
+				continue
+			}
+		}
+		rest = append(rest, t)
+	}
+
+	freeOutputs := func() []*Output {
+		var free []*Output
+		for _, o := range connected {
+			if !o.Builtin && !used[o.Name] {
+				free = append(free, o)
+			}
+		}
+		return free
+	}
+
+	var unmatched []*TouchDevice
+	for _, t := range rest {
+		var candidates []*Output
+		for _, o := range freeOutputs() {
+			if touchSizeMatch(t, o) {
+				candidates = append(candidates, o)
+			}
+		}
+		if len(candidates) == 1 {
+			result[t.Serial] = candidates[0].Name
+			used[candidates[0].Name] = true
+		} else if !t.isBuiltin() {
+			unmatched = append(unmatched, t)
+		}
+	}
+
+	// 按 USB 拓扑排序，和从左到右的显示器一一对应
+	free := freeOutputs()
+	if len(unmatched) == 0 || len(unmatched) != len(free) {
+		return result
+	}
+	sort.SliceStable(unmatched, func(i, j int) bool {
+		return unmatched[i].Path < unmatched[j].Path
+	})
+	sort.SliceStable(free, func(i, j int) bool {
+		return free[i].X < free[j].X
+	})
+	for i, t := range unmatched {
+		result[t.Serial] = free[i].Name
+	}
+	return result
+}
+
+func getBuiltinOutput(outputs []*Output) *Output {
+	for _, o := range outputs {
+		if o.Builtin {
+			return o
+		}
+	}
+	return nil
+}
+
+// TouchMatrix 是 3x3 的坐标变换矩阵，按行排列
+type TouchMatrix [9]float64
+
+func (a TouchMatrix) mul(b TouchMatrix) TouchMatrix {
+	var r TouchMatrix
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			var v float64
+			for k := 0; k < 3; k++ {
+				v += a[i*3+k] * b[k*3+j]
+			}
+			r[i*3+j] = v
+		}
+	}
+	return r
+}
+
+var identityTouchMatrix = TouchMatrix{1, 0, 0, 0, 1, 0, 0, 0, 1}
+
+// 和 dxinput 中的旋转矩阵相同
+func rotationTouchMatrix(rotation uint16) TouchMatrix {
+	switch rotation {
+	case RotationRotate90:
+		return TouchMatrix{0, -1, 1, 1, 0, 0, 0, 0, 1}
+	case RotationRotate180:
+		return TouchMatrix{-1, 0, 1, 0, -1, 1, 0, 0, 1}
+	case RotationRotate270:
+		return TouchMatrix{0, 1, 0, -1, 0, 1, 0, 0, 1}
+	default:
+		return identityTouchMatrix
+	}
+}
+
+func reflectTouchMatrix(reflect uint16) TouchMatrix {
+	m := identityTouchMatrix
+	if reflect&ReflectX != 0 {
+		m = m.mul(TouchMatrix{-1, 0, 1, 0, 1, 0, 0, 0, 1})
+	}
+	if reflect&ReflectY != 0 {
+		m = m.mul(TouchMatrix{1, 0, 0, 0, -1, 1, 0, 0, 1})
+	}
+	return m
+}
+
+// GetTouchMatrix 计算触摸屏映射到输出设备的坐标变换矩阵。
+// x、y、width、height 是输出设备在屏幕中占用的区域，已经包含了旋转和缩放。
+func GetTouchMatrix(x, y int16, width, height uint16, rotation, reflect uint16,
+	screenWidth, screenHeight uint16) TouchMatrix {
+	if screenWidth == 0 || screenHeight == 0 {
+		return identityTouchMatrix
+	}
+	sw, sh := float64(screenWidth), float64(screenHeight)
+	rect := TouchMatrix{
+		float64(width) / sw, 0, float64(x) / sw,
+		0, float64(height) / sh, float64(y) / sh,
+		0, 0, 1,
+	}
+	return rect.mul(rotationTouchMatrix(rotation)).mul(reflectTouchMatrix(reflect))
+}
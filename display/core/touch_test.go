@@ -0,0 +1,60 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTouchTestOutputs() []*Output {
+	return []*Output{
+		{ID: 66, Name: "eDP-1", Connected: true, Builtin: true, MmWidth: 294, MmHeight: 165},
+		{ID: 70, Name: "HDMI-1", Connected: true, X: 1920, MmWidth: 527, MmHeight: 296},
+		{ID: 72, Name: "DP-1", Connected: true, X: 3840, MmWidth: 344, MmHeight: 194},
+	}
+}
+
+func TestMatchTouchscreens(t *testing.T) {
+	outputs := newTouchTestOutputs()
+	touches := []*TouchDevice{
+		{Serial: "elan", Bus: "i2c", MmWidth: 293, MmHeight: 164},
+		// 旋转安装的
+		{Serial: "ilitek", Bus: "usb", MmWidth: 195, MmHeight: 345, Path: "pci-0000:00:14.0-usb-0:2:1.0"},
+	}
+	assert.Equal(t, map[string]string{
+		"elan":   "eDP-1",
+		"ilitek": "DP-1",
+	}, MatchTouchscreens(touches, outputs, nil))
+
+	// 已经关联的不再处理，它的输出设备也不再关联给外接触摸屏
+	assert.Equal(t, map[string]string{
+		"elan": "eDP-1",
+	}, MatchTouchscreens(touches, outputs, map[string]string{"ilitek": "DP-1"}))
+
+	// 大小不匹配时按 USB 拓扑的顺序关联
+	touches = []*TouchDevice{
+		{Serial: "b", Bus: "usb", Path: "pci-0000:00:14.0-usb-0:3:1.0"},
+		{Serial: "a", Bus: "usb", Path: "pci-0000:00:14.0-usb-0:1:1.0"},
+	}
+	assert.Equal(t, map[string]string{
+		"a": "HDMI-1",
+		"b": "DP-1",
+	}, MatchTouchscreens(touches, outputs, nil))
+
+	// 数量不同时无法确定
+	assert.Empty(t, MatchTouchscreens(touches[:1], outputs, nil))
+}
+
+func TestGetTouchMatrix(t *testing.T) {
+	m := GetTouchMatrix(0, 0, 1920, 1080, RotationRotate0, 0, 1920, 1080)
+	assert.Equal(t, identityTouchMatrix, m)
+
+	m = GetTouchMatrix(1920, 0, 1920, 1080, RotationRotate0, 0, 3840, 1080)
+	assert.Equal(t, TouchMatrix{0.5, 0, 0.5, 0, 1, 0, 0, 0, 1}, m)
+
+	m = GetTouchMatrix(0, 0, 1080, 1920, RotationRotate90, 0, 1080, 1920)
+	assert.Equal(t, rotationTouchMatrix(RotationRotate90), m)
+
+	m = GetTouchMatrix(0, 0, 1920, 1080, RotationRotate0, ReflectX, 1920, 1080)
+	assert.Equal(t, TouchMatrix{-1, 0, 1, 0, 1, 0, 0, 0, 1}, m)
+}
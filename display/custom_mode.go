@@ -0,0 +1,138 @@
+package display
+
+import (
+	"errors"
+
+	dbus "github.com/godbus/dbus"
+	"github.com/linuxdeepin/go-x11-client/ext/randr"
+	"pkg.deepin.io/dde/startdde/display/core"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// 为 EDID 有问题的显示器添加自定义模式，比如 KVM 切换器和采集卡
+
+func toRandrModeInfo(l *core.ModeLine) randr.ModeInfo {
+	var flags uint32
+	if l.HSyncPositive {
+		flags |= randr.ModeFlagHsyncPositive
+	} else {
+		flags |= randr.ModeFlagHsyncNegative
+	}
+	if l.VSyncPositive {
+		flags |= randr.ModeFlagVsyncPositive
+	} else {
+		flags |= randr.ModeFlagVsyncNegative
+	}
+	return randr.ModeInfo{
+		Width:      l.HDisplay,
+		Height:     l.VDisplay,
+		DotClock:   l.PixelClock * 1000,
+		HSyncStart: l.HSyncStart,
+		HSyncEnd:   l.HSyncEnd,
+		HTotal:     l.HTotal,
+		VSyncStart: l.VSyncStart,
+		VSyncEnd:   l.VSyncEnd,
+		VTotal:     l.VTotal,
+		ModeFlags:  flags,
+		Name:       l.Name,
+	}
+}
+
+// 已经有同名的模式时直接使用，否则创建新的模式
+func (m *Manager) createMode(l *core.ModeLine) (randr.Mode, error) {
+	for _, modeInfo := range m.modes {
+		if modeInfo.Name == l.Name {
+			return randr.Mode(modeInfo.Id), nil
+		}
+	}
+	logger.Debugf("create mode %s", l.Name)
+	root := m.xConn.GetDefaultScreen().Root
+	reply, err := randr.CreateMode(m.xConn, root, toRandrModeInfo(l), l.Name).Reply(m.xConn)
+	if err != nil {
+		return 0, err
+	}
+	return reply.Mode, nil
+}
+
+// addCustomMode 生成 CVT 时序，创建模式并添加到显示器上，返回模式的 ID
+func (m *Manager) addCustomMode(monitor *Monitor, mode core.CustomMode) (uint32, error) {
+	l, err := core.CVTModeLine(mode.Width, mode.Height, mode.Rate, mode.ReducedBlanking)
+	if err != nil {
+		return 0, err
+	}
+	modeId, err := m.createMode(l)
+	if err != nil {
+		return 0, err
+	}
+
+	output := randr.Output(monitor.ID)
+	monitor.PropsMu.RLock()
+	_, added := findModeInfo(monitor.Modes, uint32(modeId))
+	monitor.PropsMu.RUnlock()
+	if added {
+		return uint32(modeId), nil
+	}
+	logger.Debugf("add mode %s to %s", l.Name, monitor.Name)
+	err = randr.AddOutputModeChecked(m.xConn, output, modeId).Check(m.xConn)
+	if err != nil {
+		return 0, err
+	}
+
+	// 更新模式列表和显示器的模式
+	resources, err := m.getScreenResourcesCurrent()
+	if err != nil {
+		return 0, err
+	}
+	m.modes = resources.Modes
+	outputInfo, err := m.updateOutputInfo(output)
+	if err != nil {
+		return 0, err
+	}
+	m.updateMonitor(output, outputInfo)
+	return uint32(modeId), nil
+}
+
+// restoreCustomModes 添加保存的自定义模式，需要在应用布局之前调用
+func (m *Manager) restoreCustomModes() {
+	for _, monitor := range m.getConnectedMonitors() {
+		monitor.PropsMu.RLock()
+		uuid := monitor.uuid
+		monitor.PropsMu.RUnlock()
+		for _, mode := range m.config.GetOutputProps(uuid).CustomModes {
+			_, err := m.addCustomMode(monitor, mode)
+			if err != nil {
+				logger.Warningf("failed to add custom mode %vx%v@%v to %s: %v",
+					mode.Width, mode.Height, mode.Rate, monitor.Name, err)
+			}
+		}
+	}
+}
+
+func (m *Monitor) AddCustomMode(width, height uint16, rate float64, reducedBlanking bool) (uint32, *dbus.Error) {
+	if !m.Connected {
+		return 0, dbusutil.ToError(errors.New("monitor is disconnected"))
+	}
+	mode := core.CustomMode{
+		Width:           width,
+		Height:          height,
+		Rate:            rate,
+		ReducedBlanking: reducedBlanking,
+	}
+	modeId, err := m.m.addCustomMode(m, mode)
+	if err != nil {
+		return 0, dbusutil.ToError(err)
+	}
+
+	m.PropsMu.Lock()
+	added := m.outputProps.AddCustomMode(mode)
+	uuid := m.uuid
+	props := m.outputProps
+	m.PropsMu.Unlock()
+	if added {
+		err = m.m.saveOutputProps(uuid, props)
+		if err != nil {
+			return 0, dbusutil.ToError(err)
+		}
+	}
+	return modeId, nil
+}
@@ -40,22 +40,27 @@ func StartPart2() error {
 	m := _dpy
 	m.initTouchscreens()
 	m.initTouchMap()
-	err := generateRedshiftConfFile()
-	if err != nil {
-		logger.Warning(err)
-	}
+	m.initTablets()
 	m.initColorTemperature()
+	m.initAutoBrightness()
+	m.initAutoRotation()
+	m.initLid()
+	m.initScreenPower()
 
+	var newTouches []*Touchscreen
 	for _, touch := range m.Touchscreens {
 		if _, ok := m.TouchMap[touch.Serial]; !ok {
-			err := m.associateTouch(m.Primary, touch.Serial)
-			if err != nil {
-				logger.Warningf("associate touch(%v, %v) failed: %v", m.Primary, touch.Serial, err)
-			}
-			err = m.showTouchscreenDialog(touch.Serial)
-			if err != nil {
-				logger.Warning("failed to show touchscreen dialog:", err)
-			}
+			newTouches = append(newTouches, touch)
+		}
+	}
+	for _, touch := range m.autoAssociateTouches(newTouches) {
+		err := m.associateTouch(m.Primary, touch.Serial)
+		if err != nil {
+			logger.Warningf("associate touch(%v, %v) failed: %v", m.Primary, touch.Serial, err)
+		}
+		err = m.showTouchscreenDialog(touch.Serial)
+		if err != nil {
+			logger.Warning("failed to show touchscreen dialog:", err)
 		}
 	}
 
@@ -1,10 +1,11 @@
-// Code generated by "dbusutil-gen -output display_dbusutil.go -import github.com/godbus/dbus,github.com/linuxdeepin/go-x11-client -type Manager,Monitor manager.go monitor.go"; DO NOT EDIT.
+// Code generated by "dbusutil-gen -output display_dbusutil.go -import github.com/godbus/dbus,github.com/linuxdeepin/go-x11-client,pkg.deepin.io/dde/startdde/display/edid -type Manager,Monitor manager.go monitor.go"; DO NOT EDIT.
 
 package display
 
 import (
 	"github.com/linuxdeepin/go-x11-client"
 	"github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/display/edid"
 )
 
 func (v *Manager) setPropMonitors(value []dbus.ObjectPath) {
@@ -78,6 +79,24 @@ func (v *Manager) emitPropChangedTouchMap(value map[string]string) error {
 	return v.service.EmitPropertyChanged(v, "TouchMap", value)
 }
 
+func (v *Manager) setPropTablets(value dxTablets) {
+	v.Tablets = value
+	v.emitPropChangedTablets(value)
+}
+
+func (v *Manager) emitPropChangedTablets(value dxTablets) error {
+	return v.service.EmitPropertyChanged(v, "Tablets", value)
+}
+
+func (v *Manager) setPropTabletMap(value map[string]TabletMapping) {
+	v.TabletMap = value
+	v.emitPropChangedTabletMap(value)
+}
+
+func (v *Manager) emitPropChangedTabletMap(value map[string]TabletMapping) error {
+	return v.service.EmitPropertyChanged(v, "TabletMap", value)
+}
+
 func (v *Manager) setPropCurrentCustomId(value string) (changed bool) {
 	if v.CurrentCustomId != value {
 		v.CurrentCustomId = value
@@ -152,6 +171,97 @@ func (v *Manager) emitPropChangedMaxBacklightBrightness(value uint32) error {
 	return v.service.EmitPropertyChanged(v, "MaxBacklightBrightness", value)
 }
 
+func (v *Manager) setPropColorTemperatureCurrent(value int32) (changed bool) {
+	if v.ColorTemperatureCurrent != value {
+		v.ColorTemperatureCurrent = value
+		v.emitPropChangedColorTemperatureCurrent(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedColorTemperatureCurrent(value int32) error {
+	return v.service.EmitPropertyChanged(v, "ColorTemperatureCurrent", value)
+}
+
+func (v *Manager) setPropColorTemperatureNextTransition(value int64) (changed bool) {
+	if v.ColorTemperatureNextTransition != value {
+		v.ColorTemperatureNextTransition = value
+		v.emitPropChangedColorTemperatureNextTransition(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedColorTemperatureNextTransition(value int64) error {
+	return v.service.EmitPropertyChanged(v, "ColorTemperatureNextTransition", value)
+}
+
+func (v *Manager) setPropAutoBrightness(value bool) (changed bool) {
+	if v.AutoBrightness != value {
+		v.AutoBrightness = value
+		v.emitPropChangedAutoBrightness(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedAutoBrightness(value bool) error {
+	return v.service.EmitPropertyChanged(v, "AutoBrightness", value)
+}
+
+func (v *Manager) setPropHasAmbientLightSensor(value bool) (changed bool) {
+	if v.HasAmbientLightSensor != value {
+		v.HasAmbientLightSensor = value
+		v.emitPropChangedHasAmbientLightSensor(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedHasAmbientLightSensor(value bool) error {
+	return v.service.EmitPropertyChanged(v, "HasAmbientLightSensor", value)
+}
+
+func (v *Manager) setPropAutoRotation(value bool) (changed bool) {
+	if v.AutoRotation != value {
+		v.AutoRotation = value
+		v.emitPropChangedAutoRotation(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedAutoRotation(value bool) error {
+	return v.service.EmitPropertyChanged(v, "AutoRotation", value)
+}
+
+func (v *Manager) setPropRotationLocked(value bool) (changed bool) {
+	if v.RotationLocked != value {
+		v.RotationLocked = value
+		v.emitPropChangedRotationLocked(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedRotationLocked(value bool) error {
+	return v.service.EmitPropertyChanged(v, "RotationLocked", value)
+}
+
+func (v *Manager) setPropLidClosePolicy(value byte) (changed bool) {
+	if v.LidClosePolicy != value {
+		v.LidClosePolicy = value
+		v.emitPropChangedLidClosePolicy(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedLidClosePolicy(value byte) error {
+	return v.service.EmitPropertyChanged(v, "LidClosePolicy", value)
+}
+
 func (v *Monitor) setPropID(value uint32) (changed bool) {
 	if v.ID != value {
 		v.ID = value
@@ -199,6 +309,84 @@ func (v *Monitor) setPropModel(value string) {
 	}
 }
 
+func (v *Monitor) setPropVendorName(value string) (changed bool) {
+	if v.VendorName != value {
+		v.VendorName = value
+		v.emitPropChangedVendorName(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedVendorName(value string) error {
+	return v.service.EmitPropertyChanged(v, "VendorName", value)
+}
+
+func (v *Monitor) setPropProductName(value string) (changed bool) {
+	if v.ProductName != value {
+		v.ProductName = value
+		v.emitPropChangedProductName(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedProductName(value string) error {
+	return v.service.EmitPropertyChanged(v, "ProductName", value)
+}
+
+func (v *Monitor) setPropProductCode(value uint16) (changed bool) {
+	if v.ProductCode != value {
+		v.ProductCode = value
+		v.emitPropChangedProductCode(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedProductCode(value uint16) error {
+	return v.service.EmitPropertyChanged(v, "ProductCode", value)
+}
+
+func (v *Monitor) setPropSerialNumber(value string) (changed bool) {
+	if v.SerialNumber != value {
+		v.SerialNumber = value
+		v.emitPropChangedSerialNumber(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedSerialNumber(value string) error {
+	return v.service.EmitPropertyChanged(v, "SerialNumber", value)
+}
+
+func (v *Monitor) setPropManufactureWeek(value uint8) (changed bool) {
+	if v.ManufactureWeek != value {
+		v.ManufactureWeek = value
+		v.emitPropChangedManufactureWeek(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedManufactureWeek(value uint8) error {
+	return v.service.EmitPropertyChanged(v, "ManufactureWeek", value)
+}
+
+func (v *Monitor) setPropManufactureYear(value uint16) (changed bool) {
+	if v.ManufactureYear != value {
+		v.ManufactureYear = value
+		v.emitPropChangedManufactureYear(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedManufactureYear(value uint16) error {
+	return v.service.EmitPropertyChanged(v, "ManufactureYear", value)
+}
+
 func (v *Monitor) emitPropChangedConnected(value bool) error {
 	return v.service.EmitPropertyChanged(v, "Connected", value)
 }
@@ -378,6 +566,19 @@ func (v *Monitor) emitPropChangedRefreshRate(value float64) error {
 	return v.service.EmitPropertyChanged(v, "RefreshRate", value)
 }
 
+func (v *Monitor) setPropScale(value float64) (changed bool) {
+	if v.Scale != value {
+		v.Scale = value
+		v.emitPropChangedScale(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedScale(value float64) error {
+	return v.service.EmitPropertyChanged(v, "Scale", value)
+}
+
 func (v *Monitor) setPropCurrentMode(value ModeInfo) {
 	v.CurrentMode = value
 	v.emitPropChangedCurrentMode(value)
@@ -386,3 +587,152 @@ func (v *Monitor) setPropCurrentMode(value ModeInfo) {
 func (v *Monitor) emitPropChangedCurrentMode(value ModeInfo) error {
 	return v.service.EmitPropertyChanged(v, "CurrentMode", value)
 }
+
+func (v *Monitor) setPropVrrMinRate(value uint16) (changed bool) {
+	if v.VrrMinRate != value {
+		v.VrrMinRate = value
+		v.emitPropChangedVrrMinRate(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedVrrMinRate(value uint16) error {
+	return v.service.EmitPropertyChanged(v, "VrrMinRate", value)
+}
+
+func (v *Monitor) setPropVrrMaxRate(value uint16) (changed bool) {
+	if v.VrrMaxRate != value {
+		v.VrrMaxRate = value
+		v.emitPropChangedVrrMaxRate(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedVrrMaxRate(value uint16) error {
+	return v.service.EmitPropertyChanged(v, "VrrMaxRate", value)
+}
+
+func (v *Monitor) setPropHdrEotfs(value []string) {
+	v.HdrEotfs = value
+	v.emitPropChangedHdrEotfs(value)
+}
+
+func (v *Monitor) emitPropChangedHdrEotfs(value []string) error {
+	return v.service.EmitPropertyChanged(v, "HdrEotfs", value)
+}
+
+func (v *Monitor) setPropHdrMaxLuminance(value float64) (changed bool) {
+	if v.HdrMaxLuminance != value {
+		v.HdrMaxLuminance = value
+		v.emitPropChangedHdrMaxLuminance(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedHdrMaxLuminance(value float64) error {
+	return v.service.EmitPropertyChanged(v, "HdrMaxLuminance", value)
+}
+
+func (v *Monitor) setPropHdrMaxFrameAvgLuminance(value float64) (changed bool) {
+	if v.HdrMaxFrameAvgLuminance != value {
+		v.HdrMaxFrameAvgLuminance = value
+		v.emitPropChangedHdrMaxFrameAvgLuminance(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedHdrMaxFrameAvgLuminance(value float64) error {
+	return v.service.EmitPropertyChanged(v, "HdrMaxFrameAvgLuminance", value)
+}
+
+func (v *Monitor) setPropHdrMinLuminance(value float64) (changed bool) {
+	if v.HdrMinLuminance != value {
+		v.HdrMinLuminance = value
+		v.emitPropChangedHdrMinLuminance(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedHdrMinLuminance(value float64) error {
+	return v.service.EmitPropertyChanged(v, "HdrMinLuminance", value)
+}
+
+func (v *Monitor) setPropColorDepths(value []uint8) {
+	v.ColorDepths = value
+	v.emitPropChangedColorDepths(value)
+}
+
+func (v *Monitor) emitPropChangedColorDepths(value []uint8) error {
+	return v.service.EmitPropertyChanged(v, "ColorDepths", value)
+}
+
+func (v *Monitor) setPropPreferredTiming(value edid.DetailedTiming) {
+	v.PreferredTiming = value
+	v.emitPropChangedPreferredTiming(value)
+}
+
+func (v *Monitor) emitPropChangedPreferredTiming(value edid.DetailedTiming) error {
+	return v.service.EmitPropertyChanged(v, "PreferredTiming", value)
+}
+
+func (v *Monitor) setPropVrrCapable(value bool) (changed bool) {
+	if v.VrrCapable != value {
+		v.VrrCapable = value
+		v.emitPropChangedVrrCapable(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedVrrCapable(value bool) error {
+	return v.service.EmitPropertyChanged(v, "VrrCapable", value)
+}
+
+func (v *Monitor) setPropMaxBpc(value uint32) (changed bool) {
+	if v.MaxBpc != value {
+		v.MaxBpc = value
+		v.emitPropChangedMaxBpc(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedMaxBpc(value uint32) error {
+	return v.service.EmitPropertyChanged(v, "MaxBpc", value)
+}
+
+func (v *Monitor) setPropMaxBpcRange(value []uint32) {
+	v.MaxBpcRange = value
+	v.emitPropChangedMaxBpcRange(value)
+}
+
+func (v *Monitor) emitPropChangedMaxBpcRange(value []uint32) error {
+	return v.service.EmitPropertyChanged(v, "MaxBpcRange", value)
+}
+
+func (v *Monitor) setPropBroadcastRGB(value string) (changed bool) {
+	if v.BroadcastRGB != value {
+		v.BroadcastRGB = value
+		v.emitPropChangedBroadcastRGB(value)
+		return true
+	}
+	return false
+}
+
+func (v *Monitor) emitPropChangedBroadcastRGB(value string) error {
+	return v.service.EmitPropertyChanged(v, "BroadcastRGB", value)
+}
+
+func (v *Monitor) setPropBroadcastRGBValues(value []string) {
+	v.BroadcastRGBValues = value
+	v.emitPropChangedBroadcastRGBValues(value)
+}
+
+func (v *Monitor) emitPropChangedBroadcastRGBValues(value []string) error {
+	return v.service.EmitPropertyChanged(v, "BroadcastRGBValues", value)
+}
@@ -0,0 +1,202 @@
+package edid
+
+import (
+	"math"
+	"sort"
+)
+
+// Capabilities 是 EDID 中描述的显示能力
+type Capabilities struct {
+	// 显示范围限制描述符中的垂直刷新率范围，单位 Hz，为 0 表示未知
+	MinVRate uint16
+	MaxVRate uint16
+	// HDR 静态元数据，不支持 HDR 时为 nil
+	HDR *HDRStaticMetadata
+	// 支持的每个颜色分量的位数，从小到大排列，模拟信号输入时为空
+	ColorDepths []uint8
+	// 第一个详细时序描述符，没有时为 nil
+	PreferredTiming *DetailedTiming
+}
+
+// HDRStaticMetadata 来自 CEA-861 扩展中的 HDR Static Metadata Data Block，
+// 亮度的单位是 cd/m²，为 0 表示显示器没有提供
+type HDRStaticMetadata struct {
+	EOTFs                []string
+	MaxLuminance         float64
+	MaxFrameAvgLuminance float64
+	MinLuminance         float64
+}
+
+// HDR 静态元数据中支持的 EOTF
+const (
+	EOTFTraditionalSDR = "SDR"
+	EOTFTraditionalHDR = "HDR"
+	EOTFSMPTEST2084    = "PQ"
+	EOTFHLG            = "HLG"
+)
+
+var eotfNames = []string{EOTFTraditionalSDR, EOTFTraditionalHDR, EOTFSMPTEST2084, EOTFHLG}
+
+// DetailedTiming 是详细时序描述符，PixelClock 的单位是 kHz
+type DetailedTiming struct {
+	PixelClock uint32
+	Width      uint16
+	Height     uint16
+	HTotal     uint16
+	VTotal     uint16
+	Rate       float64
+	Interlaced bool
+}
+
+// Capabilities 从基本块和 CEA-861 扩展块中解析显示能力
+func (e *EDID) Capabilities() *Capabilities {
+	caps := &Capabilities{}
+	depths := make(map[uint8]bool)
+
+	// 视频输入定义，EDID 1.4 中数字信号的 4~6 位是颜色深度
+	if e.Digital && e.Version == 1 && e.Revision >= 4 {
+		switch (e.raw[20] >> 4) & 0x7 {
+		case 1:
+			depths[6] = true
+		case 2:
+			depths[8] = true
+		case 3:
+			depths[10] = true
+		case 4:
+			depths[12] = true
+		case 5:
+			depths[14] = true
+		case 6:
+			depths[16] = true
+		}
+	}
+
+	if len(e.DetailedTimings) > 0 {
+		caps.PreferredTiming = e.DetailedTimings[0]
+	}
+	for i := 0; i < 4; i++ {
+		d := e.raw[54+i*18 : 54+(i+1)*18]
+		if d[0] == 0 && d[1] == 0 && d[3] == descriptorRangeLimits {
+			// 显示范围限制，EDID 1.4 中字节 4 的最低两位表示刷新率需要加上 255
+			minRate, maxRate := uint16(d[5]), uint16(d[6])
+			if d[4]&0x1 != 0 {
+				minRate += 255
+			}
+			if d[4]&0x2 != 0 {
+				maxRate += 255
+			}
+			caps.MinVRate, caps.MaxVRate = minRate, maxRate
+		}
+	}
+
+	for _, ext := range e.ExtensionsByTag(ExtensionTagCEA) {
+		parseCEAExtension(ext.Data, caps, depths)
+	}
+
+	if e.Digital {
+		// 数字接口至少支持每分量 8 位
+		if len(depths) == 0 {
+			depths[8] = true
+		}
+		for depth := range depths {
+			caps.ColorDepths = append(caps.ColorDepths, depth)
+		}
+		sort.Slice(caps.ColorDepths, func(i, j int) bool {
+			return caps.ColorDepths[i] < caps.ColorDepths[j]
+		})
+	}
+	return caps
+}
+
+func parseDetailedTiming(d []byte) *DetailedTiming {
+	clock := uint32(d[0]) | uint32(d[1])<<8 // 单位 10kHz
+	hActive := uint16(d[2]) | uint16(d[4]>>4)<<8
+	hBlank := uint16(d[3]) | uint16(d[4]&0xf)<<8
+	vActive := uint16(d[5]) | uint16(d[7]>>4)<<8
+	vBlank := uint16(d[6]) | uint16(d[7]&0xf)<<8
+	t := &DetailedTiming{
+		PixelClock: clock * 10,
+		Width:      hActive,
+		Height:     vActive,
+		HTotal:     hActive + hBlank,
+		VTotal:     vActive + vBlank,
+		Interlaced: d[17]&0x80 != 0,
+	}
+	if t.HTotal != 0 && t.VTotal != 0 {
+		rate := float64(clock) * 10000 / (float64(t.HTotal) * float64(t.VTotal))
+		t.Rate = math.Round(rate*100) / 100
+	}
+	return t
+}
+
+// CEA-861 扩展块中的数据块
+const (
+	ceaTagVendorSpecific = 3
+	ceaTagExtended       = 7
+
+	ceaExtTagHDRStaticMetadata = 6
+
+	hdmiIEEEOUI = 0x000c03
+)
+
+func parseCEAExtension(block []byte, caps *Capabilities, depths map[uint8]bool) {
+	// 字节 2 是详细时序描述符的偏移，之前是数据块
+	end := int(block[2])
+	if end < 4 || end > len(block) {
+		return
+	}
+	for i := 4; i < end; {
+		tag := block[i] >> 5
+		length := int(block[i] & 0x1f)
+		if i+1+length > end {
+			return
+		}
+		data := block[i+1 : i+1+length]
+		i += 1 + length
+
+		switch tag {
+		case ceaTagVendorSpecific:
+			if len(data) < 3 {
+				continue
+			}
+			oui := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+			// HDMI VSDB 的第 6 字节是 deep color 的支持情况
+			if oui == hdmiIEEEOUI && len(data) >= 6 {
+				depths[8] = true
+				if data[5]&0x10 != 0 {
+					depths[10] = true
+				}
+				if data[5]&0x20 != 0 {
+					depths[12] = true
+				}
+				if data[5]&0x40 != 0 {
+					depths[16] = true
+				}
+			}
+		case ceaTagExtended:
+			if len(data) >= 3 && data[0] == ceaExtTagHDRStaticMetadata {
+				caps.HDR = parseHDRStaticMetadata(data[1:])
+			}
+		}
+	}
+}
+
+func parseHDRStaticMetadata(data []byte) *HDRStaticMetadata {
+	hdr := &HDRStaticMetadata{}
+	for i, name := range eotfNames {
+		if data[0]&(1<<uint(i)) != 0 {
+			hdr.EOTFs = append(hdr.EOTFs, name)
+		}
+	}
+	// data[1] 是支持的静态元数据类型，之后是可选的亮度
+	if len(data) >= 3 && data[2] != 0 {
+		hdr.MaxLuminance = 50 * math.Pow(2, float64(data[2])/32)
+	}
+	if len(data) >= 4 && data[3] != 0 {
+		hdr.MaxFrameAvgLuminance = 50 * math.Pow(2, float64(data[3])/32)
+	}
+	if len(data) >= 5 && hdr.MaxLuminance != 0 {
+		hdr.MinLuminance = hdr.MaxLuminance * math.Pow(float64(data[4])/255, 2) / 100
+	}
+	return hdr
+}
@@ -0,0 +1,86 @@
+package edid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 1920x1080@60 的详细时序描述符
+var testDetailedTiming1080p = []byte{0x02, 0x3a, 0x80, 0x18, 0x71, 0x38, 0x2d, 0x40,
+	0x58, 0x2c, 0x45, 0x00, 0x0f, 0x48, 0x42, 0x00, 0x00, 0x1e}
+
+// 修正块的校验和
+func fixChecksum(block []byte) {
+	block[blockSize-1] = 0
+	var sum byte
+	for _, b := range block[:blockSize-1] {
+		sum += b
+	}
+	block[blockSize-1] = -sum
+}
+
+func newTestEDID(withExtension bool) []byte {
+	edid := make([]byte, blockSize)
+	copy(edid, header)
+	// DEL，产品代码 0xA0BC，序列号 0x30303030
+	copy(edid[8:], []byte{0x10, 0xac, 0xbc, 0xa0, 0x30, 0x30, 0x30, 0x30, 12, 28})
+	edid[21], edid[22] = 53, 30
+	edid[18], edid[19] = 1, 4
+	// 数字信号，每分量 10 位，DisplayPort
+	edid[20] = 0x80 | 3<<4 | 5
+	copy(edid[54:], testDetailedTiming1080p)
+	// 显示范围限制 48~144Hz
+	copy(edid[72:], []byte{0, 0, 0, 0xfd, 0, 48, 144, 30, 160, 60, 0x01, 0x0a})
+	copy(edid[90:], []byte{0, 0, 0, 0xfc, 0, 'D', 'E', 'L', 'L', ' ', 'U', '2', '4', '1', '4', 'H', 0x0a, 0x20})
+	if !withExtension {
+		fixChecksum(edid)
+		return edid
+	}
+
+	edid[126] = 1
+	fixChecksum(edid)
+	ext := make([]byte, blockSize)
+	ext[0], ext[1] = 0x02, 0x03
+	blocks := []byte{
+		// HDMI VSDB，支持 30 和 36 位
+		ceaTagVendorSpecific<<5 | 6, 0x03, 0x0c, 0x00, 0x10, 0x00, 0x30,
+		// HDR 静态元数据，支持 SDR 和 PQ
+		ceaTagExtended<<5 | 6, ceaExtTagHDRStaticMetadata, 0x05, 0x01, 0x60, 0x50, 0x20,
+	}
+	copy(ext[4:], blocks)
+	ext[2] = byte(4 + len(blocks))
+	fixChecksum(ext)
+	return append(edid, ext...)
+}
+
+func parseCapabilities(t *testing.T, data []byte) *Capabilities {
+	e, err := Parse(data)
+	require.NoError(t, err)
+	return e.Capabilities()
+}
+
+func TestEDID_Capabilities(t *testing.T) {
+	caps := parseCapabilities(t, newTestEDID(false))
+	assert.Equal(t, uint16(48), caps.MinVRate)
+	assert.Equal(t, uint16(144), caps.MaxVRate)
+	assert.Nil(t, caps.HDR)
+	assert.Equal(t, []uint8{10}, caps.ColorDepths)
+	assert.Equal(t, &DetailedTiming{
+		PixelClock: 148500,
+		Width:      1920,
+		Height:     1080,
+		HTotal:     2200,
+		VTotal:     1125,
+		Rate:       60,
+	}, caps.PreferredTiming)
+
+	caps = parseCapabilities(t, newTestEDID(true))
+	assert.Equal(t, []uint8{8, 10, 12}, caps.ColorDepths)
+	require.NotNil(t, caps.HDR)
+	assert.Equal(t, []string{EOTFTraditionalSDR, EOTFSMPTEST2084}, caps.HDR.EOTFs)
+	assert.InDelta(t, 400, caps.HDR.MaxLuminance, 0.5)
+	assert.InDelta(t, 282.8, caps.HDR.MaxFrameAvgLuminance, 0.1)
+	assert.InDelta(t, 0.063, caps.HDR.MinLuminance, 0.001)
+}
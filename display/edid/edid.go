@@ -0,0 +1,209 @@
+// Package edid 解析显示器的 EDID，包括基本块、显示器描述符和扩展块
+package edid
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var header = []byte{0x00, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x00}
+
+const blockSize = 128
+
+// EDID 是解析后的 EDID
+type EDID struct {
+	// PNP ID，三个大写字母
+	Vendor       string
+	ProductCode  uint16
+	SerialNumber uint32
+	// 制造的周和年份，ModelYear 为 true 时 Year 是型号年份，Week 为 0
+	Week      uint8
+	Year      uint16
+	ModelYear bool
+	Version   uint8
+	Revision  uint8
+	Digital   bool
+	// 物理大小，单位 mm，投影仪等大小不固定的显示器为 0
+	MmWidth  uint32
+	MmHeight uint32
+
+	// 显示器描述符中的字符串
+	MonitorName  string
+	SerialString string
+	Texts        []string
+
+	DetailedTimings []*DetailedTiming
+	Extensions      []*Extension
+
+	raw []byte
+}
+
+// Extension 是一个扩展块，Tag 为 0x02 的是 CEA-861 扩展
+type Extension struct {
+	Tag      uint8
+	Revision uint8
+	Data     []byte
+}
+
+// 扩展块的类型
+const (
+	ExtensionTagCEA       = 0x02
+	ExtensionTagDisplayID = 0x70
+)
+
+// 显示器描述符的类型
+const (
+	descriptorSerial      = 0xff
+	descriptorText        = 0xfe
+	descriptorRangeLimits = 0xfd
+	descriptorMonitorName = 0xfc
+)
+
+// Parse 解析 EDID，基本块无效时返回错误。
+// 不少显示器的基本块校验和是错的，不检查；校验和错误的扩展块被忽略。
+func Parse(data []byte) (*EDID, error) {
+	if len(data) < blockSize {
+		return nil, fmt.Errorf("edid too short: %d bytes", len(data))
+	}
+	if !bytes.Equal(data[:8], header) {
+		return nil, errors.New("invalid edid header")
+	}
+	e := &EDID{
+		Vendor:       parseVendor(data[8], data[9]),
+		ProductCode:  uint16(data[10]) | uint16(data[11])<<8,
+		SerialNumber: uint32(data[12]) | uint32(data[13])<<8 | uint32(data[14])<<16 | uint32(data[15])<<24,
+		Version:      data[18],
+		Revision:     data[19],
+		Digital:      data[20]&0x80 != 0,
+		raw:          data,
+	}
+	if data[16] == 0xff {
+		e.ModelYear = true
+	} else {
+		e.Week = data[16]
+	}
+	e.Year = uint16(data[17]) + 1990
+	// 只有一个不为 0 时表示的是宽高比
+	if data[21] != 0 && data[22] != 0 {
+		e.MmWidth = uint32(data[21]) * 10
+		e.MmHeight = uint32(data[22]) * 10
+	}
+
+	for i := 0; i < 4; i++ {
+		d := data[54+i*18 : 54+(i+1)*18]
+		if d[0] != 0 || d[1] != 0 {
+			e.DetailedTimings = append(e.DetailedTimings, parseDetailedTiming(d))
+			continue
+		}
+		switch d[3] {
+		case descriptorMonitorName:
+			e.MonitorName = parseDescriptorString(d)
+		case descriptorSerial:
+			e.SerialString = parseDescriptorString(d)
+		case descriptorText:
+			if text := parseDescriptorString(d); text != "" {
+				e.Texts = append(e.Texts, text)
+			}
+		}
+	}
+
+	numExt := int(data[126])
+	for i := 1; i <= numExt && len(data) >= (i+1)*blockSize; i++ {
+		block := data[i*blockSize : (i+1)*blockSize]
+		if !checksumValid(block) {
+			continue
+		}
+		e.Extensions = append(e.Extensions, &Extension{
+			Tag:      block[0],
+			Revision: block[1],
+			Data:     block,
+		})
+	}
+	return e, nil
+}
+
+func checksumValid(block []byte) bool {
+	var sum byte
+	for _, b := range block {
+		sum += b
+	}
+	return sum == 0
+}
+
+// 每个字母 5 位，1 表示 'A'
+func parseVendor(b0, b1 byte) string {
+	v := uint16(b0)<<8 | uint16(b1)
+	var id []byte
+	for shift := uint(10); ; shift -= 5 {
+		c := byte((v>>shift)&0x1f) + 'A' - 1
+		if c < 'A' || c > 'Z' {
+			return ""
+		}
+		id = append(id, c)
+		if shift == 0 {
+			break
+		}
+	}
+	return string(id)
+}
+
+// 描述符中的字符串最多 13 个字符，以换行结束，之后用空格填充
+func parseDescriptorString(d []byte) string {
+	s := d[5:18]
+	if i := bytes.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	var buf []byte
+	for _, c := range s {
+		if c >= ' ' && c <= '~' {
+			buf = append(buf, c)
+		}
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// ExtensionsByTag 返回类型为 tag 的扩展块
+func (e *EDID) ExtensionsByTag(tag uint8) []*Extension {
+	var result []*Extension
+	for _, ext := range e.Extensions {
+		if ext.Tag == tag {
+			result = append(result, ext)
+		}
+	}
+	return result
+}
+
+// Serial 返回序列号，优先使用描述符中的字符串，都没有时返回空字符串
+func (e *EDID) Serial() string {
+	if e.SerialString != "" {
+		return e.SerialString
+	}
+	if e.SerialNumber != 0 {
+		return strconv.FormatUint(uint64(e.SerialNumber), 10)
+	}
+	return ""
+}
+
+// Identity 由 PNP ID、产品代码和序列号组成，比如 DEL-A0BC-5KC0366P0TKL。
+// 没有序列号时相同型号的显示器的 Identity 相同，需要再结合接口名称区分。
+func (e *EDID) Identity() string {
+	id := fmt.Sprintf("%s-%04X", e.Vendor, e.ProductCode)
+	if serial := e.Serial(); serial != "" {
+		id += "-" + sanitizeIdentity(serial)
+	}
+	return id
+}
+
+// 配置中用逗号连接多个显示器的 UUID，只保留字母、数字和少数符号
+func sanitizeIdentity(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, s)
+}
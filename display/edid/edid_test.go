@@ -0,0 +1,70 @@
+package edid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	_, err := Parse(nil)
+	assert.Error(t, err)
+	_, err = Parse(make([]byte, blockSize))
+	assert.Error(t, err)
+
+	data := newTestEDID(true)
+	e, err := Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, "DEL", e.Vendor)
+	assert.Equal(t, uint16(0xa0bc), e.ProductCode)
+	assert.Equal(t, uint32(0x30303030), e.SerialNumber)
+	assert.Equal(t, uint8(12), e.Week)
+	assert.Equal(t, uint16(2018), e.Year)
+	assert.False(t, e.ModelYear)
+	assert.Equal(t, uint8(1), e.Version)
+	assert.Equal(t, uint8(4), e.Revision)
+	assert.True(t, e.Digital)
+	assert.Equal(t, uint32(530), e.MmWidth)
+	assert.Equal(t, uint32(300), e.MmHeight)
+	assert.Equal(t, "DELL U2414H", e.MonitorName)
+	assert.Equal(t, "", e.SerialString)
+	assert.Len(t, e.DetailedTimings, 1)
+	require.Len(t, e.Extensions, 1)
+	assert.Equal(t, uint8(ExtensionTagCEA), e.Extensions[0].Tag)
+	assert.Equal(t, uint8(3), e.Extensions[0].Revision)
+	assert.Equal(t, "DEL-A0BC-808464432", e.Identity())
+
+	// 序列号字符串优先，不能用在配置键中的字符被替换
+	copy(data[108:], []byte{0, 0, 0, 0xff, 0, '5', 'K', 'C', ',', '0', '3', 0x0a, 0x20, 0x20, 0x20, 0x20, 0x20, 0x20})
+	data[16] = 0xff
+	// 校验和错误的扩展块被忽略
+	data[blockSize+10]++
+	e, err = Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, "5KC,03", e.SerialString)
+	assert.Equal(t, "DEL-A0BC-5KC_03", e.Identity())
+	assert.True(t, e.ModelYear)
+	assert.Equal(t, uint8(0), e.Week)
+	assert.Empty(t, e.Extensions)
+
+	// 没有序列号
+	copy(data[12:16], make([]byte, 4))
+	data[111] = descriptorText
+	e, err = Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"5KC,03"}, e.Texts)
+	assert.Equal(t, "DEL-A0BC", e.Identity())
+}
+
+func TestLoadPnpIds(t *testing.T) {
+	ids, err := loadPnpIds("testdata/pnp.ids")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"AAA": "Avolites Ltd",
+		"DEL": "Dell Inc.",
+	}, ids)
+
+	assert.Equal(t, "Dell Inc.", VendorName("DEL"))
+	assert.Equal(t, "XYZ", VendorName("XYZ"))
+}
@@ -0,0 +1,87 @@
+package edid
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"sync"
+)
+
+// hwdata 提供的 PNP ID 列表，每行是 ID 和厂商名称，用 tab 分隔
+var pnpIdsFiles = []string{
+	"/usr/share/hwdata/pnp.ids",
+	"/usr/share/misc/pnp.ids",
+}
+
+// 系统中没有 pnp.ids 时使用，只包含常见的显示器厂商
+var builtinVendors = map[string]string{
+	"ACI": "Ancor Communications Inc",
+	"ACR": "Acer Technologies",
+	"AOC": "AOC",
+	"AUO": "AU Optronics",
+	"AUS": "ASUSTek COMPUTER INC",
+	"BNQ": "BenQ Corporation",
+	"BOE": "BOE",
+	"CMN": "Chimei Innolux Corporation",
+	"DEL": "Dell Inc.",
+	"EIZ": "EIZO GmbH Display Technologies",
+	"GSM": "Goldstar Company Ltd",
+	"HKC": "HKC Overseas Limited",
+	"HPN": "HP Inc.",
+	"HWP": "Hewlett Packard",
+	"IVO": "InfoVision Optoelectronics",
+	"LEN": "Lenovo Group Limited",
+	"LGD": "LG Display",
+	"MEI": "Panasonic Industry Company",
+	"NEC": "NEC Corporation",
+	"PHL": "Philips Consumer Electronics Company",
+	"SAM": "Samsung Electric Company",
+	"SDC": "Samsung Display Corp",
+	"SHP": "Sharp Corporation",
+	"SNY": "Sony",
+	"VSC": "ViewSonic Corporation",
+}
+
+var (
+	pnpIds     map[string]string
+	pnpIdsOnce sync.Once
+)
+
+func loadPnpIds(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	result := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(fields) != 2 || len(fields[0]) != 3 {
+			continue
+		}
+		result[fields[0]] = strings.TrimSpace(fields[1])
+	}
+	return result, scanner.Err()
+}
+
+// VendorName 返回 PNP ID 对应的厂商名称，找不到时返回 PNP ID
+func VendorName(id string) string {
+	pnpIdsOnce.Do(func() {
+		for _, file := range pnpIdsFiles {
+			ids, err := loadPnpIds(file)
+			if err == nil {
+				pnpIds = ids
+				return
+			}
+		}
+	})
+	if name, ok := pnpIds[id]; ok {
+		return name
+	}
+	if name, ok := builtinVendors[id]; ok {
+		return name
+	}
+	return id
+}
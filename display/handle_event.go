@@ -3,6 +3,7 @@ package display
 import (
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/randr"
+	"pkg.deepin.io/dde/startdde/display/brightness"
 )
 
 func (m *Manager) listenEvent() {
@@ -83,14 +84,33 @@ func (m *Manager) handleOutputChanged(ev *randr.OutputChangeNotifyEvent) {
 	newMonitorsID := m.getMonitorsId()
 	if newMonitorsID != oldMonitorsID {
 		logger.Debug("new monitors id:", newMonitorsID)
-		m.markClean()
-		m.applyDisplayMode()
+		m.backend.NotifyHotplug()
 		m.monitorsId = newMonitorsID
 	}
 }
 
+// 已连接的显示器发生变化后，放弃未保存的修改并重新应用显示模式
+func (m *Manager) handleHotplug() {
+	brightness.ResetDDCCICache()
+	m.markClean()
+	m.migrateMonitorUUIDs()
+	m.restoreCustomModes()
+	m.applyDisplayMode()
+	m.restoreOutputProps()
+	_, err := m.lid.HandleHotplug()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
 func (m *Manager) handleOutputPropertyChanged(ev *randr.OutputPropertyNotifyEvent) {
 	logger.Debug("output property changed", ev.Output, ev.Atom)
+	m.monitorMapMu.Lock()
+	monitor := m.monitorMap[ev.Output]
+	m.monitorMapMu.Unlock()
+	if monitor != nil && monitor.Connected {
+		monitor.updateOutputProps()
+	}
 }
 
 func (m *Manager) handleCrtcChanged(ev *randr.CrtcChangeNotifyEvent) {
@@ -180,4 +200,5 @@ func (m *Manager) handleScreenChanged(ev *randr.ScreenChangeNotifyEvent) {
 
 	logger.Info("redo map touch screen")
 	m.doMapTouches()
+	m.doMapTablets()
 }
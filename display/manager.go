@@ -3,13 +3,9 @@ package display
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
-	"os"
 	"os/exec"
-	"path/filepath"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 
@@ -17,20 +13,23 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	dbus "github.com/godbus/dbus"
+	ofdbus "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.dbus"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/randr"
 	"pkg.deepin.io/dde/startdde/display/brightness"
+	"pkg.deepin.io/dde/startdde/display/core"
 	"pkg.deepin.io/dde/startdde/display/utils"
 	gio "pkg.deepin.io/gir/gio-2.0"
 	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/log"
 )
 
 const (
-	DisplayModeCustom uint8 = iota
-	DisplayModeMirror
-	DisplayModeExtend
-	DisplayModeOnlyOne
-	DisplayModeUnknow
+	DisplayModeCustom  = core.DisplayModeCustom
+	DisplayModeMirror  = core.DisplayModeMirror
+	DisplayModeExtend  = core.DisplayModeExtend
+	DisplayModeOnlyOne = core.DisplayModeOnlyOne
+	DisplayModeUnknow  = core.DisplayModeUnknow
 )
 
 const (
@@ -49,31 +48,10 @@ const (
 	gsKeyCustomMode             = "current-custom-mode"
 	gsKeyColorTemperatureMode   = "color-temperature-mode"
 	gsKeyColorTemperatureManual = "color-temperature-manual"
-	customModeDelim             = "+"
-	monitorsIdDelimiter         = ","
 
 	cmdTouchscreenDialogBin = "/usr/lib/deepin-daemon/dde-touchscreen-dialog"
 )
 
-const (
-	priorityEDP = iota
-	priorityDP
-	priorityHDMI
-	priorityDVI
-	priorityVGA
-	priorityOther
-)
-
-var (
-	monitorPriority = map[string]int{
-		"edp":  priorityEDP,
-		"dp":   priorityDP,
-		"hdmi": priorityHDMI,
-		"dvi":  priorityDVI,
-		"vga":  priorityVGA,
-	}
-)
-
 //go:generate dbusutil-gen -output display_dbusutil.go -import github.com/godbus/dbus,github.com/linuxdeepin/go-x11-client -type Manager,Monitor manager.go monitor.go
 
 type Manager struct {
@@ -97,6 +75,25 @@ type Manager struct {
 	monitorsId               string
 	isLaptop                 bool
 	modeChanged              bool
+	colorTemperature         int // 当前使用的色温
+	colorTempCfg             *colorTempConfig
+	colorTempTimer           *time.Timer
+	colorTempMu              sync.Mutex
+	brightnessProfiles       map[string]*BrightnessProfile // 键为显示器的 UUID
+	brightnessProfilesMu     sync.Mutex
+	brightness               *core.Brightness
+	autoBrightness           *autoBrightness
+	autoRotation             *autoRotation
+	lid                      *core.LidHandler
+	screenPower              *screenPower
+	lidController            *core.LidController
+	profiles                 []*DisplayProfile
+	profilesMu               sync.Mutex
+	backend                  *randrBackend
+	switcher                 *core.ModeSwitcher
+	changes                  *core.ChangesManager
+	dbusDaemon               *ofdbus.DBus
+	sessionSigLoop           *dbusutil.SignalLoop
 
 	// dbusutil-gen: equal=nil
 	Monitors []dbus.ObjectPath
@@ -109,7 +106,11 @@ type Manager struct {
 	// dbusutil-gen: equal=nil
 	Touchscreens dxTouchscreens
 	// dbusutil-gen: equal=nil
-	TouchMap        map[string]string
+	TouchMap map[string]string
+	// dbusutil-gen: equal=nil
+	Tablets dxTablets
+	// dbusutil-gen: equal=nil
+	TabletMap       map[string]TabletMapping
 	CurrentCustomId string
 	Primary         string
 	// dbusutil-gen: equal=nil
@@ -121,25 +122,58 @@ type Manager struct {
 	ColorTemperatureMode gsprop.Enum `prop:"access:r"`
 	// adjust color temperature by manual adjustment
 	ColorTemperatureManual gsprop.Int `prop:"access:r"`
+	// color temperature currently applied, changes gradually during transitions
+	ColorTemperatureCurrent int32
+	// unix time when the next automatic transition begins, 0 if none
+	ColorTemperatureNextTransition int64
+	// adjust brightness of the builtin monitor by the ambient light sensor
+	AutoBrightness        bool
+	HasAmbientLightSensor bool
+	// rotate the builtin monitor by the accelerometer
+	AutoRotation   bool
+	RotationLocked bool
+	// what to do with the builtin monitor when the lid is closed
+	LidClosePolicy byte
 
 	methods *struct { //nolint
-		AssociateTouch         func() `in:"outputName,touchSerial"`
-		ChangeBrightness       func() `in:"raised"`
-		DeleteCustomMode       func() `in:"name"`
-		GetBrightness          func() `out:"values"`
-		ListOutputNames        func() `out:"names"`
-		ListOutputsCommonModes func() `out:"modes"`
-		ModifyConfigName       func() `in:"name,newName"`
-		SetAndSaveBrightness   func() `in:"outputName,value"`
-		SetBrightness          func() `in:"outputName,value"`
-		SetPrimary             func() `in:"outputName"`
-		SwitchMode             func() `in:"mode,name"`
-		CanRotate              func() `out:"can"`
-		CanSetBrightness       func() `in:"outputName" out:"can"`
-		GetBuiltinMonitor      func() `out:"name,path"`
-		SetMethodAdjustCCT     func() `in:"adjustMethod"`
-		SetColorTemperature    func() `in:"colorTemperature"`
-		GetRealDisplayMode     func() `out:"mode"`
+		AssociateTouch          func() `in:"outputName,touchSerial"`
+		AssociateTablet         func() `in:"outputName,deviceId,keepAspect"`
+		ChangeBrightness        func() `in:"raised"`
+		DeleteCustomMode        func() `in:"name"`
+		GetBrightness           func() `out:"values"`
+		ListOutputNames         func() `out:"names"`
+		ListOutputsCommonModes  func() `out:"modes"`
+		ModifyConfigName        func() `in:"name,newName"`
+		SetAndSaveBrightness    func() `in:"outputName,value"`
+		SetBrightness           func() `in:"outputName,value"`
+		SetPrimary              func() `in:"outputName"`
+		SwitchMode              func() `in:"mode,name"`
+		CanRotate               func() `out:"can"`
+		CanSetBrightness        func() `in:"outputName" out:"can"`
+		GetBuiltinMonitor       func() `out:"name,path"`
+		SetMethodAdjustCCT      func() `in:"adjustMethod"`
+		SetColorTemperature     func() `in:"colorTemperature"`
+		GetRealDisplayMode      func() `out:"mode"`
+		GetBrightnessProfile    func() `in:"outputName" out:"min,max,nightMin,gamma,steps"`
+		SetBrightnessProfile    func() `in:"outputName,min,max,nightMin,gamma,steps"`
+		SetAutoBrightness       func() `in:"enabled"`
+		SetAutoRotation         func() `in:"enabled"`
+		SetRotationLock         func() `in:"locked"`
+		SetLidClosePolicy       func() `in:"policy"`
+		GetScreenPowerTimeouts  func() `in:"onBattery" out:"dimDelay,offDelay,dimLevel"`
+		SetScreenPowerTimeouts  func() `in:"onBattery,dimDelay,offDelay,dimLevel"`
+		ListProfiles            func() `out:"names"`
+		ApplyProfile            func() `in:"name"`
+		SaveProfileAs           func() `in:"name"`
+		ApplyChangesWithTimeout func() `in:"seconds"`
+		GetLayout               func() `out:"layout"`
+		ApplyLayout             func() `in:"layout,dryRun" out:"result"`
+		ConfirmChanges          func()
+	}
+
+	signals *struct { //nolint
+		// 超时没有确认或者发起修改的客户端退出，修改已经被恢复
+		ChangesReverted struct{}
 	}
 }
 
@@ -154,6 +188,7 @@ type ModeInfo struct {
 var _xConn *x.Conn
 
 var _hasRandr1d2 bool // 是否 randr 版本大于等于 1.2
+var _hasRandr1d3 bool // 是否 randr 版本大于等于 1.3，支持 crtc transform
 
 func Init(xConn *x.Conn) {
 	_xConn = xConn
@@ -166,6 +201,10 @@ func Init(xConn *x.Conn) {
 			(randrVersion.ServerMajorVersion == 1 && randrVersion.ServerMinorVersion >= 2) {
 			_hasRandr1d2 = true
 		}
+		if randrVersion.ServerMajorVersion > 1 ||
+			(randrVersion.ServerMajorVersion == 1 && randrVersion.ServerMinorVersion >= 3) {
+			_hasRandr1d3 = true
+		}
 		logger.Debug("has randr1.2:", _hasRandr1d2)
 	}
 }
@@ -230,6 +269,28 @@ func newManager(service *dbusutil.Service) *Manager {
 		service:    service,
 		monitorMap: make(map[randr.Output]*Monitor),
 	}
+	m.backend = newRandrBackend(m)
+	m.lid = &core.LidHandler{
+		Backend: m.backend,
+		GetPrimary: func() string {
+			return m.Primary
+		},
+	}
+	m.lidController = &core.LidController{
+		Handler:    m.lid,
+		Callbacks:  lidCallbacks{m: m},
+		ConfigFile: lidConfigFile,
+	}
+	m.switcher = &core.ModeSwitcher{
+		Backend: m.backend,
+		GetPrimary: func() string {
+			return m.Primary
+		},
+		SaveConfig: m.saveConfig,
+		FixConfigs: m.lid.FixConfigs,
+	}
+	m.changes = core.NewChangesManager(changesHandler{m: m})
+	m.backend.SubscribeHotplug(m.handleHotplug)
 
 	chassis, err := getComputeChassis()
 	if err != nil {
@@ -247,6 +308,8 @@ func newManager(service *dbusutil.Service) *Manager {
 	m.CurrentCustomId = m.settings.GetString(gsKeyCustomMode)
 	m.ColorTemperatureManual.Bind(m.settings, gsKeyColorTemperatureManual)
 	m.ColorTemperatureMode.Bind(m.settings, gsKeyColorTemperatureMode)
+	m.colorTemperature = m.getTargetColorTemperature(time.Now())
+	m.ColorTemperatureCurrent = int32(m.colorTemperature)
 	m.xConn = _xConn
 
 	screen := m.xConn.GetDefaultScreen()
@@ -283,6 +346,7 @@ func newManager(service *dbusutil.Service) *Manager {
 		m.updateOutputPrimary()
 
 		m.config = loadConfig()
+		m.initDisplayProfiles()
 	} else {
 		// randr 版本低于 1.2
 		screenInfo, err := randr.GetScreenInfo(m.xConn, screen.Root).Reply(m.xConn)
@@ -319,43 +383,29 @@ func (m *Manager) initBuiltinMonitor() {
 	if err != nil {
 		logger.Warning(err)
 	}
-	monitors := m.getConnectedMonitors()
-	if builtinMonitorName != "" {
-		for _, monitor := range monitors {
-			if monitor.Name == builtinMonitorName {
-				m.builtinMonitor = monitor
-			}
-		}
-	}
-
-	if m.builtinMonitor != nil {
+	outputs, err := m.backend.ListOutputs()
+	if err != nil {
+		logger.Warning(err)
 		return
 	}
-	builtinMonitorName = ""
-
-	var rest []*Monitor
-	for _, monitor := range monitors {
-		name := strings.ToLower(monitor.Name)
-		if strings.HasPrefix(name, "vga") {
-			// ignore  VGA
-		} else if strings.HasPrefix(name, "edp") {
-			// 如果是 edp 开头，直接成为 builtinMonitor
-			rest = []*Monitor{monitor}
-			break
-		} else {
-			rest = append(rest, monitor)
+	builtin, candidates := core.GuessBuiltinOutput(outputs, builtinMonitorName)
+	if builtin == nil {
+		builtinMonitorName = ""
+	} else {
+		m.builtinMonitor = m.monitorMap[randr.Output(builtin.ID)]
+		if builtin.Name == builtinMonitorName {
+			return
+		}
+		builtinMonitorName = builtin.Name
+		if len(candidates) > 0 {
+			// 但是不保存到配置文件中
+			builtinMonitorName = ""
+			for _, o := range candidates {
+				m.candidateBuiltinMonitors = append(m.candidateBuiltinMonitors,
+					m.monitorMap[randr.Output(o.ID)])
+			}
 		}
 	}
-
-	if len(rest) == 1 {
-		m.builtinMonitor = rest[0]
-		builtinMonitorName = m.builtinMonitor.Name
-	} else if len(rest) > 1 {
-		m.builtinMonitor = getMinIDMonitor(rest)
-		// 但是不保存到配置文件中
-		m.candidateBuiltinMonitors = rest
-	}
-	logger.Debug("rest:", rest)
 	logger.Debug("m.builtinMonitor:", m.builtinMonitor)
 	logger.Debug("m.candidateBuiltinMonitors:", m.candidateBuiltinMonitors)
 
@@ -400,45 +450,21 @@ func (m *Manager) applyDisplayMode() {
 		return
 	}
 	logger.Debug("applyDisplayMode")
-	monitors := m.getConnectedMonitors()
-	var err error
-	if len(monitors) == 1 {
-		// 单屏
-		screenCfg := m.getScreenConfig()
-		var config *MonitorConfig
-		if screenCfg.Single != nil {
-			config = screenCfg.Single
-		} else {
-			config = monitors[0].toConfig()
-			config.Enabled = true
-			config.Primary = true
-			mode := monitors[0].BestMode
-			config.X = 0
-			config.Y = 0
-			config.Width = mode.Width
-			config.Height = mode.Height
-			config.RefreshRate = mode.Rate
-			config.Rotation = randr.RotationRotate0
+	result, err := m.switcher.ApplyDisplayMode(m.config, m.getProfiles(), m.DisplayMode, m.CurrentCustomId)
+	if result != nil {
+		if result.FallbackErr != nil {
+			logger.Warning(result.FallbackErr)
 		}
-
-		err = m.applyConfigs([]*MonitorConfig{config})
-		if err != nil {
-			logger.Warning("failed to apply configs:", err)
+		if result.CustomIdListChanged {
+			m.setPropCustomIdList(m.getCustomIdList())
+		}
+		if result.CustomId != m.CurrentCustomId {
+			m.setCurrentCustomId(result.CustomId)
+		}
+		if result.Mode != m.DisplayMode {
+			m.setDisplayMode(result.Mode)
 		}
-		return
-	}
-
-	switch m.DisplayMode {
-	case DisplayModeCustom:
-		err = m.switchModeCustom(m.CurrentCustomId)
-	case DisplayModeMirror:
-		err = m.switchModeMirror()
-	case DisplayModeExtend:
-		err = m.switchModeExtend("")
-	case DisplayModeOnlyOne:
-		err = m.switchModeOnlyOne("")
 	}
-
 	if err != nil {
 		logger.Warning(err)
 	}
@@ -447,16 +473,16 @@ func (m *Manager) applyDisplayMode() {
 func (m *Manager) init() {
 	brightness.InitBacklightHelper()
 	m.initBrightness()
+	m.migrateMonitorUUIDs()
+	m.restoreCustomModes()
 	m.applyDisplayMode()
+	m.restoreOutputProps()
 	m.listenEvent() //等待applyDisplayMode执行完成再开启监听X事件
+	m.listenNameLost()
 }
 
 func (m *Manager) initColorTemperature() {
-	method := m.ColorTemperatureMode.Get()
-	err := m.SetMethodAdjustCCT(method)
-	if err != nil {
-		logger.Error(err)
-	}
+	m.updateColorTemperature()
 }
 
 func calcRecommendedScaleFactor(widthPx, heightPx, widthMm, heightMm float64) float64 {
@@ -646,6 +672,7 @@ func (m *Manager) addMonitorFallback(screenInfo *randr.GetScreenInfoReply) (*Mon
 		Enabled:   true,
 		Width:     size.Width,
 		Height:    size.Height,
+		Scale:     1,
 	}
 
 	err = m.service.Export(monitor.getPath(), monitor)
@@ -713,7 +740,7 @@ func (m *Manager) addMonitor(output randr.Output, outputInfo *randr.GetOutputInf
 	if err != nil {
 		logger.Warning(err)
 	}
-	manufacturer, model := parseEDID(edid)
+	manufacturer, model := core.ParseEDID(edid)
 	logger.Debug("addMonitor", output, outputInfo.Name)
 	monitor := &Monitor{
 		service:           m.service,
@@ -725,9 +752,11 @@ func (m *Manager) addMonitor(output randr.Output, outputInfo *randr.GetOutputInf
 		MmHeight:          outputInfo.MmHeight,
 		Enabled:           enabled,
 		crtc:              outputInfo.Crtc,
-		uuid:              getOutputUUID(outputInfo.Name, edid),
+		uuid:              core.MonitorUUID(outputInfo.Name, edid),
+		legacyUUID:        core.OutputUUID(outputInfo.Name, edid),
 		Manufacturer:      manufacturer,
 		Model:             model,
+		Scale:             1,
 		lastConnectedTime: lastConnectedTime,
 	}
 
@@ -754,6 +783,10 @@ func (m *Manager) addMonitor(output randr.Output, outputInfo *randr.GetOutputInf
 	if err != nil {
 		return err
 	}
+	monitor.updateEDID(edid)
+	if connected {
+		monitor.updateOutputProps()
+	}
 	m.monitorMapMu.Lock()
 	m.monitorMap[output] = monitor
 	m.monitorMapMu.Unlock()
@@ -802,10 +835,10 @@ func (m *Manager) updateMonitor(output randr.Output, outputInfo *randr.GetOutput
 	} else {
 		m.updateBuiltinMonitorOnDisconnected(monitor.ID)
 	}
-	manufacturer, model := parseEDID(edid)
-	uuid := getOutputUUID(outputInfo.Name, edid)
+	manufacturer, model := core.ParseEDID(edid)
 	monitor.PropsMu.Lock()
-	monitor.uuid = uuid
+	monitor.uuid = core.MonitorUUID(outputInfo.Name, edid)
+	monitor.legacyUUID = core.OutputUUID(outputInfo.Name, edid)
 	monitor.crtc = outputInfo.Crtc
 	monitor.lastConnectedTime = lastConnectedTime
 	monitor.setPropManufacturer(manufacturer)
@@ -818,6 +851,10 @@ func (m *Manager) updateMonitor(output randr.Output, outputInfo *randr.GetOutput
 	monitor.setPropMmWidth(outputInfo.MmWidth)
 	monitor.setPropMmHeight(outputInfo.MmHeight)
 	monitor.PropsMu.Unlock()
+	monitor.updateEDID(edid)
+	if connected {
+		monitor.updateOutputProps()
+	}
 	m.updateMonitorCrtcInfo(monitor, crtcInfo)
 }
 
@@ -869,64 +906,9 @@ func (m *Manager) findFreeCrtc(output randr.Output) randr.Crtc {
 	return 0
 }
 
-func (m *Manager) switchModeMirrorAux() (err error, monitor0 *Monitor) {
-	logger.Debug("switch mode mirror")
-	screenCfg := m.getScreenConfig()
-	configs := screenCfg.getMonitorConfigs(DisplayModeMirror, "")
-	monitors := m.getConnectedMonitors()
-	commonSizes := getMonitorsCommonSizes(monitors)
-	if len(commonSizes) == 0 {
-		err = errors.New("not found common size")
-		return
-	}
-	maxSize := getMaxAreaSize(commonSizes)
-	logger.Debug("max common size:", maxSize)
-	for _, monitor := range m.monitorMap {
-		if monitor.Connected {
-			monitor.enable(true)
-
-			cfg := getMonitorConfigByUuid(configs, monitor.uuid)
-			var mode ModeInfo
-			if cfg != nil {
-				mode = monitor.selectMode(cfg.Width, cfg.Height, cfg.RefreshRate)
-			} else {
-				mode = getFirstModeBySize(monitor.Modes, maxSize.width, maxSize.height)
-			}
-			monitor.setMode(mode)
-			monitor.setPosition(0, 0)
-			monitor.setRotation(randr.RotationRotate0)
-			monitor.setReflect(0)
-
-		} else {
-			monitor.enable(false)
-		}
-	}
-
-	err = m.apply()
-	if err != nil {
-		return
-	}
-
-	monitor0 = m.getDefaultPrimaryMonitor(m.getConnectedMonitors())
-	if monitor0 != nil {
-		err = m.setOutputPrimary(randr.Output(monitor0.ID))
-		if err != nil {
-			return
-		}
-	}
-	return
-}
-
 func (m *Manager) switchModeMirror() (err error) {
-	err, monitor0 := m.switchModeMirrorAux()
-	if err != nil {
-		return
-	}
-
-	screenCfg := m.getScreenConfig()
-	screenCfg.setMonitorConfigs(DisplayModeMirror, "",
-		toMonitorConfigs(m.getConnectedMonitors(), monitor0.Name))
-	return m.saveConfig()
+	logger.Debug("switch mode mirror")
+	return m.switcher.SwitchModeMirror(m.getScreenConfig())
 }
 
 type screenSize struct {
@@ -965,6 +947,7 @@ type crtcConfig struct {
 	y        int16
 	rotation uint16
 	mode     randr.Mode
+	scale    float64
 }
 
 func (m *Manager) apply() error {
@@ -993,6 +976,7 @@ func (m *Manager) apply() error {
 				mode:     randr.Mode(monitor.CurrentMode.Id),
 				rotation: monitor.Rotation | monitor.Reflect,
 				outputs:  []randr.Output{output},
+				scale:    monitor.Scale,
 			}
 		} else {
 			if monitor.crtc != 0 {
@@ -1074,14 +1058,7 @@ func (m *Manager) apply() error {
 		m.updateMonitor(output, outputInfo)
 
 		if monitor.Enabled {
-			m.PropsMu.Lock()
-			value, ok := m.Brightness[monitor.Name]
-			if !ok {
-				value = 1
-				m.Brightness[monitor.Name] = value
-				_ = m.emitPropChangedBrightness(m.Brightness)
-			}
-			m.PropsMu.Unlock()
+			value := m.brightness.GetOrInit(monitor.Name, 1)
 
 			go func(mon *Monitor) {
 				err = m.setMonitorBrightness(mon, value)
@@ -1092,6 +1069,9 @@ func (m *Manager) apply() error {
 		}
 	}
 
+	// 显示器的位置、旋转或缩放可能变了，更新触摸屏和数位板的坐标变换矩阵
+	m.doMapTouches()
+	m.doMapTablets()
 	return nil
 }
 
@@ -1163,142 +1143,30 @@ func (m *Manager) updateOutputPrimary() {
 	}
 
 	m.PropsMu.Lock()
+	primaryChanged := m.Primary != newPrimary
 	m.setPropPrimary(newPrimary)
 	m.setPropPrimaryRect(newRect)
 	m.PropsMu.Unlock()
 
 	logger.Debugf("updateOutputPrimary name: %q, rect: %#v", newPrimary, newRect)
+	if primaryChanged {
+		// 跟随主屏的数位板需要重新映射
+		m.doMapTablets()
+	}
 }
 
 func (m *Manager) setPrimary(name string) error {
-	switch m.DisplayMode {
-	case DisplayModeMirror:
-		return errors.New("not allow set primary in mirror mode")
-
-	case DisplayModeOnlyOne:
-		return m.switchModeOnlyOne(name)
-
-	case DisplayModeExtend, DisplayModeCustom:
-		screenCfg := m.getScreenConfig()
-		configs := screenCfg.getMonitorConfigs(m.DisplayMode, m.CurrentCustomId)
-
-		var monitor0 *Monitor
-		for _, monitor := range m.monitorMap {
-			if monitor.Name != name {
-				continue
-			}
-
-			if !monitor.Connected {
-				return errors.New("monitor is not connected")
-			}
-
-			monitor0 = monitor
-			break
-		}
-
-		if monitor0 == nil {
-			return errors.New("not found monitor")
-		}
-
-		if len(configs) == 0 {
-			if m.DisplayMode == DisplayModeCustom {
-				return errors.New("custom mode configs is empty")
-			}
-			configs = toMonitorConfigs(m.getConnectedMonitors(), monitor0.Name)
-		} else {
-			// modify configs
-			updateMonitorConfigsName(configs, m.monitorMap)
-			setMonitorConfigsPrimary(configs, monitor0.uuid)
-		}
-
-		err := m.setOutputPrimary(randr.Output(monitor0.ID))
-		if err != nil {
-			return err
-		}
-
-		screenCfg.setMonitorConfigs(m.DisplayMode, m.CurrentCustomId, configs)
-
-		err = m.saveConfig()
-		if err != nil {
-			return err
-		}
-
-	default:
-		return fmt.Errorf("invalid display mode %v", m.DisplayMode)
+	err := m.switcher.SetPrimary(m.getScreenConfig(), m.DisplayMode, m.CurrentCustomId, name)
+	if err != nil {
+		return err
 	}
+	m.lidController.HandleLayoutChanged(false)
 	return nil
 }
 
 func (m *Manager) switchModeExtend(primary string) (err error) {
 	logger.Debug("switch mode extend")
-	var monitors []*Monitor
-	for _, monitor := range m.monitorMap {
-		monitors = append(monitors, monitor)
-	}
-	sortMonitorsByID(monitors)
-	screenCfg := m.getScreenConfig()
-	configs := screenCfg.getMonitorConfigs(DisplayModeExtend, "")
-
-	var xOffset int
-	var monitor0 *Monitor
-	for _, monitor := range monitors {
-		if monitor.Connected {
-			monitor.enable(true)
-
-			cfg := getMonitorConfigByUuid(configs, monitor.uuid)
-			var mode ModeInfo
-			if cfg != nil {
-				mode = monitor.selectMode(cfg.Width, cfg.Height, cfg.RefreshRate)
-				if monitor0 == nil && cfg.Primary {
-					monitor0 = monitor
-				}
-
-			} else {
-				mode = monitor.BestMode
-			}
-
-			monitor.setMode(mode)
-
-			if xOffset > math.MaxInt16 {
-				xOffset = math.MaxInt16
-			}
-			monitor.setPosition(int16(xOffset), 0)
-			monitor.setRotation(randr.RotationRotate0)
-			monitor.setReflect(0)
-
-			xOffset += int(monitor.Width)
-		} else {
-			monitor.enable(false)
-		}
-	}
-
-	if monitor0 == nil {
-		monitor0 = m.getDefaultPrimaryMonitor(m.getConnectedMonitors())
-	}
-
-	err = m.apply()
-	if err != nil {
-		return
-	}
-
-	if monitor0 != nil {
-		err = m.setOutputPrimary(randr.Output(monitor0.ID))
-		if err != nil {
-			logger.Warning("failed to set primary output:", err)
-			return
-		}
-
-		screenCfg.setMonitorConfigs(DisplayModeExtend, "",
-			toMonitorConfigs(m.getConnectedMonitors(), monitor0.Name))
-
-		err = m.saveConfig()
-		if err != nil {
-			logger.Warning("failed to save config:", err)
-			return
-		}
-	}
-
-	return
+	return m.switcher.SwitchModeExtend(m.getScreenConfig())
 }
 
 func (m *Manager) getScreenConfig() *ScreenConfig {
@@ -1313,134 +1181,18 @@ func (m *Manager) getScreenConfig() *ScreenConfig {
 
 func (m *Manager) switchModeOnlyOne(name string) (err error) {
 	logger.Debug("switch mode only one", name)
-
-	screenCfg := m.getScreenConfig()
-	configs := screenCfg.getMonitorConfigs(DisplayModeOnlyOne, "")
-
-	var monitor0 *Monitor
-	var needSaveCfg bool
-	if name != "" {
-		needSaveCfg = true
-		for _, monitor := range m.monitorMap {
-			if monitor.Name == name {
-				monitor0 = monitor
-
-				if !monitor.Connected {
-					err = errors.New("monitor is not connected")
-					return
-				}
-
-				break
-			}
-		}
-		if monitor0 == nil {
-			err = errors.New("not found monitor")
-			return
-		}
-	} else {
-		var enableUuid string
-		for _, cfg := range configs {
-			if cfg.Enabled {
-				enableUuid = cfg.UUID
-				break
-			}
-		}
-		if enableUuid != "" {
-			for _, monitor := range m.monitorMap {
-				if monitor.uuid == enableUuid {
-					monitor0 = monitor
-					break
-				}
-			}
-		}
-
-		if monitor0 == nil {
-			needSaveCfg = true
-			monitor0 = getMinIDMonitor(m.getConnectedMonitors())
-		}
-
-	}
-	if monitor0 == nil {
-		err = errors.New("monitor0 is nil")
-		return
-	}
-
-	for _, monitor := range m.monitorMap {
-		if monitor.uuid == monitor0.uuid {
-			monitor.enable(true)
-			cfg := getMonitorConfigByUuid(configs, monitor.uuid)
-			var mode ModeInfo
-			var rotation uint16 = randr.RotationRotate0
-			var reflect uint16
-			if cfg != nil {
-				mode = monitor.selectMode(cfg.Width, cfg.Height, cfg.RefreshRate)
-				rotation = cfg.Rotation
-				reflect = cfg.Reflect
-			} else {
-				mode = monitor.BestMode
-			}
-
-			monitor.setMode(mode)
-			monitor.setPosition(0, 0)
-			monitor.setRotation(rotation)
-			monitor.setReflect(reflect)
-
-		} else {
-			monitor.enable(false)
-		}
-	}
-
-	err = m.apply()
-	if err != nil {
-		return
-	}
-
-	// set primary output
-	err = m.setOutputPrimary(randr.Output(monitor0.ID))
-	if err != nil {
-		return
-	}
-
-	if needSaveCfg {
-		screenCfg.setMonitorConfigs(DisplayModeOnlyOne, "",
-			toMonitorConfigs(m.getConnectedMonitors(), monitor0.Name))
-
-		err = m.saveConfig()
-		if err != nil {
-			return
-		}
-	}
-
-	return
+	return m.switcher.SwitchModeOnlyOne(m.getScreenConfig(), name)
 }
 
 func (m *Manager) switchModeCustom(name string) (err error) {
 	logger.Debug("switch mode custom", name)
-	if name == "" {
-		err = errors.New("name is empty")
-		return
-	}
-
-	screenCfg := m.getScreenConfig()
-	configs := screenCfg.getMonitorConfigs(DisplayModeCustom, name)
-	if len(configs) > 0 {
-		err = m.applyConfigs(configs)
-		return
-	}
-
-	// 自定义配置不存在时，默认使用复制模式，即自定义模式的合并子模式
-	err, monitor0 := m.switchModeMirrorAux()
+	created, err := m.switcher.SwitchModeCustom(m.getScreenConfig(), name)
 	if err != nil {
 		return
 	}
-
-	screenCfg.setMonitorConfigs(DisplayModeCustom, name,
-		toMonitorConfigs(m.getConnectedMonitors(), monitor0.Name))
-	err = m.saveConfig()
-	if err != nil {
-		return
+	if created {
+		m.setPropCustomIdList(m.getCustomIdList())
 	}
-	m.setPropCustomIdList(m.getCustomIdList())
 	return
 }
 
@@ -1463,6 +1215,7 @@ func (m *Manager) switchMode(mode byte, name string) (err error) {
 	if err == nil {
 		m.setDisplayMode(mode)
 		m.modeChanged = true
+		m.lidController.HandleLayoutChanged(true)
 	} else {
 		logger.Warningf("failed to switch mode %v %v: %v", mode, name, err)
 	}
@@ -1492,8 +1245,10 @@ func (m *Manager) save() (err error) {
 	if len(monitors) == 1 {
 		screenCfg.Single = monitors[0].toConfig()
 	} else {
-		screenCfg.setMonitorConfigs(m.DisplayMode, m.CurrentCustomId,
-			toMonitorConfigs(monitors, m.Primary))
+		configs := toMonitorConfigs(monitors, m.Primary)
+		// 合上盖子禁用内置显示器只是临时的
+		m.lid.FixConfigs(configs)
+		screenCfg.SetMonitorConfigs(m.DisplayMode, m.CurrentCustomId, configs)
 	}
 
 	err = m.saveConfig()
@@ -1510,6 +1265,7 @@ func (m *Manager) markClean() {
 		monitor.backup = nil
 	}
 	m.monitorMapMu.Unlock()
+	m.changes.Cancel()
 
 	m.PropsMu.Lock()
 	m.setPropHasChanged(false)
@@ -1535,110 +1291,11 @@ func (m *Manager) setCurrentCustomId(name string) {
 
 func (m *Manager) applyConfigs(configs []*MonitorConfig) error {
 	logger.Debug("applyConfigs", spew.Sdump(configs))
-	var primaryOutput randr.Output
-	for output, monitor := range m.monitorMap {
-		monitorCfg := getMonitorConfigByUuid(configs, monitor.uuid)
-		if monitorCfg == nil {
-			monitor.enable(false)
-		} else {
-			if monitorCfg.Primary && monitorCfg.Enabled {
-				primaryOutput = output
-			}
-			monitor.enable(monitorCfg.Enabled)
-			monitor.setPosition(monitorCfg.X, monitorCfg.Y)
-			monitor.setRotation(monitorCfg.Rotation)
-			monitor.setReflect(monitorCfg.Reflect)
-
-			width := monitorCfg.Width
-			height := monitorCfg.Height
-			if needSwapWidthHeight(monitorCfg.Rotation) {
-				width, height = height, width
-			}
-			mode := monitor.selectMode(width, height, monitorCfg.RefreshRate)
-			monitor.setMode(mode)
-		}
-	}
-	err := m.apply()
-	if err != nil {
-		return err
-	}
-	if primaryOutput == 0 {
-		primaryOutput = randr.Output(m.getDefaultPrimaryMonitor(m.getConnectedMonitors()).ID)
-	}
-	err = m.setOutputPrimary(primaryOutput)
-	if err != nil {
-		return err
-	}
-	return nil
-}
-
-func (m *Manager) getDefaultPrimaryMonitor(monitors []*Monitor) *Monitor {
-	if len(monitors) == 0 {
-		return nil
-	}
-	builtinMonitor := m.getBuiltinMonitor()
-	if builtinMonitor != nil {
-		return builtinMonitor
-	}
-
-	monitor := m.getPriorMonitor(monitors)
-	if monitor != nil {
-		return monitor
-	}
-
-	return getMinLastConnectedTimeMonitor(monitors)
-}
-
-func (m *Manager) getPriorMonitor(monitors []*Monitor) *Monitor {
-	var monitor *Monitor
-	priority := priorityOther
-	for _, v := range monitors {
-		name := m.getPortType(v.Name)
-		p, ok := monitorPriority[name]
-
-		// 不在列表中的话，留空，以便最后通过连接时间来设置主屏幕
-		if !ok {
-			continue
-		}
-
-		if p < priority {
-			monitor = v
-			priority = p
-			continue
-		}
-
-		// 当接口类型相同，若一个是默认显示器，继续让它作为默认显示器
-		if p == priority && m.Primary == v.Name {
-			monitor = v
-			priority = p
-		}
-	}
-
-	return monitor
-}
-
-func (m *Manager) getPortType(name string) string {
-	i := strings.IndexRune(name, '-')
-	if i != -1 {
-		name = name[0 : i+1]
-	}
-	return strings.ToLower(name)
+	return m.switcher.ApplyConfigs(configs)
 }
 
 func (m *Manager) getCustomIdList() []string {
-	id := m.getMonitorsId()
-
-	screenCfg := m.config[id]
-	if screenCfg == nil {
-		return nil
-	}
-
-	result := make([]string, len(screenCfg.Custom))
-	for idx, custom := range screenCfg.Custom {
-		result[idx] = custom.Name
-	}
-	sort.Strings(result)
-	return result
+	return m.config.GetCustomIdList(m.getMonitorsId())
 }
 
 func (m *Manager) getMonitorsId() string {
@@ -1651,11 +1308,7 @@ func (m *Manager) getMonitorsId() string {
 		ids = append(ids, monitor.uuid)
 	}
 	m.monitorMapMu.Unlock()
-	if len(ids) == 0 {
-		return ""
-	}
-	sort.Strings(ids)
-	return strings.Join(ids, monitorsIdDelimiter)
+	return core.GetMonitorsId(ids)
 }
 
 func (m *Manager) updatePropMonitors() {
@@ -1784,22 +1437,29 @@ func (m *Manager) isCustomModeBeingUsed(name string) bool {
 		m.CurrentCustomId == name
 }
 
+// getScreenSize 根据已启用的显示器计算屏幕大小，可以在任何 goroutine 中调用
 func (m *Manager) getScreenSize() (sw, sh uint16) {
 	var w, h int
-	for _, monitor := range m.monitorMap {
-		if !monitor.Connected || !monitor.Enabled {
-			continue
-		}
-
+	for _, monitor := range m.getConnectedMonitors() {
+		monitor.PropsMu.RLock()
+		enabled := monitor.Enabled
 		width := monitor.CurrentMode.Width
 		height := monitor.CurrentMode.Height
+		rotation := monitor.Rotation
+		scale := monitor.Scale
+		x0, y0 := monitor.X, monitor.Y
+		monitor.PropsMu.RUnlock()
+		if !enabled {
+			continue
+		}
 
-		if needSwapWidthHeight(monitor.Rotation) {
+		if needSwapWidthHeight(rotation) {
 			width, height = height, width
 		}
+		width, height = core.ScaledSize(width, height, scale)
 
-		w1 := int(monitor.X) + int(width)
-		h1 := int(monitor.Y) + int(height)
+		w1 := int(x0) + int(width)
+		h1 := int(y0) + int(height)
 
 		if w < w1 {
 			w = w1
@@ -1867,19 +1527,12 @@ func (m *Manager) doMapTouches() {
 }
 
 func (m *Manager) doSetTouchMap(output, touchSerial string) error {
-	monitors := m.getConnectedMonitors()
-	found := false
-	for _, monitor := range monitors {
-		if monitor.Name == output {
-			found = true
-			break
-		}
-	}
-	if !found {
+	monitor := m.getConnectedMonitors().GetByName(output)
+	if monitor == nil {
 		return fmt.Errorf("invalid output name: %s", output)
 	}
 
-	found = false
+	found := false
 	for _, touchscreen := range m.Touchscreens {
 		if touchscreen.Serial != touchSerial {
 			continue
@@ -1887,7 +1540,7 @@ func (m *Manager) doSetTouchMap(output, touchSerial string) error {
 
 		found = true
 		// 有多个设备的序列号一样的情况
-		err := doAction(fmt.Sprintf("xinput --map-to-output %d %s", touchscreen.Id, output))
+		err := m.setTouchMatrix(touchscreen.Id, monitor)
 		if err != nil {
 			logger.Warning("failed to map touchscreen:", err)
 		}
@@ -1925,22 +1578,7 @@ func (m *Manager) associateTouch(outputName, touchSerial string) error {
 
 func (m *Manager) saveConfig() error {
 	logger.Debug("save config")
-	dir := filepath.Dir(configFile)
-	err := os.MkdirAll(dir, 0755)
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(configVersionFile, []byte(configVersion), 0644)
-	if err != nil {
-		return err
-	}
-
-	err = m.config.save(configFile)
-	if err != nil {
-		return err
-	}
-	return nil
+	return m.config.Save(configFile, configVersionFile, logger.GetLogLevel() == log.LevelDebug)
 }
 
 func (m *Manager) showTouchscreenDialog(touchscreenSerial string) error {
@@ -1967,6 +1605,7 @@ func (m *Manager) handleTouchscreenChanged() {
 	m.setPropTouchscreens(touchscreens)
 	m.PropsMu.Unlock()
 
+	var newTouches []*Touchscreen
 	for _, touch := range touchscreens {
 		found := false
 		for _, v := range oldTouchscreens {
@@ -1989,8 +1628,11 @@ func (m *Manager) handleTouchscreenChanged() {
 			}
 			continue
 		}
+		newTouches = append(newTouches, touch)
+	}
 
-		// 无配置，关联默认显示器，并显示配置 Dialog
+	for _, touch := range m.autoAssociateTouches(newTouches) {
+		// 无法自动关联，关联默认显示器，并显示配置 Dialog
 		m.associateTouch(m.Primary, touch.Serial)
 		err := m.showTouchscreenDialog(touch.Serial)
 		if err != nil {
@@ -3,17 +3,14 @@ package display
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"strconv"
 
 	"github.com/linuxdeepin/go-x11-client/ext/randr"
 	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/display/brightness"
+	"pkg.deepin.io/dde/startdde/display/core"
 	"pkg.deepin.io/lib/dbusutil"
 	"pkg.deepin.io/lib/strv"
-	"pkg.deepin.io/lib/xdg/basedir"
 )
 
 func (m *Manager) GetInterfaceName() string {
@@ -24,28 +21,30 @@ func (m *Manager) ApplyChanges() *dbus.Error {
 	if !m.HasChanged {
 		return nil
 	}
-	err := m.apply()
-	return dbusutil.ToError(err)
-}
-
-func (m *Manager) ResetChanges() *dbus.Error {
-	if !m.HasChanged {
-		return nil
-	}
-
-	for _, monitor := range m.monitorMap {
-		monitor.resetChanges()
-	}
-
 	err := m.apply()
 	if err != nil {
 		return dbusutil.ToError(err)
 	}
-
-	m.setPropHasChanged(false)
+	m.lidController.HandleLayoutChanged(false)
 	return nil
 }
 
+// ApplyChangesWithTimeout 应用修改，seconds 秒内没有调用 ConfirmChanges 就自动恢复
+func (m *Manager) ApplyChangesWithTimeout(sender dbus.Sender, seconds uint32) *dbus.Error {
+	err := m.changes.ApplyWithTimeout(string(sender), seconds)
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) ConfirmChanges() *dbus.Error {
+	err := m.changes.Confirm()
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) ResetChanges() *dbus.Error {
+	err := m.changes.Reset()
+	return dbusutil.ToError(err)
+}
+
 func (m *Manager) SwitchMode(mode byte, name string) *dbus.Error {
 	err := m.switchMode(mode, name)
 	return dbusutil.ToError(err)
@@ -61,13 +60,23 @@ func (m *Manager) AssociateTouch(outputName, touchSerial string) *dbus.Error {
 	return dbusutil.ToError(err)
 }
 
+func (m *Manager) AssociateTablet(outputName string, deviceId int32, keepAspect bool) *dbus.Error {
+	err := m.associateTablet(outputName, deviceId, keepAspect)
+	return dbusutil.ToError(err)
+}
+
 func (m *Manager) ChangeBrightness(raised bool) *dbus.Error {
 	err := m.changeBrightness(raised)
+	if err == nil {
+		if builtinMonitor := m.getBuiltinMonitor(); builtinMonitor != nil {
+			m.learnAutoBrightness(builtinMonitor.Name)
+		}
+	}
 	return dbusutil.ToError(err)
 }
 
 func (m *Manager) GetBrightness() (map[string]float64, *dbus.Error) {
-	return m.Brightness, nil
+	return m.brightness.Values(), nil
 }
 
 func (m *Manager) ListOutputNames() ([]string, *dbus.Error) {
@@ -104,11 +113,9 @@ func (m *Manager) DeleteCustomMode(name string) *dbus.Error {
 }
 
 func (m *Manager) RefreshBrightness() *dbus.Error {
-	for k, v := range m.Brightness {
-		err := m.doSetBrightness(v, k)
-		if err != nil {
-			logger.Warning(err)
-		}
+	err := m.brightness.Refresh()
+	if err != nil {
+		logger.Warning(err)
 	}
 	return nil
 }
@@ -119,9 +126,9 @@ func (m *Manager) Reset() *dbus.Error {
 }
 
 func (m *Manager) SetAndSaveBrightness(outputName string, value float64) *dbus.Error {
-	err := m.doSetBrightness(value, outputName)
+	err := m.brightness.SetAndSave(outputName, value)
 	if err == nil {
-		m.saveBrightness()
+		m.learnAutoBrightness(outputName)
 	}
 	return dbusutil.ToError(err)
 }
@@ -141,11 +148,12 @@ func (m *Manager) SetPrimary(outputName string) *dbus.Error {
 	return dbusutil.ToError(err)
 }
 
+// CanRotate 返回是否有方向传感器可以自动旋转内置显示器
 func (m *Manager) CanRotate() (bool, *dbus.Error) {
 	if os.Getenv("DEEPIN_DISPLAY_DISABLE_ROTATE") == "1" {
 		return false, nil
 	}
-	return true, nil
+	return m.autoRotation != nil && m.autoRotation.hasSensor(), nil
 }
 
 func (m *Manager) CanSetBrightness(outputName string) (bool, *dbus.Error) {
@@ -159,7 +167,14 @@ func (m *Manager) CanSetBrightness(outputName string) (bool, *dbus.Error) {
 			return false, nil
 		}
 	}
-	return true, nil
+
+	monitor := m.getConnectedMonitors().GetByName(outputName)
+	if monitor == nil {
+		return false, nil
+	}
+	can := brightness.CanSet(m.getBrightnessSetter(), m.isBuiltinMonitor(monitor),
+		monitor.ID, m.xConn)
+	return can, nil
 }
 
 func (m *Manager) getBuiltinMonitor() *Monitor {
@@ -189,19 +204,10 @@ func (m *Manager) SetMethodAdjustCCT(adjustMethod int32) *dbus.Error {
 		return dbusutil.ToError(errors.New("adjustMethod type out of range, not 0 or 1 or 2"))
 	}
 	m.ColorTemperatureMode.Set(adjustMethod)
-	switch adjustMethod {
-	case ColorTemperatureModeNormal: // 不调节色温，关闭redshift服务
-		controlRedshift("stop") // 停止服务
-		resetColorTemp()        // 色温重置
-	case ColorTemperatureModeAuto: // 自动模式调节色温 启动服务
-		resetColorTemp()
-		controlRedshift("start") // 开启服务
-	case ColorTemperatureModeManual: // 手动调节色温 关闭服务 调节色温(调用存在之前保存的手动色温值)
-		controlRedshift("stop") // 停止服务
-		lastManualCCT := m.ColorTemperatureManual.Get()
-		err := m.SetColorTemperature(lastManualCCT)
-		return err
+	if adjustMethod == ColorTemperatureModeAuto {
+		m.reloadColorTempConfig()
 	}
+	m.updateColorTemperature()
 	return nil
 }
 
@@ -209,14 +215,80 @@ func (m *Manager) SetColorTemperature(value int32) *dbus.Error {
 	if m.ColorTemperatureMode.Get() != ColorTemperatureModeManual {
 		return dbusutil.ToError(errors.New("current not manual mode, can not adjust CCT by manual"))
 	}
-	if value < 1000 || value > 25000 {
+	if value < brightness.ColorTemperatureMin || value > brightness.ColorTemperatureMax {
 		return dbusutil.ToError(errors.New("value out of range"))
 	}
-	setColorTempOneShot(strconv.Itoa(int(value))) // 手动设置色温
 	m.ColorTemperatureManual.Set(value)
+	m.updateColorTemperature()
 	return nil
 }
 
+func (m *Manager) GetBrightnessProfile(outputName string) (min, max, nightMin, gamma float64,
+	steps int32, busErr *dbus.Error) {
+	monitor := m.getConnectedMonitors().GetByName(outputName)
+	if monitor == nil {
+		busErr = dbusutil.ToError(InvalidOutputNameError{Name: outputName})
+		return
+	}
+	p := m.getBrightnessProfile(monitor.uuid)
+	return p.Min, p.Max, p.NightMin, p.Gamma, int32(p.Steps), nil
+}
+
+func (m *Manager) SetBrightnessProfile(outputName string, min, max, nightMin, gamma float64,
+	steps int32) *dbus.Error {
+	monitor := m.getConnectedMonitors().GetByName(outputName)
+	if monitor == nil {
+		return dbusutil.ToError(InvalidOutputNameError{Name: outputName})
+	}
+	err := m.setBrightnessProfile(monitor.uuid, BrightnessProfile{
+		Min:      min,
+		Max:      max,
+		NightMin: nightMin,
+		Gamma:    gamma,
+		Steps:    int(steps),
+	})
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) SetAutoBrightness(enabled bool) *dbus.Error {
+	err := m.setAutoBrightness(enabled)
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) SetAutoRotation(enabled bool) *dbus.Error {
+	err := m.setAutoRotation(enabled)
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) SetRotationLock(locked bool) *dbus.Error {
+	err := m.setRotationLock(locked)
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) SetLidClosePolicy(policy uint8) *dbus.Error {
+	err := m.lidController.SetPolicy(policy)
+	return dbusutil.ToError(err)
+}
+
+func (m *Manager) GetScreenPowerTimeouts(onBattery bool) (dimDelay, offDelay uint32, dimLevel float64,
+	busErr *dbus.Error) {
+	t, err := m.getScreenPowerTimeouts(onBattery)
+	if err != nil {
+		busErr = dbusutil.ToError(err)
+		return
+	}
+	return t.DimDelay, t.OffDelay, t.DimLevel, nil
+}
+
+func (m *Manager) SetScreenPowerTimeouts(onBattery bool, dimDelay, offDelay uint32, dimLevel float64) *dbus.Error {
+	err := m.setScreenPowerTimeouts(onBattery, core.ScreenPowerTimeouts{
+		DimDelay: dimDelay,
+		OffDelay: offDelay,
+		DimLevel: dimLevel,
+	})
+	return dbusutil.ToError(err)
+}
+
 func (m *Manager) GetRealDisplayMode() (uint8, *dbus.Error) {
 	monitors := m.getConnectedMonitors()
 
@@ -248,60 +320,16 @@ func (m *Manager) GetRealDisplayMode() (uint8, *dbus.Error) {
 	return mode, nil
 }
 
-func controlRedshift(action string) {
-	_, err := exec.Command("systemctl", "--user", action, "redshift.service").Output()
-	if err != nil {
-		logger.Warning("failed to ", action, " redshift.service:", err)
-	} else {
-		logger.Info("success to ", action, " redshift.service")
-	}
-}
-
-func setColorTempOneShot(colorTemp string) {
-	_, err := exec.Command("redshift", "-m", "vidmode", "-O", colorTemp).Output()
-	if err != nil {
-		logger.Warning("failed to set current ColorTemperature by redshift.service: ", err)
-	} else {
-		logger.Info("success to to set current ColorTemperature by redshift.service")
-	}
+func (m *Manager) ListProfiles() ([]string, *dbus.Error) {
+	return m.listProfiles(), nil
 }
 
-func resetColorTemp() {
-	_, err := exec.Command("redshift", "-m", "vidmode", "-x").Output()
-	if err != nil {
-		logger.Warning("failed to reset ColorTemperature ", err)
-	} else {
-		logger.Info("success to reset ColorTemperature")
-	}
+func (m *Manager) ApplyProfile(name string) *dbus.Error {
+	err := m.applyProfile(name)
+	return dbusutil.ToError(err)
 }
 
-func generateRedshiftConfFile() error { // 用来生成redshift的配置文件，路径为“~/.config/redshift/redshift.conf”
-	controlRedshift("disable")
-	configFilePath := basedir.GetUserConfigDir() + "/redshift/redshift.conf"
-	_, err := os.Stat(configFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			dir := filepath.Dir(configFilePath)
-			err := os.MkdirAll(dir, 0755)
-			if err != nil {
-				return err
-			}
-			content := []byte("[redshift]\n" +
-				"temp-day=6500\n" + // 自动模式下，白天的色温
-				"temp-night=3500\n" + // 自动模式下，夜晚的色温
-				"transition=1\n" +
-				"gamma=1\n" +
-				"location-provider=geoclue2\n" +
-				"adjustment-method=vidmode\n" +
-				"[vidmode]\n" +
-				"screen=0")
-			err = ioutil.WriteFile(configFilePath, content, 0644)
-			return err
-		} else {
-			return err
-		}
-	} else {
-		logger.Debug("redshift.conf file exist , don't need create config file")
-	}
-	return nil
+func (m *Manager) SaveProfileAs(name string) *dbus.Error {
+	err := m.saveProfileAs(name)
+	return dbusutil.ToError(err)
 }
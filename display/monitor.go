@@ -10,6 +10,9 @@ import (
 
 	dbus "github.com/godbus/dbus"
 	"github.com/linuxdeepin/go-x11-client/ext/randr"
+	"github.com/linuxdeepin/go-x11-client/ext/render"
+	"pkg.deepin.io/dde/startdde/display/core"
+	"pkg.deepin.io/dde/startdde/display/edid"
 	"pkg.deepin.io/lib/dbusutil"
 )
 
@@ -22,6 +25,7 @@ type Monitor struct {
 	service           *dbusutil.Service
 	crtc              randr.Crtc
 	uuid              string
+	legacyUUID        string // 旧版本的 UUID，用来迁移配置
 	PropsMu           sync.RWMutex
 	lastConnectedTime time.Time
 
@@ -30,6 +34,13 @@ type Monitor struct {
 	Connected    bool
 	Manufacturer string
 	Model        string
+	// 从 EDID 中解析出的信息，没有 EDID 时为空
+	VendorName      string
+	ProductName     string
+	ProductCode     uint16
+	SerialNumber    string
+	ManufactureWeek uint8
+	ManufactureYear uint16
 	// dbusutil-gen: equal=nil
 	Rotations []uint16
 	// dbusutil-gen: equal=nil
@@ -51,12 +62,40 @@ type Monitor struct {
 	Rotation    uint16
 	Reflect     uint16
 	RefreshRate float64
+	// 缩放比例，大于 1 时内容被放大，Width 和 Height 是缩放之后在屏幕中占用的大小
+	Scale float64
 
 	oldRotation uint16
 
 	// dbusutil-gen: equal=nil
 	CurrentMode ModeInfo
 
+	// 从 EDID 中解析出的能力，VRR 刷新率范围为 0 表示未知
+	VrrMinRate uint16
+	VrrMaxRate uint16
+	// dbusutil-gen: equal=nil
+	HdrEotfs                []string
+	HdrMaxLuminance         float64
+	HdrMaxFrameAvgLuminance float64
+	HdrMinLuminance         float64
+	// dbusutil-gen: equal=nil
+	ColorDepths []uint8
+	// dbusutil-gen: equal=nil
+	PreferredTiming edid.DetailedTiming
+
+	// 驱动提供的 RandR 输出属性，不支持时 MaxBpcRange 和 BroadcastRGBValues 为空。
+	// vrr_capable 是内核报告的只读属性，只表示显示器和驱动是否支持 VRR，不能设置
+	VrrCapable bool
+	MaxBpc     uint32
+	// dbusutil-gen: equal=nil
+	MaxBpcRange  []uint32
+	BroadcastRGB string
+	// dbusutil-gen: equal=nil
+	BroadcastRGBValues []string
+
+	// 用户设置的输出属性
+	outputProps core.OutputProps
+
 	backup  *MonitorBackup
 	methods *struct { //nolint
 		Enable         func() `in:"enabled"`
@@ -66,6 +105,16 @@ type Monitor struct {
 		SetReflect     func() `in:"value"`
 		SetRotation    func() `in:"value"`
 		SetRefreshRate func() `in:"value"`
+		SetScale       func() `in:"value"`
+		AddCustomMode  func() `in:"width,height,rate,reducedBlanking" out:"mode"`
+
+		GetInputSources func() `out:"sources,current"`
+		SetInputSource  func() `in:"source"`
+		GetContrast     func() `out:"value"`
+		SetContrast     func() `in:"value"`
+
+		SetMaxBpc       func() `in:"value"`
+		SetBroadcastRGB func() `in:"value"`
 	}
 }
 
@@ -87,6 +136,7 @@ type MonitorBackup struct {
 	X, Y     int16
 	Reflect  uint16
 	Rotation uint16
+	Scale    float64
 }
 
 func (m *Monitor) markChanged() {
@@ -99,6 +149,7 @@ func (m *Monitor) markChanged() {
 			Y:        m.Y,
 			Reflect:  m.Reflect,
 			Rotation: m.Rotation,
+			Scale:    m.Scale,
 		}
 	}
 }
@@ -149,6 +200,7 @@ func (m *Monitor) setMode(mode ModeInfo) {
 	if needSwapWidthHeight(m.Rotation) {
 		width, height = height, width
 	}
+	width, height = core.ScaledSize(width, height, m.Scale)
 
 	m.setPropWidth(width)
 	m.setPropHeight(height)
@@ -166,18 +218,6 @@ func (m *Monitor) getBestMode(manager *Manager, outputInfo *randr.GetOutputInfoR
 	return mode
 }
 
-func (m *Monitor) selectMode(width, height uint16, rate float64) ModeInfo {
-	mode := getFirstModeBySizeRate(m.Modes, width, height, rate)
-	if mode.Id != 0 {
-		return mode
-	}
-	mode = getFirstModeBySize(m.Modes, width, height)
-	if mode.Id != 0 {
-		return mode
-	}
-	return m.BestMode
-}
-
 func (m *Monitor) SetModeBySize(width, height uint16) *dbus.Error {
 	mode := getFirstModeBySize(m.Modes, width, height)
 	if mode.Id == 0 {
@@ -187,10 +227,11 @@ func (m *Monitor) SetModeBySize(width, height uint16) *dbus.Error {
 }
 
 func (m *Monitor) SetRefreshRate(value float64) *dbus.Error {
-	if m.Width == 0 || m.Height == 0 {
+	width, height := m.CurrentMode.Width, m.CurrentMode.Height
+	if width == 0 || height == 0 {
 		return dbusutil.ToError(errors.New("width or height is 0"))
 	}
-	mode := getFirstModeBySizeRate(m.Modes, m.Width, m.Height, value)
+	mode := getFirstModeBySizeRate(m.Modes, width, height, value)
 	if mode.Id == 0 {
 		return dbusutil.ToError(errors.New("not found match mode"))
 	}
@@ -255,7 +296,6 @@ func (m *Monitor) SetRotation(value uint16) *dbus.Error {
 	m.oldRotation = m.Rotation
 	m.markChanged()
 	m.setRotation(value)
-	m.m.touchScreenSetRotation(value, m.Name)
 	return nil
 }
 
@@ -267,6 +307,7 @@ func (m *Monitor) setRotation(value uint16) {
 	if needSwapWidthHeight(value) {
 		width, height = height, width
 	}
+	width, height = core.ScaledSize(width, height, m.Scale)
 
 	m.setPropRotation(value)
 	m.setPropWidth(width)
@@ -274,6 +315,46 @@ func (m *Monitor) setRotation(value uint16) {
 	m.PropsMu.Unlock()
 }
 
+// 缩放比例的范围
+const (
+	minScale = 0.5
+	maxScale = 3
+)
+
+func (m *Monitor) SetScale(value float64) *dbus.Error {
+	if value < minScale || value > maxScale {
+		return dbusutil.ToError(fmt.Errorf("invalid scale %v", value))
+	}
+	if !_hasRandr1d3 {
+		return dbusutil.ToError(errors.New("crtc transform is not supported"))
+	}
+	if m.Scale == value {
+		return nil
+	}
+	m.markChanged()
+	m.setScale(value)
+	return nil
+}
+
+func (m *Monitor) setScale(value float64) {
+	if value <= 0 {
+		value = 1
+	}
+	m.PropsMu.Lock()
+	width := m.CurrentMode.Width
+	height := m.CurrentMode.Height
+
+	if needSwapWidthHeight(m.Rotation) {
+		width, height = height, width
+	}
+	width, height = core.ScaledSize(width, height, value)
+
+	m.setPropScale(value)
+	m.setPropWidth(width)
+	m.setPropHeight(height)
+	m.PropsMu.Unlock()
+}
+
 func (m *Monitor) resetChanges() {
 	if m.backup == nil {
 		return
@@ -288,9 +369,8 @@ func (m *Monitor) resetChanges() {
 	m.setPropReflect(b.Reflect)
 
 	m.setPropCurrentMode(b.Mode)
-	m.setPropWidth(b.Mode.Width)
-	m.setPropHeight(b.Mode.Height)
 	m.setPropRefreshRate(b.Mode.Rate)
+	m.setScale(b.Scale)
 
 	m.backup = nil
 }
@@ -320,6 +400,11 @@ func (m *Monitor) applyConfig(cfg crtcConfig) error {
 	cfgTs := m.m.configTimestamp
 	m.m.PropsMu.RUnlock()
 
+	err := m.setCrtcTransform(cfg.crtc, cfg.scale)
+	if err != nil {
+		return err
+	}
+
 	logger.Debugf("setCrtcConfig crtc: %v, cfgTs: %v, x: %v, y: %v,"+
 		" mode: %v, rotation|reflect: %v, outputs: %v",
 		cfg.crtc, cfgTs, cfg.x, cfg.y, cfg.mode, cfg.rotation, cfg.outputs)
@@ -337,6 +422,39 @@ func (m *Monitor) applyConfig(cfg crtcConfig) error {
 	return nil
 }
 
+// 设置的 transform 在下一次 SetCrtcConfig 时生效
+func (m *Monitor) setCrtcTransform(crtc randr.Crtc, scale float64) error {
+	if !_hasRandr1d3 {
+		return nil
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+	filter := "nearest"
+	if scale != 1 {
+		filter = "bilinear"
+	}
+	// 把输出设备上的坐标变换为屏幕中的坐标
+	transform := render.Transform{
+		Matrix11: doubleToFixed(1 / scale),
+		Matrix22: doubleToFixed(1 / scale),
+		Matrix33: doubleToFixed(1),
+	}
+	logger.Debugf("setCrtcTransform crtc: %v, scale: %v", crtc, scale)
+	err := randr.SetCrtcTransformChecked(m.m.xConn, crtc, transform, filter,
+		nil).Check(m.m.xConn)
+	if err != nil && scale == 1 {
+		// 不缩放时失败了也不影响
+		logger.Warning("failed to set crtc transform:", err)
+		return nil
+	}
+	return err
+}
+
+func doubleToFixed(v float64) render.Fixed {
+	return render.Fixed(math.Round(v * 65536))
+}
+
 func toMonitorConfigs(monitors []*Monitor, primary string) []*MonitorConfig {
 	found := false
 	result := make([]*MonitorConfig, len(monitors))
@@ -351,18 +469,29 @@ func toMonitorConfigs(monitors []*Monitor, primary string) []*MonitorConfig {
 	return result
 }
 
+// 保存的是模式旋转之后的大小，不受缩放影响
 func (m *Monitor) toConfig() *MonitorConfig {
+	width, height := m.CurrentMode.Width, m.CurrentMode.Height
+	if needSwapWidthHeight(m.Rotation) {
+		width, height = height, width
+	}
+	var scale float64
+	if m.Scale != 1 {
+		scale = m.Scale
+	}
 	return &MonitorConfig{
 		UUID:        m.uuid,
 		Name:        m.Name,
 		Enabled:     m.Enabled,
 		X:           m.X,
 		Y:           m.Y,
-		Width:       m.Width,
-		Height:      m.Height,
+		Width:       width,
+		Height:      height,
 		Rotation:    m.Rotation,
 		Reflect:     m.Reflect,
 		RefreshRate: m.RefreshRate,
+		Scale:       scale,
+		OutputProps: m.outputProps,
 	}
 }
 
@@ -0,0 +1,295 @@
+package display
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	dbus "github.com/godbus/dbus"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/ext/randr"
+	"pkg.deepin.io/dde/startdde/display/core"
+	"pkg.deepin.io/dde/startdde/display/edid"
+	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/strv"
+)
+
+// 从 EDID 中解析出的显示器信息和能力，以及内核 DRM 驱动提供的 RandR 输出属性
+
+const (
+	outputPropVrrCapable   = "vrr_capable"
+	outputPropMaxBpc       = "max bpc"
+	outputPropBroadcastRGB = "Broadcast RGB"
+)
+
+// outputProp 是一个 32 位的 RandR 输出属性，Broadcast RGB 的值是 atom
+type outputProp struct {
+	atom        x.Atom
+	typ         x.Atom
+	value       uint32
+	isRange     bool
+	immutable   bool
+	validValues []int32
+}
+
+// 驱动不支持这个属性时返回 nil
+func getOutputProp(conn *x.Conn, output randr.Output, name string) (*outputProp, error) {
+	atom, err := conn.GetAtom(name)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := randr.GetOutputProperty(conn, output, atom, x.GetPropertyTypeAny,
+		0, 1, false, false).Reply(conn)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Type == x.None {
+		return nil, nil
+	}
+	if reply.Format != 32 || len(reply.Value) < 4 {
+		return nil, fmt.Errorf("output property %q has unexpected format %d", name, reply.Format)
+	}
+
+	info, err := randr.QueryOutputProperty(conn, output, atom).Reply(conn)
+	if err != nil {
+		return nil, err
+	}
+	return &outputProp{
+		atom:        atom,
+		typ:         reply.Type,
+		value:       binary.LittleEndian.Uint32(reply.Value),
+		isRange:     info.Range,
+		immutable:   info.Immutable,
+		validValues: info.ValidValues,
+	}, nil
+}
+
+func (p *outputProp) isValid(value uint32) bool {
+	if p.isRange {
+		return len(p.validValues) == 2 &&
+			int64(value) >= int64(p.validValues[0]) && int64(value) <= int64(p.validValues[1])
+	}
+	if len(p.validValues) == 0 {
+		return true
+	}
+	for _, v := range p.validValues {
+		if uint32(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Manager) setOutputProp(output randr.Output, name string, value uint32) error {
+	prop, err := getOutputProp(m.xConn, output, name)
+	if err != nil {
+		return err
+	}
+	if prop == nil {
+		return fmt.Errorf("output property %q is not supported", name)
+	}
+	if prop.immutable {
+		return fmt.Errorf("output property %q is immutable", name)
+	}
+	if !prop.isValid(value) {
+		return fmt.Errorf("invalid value %d for output property %q", value, name)
+	}
+	if prop.value == value {
+		return nil
+	}
+	logger.Debugf("set output %d property %q to %d", output, name, value)
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, value)
+	return randr.ChangeOutputPropertyChecked(m.xConn, output, prop.atom, prop.typ,
+		32, x.PropModeReplace, 1, data).Check(m.xConn)
+}
+
+// updateEDID 更新从 EDID 中解析出的信息和能力，EDID 无效时清空
+func (m *Monitor) updateEDID(data []byte) {
+	e, err := edid.Parse(data)
+	if err != nil {
+		if len(data) > 0 {
+			logger.Warningf("failed to parse edid of %s: %v", m.Name, err)
+		}
+	}
+
+	info := &edid.EDID{}
+	caps := &edid.Capabilities{}
+	if e != nil {
+		info = e
+		caps = e.Capabilities()
+	}
+	var vendorName string
+	if info.Vendor != "" {
+		vendorName = edid.VendorName(info.Vendor)
+	}
+	var timing edid.DetailedTiming
+	if caps.PreferredTiming != nil {
+		timing = *caps.PreferredTiming
+	}
+	hdr := caps.HDR
+	if hdr == nil {
+		hdr = &edid.HDRStaticMetadata{}
+	}
+
+	m.PropsMu.Lock()
+	m.setPropVendorName(vendorName)
+	m.setPropProductName(info.MonitorName)
+	m.setPropProductCode(info.ProductCode)
+	m.setPropSerialNumber(info.Serial())
+	m.setPropManufactureWeek(info.Week)
+	m.setPropManufactureYear(info.Year)
+
+	m.setPropVrrMinRate(caps.MinVRate)
+	m.setPropVrrMaxRate(caps.MaxVRate)
+	m.setPropHdrEotfs(hdr.EOTFs)
+	m.setPropHdrMaxLuminance(hdr.MaxLuminance)
+	m.setPropHdrMaxFrameAvgLuminance(hdr.MaxFrameAvgLuminance)
+	m.setPropHdrMinLuminance(hdr.MinLuminance)
+	m.setPropColorDepths(caps.ColorDepths)
+	m.setPropPreferredTiming(timing)
+	m.PropsMu.Unlock()
+}
+
+// updateOutputProps 从 X 读取输出属性的当前值和可选值
+func (m *Monitor) updateOutputProps() {
+	conn := m.m.xConn
+	output := randr.Output(m.ID)
+	getProp := func(name string) *outputProp {
+		prop, err := getOutputProp(conn, output, name)
+		if err != nil {
+			logger.Warningf("failed to get output %s property %q: %v", m.Name, name, err)
+		}
+		return prop
+	}
+
+	var vrrCapable bool
+	if prop := getProp(outputPropVrrCapable); prop != nil {
+		vrrCapable = prop.value != 0
+	}
+
+	var maxBpc uint32
+	var maxBpcRange []uint32
+	if prop := getProp(outputPropMaxBpc); prop != nil {
+		maxBpc = prop.value
+		if prop.isRange && len(prop.validValues) == 2 && !prop.immutable {
+			maxBpcRange = []uint32{uint32(prop.validValues[0]), uint32(prop.validValues[1])}
+		}
+	}
+
+	var broadcastRGB string
+	var broadcastRGBValues []string
+	if prop := getProp(outputPropBroadcastRGB); prop != nil && prop.typ == x.AtomAtom {
+		name, err := conn.GetAtomName(x.Atom(prop.value))
+		if err != nil {
+			logger.Warning(err)
+		}
+		broadcastRGB = name
+		if !prop.immutable {
+			for _, v := range prop.validValues {
+				name, err := conn.GetAtomName(x.Atom(v))
+				if err != nil {
+					logger.Warning(err)
+					continue
+				}
+				broadcastRGBValues = append(broadcastRGBValues, name)
+			}
+		}
+	}
+
+	m.PropsMu.Lock()
+	m.setPropVrrCapable(vrrCapable)
+	m.setPropMaxBpc(maxBpc)
+	m.setPropMaxBpcRange(maxBpcRange)
+	m.setPropBroadcastRGB(broadcastRGB)
+	m.setPropBroadcastRGBValues(broadcastRGBValues)
+	m.PropsMu.Unlock()
+}
+
+func (m *Monitor) setMaxBpc(value uint32) error {
+	return m.m.setOutputProp(randr.Output(m.ID), outputPropMaxBpc, value)
+}
+
+func (m *Monitor) setBroadcastRGB(value string) error {
+	m.PropsMu.RLock()
+	valid := strv.Strv(m.BroadcastRGBValues).Contains(value)
+	m.PropsMu.RUnlock()
+	if !valid {
+		return fmt.Errorf("invalid Broadcast RGB value %q", value)
+	}
+	atom, err := m.m.xConn.GetAtom(value)
+	if err != nil {
+		return err
+	}
+	return m.m.setOutputProp(randr.Output(m.ID), outputPropBroadcastRGB, uint32(atom))
+}
+
+// 修改输出属性后立即保存，下次连接时恢复
+func (m *Monitor) saveOutputProps(fn func(props *core.OutputProps)) error {
+	m.updateOutputProps()
+	m.PropsMu.Lock()
+	fn(&m.outputProps)
+	uuid := m.uuid
+	props := m.outputProps
+	m.PropsMu.Unlock()
+	return m.m.saveOutputProps(uuid, props)
+}
+
+func (m *Monitor) SetMaxBpc(value uint32) *dbus.Error {
+	err := m.setMaxBpc(value)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.saveOutputProps(func(props *core.OutputProps) {
+		props.MaxBpc = value
+	})
+	return dbusutil.ToError(err)
+}
+
+func (m *Monitor) SetBroadcastRGB(value string) *dbus.Error {
+	err := m.setBroadcastRGB(value)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = m.saveOutputProps(func(props *core.OutputProps) {
+		props.BroadcastRGB = value
+	})
+	return dbusutil.ToError(err)
+}
+
+// 配置中还没有这个显示器时保存当前布局，否则输出属性会丢失
+func (m *Manager) saveOutputProps(uuid string, props core.OutputProps) error {
+	m.PropsMu.RLock()
+	hasChanged := m.HasChanged
+	m.PropsMu.RUnlock()
+	if !m.config.SetOutputProps(uuid, props) && !hasChanged {
+		return m.save()
+	}
+	return m.saveConfig()
+}
+
+// restoreOutputProps 应用保存的输出属性，在应用显示模式之后调用
+func (m *Manager) restoreOutputProps() {
+	for _, monitor := range m.getConnectedMonitors() {
+		monitor.PropsMu.Lock()
+		props := m.config.GetOutputProps(monitor.uuid)
+		monitor.outputProps = props
+		monitor.PropsMu.Unlock()
+
+		// 先读取可选值，设置 Broadcast RGB 时需要
+		monitor.updateOutputProps()
+		var err error
+		if props.MaxBpc != 0 {
+			err = monitor.setMaxBpc(props.MaxBpc)
+			if err != nil {
+				logger.Warningf("failed to restore max bpc of %s: %v", monitor.Name, err)
+			}
+		}
+		if props.BroadcastRGB != "" {
+			err = monitor.setBroadcastRGB(props.BroadcastRGB)
+			if err != nil {
+				logger.Warningf("failed to restore Broadcast RGB of %s: %v", monitor.Name, err)
+			}
+		}
+		monitor.updateOutputProps()
+	}
+}
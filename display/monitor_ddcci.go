@@ -0,0 +1,77 @@
+package display
+
+import (
+	"fmt"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/display/brightness"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// 通过 DDC/CI 控制外接显示器的输入源和对比度
+
+func (m *Monitor) getDDCCIDevice() (*brightness.DDCCIDevice, error) {
+	m.PropsMu.RLock()
+	connected := m.Connected
+	m.PropsMu.RUnlock()
+	if !connected {
+		return nil, fmt.Errorf("monitor %s is disconnected", m.Name)
+	}
+	return brightness.GetDDCCIDevice(m.ID, m.m.xConn)
+}
+
+// GetInputSources 返回显示器支持的输入源和当前的输入源，取值按照 MCCS 中 VCP 0x60 的定义
+func (m *Monitor) GetInputSources() (sources []uint16, current uint16, busErr *dbus.Error) {
+	dev, err := m.getDDCCIDevice()
+	if err != nil {
+		return nil, 0, dbusutil.ToError(err)
+	}
+
+	cur, _, err := dev.GetVCP(brightness.VCPCodeInputSource)
+	if err != nil {
+		return nil, 0, dbusutil.ToError(err)
+	}
+	current = cur & 0xff
+
+	caps, err := dev.GetCapabilities()
+	if err != nil {
+		logger.Warningf("failed to get capabilities of %s: %v", m.Name, err)
+	} else {
+		sources = brightness.ParseInputSources(caps)
+	}
+	if len(sources) == 0 {
+		sources = []uint16{current}
+	}
+	return sources, current, nil
+}
+
+func (m *Monitor) SetInputSource(source uint16) *dbus.Error {
+	dev, err := m.getDDCCIDevice()
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	logger.Debugf("set input source of %s to %#x", m.Name, source)
+	err = dev.SetVCP(brightness.VCPCodeInputSource, source)
+	return dbusutil.ToError(err)
+}
+
+func (m *Monitor) GetContrast() (float64, *dbus.Error) {
+	dev, err := m.getDDCCIDevice()
+	if err != nil {
+		return 0, dbusutil.ToError(err)
+	}
+	value, err := dev.GetValue(brightness.VCPCodeContrast)
+	return value, dbusutil.ToError(err)
+}
+
+func (m *Monitor) SetContrast(value float64) *dbus.Error {
+	if value < 0 || value > 1 {
+		return dbusutil.ToError(fmt.Errorf("invalid contrast %v", value))
+	}
+	dev, err := m.getDDCCIDevice()
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	err = dev.SetValue(brightness.VCPCodeContrast, value)
+	return dbusutil.ToError(err)
+}
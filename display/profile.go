@@ -0,0 +1,158 @@
+package display
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"pkg.deepin.io/dde/startdde/display/configfile"
+	"pkg.deepin.io/dde/startdde/display/core"
+)
+
+// 显示配置方案的匹配在 core 包中，这里只负责保存在 displayProfilesFile 中
+type (
+	DisplayProfile = core.DisplayProfile
+	ProfileOutput  = core.ProfileOutput
+	ProfileMatcher = core.ProfileMatcher
+)
+
+func loadDisplayProfiles(filename string) ([]*DisplayProfile, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var profiles []*DisplayProfile
+	err = json.Unmarshal(data, &profiles)
+	if err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+func saveDisplayProfiles(filename string, profiles []*DisplayProfile) error {
+	data, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, data, 0644, 0)
+}
+
+func (m *Manager) initDisplayProfiles() {
+	profiles, err := loadDisplayProfiles(displayProfilesFile)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load display profiles:", err)
+	}
+	m.profilesMu.Lock()
+	m.profiles = profiles
+	m.profilesMu.Unlock()
+}
+
+func (m *Manager) listProfiles() []string {
+	m.profilesMu.Lock()
+	defer m.profilesMu.Unlock()
+	names := make([]string, len(m.profiles))
+	for i, p := range m.profiles {
+		names[i] = p.Name
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *Manager) getProfiles() []*DisplayProfile {
+	m.profilesMu.Lock()
+	defer m.profilesMu.Unlock()
+	return m.profiles
+}
+
+func (m *Manager) getProfile(name string) *DisplayProfile {
+	m.profilesMu.Lock()
+	defer m.profilesMu.Unlock()
+	for _, p := range m.profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func (m *Manager) applyProfile(name string) error {
+	p := m.getProfile(name)
+	if p == nil {
+		return fmt.Errorf("not found profile %q", name)
+	}
+	outputs, err := m.backend.ListOutputs()
+	if err != nil {
+		return err
+	}
+	configs, ok := p.Resolve(outputs)
+	if !ok {
+		return fmt.Errorf("profile %q does not match connected monitors", name)
+	}
+	err = m.applyProfileConfigs(p.Name, configs)
+	if err != nil {
+		return err
+	}
+	m.lidController.HandleLayoutChanged(true)
+	return nil
+}
+
+// 以方案的名称保存为当前显示器组合的自定义模式，以后再连接同样的显示器时直接使用
+func (m *Manager) applyProfileConfigs(name string, configs []*MonitorConfig) error {
+	logger.Debugf("apply profile %q", name)
+	err := m.applyConfigs(configs)
+	if err != nil {
+		return err
+	}
+	return m.saveCustomMode(name, configs)
+}
+
+// 保存为当前显示器组合的名称为 name 的自定义模式，并切换到这个模式
+func (m *Manager) saveCustomMode(name string, configs []*MonitorConfig) error {
+	screenCfg := m.getScreenConfig()
+	screenCfg.SetMonitorConfigs(DisplayModeCustom, name, configs)
+	err := m.saveConfig()
+	if err != nil {
+		return err
+	}
+	m.setPropCustomIdList(m.getCustomIdList())
+	m.setCurrentCustomId(name)
+	m.setDisplayMode(DisplayModeCustom)
+	return nil
+}
+
+func (m *Manager) saveProfileAs(name string) error {
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	monitors := m.getConnectedMonitors()
+	if len(monitors) == 0 {
+		return errors.New("no output connected")
+	}
+	outputs, err := m.backend.ListOutputs()
+	if err != nil {
+		return err
+	}
+	configs := toMonitorConfigs(monitors, m.Primary)
+	m.lid.FixConfigs(configs)
+	p := core.NewDisplayProfile(name, outputs, configs)
+
+	m.profilesMu.Lock()
+	defer m.profilesMu.Unlock()
+	var profiles []*DisplayProfile
+	for _, profile := range m.profiles {
+		if profile.Name != name {
+			profiles = append(profiles, profile)
+		}
+	}
+	profiles = append(profiles, p)
+	err = saveDisplayProfiles(displayProfilesFile, profiles)
+	if err != nil {
+		return err
+	}
+	m.profiles = profiles
+	return nil
+}
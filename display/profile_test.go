@@ -0,0 +1,36 @@
+package display
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_saveDisplayProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-display")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "display-profiles.json")
+	profiles := []*DisplayProfile{
+		{
+			Name: "desk",
+			Outputs: []*ProfileOutput{
+				{
+					Match:  ProfileMatcher{Vendor: "DEL*", Size: 27},
+					Config: MonitorConfig{Name: "DP-1", Enabled: true, Width: 2560, Height: 1440},
+				},
+			},
+		},
+	}
+	err = saveDisplayProfiles(filename, profiles)
+	require.NoError(t, err)
+
+	profiles1, err := loadDisplayProfiles(filename)
+	require.NoError(t, err)
+	assert.Equal(t, profiles, profiles1)
+}
@@ -0,0 +1,176 @@
+package display
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/linuxdeepin/go-x11-client/ext/randr"
+	"pkg.deepin.io/dde/startdde/display/core"
+)
+
+// randrBackend 通过 RandR 实现 core.OutputBackend
+type randrBackend struct {
+	core.HotplugHandlers
+	m *Manager
+}
+
+func newRandrBackend(m *Manager) *randrBackend {
+	return &randrBackend{m: m}
+}
+
+func toCoreMode(mode ModeInfo) core.Mode {
+	return core.Mode{
+		ID:     mode.Id,
+		Width:  mode.Width,
+		Height: mode.Height,
+		Rate:   mode.Rate,
+	}
+}
+
+func (m *Monitor) toOutput(builtin bool) *core.Output {
+	m.PropsMu.RLock()
+	defer m.PropsMu.RUnlock()
+
+	modes := make([]core.Mode, len(m.Modes))
+	for i, mode := range m.Modes {
+		modes[i] = toCoreMode(mode)
+	}
+	// core 中 0 表示不缩放
+	var scale float64
+	if m.Scale != 1 {
+		scale = m.Scale
+	}
+	return &core.Output{
+		ID:            m.ID,
+		Name:          m.Name,
+		UUID:          m.uuid,
+		Connected:     m.Connected,
+		Manufacturer:  m.Manufacturer,
+		Model:         m.Model,
+		MmWidth:       m.MmWidth,
+		MmHeight:      m.MmHeight,
+		Builtin:       builtin,
+		ConnectedTime: m.lastConnectedTime,
+		Modes:         modes,
+		BestMode:      toCoreMode(m.BestMode),
+		Enabled:       m.Enabled,
+		X:             m.X,
+		Y:             m.Y,
+		Mode:          toCoreMode(m.CurrentMode),
+		Rotation:      m.Rotation,
+		Reflect:       m.Reflect,
+		Scale:         scale,
+	}
+}
+
+func (b *randrBackend) ListOutputs() ([]*core.Output, error) {
+	builtinMonitor := b.m.getBuiltinMonitor()
+	b.m.monitorMapMu.Lock()
+	outputs := make([]*core.Output, 0, len(b.m.monitorMap))
+	for _, monitor := range b.m.monitorMap {
+		outputs = append(outputs, monitor.toOutput(monitor == builtinMonitor))
+	}
+	b.m.monitorMapMu.Unlock()
+	sort.Slice(outputs, func(i, j int) bool {
+		return outputs[i].ID < outputs[j].ID
+	})
+	return outputs, nil
+}
+
+type monitorState struct {
+	enabled  bool
+	mode     ModeInfo
+	x, y     int16
+	rotation uint16
+	reflect  uint16
+	scale    float64
+}
+
+func findModeInfo(modes []ModeInfo, id uint32) (ModeInfo, bool) {
+	for _, mode := range modes {
+		if mode.Id == id {
+			return mode, true
+		}
+	}
+	return ModeInfo{}, false
+}
+
+func (m *Monitor) setState(s monitorState) {
+	m.enable(s.enabled)
+	m.setMode(s.mode)
+	m.setPosition(s.x, s.y)
+	m.setRotation(s.rotation)
+	m.setReflect(s.reflect)
+	m.setScale(s.scale)
+}
+
+func (b *randrBackend) ApplyLayout(layout *core.Layout) error {
+	m := b.m
+	// 先计算所有显示器的新状态，出错时不做任何修改
+	oldStates := make(map[*Monitor]monitorState)
+	newStates := make(map[*Monitor]monitorState)
+	for _, monitor := range m.monitorMap {
+		oldStates[monitor] = monitorState{
+			enabled:  monitor.Enabled,
+			mode:     monitor.CurrentMode,
+			x:        monitor.X,
+			y:        monitor.Y,
+			rotation: monitor.Rotation,
+			reflect:  monitor.Reflect,
+			scale:    monitor.Scale,
+		}
+
+		cfg := layout.Get(monitor.ID)
+		if cfg == nil || !cfg.Enabled {
+			s := oldStates[monitor]
+			s.enabled = false
+			newStates[monitor] = s
+			continue
+		}
+		if !monitor.Connected {
+			return fmt.Errorf("monitor %s is not connected", monitor.Name)
+		}
+		mode, ok := findModeInfo(monitor.Modes, cfg.Mode.ID)
+		if !ok {
+			return fmt.Errorf("monitor %s has no mode %d", monitor.Name, cfg.Mode.ID)
+		}
+		scale := cfg.Scale
+		if !_hasRandr1d3 {
+			scale = 1
+		}
+		newStates[monitor] = monitorState{
+			enabled:  true,
+			mode:     mode,
+			x:        cfg.X,
+			y:        cfg.Y,
+			rotation: cfg.Rotation,
+			reflect:  cfg.Reflect,
+			scale:    scale,
+		}
+	}
+
+	for monitor, s := range newStates {
+		monitor.setState(s)
+	}
+	err := m.apply()
+	if err != nil {
+		logger.Warning("failed to apply layout, restore:", err)
+		for monitor, s := range oldStates {
+			monitor.setState(s)
+		}
+		err1 := m.apply()
+		if err1 != nil {
+			logger.Warning("failed to restore:", err1)
+		}
+		return err
+	}
+
+	if layout.Primary != 0 {
+		return b.SetPrimary(layout.Primary)
+	}
+	return nil
+}
+
+func (b *randrBackend) SetPrimary(id uint32) error {
+	return b.m.setOutputPrimary(randr.Output(id))
+}
@@ -0,0 +1,67 @@
+package display
+
+import (
+	ofdbus "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.dbus"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+const signalChangesReverted = "ChangesReverted"
+
+// changesHandler 实现 core.ChangesHandler
+type changesHandler struct {
+	m *Manager
+}
+
+func (h changesHandler) HasChanged() bool {
+	h.m.PropsMu.RLock()
+	defer h.m.PropsMu.RUnlock()
+	return h.m.HasChanged
+}
+
+func (h changesHandler) SetHasChanged(changed bool) {
+	h.m.PropsMu.Lock()
+	h.m.setPropHasChanged(changed)
+	h.m.PropsMu.Unlock()
+}
+
+func (h changesHandler) ApplyChanges() error {
+	return h.m.apply()
+}
+
+// 恢复到 MonitorBackup 中保存的状态
+func (h changesHandler) ResetMonitors() {
+	h.m.monitorMapMu.Lock()
+	for _, monitor := range h.m.monitorMap {
+		monitor.resetChanges()
+	}
+	h.m.monitorMapMu.Unlock()
+}
+
+func (h changesHandler) LayoutChanged() {
+	h.m.lidController.HandleLayoutChanged(false)
+}
+
+func (h changesHandler) ChangesReverted(err error) {
+	logger.Info("changes are not confirmed, revert")
+	if err != nil {
+		logger.Warning("failed to revert changes:", err)
+	}
+	err = h.m.service.Emit(h.m, signalChangesReverted)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// 监听 D-Bus 客户端的退出，发起修改的客户端崩溃时恢复修改
+func (m *Manager) listenNameLost() {
+	sessionBus := m.service.Conn()
+	m.dbusDaemon = ofdbus.NewDBus(sessionBus)
+	m.sessionSigLoop = dbusutil.NewSignalLoop(sessionBus, 10)
+	m.sessionSigLoop.Start()
+	m.dbusDaemon.InitSignalExt(m.sessionSigLoop, true)
+
+	_, err := m.dbusDaemon.ConnectNameOwnerChanged(m.changes.HandleNameOwnerChanged)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
@@ -0,0 +1,430 @@
+package display
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	upower "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.upower"
+	x "github.com/linuxdeepin/go-x11-client"
+	"github.com/linuxdeepin/go-x11-client/ext/dpms"
+	"github.com/linuxdeepin/go-x11-client/ext/input"
+	"github.com/linuxdeepin/go-x11-client/ext/screensaver"
+	"pkg.deepin.io/dde/startdde/display/core"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// 空闲时调暗屏幕，更长时间后用 DPMS 关闭屏幕，按 UPower 报告的供电方式使用不同的延迟
+
+// 设置为 session 时从 session bus 上的 org.freedesktop.UPower 读取供电方式，
+// 用于在台式机上运行假的服务进行测试
+const envUPowerBus = "DEEPIN_DISPLAY_UPOWER_BUS"
+
+const (
+	// 恢复亮度时渐变的时间和步数
+	screenPowerFadeDuration = 300 * time.Millisecond
+	screenPowerFadeSteps    = 10
+)
+
+// 供电方式
+type powerSource interface {
+	onBattery() (bool, error)
+	connectOnBatteryChanged(cb func(onBattery bool)) error
+}
+
+// UPower 的 D-Bus 接口
+type upowerSource struct {
+	obj *upower.UPower
+}
+
+func newUPowerSource() (*upowerSource, error) {
+	var conn *dbus.Conn
+	var err error
+	if os.Getenv(envUPowerBus) == "session" {
+		conn, err = dbus.SessionBus()
+	} else {
+		conn, err = dbus.SystemBus()
+	}
+	if err != nil {
+		return nil, err
+	}
+	sigLoop := dbusutil.NewSignalLoop(conn, 10)
+	sigLoop.Start()
+	obj := upower.NewUPower(conn)
+	obj.InitSignalExt(sigLoop, true)
+	return &upowerSource{obj: obj}, nil
+}
+
+func (s *upowerSource) onBattery() (bool, error) {
+	return s.obj.OnBattery().Get(0)
+}
+
+func (s *upowerSource) connectOnBatteryChanged(cb func(onBattery bool)) error {
+	return s.obj.OnBattery().ConnectChanged(func(hasValue bool, value bool) {
+		if hasValue {
+			cb(value)
+		}
+	})
+}
+
+// 返回用户没有输入的时间，并在用户有输入时通知
+type idleMonitor interface {
+	idleTime() (time.Duration, error)
+	// 用户下一次有输入时调用一次 cb
+	watchInput(cb func()) error
+	stopWatchingInput()
+}
+
+// 监听的原始输入事件，选择之后才会收到，不影响其他程序
+const rawInputEventMask uint32 = input.XIEventMaskRawKeyPress | input.XIEventMaskRawButtonPress |
+	input.XIEventMaskRawMotion | input.XIEventMaskRawTouchBegin
+
+// 使用 X 的 MIT-SCREEN-SAVER 扩展获取空闲时间，用 XInput2 的原始事件监听输入
+type xIdleMonitor struct {
+	conn *x.Conn
+
+	mu        sync.Mutex
+	eventChan chan x.GenericEvent
+	onInput   func()
+}
+
+func (im *xIdleMonitor) idleTime() (time.Duration, error) {
+	root := im.conn.GetDefaultScreen().Root
+	reply, err := screensaver.QueryInfo(im.conn, x.Drawable(root)).Reply(im.conn)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(reply.MsSinceUserInput) * time.Millisecond, nil
+}
+
+func (im *xIdleMonitor) selectInput(mask uint32) error {
+	root := im.conn.GetDefaultScreen().Root
+	return input.XISelectEventsChecked(im.conn, root, []input.EventMask{
+		{
+			DeviceId: input.DeviceAllMaster,
+			Mask:     []uint32{mask},
+		},
+	}).Check(im.conn)
+}
+
+func (im *xIdleMonitor) watchInput(cb func()) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.onInput != nil {
+		im.onInput = cb
+		return nil
+	}
+	if im.eventChan == nil {
+		_, err := input.XIQueryVersion(im.conn, input.MajorVersion, input.MinorVersion).Reply(im.conn)
+		if err != nil {
+			return err
+		}
+		im.eventChan = make(chan x.GenericEvent, 50)
+		im.conn.AddEventChan(im.eventChan)
+		go im.listenEvent()
+	}
+	err := im.selectInput(rawInputEventMask)
+	if err != nil {
+		return err
+	}
+	im.onInput = cb
+	return nil
+}
+
+func (im *xIdleMonitor) stopWatchingInput() {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	if im.onInput == nil {
+		return
+	}
+	im.onInput = nil
+	err := im.selectInput(0)
+	if err != nil {
+		logger.Warning("failed to deselect input events:", err)
+	}
+}
+
+// 收到第一个输入事件后就取消选择，避免一直处理鼠标移动的事件
+func (im *xIdleMonitor) listenEvent() {
+	inputExtData := im.conn.GetExtensionData(input.Ext())
+	for ev := range im.eventChan {
+		if ev.GetEventCode() != x.GeGenericEventCode {
+			continue
+		}
+		geEvent, _ := x.NewGeGenericEvent(ev)
+		if geEvent == nil || geEvent.Extension != inputExtData.MajorOpcode {
+			continue
+		}
+		im.mu.Lock()
+		cb := im.onInput
+		if cb != nil {
+			im.onInput = nil
+			err := im.selectInput(0)
+			if err != nil {
+				logger.Warning("failed to deselect input events:", err)
+			}
+		}
+		im.mu.Unlock()
+		// 在事件循环之外处理，cb 中还要发送 X 请求
+		if cb != nil {
+			go cb()
+		}
+	}
+}
+
+type screenPower struct {
+	mu      sync.Mutex
+	cfgFile string
+	policy  *core.ScreenPower
+	idle    idleMonitor
+	timer   *time.Timer
+}
+
+// source 为 nil 时总是按使用交流电处理
+func newScreenPower(cfgFile string, source powerSource, idle idleMonitor,
+	backend core.ScreenPowerBackend) *screenPower {
+	cfg, err := core.LoadScreenPowerConfig(cfgFile)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load screen power config:", err)
+	}
+	sp := &screenPower{
+		cfgFile: cfgFile,
+		policy:  core.NewScreenPower(backend, cfg),
+		idle:    idle,
+	}
+
+	if source != nil {
+		onBattery, err := source.onBattery()
+		if err != nil {
+			logger.Warning("failed to get OnBattery:", err)
+		}
+		sp.policy.SetOnBattery(onBattery)
+		err = source.connectOnBatteryChanged(func(onBattery bool) {
+			logger.Debug("on battery:", onBattery)
+			sp.policy.SetOnBattery(onBattery)
+			sp.update()
+		})
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+	sp.update()
+	return sp
+}
+
+// 读取空闲时间并更新屏幕的状态，然后在需要时再次检查
+func (sp *screenPower) update() {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	idle, err := sp.idle.idleTime()
+	if err != nil {
+		logger.Warning("failed to get idle time:", err)
+		return
+	}
+	next, err := sp.policy.Update(idle)
+	if err != nil {
+		logger.Warning("failed to update screen power:", err)
+	}
+	sp.schedule(idle, next)
+}
+
+// 定时在 next 之后检查，屏幕调暗或者关闭之后还要等待用户的输入，调用时需要持有 sp.mu
+func (sp *screenPower) schedule(idle, next time.Duration) {
+	if sp.timer != nil {
+		sp.timer.Stop()
+		sp.timer = nil
+	}
+	if sp.policy.WaitingForInput() {
+		err := sp.idle.watchInput(sp.update)
+		if err != nil {
+			// 无法监听输入时只能定时检查
+			logger.Warning("failed to watch input:", err)
+			next = core.ScreenPowerRetryInterval
+		} else if idle0, err := sp.idle.idleTime(); err == nil && idle0 < idle {
+			// 开始监听之前用户已经有输入了
+			next = time.Millisecond
+		}
+	} else {
+		sp.idle.stopWatchingInput()
+	}
+	if next > 0 {
+		sp.timer = time.AfterFunc(next, sp.update)
+	}
+}
+
+func (sp *screenPower) isDimmed() bool {
+	return sp.policy.Dimmed()
+}
+
+func (sp *screenPower) setInhibited(inhibited bool) {
+	sp.policy.SetInhibited(inhibited)
+	sp.update()
+}
+
+func (sp *screenPower) setLocked(locked bool) {
+	sp.policy.SetLocked(locked)
+	sp.update()
+}
+
+// 立即关闭屏幕，用户有输入时打开
+func (sp *screenPower) forceOff() error {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	idle, err := sp.idle.idleTime()
+	if err != nil {
+		return err
+	}
+	err = sp.policy.ForceOff(idle)
+	if err != nil {
+		return err
+	}
+	sp.schedule(idle, 0)
+	return nil
+}
+
+func (sp *screenPower) setTimeouts(onBattery bool, timeouts core.ScreenPowerTimeouts) error {
+	cfg := sp.policy.Config()
+	if onBattery {
+		cfg.Battery = timeouts
+	} else {
+		cfg.AC = timeouts
+	}
+	err := sp.policy.SetConfig(cfg)
+	if err != nil {
+		return err
+	}
+	err = core.SaveScreenPowerConfig(sp.cfgFile, cfg)
+	if err != nil {
+		logger.Warning("failed to save screen power config:", err)
+	}
+	sp.update()
+	return nil
+}
+
+// 调暗时只修改硬件的亮度，Brightness 属性和保存的亮度不变
+type screenPowerBackend struct {
+	m *Manager
+	// 调暗的显示器和调暗后的亮度
+	dimmed map[string]float64
+	// 恢复亮度的渐变在后台进行，不阻塞 core.ScreenPower
+	fader core.Fader
+}
+
+func (b *screenPowerBackend) Dim(level float64) error {
+	m := b.m
+	b.fader.Stop()
+	b.dimmed = make(map[string]float64)
+	for _, monitor := range m.getConnectedMonitors() {
+		if !monitor.Enabled {
+			continue
+		}
+		value, ok := m.brightness.Get(monitor.Name)
+		if !ok || value <= level {
+			continue
+		}
+		err := m.setMonitorBrightness(monitor, level)
+		if err != nil {
+			logger.Warningf("failed to dim %s: %v", monitor.Name, err)
+			continue
+		}
+		b.dimmed[monitor.Name] = level
+	}
+	return nil
+}
+
+func (b *screenPowerBackend) Restore() error {
+	m := b.m
+	dimmed := b.dimmed
+	b.dimmed = nil
+	monitors := m.getConnectedMonitors()
+	b.fader.Start(screenPowerFadeSteps, screenPowerFadeDuration/screenPowerFadeSteps, func(i int) {
+		for name, from := range dimmed {
+			monitor := monitors.GetByName(name)
+			if monitor == nil {
+				continue
+			}
+			to, ok := m.brightness.Get(name)
+			if !ok {
+				continue
+			}
+			value := core.BrightnessFade(from, to, screenPowerFadeSteps)[i]
+			err := m.setMonitorBrightness(monitor, core.RoundBrightness(value))
+			if err != nil {
+				logger.Warningf("failed to restore brightness of %s: %v", name, err)
+			}
+		}
+	})
+	return nil
+}
+
+func (b *screenPowerBackend) SetDPMS(on bool) error {
+	var mode = uint16(dpms.DPMSModeOn)
+	if !on {
+		mode = uint16(dpms.DPMSModeOff)
+	}
+	logger.Debug("set dpms:", on)
+	return dpms.ForceLevelChecked(b.m.xConn, mode).Check(b.m.xConn)
+}
+
+func (m *Manager) initScreenPower() {
+	var source powerSource
+	s, err := newUPowerSource()
+	if err != nil {
+		logger.Warning(err)
+	} else {
+		source = s
+	}
+	m.screenPower = newScreenPower(screenPowerConfigFile, source, &xIdleMonitor{conn: m.xConn},
+		&screenPowerBackend{m: m})
+}
+
+// 调暗期间不自动调节亮度，否则会把调暗的亮度覆盖掉
+func (m *Manager) isScreenDimmed() bool {
+	return m.screenPower != nil && m.screenPower.isDimmed()
+}
+
+func (m *Manager) getScreenPowerTimeouts(onBattery bool) (core.ScreenPowerTimeouts, error) {
+	if m.screenPower == nil {
+		return core.ScreenPowerTimeouts{}, errors.New("screen power is not initialized")
+	}
+	cfg := m.screenPower.policy.Config()
+	if onBattery {
+		return cfg.Battery, nil
+	}
+	return cfg.AC, nil
+}
+
+func (m *Manager) setScreenPowerTimeouts(onBattery bool, timeouts core.ScreenPowerTimeouts) error {
+	if m.screenPower == nil {
+		return errors.New("screen power is not initialized")
+	}
+	return m.screenPower.setTimeouts(onBattery, timeouts)
+}
+
+// SetIdleInhibited 在会话的空闲抑制状态变化时调用，抑制期间不调暗也不关闭屏幕
+func SetIdleInhibited(inhibited bool) {
+	if _dpy == nil || _dpy.screenPower == nil {
+		return
+	}
+	_dpy.screenPower.setInhibited(inhibited)
+}
+
+// SetSessionLocked 在锁屏和解锁时调用，锁屏后按 LockedOffDelay 关闭屏幕
+func SetSessionLocked(locked bool) {
+	if _dpy == nil || _dpy.screenPower == nil {
+		return
+	}
+	_dpy.screenPower.setLocked(locked)
+}
+
+// ForceScreenOff 立即关闭屏幕，用于关机、挂起等，之后用户有输入时打开屏幕
+func ForceScreenOff() error {
+	if _dpy == nil || _dpy.screenPower == nil {
+		return errors.New("screen power is not initialized")
+	}
+	return _dpy.screenPower.forceOff()
+}
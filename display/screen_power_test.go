@@ -0,0 +1,194 @@
+package display
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"pkg.deepin.io/dde/startdde/display/core"
+)
+
+// 代替 UPower 的假供电方式
+type fakePowerSource struct {
+	mu        sync.Mutex
+	battery   bool
+	onChanged func(onBattery bool)
+}
+
+func (s *fakePowerSource) onBattery() (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.battery, nil
+}
+
+func (s *fakePowerSource) connectOnBatteryChanged(cb func(onBattery bool)) error {
+	s.onChanged = cb
+	return nil
+}
+
+func (s *fakePowerSource) setOnBattery(onBattery bool) {
+	s.mu.Lock()
+	s.battery = onBattery
+	s.mu.Unlock()
+	s.onChanged(onBattery)
+}
+
+type fakeIdleMonitor struct {
+	mu      sync.Mutex
+	idle    time.Duration
+	onInput func()
+}
+
+func (im *fakeIdleMonitor) idleTime() (time.Duration, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.idle, nil
+}
+
+func (im *fakeIdleMonitor) setIdle(idle time.Duration) {
+	im.mu.Lock()
+	im.idle = idle
+	im.mu.Unlock()
+}
+
+func (im *fakeIdleMonitor) watchInput(cb func()) error {
+	im.mu.Lock()
+	im.onInput = cb
+	im.mu.Unlock()
+	return nil
+}
+
+func (im *fakeIdleMonitor) stopWatchingInput() {
+	im.mu.Lock()
+	im.onInput = nil
+	im.mu.Unlock()
+}
+
+func (im *fakeIdleMonitor) watching() bool {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+	return im.onInput != nil
+}
+
+// 模拟用户的输入
+func (im *fakeIdleMonitor) input() {
+	im.mu.Lock()
+	im.idle = 0
+	cb := im.onInput
+	im.onInput = nil
+	im.mu.Unlock()
+	if cb != nil {
+		cb()
+	}
+}
+
+type fakeScreenPowerBackend struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (b *fakeScreenPowerBackend) record(call string) error {
+	b.mu.Lock()
+	b.calls = append(b.calls, call)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *fakeScreenPowerBackend) Dim(level float64) error {
+	return b.record(fmt.Sprintf("dim %v", level))
+}
+
+func (b *fakeScreenPowerBackend) Restore() error {
+	return b.record("restore")
+}
+
+func (b *fakeScreenPowerBackend) SetDPMS(on bool) error {
+	return b.record(fmt.Sprintf("dpms %v", on))
+}
+
+func (b *fakeScreenPowerBackend) takeCalls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	calls := b.calls
+	b.calls = nil
+	return calls
+}
+
+func TestScreenPower(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-display")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "screen-power.json")
+	err = core.SaveScreenPowerConfig(cfgFile, core.ScreenPowerConfig{
+		AC:      core.ScreenPowerTimeouts{DimDelay: 600, OffDelay: 1200, DimLevel: 0.5},
+		Battery: core.ScreenPowerTimeouts{DimDelay: 60, DimLevel: 0.2},
+	})
+	require.NoError(t, err)
+
+	source := &fakePowerSource{}
+	idle := &fakeIdleMonitor{idle: 120 * time.Second}
+	backend := &fakeScreenPowerBackend{}
+	sp := newScreenPower(cfgFile, source, idle, backend)
+	assert.Empty(t, backend.takeCalls())
+
+	// 拔掉电源后按电池的设置调暗
+	source.setOnBattery(true)
+	assert.Equal(t, []string{"dim 0.2"}, backend.takeCalls())
+	assert.True(t, sp.isDimmed())
+	assert.True(t, idle.watching())
+
+	// 有抑制空闲的程序时恢复
+	sp.setInhibited(true)
+	assert.Equal(t, []string{"restore"}, backend.takeCalls())
+	sp.setInhibited(false)
+	assert.Equal(t, []string{"dim 0.2"}, backend.takeCalls())
+
+	// 修改设置后立即生效并保存
+	err = sp.setTimeouts(true, core.ScreenPowerTimeouts{DimDelay: 30, OffDelay: 100, DimLevel: 0.2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dpms false"}, backend.takeCalls())
+	cfg, err := core.LoadScreenPowerConfig(cfgFile)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(100), cfg.Battery.OffDelay)
+	assert.Equal(t, uint32(600), cfg.AC.DimDelay)
+
+	err = sp.setTimeouts(false, core.ScreenPowerTimeouts{DimDelay: 60, OffDelay: 60})
+	assert.Error(t, err)
+
+	// 用户有输入时立即恢复，不再监听输入
+	idle.input()
+	assert.Equal(t, []string{"dpms true", "restore"}, backend.takeCalls())
+	assert.False(t, sp.isDimmed())
+	assert.False(t, idle.watching())
+}
+
+func TestScreenPower_forceOff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-display")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// 没有配置时不调暗也不关闭屏幕
+	idle := &fakeIdleMonitor{idle: time.Hour}
+	backend := &fakeScreenPowerBackend{}
+	sp := newScreenPower(filepath.Join(dir, "screen-power.json"), nil, idle, backend)
+	assert.Empty(t, backend.takeCalls())
+	assert.False(t, idle.watching())
+
+	require.NoError(t, sp.forceOff())
+	assert.Equal(t, []string{"dpms false"}, backend.takeCalls())
+	assert.True(t, idle.watching())
+
+	// 锁屏状态变化时保持关闭
+	sp.setLocked(true)
+	assert.Empty(t, backend.takeCalls())
+
+	idle.input()
+	assert.Equal(t, []string{"dpms true"}, backend.takeCalls())
+	assert.False(t, idle.watching())
+}
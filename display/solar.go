@@ -0,0 +1,190 @@
+package display
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日出日落时间的计算，参考 https://en.wikipedia.org/wiki/Sunrise_equation
+
+type sunState int
+
+const (
+	sunStateNormal     sunState = iota
+	sunStatePolarDay            // 太阳一整天都在地平线之上
+	sunStatePolarNight          // 太阳一整天都在地平线之下
+)
+
+const (
+	julianUnixEpoch = 2440587.5
+	julianJ2000     = 2451545.0
+	secondsPerDay   = 86400
+)
+
+type geoLocation struct {
+	latitude  float64 // 北纬为正
+	longitude float64 // 东经为正
+}
+
+func toJulianDate(t time.Time) float64 {
+	return float64(t.Unix())/secondsPerDay + julianUnixEpoch
+}
+
+func fromJulianDate(j float64, loc *time.Location) time.Time {
+	sec := (j - julianUnixEpoch) * secondsPerDay
+	return time.Unix(int64(math.Round(sec)), 0).In(loc)
+}
+
+func sinDeg(v float64) float64 {
+	return math.Sin(v * math.Pi / 180)
+}
+
+func cosDeg(v float64) float64 {
+	return math.Cos(v * math.Pi / 180)
+}
+
+// getSunriseSunset 返回 date 所在的那一天的日出和日落时间，
+// 出现极昼或极夜时，只返回 sunStatePolarDay 或 sunStatePolarNight。
+func getSunriseSunset(date time.Time, location geoLocation) (sunrise, sunset time.Time, state sunState) {
+	year, month, day := date.Date()
+	noon := time.Date(year, month, day, 12, 0, 0, 0, date.Location())
+
+	n := math.Ceil(toJulianDate(noon) - julianJ2000 + 0.0008)
+	// 平太阳时
+	jStar := n - location.longitude/360
+	// 太阳平近点角
+	m := math.Mod(357.5291+0.98560028*jStar, 360)
+	// 中心差
+	c := 1.9148*sinDeg(m) + 0.02*sinDeg(2*m) + 0.0003*sinDeg(3*m)
+	// 黄道经度
+	lambda := math.Mod(m+c+180+102.9372, 360)
+	jTransit := julianJ2000 + jStar + 0.0053*sinDeg(m) - 0.0069*sinDeg(2*lambda)
+	// 太阳赤纬
+	sinDelta := sinDeg(lambda) * sinDeg(23.44)
+	cosDelta := math.Cos(math.Asin(sinDelta))
+
+	// -0.833 度修正了大气折射和太阳的视半径
+	cosOmega := (sinDeg(-0.833) - sinDeg(location.latitude)*sinDelta) /
+		(cosDeg(location.latitude) * cosDelta)
+	if cosOmega < -1 {
+		return time.Time{}, time.Time{}, sunStatePolarDay
+	} else if cosOmega > 1 {
+		return time.Time{}, time.Time{}, sunStatePolarNight
+	}
+	omega := math.Acos(cosOmega) * 180 / math.Pi
+
+	sunrise = fromJulianDate(jTransit-omega/360, date.Location())
+	sunset = fromJulianDate(jTransit+omega/360, date.Location())
+	return sunrise, sunset, sunStateNormal
+}
+
+var zoneTabFiles = []string{
+	"/usr/share/zoneinfo/zone1970.tab",
+	"/usr/share/zoneinfo/zone.tab",
+}
+
+// 获取系统时区的名称，比如 Asia/Shanghai
+func getTimezoneName() string {
+	tz := strings.TrimPrefix(os.Getenv("TZ"), ":")
+	if tz != "" {
+		return tz
+	}
+
+	content, err := ioutil.ReadFile("/etc/timezone")
+	if err == nil {
+		tz = strings.TrimSpace(string(content))
+		if tz != "" {
+			return tz
+		}
+	}
+
+	target, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return ""
+	}
+	const zoneInfoDir = "zoneinfo/"
+	idx := strings.Index(target, zoneInfoDir)
+	if idx == -1 {
+		return ""
+	}
+	return target[idx+len(zoneInfoDir):]
+}
+
+// 根据时区推算大致的经纬度，使用的是 zone.tab 中时区代表城市的坐标
+func getLocationByTimezone(tz string) (geoLocation, error) {
+	if tz == "" {
+		return geoLocation{}, errors.New("unknown timezone")
+	}
+	for _, file := range zoneTabFiles {
+		location, err := findLocationInZoneTab(file, tz)
+		if err == nil {
+			return location, nil
+		}
+		if !os.IsNotExist(err) {
+			logger.Debugf("failed to find %q in %s: %v", tz, file, err)
+		}
+	}
+	return geoLocation{}, fmt.Errorf("not found location of timezone %q", tz)
+}
+
+func findLocationInZoneTab(filename, tz string) (geoLocation, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return geoLocation{}, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		// 国家代码 坐标 时区 注释
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 || fields[2] != tz {
+			continue
+		}
+		return parseISO6709(fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return geoLocation{}, err
+	}
+	return geoLocation{}, errors.New("not found")
+}
+
+var iso6709Reg = regexp.MustCompile(`^([+-])(\d{4}|\d{6})([+-])(\d{5}|\d{7})$`)
+
+// 解析 zone.tab 中 ±DDMM±DDDMM 或者 ±DDMMSS±DDDMMSS 格式的坐标
+func parseISO6709(str string) (geoLocation, error) {
+	match := iso6709Reg.FindStringSubmatch(str)
+	if match == nil {
+		return geoLocation{}, fmt.Errorf("invalid coordinates %q", str)
+	}
+	return geoLocation{
+		latitude:  parseDMS(match[1], match[2], 2),
+		longitude: parseDMS(match[3], match[4], 3),
+	}, nil
+}
+
+func parseDMS(sign, digits string, degreeLen int) float64 {
+	degree, _ := strconv.Atoi(digits[:degreeLen])
+	minute, _ := strconv.Atoi(digits[degreeLen : degreeLen+2])
+	var second int
+	if len(digits) > degreeLen+2 {
+		second, _ = strconv.Atoi(digits[degreeLen+2:])
+	}
+	v := float64(degree) + float64(minute)/60 + float64(second)/3600
+	if sign == "-" {
+		v = -v
+	}
+	return v
+}
@@ -0,0 +1,251 @@
+package display
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+
+	"pkg.deepin.io/dde/api/dxinput/common"
+	dxutils "pkg.deepin.io/dde/api/dxinput/utils"
+	"pkg.deepin.io/dde/startdde/display/configfile"
+	"pkg.deepin.io/dde/startdde/display/core"
+)
+
+// Tablet 是数位板或者数位屏的笔，同一个数位板的笔和橡皮擦是不同的设备，但是序列号相同
+type Tablet struct {
+	Id         int32
+	Name       string
+	DeviceNode string
+	Serial     string
+
+	// 用于保持宽高比，不导出到 D-Bus
+	mmWidth  float64
+	mmHeight float64
+}
+
+type dxTablets []*Tablet
+
+// TabletMapping 是数位板关联的显示器，保存在 tabletMapFile 中，以数位板的序列号为键。
+// Output 为空时跟随主屏。
+type TabletMapping struct {
+	Output string
+	// 为 true 时只映射到显示器中间和数位板宽高比相同的区域
+	KeepAspect bool
+}
+
+var (
+	tabletInfos   dxTablets
+	tabletInfosMu sync.Mutex
+)
+
+func getTabletInfos(force bool) dxTablets {
+	tabletInfosMu.Lock()
+	defer tabletInfosMu.Unlock()
+
+	if !force && len(tabletInfos) != 0 {
+		return tabletInfos
+	}
+	tabletInfos = nil
+	for _, v := range getDeviceInfos(force) {
+		if v.Type == common.DevTypeTouchscreen {
+			continue
+		}
+		data, num := dxutils.GetProperty(v.Id, "Device Node")
+		if len(data) == 0 {
+			continue
+		}
+
+		deviceFile := string(data[:num])
+		device := gudevClient.QueryByDeviceFile(deviceFile)
+		if device == nil {
+			continue
+		}
+		// 不是所有数位板都使用 wacom 驱动，libinput 驱动的通过 udev 判断，
+		// 数位板的按键板不需要映射
+		if v.Type != common.DevTypeWacom && device.GetProperty("ID_INPUT_TABLET") == "" {
+			continue
+		}
+		if device.GetProperty("ID_INPUT_TABLET_PAD") != "" ||
+			device.GetProperty("ID_INPUT_TOUCHSCREEN") != "" {
+			continue
+		}
+
+		serial := device.GetProperty("ID_SERIAL")
+		if serial == "" {
+			serial = device.GetProperty("ID_PATH")
+		}
+		if serial == "" {
+			continue
+		}
+
+		mmWidth, _ := strconv.ParseFloat(device.GetProperty("ID_INPUT_WIDTH_MM"), 64)
+		mmHeight, _ := strconv.ParseFloat(device.GetProperty("ID_INPUT_HEIGHT_MM"), 64)
+		tabletInfos = append(tabletInfos, &Tablet{
+			Id:         v.Id,
+			Name:       v.Name,
+			DeviceNode: deviceFile,
+			Serial:     serial,
+			mmWidth:    mmWidth,
+			mmHeight:   mmHeight,
+		})
+	}
+
+	return tabletInfos
+}
+
+func (tablets dxTablets) getById(id int32) *Tablet {
+	for _, t := range tablets {
+		if t.Id == id {
+			return t
+		}
+	}
+	return nil
+}
+
+func loadTabletMap(filename string) (map[string]TabletMapping, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var tabletMap map[string]TabletMapping
+	err = json.Unmarshal(data, &tabletMap)
+	if err != nil {
+		return nil, err
+	}
+	return tabletMap, nil
+}
+
+func saveTabletMap(filename string, tabletMap map[string]TabletMapping) error {
+	data, err := json.Marshal(tabletMap)
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, data, 0644, 0)
+}
+
+func (m *Manager) initTablets() {
+	tabletMap, err := loadTabletMap(tabletMapFile)
+	if err != nil && !os.IsNotExist(err) {
+		logger.Warning("failed to load tablet map:", err)
+	}
+	if tabletMap == nil {
+		tabletMap = make(map[string]TabletMapping)
+	}
+
+	m.PropsMu.Lock()
+	m.setPropTablets(getTabletInfos(true))
+	m.setPropTabletMap(tabletMap)
+	m.PropsMu.Unlock()
+
+	m.doMapTablets()
+}
+
+func (m *Manager) handleTabletChanged() {
+	tablets := getTabletInfos(true)
+	m.PropsMu.Lock()
+	m.setPropTablets(tablets)
+	m.PropsMu.Unlock()
+
+	// 新插入的数位板如果有配置，使配置生效，没有配置的保持映射到整个屏幕
+	m.doMapTablets()
+}
+
+// 显示器的布局、旋转或者主屏改变后，重新计算所有有配置的数位板的坐标变换矩阵
+func (m *Manager) doMapTablets() {
+	m.PropsMu.RLock()
+	tablets := m.Tablets
+	tabletMap := make(map[string]TabletMapping, len(m.TabletMap))
+	for serial, mapping := range m.TabletMap {
+		tabletMap[serial] = mapping
+	}
+	primary := m.Primary
+	m.PropsMu.RUnlock()
+
+	go func() {
+		for _, tablet := range tablets {
+			mapping, ok := tabletMap[tablet.Serial]
+			if !ok {
+				continue
+			}
+			err := m.setTabletMatrix(tablet, mapping, primary)
+			if err != nil {
+				logger.Warningf("failed to map tablet %s: %v", tablet.Name, err)
+			}
+		}
+	}()
+}
+
+// 关联的显示器没有连接或者没有启用时映射到整个屏幕
+func (m *Manager) setTabletMatrix(tablet *Tablet, mapping TabletMapping, primary string) error {
+	output := mapping.Output
+	if output == "" {
+		output = primary
+	}
+	monitor := m.getConnectedMonitors().GetByName(output)
+	enabled := false
+	if monitor != nil {
+		monitor.PropsMu.RLock()
+		enabled = monitor.Enabled
+		monitor.PropsMu.RUnlock()
+	}
+	if !enabled {
+		logger.Debugf("tablet %s: output %q is not available, map to the whole screen",
+			tablet.Name, output)
+		return setInputMatrix(tablet.Id, core.TouchMatrix{1, 0, 0, 0, 1, 0, 0, 0, 1})
+	}
+
+	sw, sh := m.getScreenSize()
+	monitor.PropsMu.RLock()
+	x, y, width, height := monitor.X, monitor.Y, monitor.Width, monitor.Height
+	if mapping.KeepAspect {
+		x, y, width, height = core.KeepAspectRect(x, y, width, height, monitor.Rotation,
+			tablet.mmWidth, tablet.mmHeight)
+	}
+	matrix := core.GetTouchMatrix(x, y, width, height, monitor.Rotation, monitor.Reflect, sw, sh)
+	monitor.PropsMu.RUnlock()
+	return setInputMatrix(tablet.Id, matrix)
+}
+
+// 数位板的笔和橡皮擦等设备的序列号相同，一起关联到显示器
+func (m *Manager) associateTablet(outputName string, deviceId int32, keepAspect bool) error {
+	if outputName != "" && m.getConnectedMonitors().GetByName(outputName) == nil {
+		return fmt.Errorf("invalid output name: %s", outputName)
+	}
+
+	m.PropsMu.Lock()
+	defer m.PropsMu.Unlock()
+
+	tablet := m.Tablets.getById(deviceId)
+	if tablet == nil {
+		return fmt.Errorf("invalid tablet id: %d", deviceId)
+	}
+	mapping := TabletMapping{
+		Output:     outputName,
+		KeepAspect: keepAspect,
+	}
+	if v, ok := m.TabletMap[tablet.Serial]; ok && v == mapping {
+		return nil
+	}
+
+	for _, t := range m.Tablets {
+		if t.Serial != tablet.Serial {
+			continue
+		}
+		err := m.setTabletMatrix(t, mapping, m.Primary)
+		if err != nil {
+			logger.Warning("[AssociateTablet] set failed:", err)
+			return err
+		}
+	}
+
+	m.TabletMap[tablet.Serial] = mapping
+	err := saveTabletMap(tabletMapFile, m.TabletMap)
+	if err != nil {
+		logger.Warning("failed to save tablet map:", err)
+	}
+	return m.emitPropChangedTabletMap(m.TabletMap)
+}
@@ -0,0 +1,29 @@
+package display
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_saveTabletMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-display")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "tablet-map.json")
+	tabletMap := map[string]TabletMapping{
+		"Wacom_Co._Ltd._Intuos_PTM": {Output: "HDMI-1", KeepAspect: true},
+		"Huion_Kamvas":              {},
+	}
+	err = saveTabletMap(filename, tabletMap)
+	require.NoError(t, err)
+
+	tabletMap1, err := loadTabletMap(filename)
+	require.NoError(t, err)
+	assert.Equal(t, tabletMap, tabletMap1)
+}
@@ -6,11 +6,15 @@ package display
 import "C"
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"sync"
 
 	"pkg.deepin.io/dde/api/dxinput"
 	"pkg.deepin.io/dde/api/dxinput/common"
 	dxutils "pkg.deepin.io/dde/api/dxinput/utils"
+	"pkg.deepin.io/dde/startdde/display/core"
 	gudev "pkg.deepin.io/gir/gudev-1.0"
 )
 
@@ -19,6 +23,12 @@ type Touchscreen struct {
 	Name       string
 	DeviceNode string
 	Serial     string
+
+	// 用于自动关联显示器，不导出到 D-Bus
+	mmWidth  float64
+	mmHeight float64
+	bus      string
+	path     string
 }
 
 type dxTouchscreens []*Touchscreen
@@ -39,6 +49,7 @@ func handleDeviceChanged() {
 	logger.Debug("Device changed")
 
 	_dpy.handleTouchscreenChanged()
+	_dpy.handleTabletChanged()
 }
 
 func getDeviceInfos(force bool) common.DeviceInfos {
@@ -78,11 +89,17 @@ func getTouchscreenInfos(force bool) dxTouchscreens {
 				continue
 			}
 
+			mmWidth, _ := strconv.ParseFloat(device.GetProperty("ID_INPUT_WIDTH_MM"), 64)
+			mmHeight, _ := strconv.ParseFloat(device.GetProperty("ID_INPUT_HEIGHT_MM"), 64)
 			touchscreenInfos = append(touchscreenInfos, &Touchscreen{
 				Id:         tmp.Id,
 				Name:       tmp.Name,
 				DeviceNode: deviceFile,
 				Serial:     serial,
+				mmWidth:    mmWidth,
+				mmHeight:   mmHeight,
+				bus:        device.GetProperty("ID_BUS"),
+				path:       device.GetProperty("ID_PATH"),
 			})
 		}
 	}
@@ -90,30 +107,71 @@ func getTouchscreenInfos(force bool) dxTouchscreens {
 	return touchscreenInfos
 }
 
-func (m *Manager) touchScreenSetRotation(direction uint16, output string) {
-	touchSerial := ""
-	for ts, op := range m.TouchMap {
-		if op == output {
-			touchSerial = ts
-			break
-		}
-	}
-	if touchSerial == "" {
-		logger.Errorf("get touchSerial failed")
-		return
+func (t *Touchscreen) toTouchDevice() *core.TouchDevice {
+	return &core.TouchDevice{
+		Serial:   t.Serial,
+		MmWidth:  t.mmWidth,
+		MmHeight: t.mmHeight,
+		Bus:      t.bus,
+		Path:     t.path,
 	}
+}
 
-	for _, ts := range m.Touchscreens {
-		if ts.Serial != touchSerial {
+// 按物理大小、内置显示器和 USB 拓扑自动关联触摸屏，返回无法自动关联的触摸屏
+func (m *Manager) autoAssociateTouches(touches []*Touchscreen) []*Touchscreen {
+	if len(touches) == 0 {
+		return nil
+	}
+	outputs, err := m.backend.ListOutputs()
+	if err != nil {
+		logger.Warning(err)
+		return touches
+	}
+	devices := make([]*core.TouchDevice, len(touches))
+	for i, touch := range touches {
+		devices[i] = touch.toTouchDevice()
+	}
+	m.PropsMu.RLock()
+	touchMap := make(map[string]string, len(m.TouchMap))
+	for serial, output := range m.TouchMap {
+		touchMap[serial] = output
+	}
+	m.PropsMu.RUnlock()
+
+	matched := core.MatchTouchscreens(devices, outputs, touchMap)
+	var rest []*Touchscreen
+	for _, touch := range touches {
+		output, ok := matched[touch.Serial]
+		if !ok {
+			rest = append(rest, touch)
 			continue
 		}
-		touchScreen, err := dxinput.NewTouchscreen(ts.Id)
+		logger.Infof("auto associate touchscreen %s with %s", touch.Serial, output)
+		err = m.associateTouch(output, touch.Serial)
 		if err != nil {
-			logger.Warningf("NewTouchScreen %d failed", ts.Id)
-		}
-		err = touchScreen.SetRotation(uint8(direction))
-		if err != nil {
-			logger.Warningf("touchScreen %d SetRotation failed", ts.Id)
+			logger.Warning(err)
+			rest = append(rest, touch)
 		}
 	}
+	return rest
+}
+
+// 设置完整的坐标变换矩阵，包括显示器在屏幕中的位置、旋转和缩放
+func (m *Manager) setTouchMatrix(touchId int32, monitor *Monitor) error {
+	sw, sh := m.getScreenSize()
+	monitor.PropsMu.RLock()
+	matrix := core.GetTouchMatrix(monitor.X, monitor.Y, monitor.Width, monitor.Height,
+		monitor.Rotation, monitor.Reflect, sw, sh)
+	monitor.PropsMu.RUnlock()
+	return setInputMatrix(touchId, matrix)
+}
+
+// 触摸屏和数位板共用
+func setInputMatrix(deviceId int32, matrix core.TouchMatrix) error {
+	values := make([]string, len(matrix))
+	for i, v := range matrix {
+		values[i] = strconv.FormatFloat(v, 'f', 6, 64)
+	}
+	return doAction(fmt.Sprintf("xinput set-prop %d --type=float \"Coordinate Transformation Matrix\" %s",
+		deviceId, strings.Join(values, " ")))
 }
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os/exec"
 	"regexp"
 	"sort"
@@ -18,7 +17,6 @@ import (
 	"pkg.deepin.io/gir/gudev-1.0"
 	"pkg.deepin.io/lib/keyfile"
 	"pkg.deepin.io/lib/strv"
-	"pkg.deepin.io/lib/utils"
 )
 
 const (
@@ -241,97 +239,12 @@ func getCrtcRect(crtcInfo *randr.GetCrtcInfoReply) x.Rectangle {
 	return rect
 }
 
-func parseEDID(edid []byte) (string, string) {
-	if len(edid) < 16 {
-		return "DEFAULT", ""
-	}
-	var brandInf = edid[8:12]
-	var bInf = uint64(brandInf[0])<<8 + uint64(brandInf[1])
-	var maInf []byte
-	var k uint
-	for k = 1; k <= 3; k++ {
-		m := byte(((bInf >> (15 - 5*k)) & 31) + 'A' - 1)
-		if m >= 'A' && m <= 'Z' {
-			maInf = append(maInf, m)
-		} else {
-			return "DEFAULT", ""
-		}
-	}
-
-	// 截取显示器型号信息
-	if len(edid) < 128 {
-		return string(maInf), ""
-	}
-	modelInf := edid[88:112]
-	var moInf []byte
-	var isHaveInf = false
-	for _, m := range modelInf {
-		if m >= '!' && m <= '~' {
-			moInf = append(moInf, m)
-			isHaveInf = true
-		}
-		if isHaveInf && (m < '!' || m > '~') { // 截取型号信息终止
-			break
-		}
-	}
-	if !isHaveInf { // 如果没有型号信息，则解析厂家内部小版本号作为类型信息
-		for i := 2; i <= 3; i++ {
-			strInf := []byte(strconv.Itoa(int(brandInf[i])))
-			for j := 0; j < len(strInf); j++ {
-				moInf = append(moInf, strInf[j])
-			}
-		}
-	}
-	return string(maInf), string(moInf)
-}
-
-func getOutputUUID(name string, edid []byte) string {
-	if len(edid) < 128 {
-		return name
-	}
-
-	id, _ := utils.SumStrMd5(string(edid[:128]))
-	if id == "" {
-		return name
-	}
-	return name + id
-}
-
 func sortMonitorsByID(monitors []*Monitor) {
 	sort.Slice(monitors, func(i, j int) bool {
 		return monitors[i].ID < monitors[j].ID
 	})
 }
 
-func getMinIDMonitor(monitors []*Monitor) *Monitor {
-	if len(monitors) == 0 {
-		return nil
-	}
-
-	minMonitor := monitors[0]
-	for _, monitor := range monitors[1:] {
-		if minMonitor.ID > monitor.ID {
-			minMonitor = monitor
-		}
-	}
-	return minMonitor
-}
-
-// 获取最早连接的显示器
-func getMinLastConnectedTimeMonitor(monitors []*Monitor) *Monitor {
-	if len(monitors) == 0 {
-		return nil
-	}
-	minMonitor := monitors[0]
-	for _, monitor := range monitors[1:] {
-		if minMonitor.lastConnectedTime.After(monitor.lastConnectedTime) {
-			// minMonitor > monitor
-			minMonitor = monitor
-		}
-	}
-	return minMonitor
-}
-
 func jsonMarshal(v interface{}) string {
 	data, _ := json.Marshal(v)
 	return string(data)
@@ -358,14 +271,6 @@ func needSwapWidthHeight(rotation uint16) bool {
 		rotation&randr.RotationRotate270 != 0
 }
 
-func getConfigVersion(filename string) (string, error) {
-	content, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes.TrimSpace(content)), nil
-}
-
 func getComputeChassis() (string, error) {
 	systemBus, err := dbus.SystemBus()
 	if err != nil {
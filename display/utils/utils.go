@@ -6,6 +6,7 @@ import (
 	libutils "pkg.deepin.io/lib/utils"
 )
 
+// GetOutputEDID 返回输出设备的 EDID，包含扩展块
 func GetOutputEDID(conn *x.Conn, output randr.Output) ([]byte, error) {
 	atomEDID, err := conn.GetAtom("EDID")
 	if err != nil {
@@ -14,7 +15,7 @@ func GetOutputEDID(conn *x.Conn, output randr.Output) ([]byte, error) {
 
 	reply, err := randr.GetOutputProperty(conn, output,
 		atomEDID, x.AtomInteger,
-		0, 32, false, false).Reply(conn)
+		0, 256, false, false).Reply(conn)
 	if err != nil {
 		return nil, err
 	}
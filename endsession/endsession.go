@@ -0,0 +1,351 @@
+// Package endsession 实现会话结束（注销、关机、重启）时执行的清理流水线。
+//
+// 流水线由若干阶段组成，每个阶段都定义在 drop-in 目录下的一个 JSON 文件中，
+// 按 Order 从小到大依次执行。后面目录中的同名文件覆盖前面目录中的，
+// 设置 "Disabled": true 可以移除某个阶段。
+package endsession
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/log"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+const (
+	EventLogout   = "logout"
+	EventShutdown = "shutdown"
+)
+
+const (
+	StageTypeDBus        = "dbus"
+	StageTypeKill        = "kill"
+	StageTypeSystemdUnit = "systemd-unit"
+	StageTypeScript      = "script"
+	// 调用 startdde 内部用 RegisterBuiltin 注册的函数，比如播放注销的提示音
+	StageTypeBuiltin = "builtin"
+)
+
+const defaultStageTimeout = 3 // seconds
+
+var logger = log.NewLogger("startdde/endsession")
+
+func SetLogLevel(level log.Priority) {
+	logger.SetLogLevel(level)
+}
+
+type Stage struct {
+	Name     string   `json:"Name"`
+	Type     string   `json:"Type"`
+	Order    int      `json:"Order"`
+	Events   []string `json:"Events"`
+	Disabled bool     `json:"Disabled"`
+	// 单位秒
+	Timeout int `json:"Timeout"`
+	// 强制注销或关机时是否也执行
+	RunOnForce bool `json:"RunOnForce"`
+
+	// dbus
+	Bus    string   `json:"Bus"` // session or system
+	Dest   string   `json:"Dest"`
+	Path   string   `json:"Path"`
+	Method string   `json:"Method"` // interface.method
+	Args   []string `json:"Args"`
+
+	// kill
+	Pattern     string `json:"Pattern"`
+	CurrentUser bool   `json:"CurrentUser"`
+
+	// systemd-unit
+	Unit string `json:"Unit"`
+	Mask bool   `json:"Mask"`
+
+	// script
+	Exec string `json:"Exec"`
+
+	// builtin
+	Builtin string `json:"Builtin"`
+}
+
+// BuiltinFunc 是内置阶段执行的函数，event 为 EventLogout 或 EventShutdown
+type BuiltinFunc func(ctx context.Context, event string) error
+
+var (
+	builtinsMu sync.Mutex
+	builtins   = make(map[string]BuiltinFunc)
+)
+
+// RegisterBuiltin 注册内置阶段的函数，Builtin 为 name 的阶段会调用 fn
+func RegisterBuiltin(name string, fn BuiltinFunc) {
+	builtinsMu.Lock()
+	builtins[name] = fn
+	builtinsMu.Unlock()
+}
+
+func getBuiltin(name string) BuiltinFunc {
+	builtinsMu.Lock()
+	defer builtinsMu.Unlock()
+	return builtins[name]
+}
+
+func (s *Stage) hasEvent(event string) bool {
+	for _, e := range s.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Stage) getTimeout() time.Duration {
+	if s.Timeout <= 0 {
+		return defaultStageTimeout * time.Second
+	}
+	return time.Duration(s.Timeout) * time.Second
+}
+
+func (s *Stage) validate() error {
+	switch s.Type {
+	case StageTypeDBus:
+		if s.Dest == "" || s.Path == "" || s.Method == "" {
+			return errors.New("dbus stage requires Dest, Path and Method")
+		}
+		if s.Bus != "" && s.Bus != "session" && s.Bus != "system" {
+			return fmt.Errorf("invalid bus %q", s.Bus)
+		}
+	case StageTypeKill:
+		if s.Pattern == "" {
+			return errors.New("kill stage requires Pattern")
+		}
+	case StageTypeSystemdUnit:
+		if s.Unit == "" {
+			return errors.New("systemd-unit stage requires Unit")
+		}
+	case StageTypeScript:
+		if s.Exec == "" {
+			return errors.New("script stage requires Exec")
+		}
+	case StageTypeBuiltin:
+		if s.Builtin == "" {
+			return errors.New("builtin stage requires Builtin")
+		}
+	default:
+		return fmt.Errorf("unknown stage type %q", s.Type)
+	}
+	return nil
+}
+
+func getStageDirs() []string {
+	return []string{
+		"/usr/share/startdde/end-session.d",
+		"/etc/deepin/startdde/end-session.d",
+		filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", "end-session.d"),
+	}
+}
+
+// LoadStages 从 dirs 中加载阶段，返回排好序的列表
+func LoadStages(dirs []string) []*Stage {
+	stageMap := make(map[string]*Stage)
+	for _, dir := range dirs {
+		fileInfoList, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warning(err)
+			}
+			continue
+		}
+
+		for _, fileInfo := range fileInfoList {
+			if fileInfo.IsDir() || !strings.HasSuffix(fileInfo.Name(), ".json") {
+				continue
+			}
+			filename := filepath.Join(dir, fileInfo.Name())
+			stage, err := loadStage(filename)
+			if err != nil {
+				logger.Warningf("failed to load stage %q: %v", filename, err)
+				continue
+			}
+			stageMap[fileInfo.Name()] = stage
+		}
+	}
+
+	stages := make([]*Stage, 0, len(stageMap))
+	for _, stage := range stageMap {
+		if stage.Disabled {
+			continue
+		}
+		stages = append(stages, stage)
+	}
+	sort.Slice(stages, func(i, j int) bool {
+		if stages[i].Order == stages[j].Order {
+			return stages[i].Name < stages[j].Name
+		}
+		return stages[i].Order < stages[j].Order
+	})
+	return stages
+}
+
+func loadStage(filename string) (*Stage, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var stage Stage
+	err = json.Unmarshal(content, &stage)
+	if err != nil {
+		return nil, err
+	}
+	if stage.Name == "" {
+		stage.Name = strings.TrimSuffix(filepath.Base(filename), ".json")
+	}
+	if stage.Disabled {
+		return &stage, nil
+	}
+	err = stage.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &stage, nil
+}
+
+// Run 按顺序执行 event 对应的所有阶段
+func Run(event string, force bool) {
+	stages := LoadStages(getStageDirs())
+	for _, stage := range stages {
+		if !stage.hasEvent(event) {
+			continue
+		}
+		if force && !stage.RunOnForce {
+			logger.Debugf("[EndSession] skip stage %q on force %s", stage.Name, event)
+			continue
+		}
+
+		t0 := time.Now()
+		err := runStage(stage, event)
+		elapsed := time.Since(t0)
+		if err != nil {
+			logger.Warningf("[EndSession] stage %q failed after %v: %v", stage.Name, elapsed, err)
+		} else {
+			logger.Infof("[EndSession] stage %q done, cost %v", stage.Name, elapsed)
+		}
+	}
+}
+
+func runStage(stage *Stage, event string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), stage.getTimeout())
+	defer cancel()
+
+	switch stage.Type {
+	case StageTypeDBus:
+		return runDBusStage(ctx, stage)
+	case StageTypeKill:
+		return runKillStage(ctx, stage)
+	case StageTypeSystemdUnit:
+		return runSystemdUnitStage(ctx, stage)
+	case StageTypeScript:
+		return runCommand(ctx, stage.Exec, stage.Args...)
+	case StageTypeBuiltin:
+		return runBuiltinStage(ctx, stage, event)
+	}
+	return fmt.Errorf("unknown stage type %q", stage.Type)
+}
+
+// 超时后不再等待，函数在后台继续执行
+func runBuiltinStage(ctx context.Context, stage *Stage, event string) error {
+	fn := getBuiltin(stage.Builtin)
+	if fn == nil {
+		return fmt.Errorf("builtin %q is not registered", stage.Builtin)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx, event)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%s timed out", stage.Builtin)
+	}
+}
+
+func runDBusStage(ctx context.Context, stage *Stage) error {
+	var conn *dbus.Conn
+	var err error
+	if stage.Bus == "system" {
+		conn, err = dbus.SystemBus()
+	} else {
+		conn, err = dbus.SessionBus()
+	}
+	if err != nil {
+		return err
+	}
+
+	args := make([]interface{}, len(stage.Args))
+	for i, arg := range stage.Args {
+		args[i] = arg
+	}
+	obj := conn.Object(stage.Dest, dbus.ObjectPath(stage.Path))
+	return obj.CallWithContext(ctx, stage.Method, dbus.FlagNoAutoStart, args...).Err
+}
+
+func runKillStage(ctx context.Context, stage *Stage) error {
+	args := []string{"-ef"}
+	if stage.CurrentUser {
+		args = append(args, "-u", strconv.Itoa(os.Getuid()))
+	}
+	args = append(args, stage.Pattern)
+	err := runCommand(ctx, "pkill", args...)
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		// no processes matched
+		return nil
+	}
+	return err
+}
+
+func runSystemdUnitStage(ctx context.Context, stage *Stage) error {
+	if stage.Mask {
+		// mask 可以防止服务被 dbus 激活而再次启动
+		err := runCommand(ctx, "systemctl", "--user", "--runtime", "--now", "mask", stage.Unit)
+		if err != nil {
+			return err
+		}
+		if runCommand(ctx, "systemctl", "--quiet", "--user", "is-active", stage.Unit) == nil {
+			logger.Warningf("[EndSession] %s is still running", stage.Unit)
+		}
+		return nil
+	}
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return err
+	}
+	systemdUser := conn.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1")
+	var jobPath dbus.ObjectPath
+	return systemdUser.CallWithContext(ctx, "org.freedesktop.systemd1.Manager.StopUnit",
+		dbus.FlagNoAutoStart, stage.Unit, "replace").Store(&jobPath)
+}
+
+func runCommand(ctx context.Context, name string, args ...string) error {
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s timed out", name)
+	}
+	if len(out) > 0 {
+		logger.Debugf("[EndSession] %s %v out: %s", name, args, out)
+	}
+	return err
+}
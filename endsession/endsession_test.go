@@ -0,0 +1,54 @@
+package endsession
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadStages(t *testing.T) {
+	stages := LoadStages([]string{"testdata/sys"})
+	var names []string
+	for _, stage := range stages {
+		names = append(names, stage.Name)
+	}
+	assert.Equal(t, []string{"call-baz", "kill-foo", "stop-bar"}, names)
+
+	stages = LoadStages([]string{"testdata/sys", "testdata/user", "testdata/notexist"})
+	names = nil
+	for _, stage := range stages {
+		names = append(names, stage.Name)
+	}
+	assert.Equal(t, []string{"call-baz", "50-script", "stop-bar"}, names)
+
+	script := stages[1]
+	assert.True(t, script.RunOnForce)
+	assert.True(t, script.hasEvent(EventShutdown))
+	assert.False(t, script.hasEvent(EventLogout))
+	assert.Equal(t, "1s", script.getTimeout().String())
+	assert.Equal(t, "3s", stages[2].getTimeout().String())
+}
+
+func TestRunBuiltinStage(t *testing.T) {
+	var events []string
+	RegisterBuiltin("test-builtin", func(ctx context.Context, event string) error {
+		events = append(events, event)
+		if event == EventShutdown {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	stage := &Stage{Name: "test", Type: StageTypeBuiltin, Builtin: "test-builtin"}
+	assert.NoError(t, stage.validate())
+	assert.NoError(t, runStage(stage, EventLogout))
+	assert.Error(t, runStage(stage, EventShutdown))
+	assert.Equal(t, []string{EventLogout, EventShutdown}, events)
+
+	stage.Builtin = "not-registered"
+	assert.Error(t, runStage(stage, EventLogout))
+
+	stage.Builtin = ""
+	assert.Error(t, stage.validate())
+}
@@ -32,6 +32,7 @@ import (
 	dbus "github.com/godbus/dbus"
 	x "github.com/linuxdeepin/go-x11-client"
 	"pkg.deepin.io/dde/startdde/display"
+	"pkg.deepin.io/dde/startdde/endsession"
 	"pkg.deepin.io/dde/startdde/iowait"
 	"pkg.deepin.io/dde/startdde/watchdog"
 	wl_display "pkg.deepin.io/dde/startdde/wl_display"
@@ -255,6 +256,7 @@ func main() {
 	if err != nil {
 		logger.Warningf("request name %q failed: %v", sessionManagerServiceName, err)
 	}
+	sessionManager.setStage(SessionStageInitEnd)
 	logDebugAfter("before launchCoreComponents")
 
 	if !_useWayland {
@@ -266,7 +268,10 @@ func main() {
 		}
 	}
 
-	launchCoreComponents(sessionManager)
+	sessionManager.addStageHook(SessionStageCoreBegin, "core-components", func() {
+		launchCoreComponents(sessionManager)
+	})
+	sessionManager.setStage(SessionStageCoreBegin)
 
 	if !_useWayland {
 		// 启动 display 模块的后一部分
@@ -343,4 +348,5 @@ func doSetLogLevel(level log.Priority) {
 		wl_display.SetLogLevel(level)
 	}
 	watchdog.SetLogLevel(level)
+	endsession.SetLogLevel(level)
 }
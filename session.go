@@ -24,7 +24,6 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"os/user"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -39,8 +38,9 @@ import (
 	login1 "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.login1"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/dpms"
-	"pkg.deepin.io/dde/api/soundutils"
 	"pkg.deepin.io/dde/startdde/autostop"
+	"pkg.deepin.io/dde/startdde/display"
+	"pkg.deepin.io/dde/startdde/endsession"
 	"pkg.deepin.io/dde/startdde/keyring"
 	"pkg.deepin.io/dde/startdde/memchecker"
 	"pkg.deepin.io/dde/startdde/swapsched"
@@ -76,6 +76,8 @@ type SessionManager struct {
 	cookieLocker          sync.Mutex
 	cookies               map[string]chan time.Time
 	Stage                 int32
+	CurrentStage          int32
+	stages                *stageMachine
 	allowSessionDaemonRun bool
 	loginSession          *login1.Session
 	dbusDaemon            *ofdbus.DBus         // session bus daemon
@@ -87,12 +89,23 @@ type SessionManager struct {
 	objLogin            *login1.Manager
 	objLoginSessionSelf *login1.Session
 
+	// 结束会话的原因和是否强制，在进入 SessionStageEndingQuery 之前设置
+	endingEvent string
+	endingForce bool
+
 	//nolint
 	signals *struct {
 		Unlock                           struct{}
 		InhibitorAdded, InhibitorRemoved struct {
 			path dbus.ObjectPath
 		}
+		AppsStillRunning struct {
+			apps []string
+		}
+		StageChanged struct {
+			old int32
+			new int32
+		}
 	}
 
 	//nolint
@@ -109,6 +122,8 @@ type SessionManager struct {
 		IsInhibited           func() `in:"flags" out:"result"`
 		Uninhibit             func() `in:"cookie"`
 		GetInhibitors         func() `out:"inhibitors"`
+		GetStageTimestamps    func() `out:"timestamps"`
+		CancelEndSession      func()
 	}
 }
 
@@ -119,15 +134,6 @@ const (
 	lockFrontObjPath = "/com/deepin/dde/lockFront"
 )
 
-const (
-	SessionStageInitBegin int32 = iota
-	SessionStageInitEnd
-	SessionStageCoreBegin
-	SessionStageCoreEnd // nolint
-	SessionStageAppsBegin
-	SessionStageAppsEnd
-)
-
 var (
 	swapSchedDispatcher *swapsched.Dispatcher
 )
@@ -141,61 +147,44 @@ func (m *SessionManager) Logout() *dbus.Error {
 	return nil
 }
 
-func stopBAMFDaemon() {
-	// NOTE: Proactively stop the bamfdaemon service.
-	// If you don't do this, it will exit in the failed state because X Server exits,
-	// causing the restart to be too frequent and not being started properly.
-	// This is a temporary workaround.
-	bus, err := dbus.SessionBus()
-	if err == nil {
-		systemdUser := bus.Object("org.freedesktop.systemd1", "/org/freedesktop/systemd1")
-		var jobPath dbus.ObjectPath
-		err = systemdUser.Call("org.freedesktop.systemd1.Manager.StopUnit",
-			dbus.FlagNoAutoStart, "bamfdaemon.service", "replace").Store(&jobPath)
-		if err != nil {
-			logger.Warning("failed to stop bamfdaemon.service:", err)
-		}
-	} else {
+// 结束会话之前的准备工作，具体的步骤是注册在 SessionStageEndingQuery 和 SessionStageEnding 阶段的 hook，
+// 在 SessionStageEndingQuery 阶段被 CancelEndSession 取消时返回 false
+func (m *SessionManager) prepareEndSession(event string, force bool) bool {
+	m.endingEvent = event
+	m.endingForce = force
+	err := m.transitStage(SessionStageEndingQuery)
+	if err != nil {
 		logger.Warning(err)
+		return false
 	}
+	err = m.transitStage(SessionStageEnding)
+	if err != nil {
+		logger.Infof("%s is canceled: %v", event, err)
+		return false
+	}
+	return true
 }
 
-func (m *SessionManager) prepareLogout(force bool) {
-	if !force {
-		err := autostop.LaunchAutostopScripts(logger)
-		if err != nil {
-			logger.Warning("failed to run auto script:", err)
-		}
+func (m *SessionManager) runAutostop() {
+	if m.endingForce {
+		return
 	}
-
-	killSogouImeWatchdog()
-	// kill process LangSelector ,because LangSelector will not be kill by common logout
-	killLangSelector()
-	// quit at-spi-dbus-bus.service
-	quitAtSpiService()
-	stopBAMFDaemon()
-	sendMsgToUserExperModule(UserLogoutMsg)
-	quitObexSevice()
-	if !force && soundutils.CanPlayEvent(soundutils.EventDesktopLogout) {
-		playLogoutSound()
-		// PulseAudio should have quit
-	} else {
-		quitPulseAudio()
+	phase := autostop.PhaseLogout
+	if m.endingEvent == endsession.EventShutdown {
+		phase = autostop.PhaseShutdown
 	}
-}
-
-// kill process LangSelector by cmd "pkill -ef -u $UID /usr/lib/deepin-daemon/langselector"
-func killLangSelector() {
-	u, err := user.Current()
+	err := autostop.LaunchAutostopScripts(logger, phase)
 	if err != nil {
-		logger.Debug("failed to get current user:", err)
+		logger.Warning("failed to run auto script:", err)
 	}
-	out, err := exec.Command("pkill", "-ef", "-u", u.Uid, "/usr/lib/deepin-daemon/langselector").Output()
-	if err != nil {
-		logger.Debug("failed to kill langselector:", err)
-	} else {
-		logger.Infof("kill langselector out:%s", out)
+}
+
+func (m *SessionManager) prepareLogout(force bool) bool {
+	if !m.prepareEndSession(endsession.EventLogout, force) {
+		return false
 	}
+	sendMsgToUserExperModule(UserLogoutMsg)
+	return true
 }
 
 func (m *SessionManager) RequestLogout() *dbus.Error {
@@ -227,7 +216,9 @@ func (m *SessionManager) logout(force bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.prepareLogout(force)
+	if !m.prepareLogout(force) {
+		return
+	}
 	clearTtys()
 	m.doLogout(force)
 }
@@ -242,23 +233,12 @@ func (m *SessionManager) Shutdown() *dbus.Error {
 	return nil
 }
 
-func (m *SessionManager) prepareShutdown(force bool) {
-	killSogouImeWatchdog()
-	stopBAMFDaemon()
-	sendMsgToUserExperModule(UserShutdownMsg)
-	if !force {
-		preparePlayShutdownSound()
-	}
-	quitPulseAudio()
-}
-
-func killSogouImeWatchdog() {
-	out, err := exec.Command("pkill", "-ef", "sogouImeService").Output()
-	if err != nil {
-		logger.Debug("failed to kill sogouIme watchdog:", err)
-	} else {
-		logger.Infof("kill sogouIme out:%s", out)
+func (m *SessionManager) prepareShutdown(force bool) bool {
+	if !m.prepareEndSession(endsession.EventShutdown, force) {
+		return false
 	}
+	sendMsgToUserExperModule(UserShutdownMsg)
+	return true
 }
 
 func (m *SessionManager) RequestShutdown() *dbus.Error {
@@ -277,7 +257,9 @@ func (m *SessionManager) shutdown(force bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.prepareShutdown(force)
+	if !m.prepareShutdown(force) {
+		return
+	}
 
 	err := m.objLogin.PowerOff(0, false)
 	if err != nil {
@@ -287,6 +269,7 @@ func (m *SessionManager) shutdown(force bool) {
 	if _gSettingsConfig.needQuickBlackScreen {
 		setDPMSMode(false)
 	}
+	m.setStage(SessionStageEnded)
 	err = m.objLoginSessionSelf.Terminate(0)
 	if err != nil {
 		logger.Warning("failed to terminate session self:", err)
@@ -320,7 +303,9 @@ func (m *SessionManager) reboot(force bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.prepareShutdown(force)
+	if !m.prepareShutdown(force) {
+		return
+	}
 
 	err := m.objLogin.Reboot(0, false)
 	if err != nil {
@@ -330,6 +315,7 @@ func (m *SessionManager) reboot(force bool) {
 	if _gSettingsConfig.needQuickBlackScreen {
 		setDPMSMode(false)
 	}
+	m.setStage(SessionStageEnded)
 	err = m.objLoginSessionSelf.Terminate(0)
 	if err != nil {
 		logger.Warning("failed to terminate session self:", err)
@@ -434,6 +420,15 @@ func (m *SessionManager) setLocked(value bool) {
 	}
 	m.mu.Unlock()
 
+	display.SetSessionLocked(value)
+
+	stage := m.stages.getCurrent()
+	if value && stage == SessionStageRunning {
+		m.setStage(SessionStageLocking)
+	} else if !value && stage == SessionStageLocking {
+		m.setStage(SessionStageRunning)
+	}
+
 	watchdogManager := watchdog.GetManager()
 	if watchdogManager != nil {
 		task := watchdogManager.GetTask("dde-lock")
@@ -608,10 +603,36 @@ func newSessionManager(service *dbusutil.Service) *SessionManager {
 		objLoginSessionSelf: objLoginSessionSelf,
 		powerManager:        powerManager,
 		dbusDaemon:          dbusDaemon,
+		stages:              newStageMachine(),
 	}
+	m.initStageHooks()
 	return m
 }
 
+func (m *SessionManager) initStageHooks() {
+	m.addStageHook(SessionStageCoreEnd, "launch-groups", m.launchDDE)
+	m.addStageHook(SessionStageAppsBegin, "autostart", m.launchAutostart)
+	// 解锁或者取消结束会话时也会回到 Running 阶段，只在第一次进入时恢复
+	var restoreOnce sync.Once
+	m.addStageHook(SessionStageRunning, "session-restore", func() {
+		restoreOnce.Do(func() {
+			go restoreSessionApps()
+		})
+	})
+
+	m.addStageHook(SessionStageEndingQuery, "session-snapshot", snapshotSessionApps)
+	m.addStageHook(SessionStageEndingQuery, "autostop", m.runAutostop)
+	m.addStageHook(SessionStageEndingQuery, "terminate-apps", func() {
+		m.terminateApps(m.endingForce)
+	})
+	// 提示音和 PulseAudio 的处理也是流水线中的阶段，见 misc/end-session.d
+	endsession.RegisterBuiltin("prepare-sound", prepareEndSessionSound)
+	endsession.RegisterBuiltin("play-logout-sound", playLogoutSound)
+	m.addStageHook(SessionStageEnding, "end-session", func() {
+		endsession.Run(m.endingEvent, m.endingForce)
+	})
+}
+
 func (m *SessionManager) init() {
 	m.setPropName("CurrentUid")
 	var err error
@@ -646,6 +667,7 @@ func (manager *SessionManager) listenDBusSignals() {
 				if err != nil {
 					logger.Warning(err)
 				}
+				manager.updateIdleInhibited()
 			}
 		}
 	})
@@ -728,7 +750,6 @@ func (m *SessionManager) launchDDE() {
 }
 
 func (m *SessionManager) launchAutostart() {
-	m.setPropStage(SessionStageAppsBegin)
 	delay := _gSettingsConfig.autoStartDelay
 	logger.Debug("autostart delay seconds:", delay)
 	if delay > 0 {
@@ -738,7 +759,6 @@ func (m *SessionManager) launchAutostart() {
 	} else {
 		startAutostartProgram()
 	}
-	m.setPropStage(SessionStageAppsEnd)
 }
 
 var _envVars = make(map[string]string, 17)
@@ -996,7 +1016,6 @@ func (m *SessionManager) start(xConn *x.Conn, sysSignalLoop *dbusutil.SignalLoop
 	if err != nil {
 		logger.Warning("failed to init qt-theme.ini", err)
 	}
-	m.setPropStage(SessionStageCoreBegin)
 	startStartManager(xConn, service)
 
 	m.startWMSwitcher()
@@ -1008,7 +1027,7 @@ func (m *SessionManager) start(xConn *x.Conn, sysSignalLoop *dbusutil.SignalLoop
 	go startAtSpiService()
 	// start obex.service
 	go startObexService()
-	m.launchDDE()
+	m.setStage(SessionStageCoreEnd)
 
 	go func() {
 		setLeftPtrCursor()
@@ -1018,7 +1037,14 @@ func (m *SessionManager) start(xConn *x.Conn, sysSignalLoop *dbusutil.SignalLoop
 		}
 	}()
 	time.AfterFunc(3*time.Second, _startManager.listenAutostartFileEvents)
-	go m.launchAutostart()
+	go func() {
+		m.setStage(SessionStageAppsBegin)
+		m.setStage(SessionStageAppsEnd)
+		m.setStage(SessionStageRunning)
+		if m.getLocked() {
+			m.setStage(SessionStageLocking)
+		}
+	}()
 	sendMsgToUserExperModule(UserLoginMsg)
 
 	if m.loginSession != nil {
@@ -1160,8 +1186,17 @@ func (m *SessionManager) handleLoginSessionUnlock() {
 	}
 }
 
+// X11 下关闭屏幕由显示模块的屏幕电源策略处理，用户有输入时再打开，
+// 策略没有初始化时才直接设置 DPMS
 func setDPMSMode(on bool) {
 	var err error
+	if !_useWayland && !on {
+		err = display.ForceScreenOff()
+		if err == nil {
+			return
+		}
+		logger.Warning("failed to turn off screen by screen power:", err)
+	}
 	if _useWayland {
 		if !on {
 			_, err = exec.Command("dde_wldpms", "-s", "Off").Output()
@@ -1182,6 +1217,7 @@ func setDPMSMode(on bool) {
 }
 
 func (m *SessionManager) doLogout(force bool) {
+	m.setStage(SessionStageEnded)
 	err := m.objLoginSessionSelf.Terminate(0)
 	if err != nil {
 		logger.Warning("LoginSessionSelf Terminate failed:", err)
@@ -1225,42 +1261,6 @@ func startObexService() {
 	}
 }
 
-func quitAtSpiService() {
-	logger.Debugf("quitting %s...", atSpiService)
-	// mask at-spi-dbus-bus.service
-	out, err := exec.Command("systemctl", "--user", "--runtime", "--now", "mask",
-		atSpiService).CombinedOutput()
-	if err != nil {
-		logger.Warningf("temp mask %s failed err: %v, out: %s", atSpiService, err, out)
-	}
-	// view status
-	err = exec.Command("systemctl", "--quiet", "--user", "is-active",
-		atSpiService).Run()
-	if err == nil {
-		logger.Warningf("%s is still running", atSpiService)
-	} else {
-		logger.Debugf("%s is stopped, err: %v", atSpiService, err)
-	}
-}
-
-func quitObexSevice() {
-	logger.Debugf("quitting %s...", obexService)
-	// mask obex.service
-	out, err := exec.Command("systemctl", "--user", "--runtime", "--now", "mask",
-		obexService).CombinedOutput()
-	if err != nil {
-		logger.Warningf("temp mask %s failed err: %v, out: %s", obexService, err, out)
-	}
-	// view status
-	err = exec.Command("systemctl", "--quiet", "--user", "is-active",
-		obexService).Run()
-	if err == nil {
-		logger.Warningf("%s is still running", obexService)
-	} else {
-		logger.Debugf("%s is stopped, err: %v", obexService, err)
-	}
-}
-
 func getCurSessionPath() (dbus.ObjectPath, error) {
 	var err error
 
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/display"
 	"pkg.deepin.io/lib/dbusutil"
 )
 
@@ -16,6 +17,8 @@ const (
 	signalInhibitorRemoved = "InhibitorRemoved"
 )
 
+const inhibitFlagIdle = 8
+
 //  The flags parameter must include at least one of the following:
 //
 //    1: Inhibit logging out
@@ -44,6 +47,7 @@ func (m *SessionManager) Inhibit(sender dbus.Sender, appId string, toplevelXid u
 	if err != nil {
 		logger.Warning(err)
 	}
+	m.updateIdleInhibited()
 
 	return ih.id, nil
 }
@@ -68,9 +72,15 @@ func (m *SessionManager) Uninhibit(sender dbus.Sender, inhibitCookie uint32) *db
 	if err != nil {
 		logger.Warning(err)
 	}
+	m.updateIdleInhibited()
 	return nil
 }
 
+// 有抑制空闲的程序时，显示模块不调暗也不关闭屏幕
+func (m *SessionManager) updateIdleInhibited() {
+	display.SetIdleInhibited(m.inhibitManager.isInhibited(inhibitFlagIdle))
+}
+
 func (m *SessionManager) GetInhibitors() ([]dbus.ObjectPath, *dbus.Error) {
 	paths := m.inhibitManager.getInhibitorsPaths()
 	return paths, nil
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pkg.deepin.io/dde/startdde/display/configfile"
+	"pkg.deepin.io/lib/strv"
+	"pkg.deepin.io/lib/xdg/basedir"
+)
+
+const (
+	sysSessionRestoreConfigFile = "/usr/share/startdde/session_restore.json"
+
+	defaultSessionRestoreInterval = 500 // ms
+)
+
+// 会话恢复的配置，用户配置优先于系统配置
+type sessionRestoreConfig struct {
+	Enabled bool `json:"enabled"`
+	// 两个应用启动之间的间隔，单位毫秒
+	Interval int `json:"interval"`
+	// 不恢复的应用，可以是 desktop id，也可以是 desktop 文件路径
+	Exclude []string `json:"exclude"`
+}
+
+// 注销时仍在运行的，通过 StartManager 启动的应用
+type sessionApp struct {
+	DesktopFile string   `json:"DesktopFile"`
+	Action      string   `json:"Action,omitempty"`
+	Files       []string `json:"Files,omitempty"`
+}
+
+func (a *sessionApp) equal(other *sessionApp) bool {
+	return a.DesktopFile == other.DesktopFile &&
+		a.Action == other.Action &&
+		strv.Strv(a.Files).Equal(other.Files)
+}
+
+func getUserSessionRestoreConfigFile() string {
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", "session_restore.json")
+}
+
+func getSessionAppsFile() string {
+	return filepath.Join(basedir.GetUserConfigDir(), "deepin", "startdde", "session_apps.json")
+}
+
+func loadSessionRestoreConfig() *sessionRestoreConfig {
+	cfg, err := doLoadSessionRestoreConfig(getUserSessionRestoreConfigFile())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning("failed to load user session restore config:", err)
+		}
+		cfg, err = doLoadSessionRestoreConfig(sysSessionRestoreConfigFile)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logger.Warning("failed to load session restore config:", err)
+			}
+			cfg = &sessionRestoreConfig{}
+		}
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultSessionRestoreInterval
+	}
+	return cfg
+}
+
+func doLoadSessionRestoreConfig(filename string) (*sessionRestoreConfig, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg sessionRestoreConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+func (cfg *sessionRestoreConfig) isExcluded(desktopFile string) bool {
+	id := strings.TrimSuffix(filepath.Base(desktopFile), ".desktop")
+	for _, item := range cfg.Exclude {
+		if item == desktopFile || item == id || item == id+".desktop" {
+			return true
+		}
+	}
+	return false
+}
+
+func loadSessionApps(filename string) ([]*sessionApp, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var apps []*sessionApp
+	err = json.Unmarshal(content, &apps)
+	if err != nil {
+		return nil, err
+	}
+	return apps, nil
+}
+
+func saveSessionApps(filename string, apps []*sessionApp) error {
+	content, err := json.Marshal(apps)
+	if err != nil {
+		return err
+	}
+	return configfile.WriteFileAtomic(filename, content, 0644, 0)
+}
+
+// 过滤掉需要排除的应用，并去掉重复项
+func filterSessionApps(apps []*sessionApp, cfg *sessionRestoreConfig) []*sessionApp {
+	var result []*sessionApp
+loop:
+	for _, app := range apps {
+		if cfg.isExcluded(app.DesktopFile) {
+			continue
+		}
+		for _, app0 := range result {
+			if app0.equal(app) {
+				continue loop
+			}
+		}
+		result = append(result, app)
+	}
+	return result
+}
+
+// 注销前保存仍在运行的应用，启动的进程已经退出但 fork 出的进程仍在运行的应用也会保存，
+// 跟踪的方式见 runningApp
+func snapshotSessionApps() {
+	if _startManager == nil {
+		return
+	}
+	cfg := loadSessionRestoreConfig()
+	if !cfg.Enabled {
+		return
+	}
+
+	var apps []*sessionApp
+	for _, app := range _startManager.getRunningApps() {
+		apps = append(apps, app.info)
+	}
+	apps = filterSessionApps(apps, cfg)
+	logger.Infof("save %d session apps", len(apps))
+	err := saveSessionApps(getSessionAppsFile(), apps)
+	if err != nil {
+		logger.Warning("failed to save session apps:", err)
+	}
+}
+
+// 在 SessionStageAppsEnd 之后，逐个启动上次会话中的应用
+func restoreSessionApps() {
+	filename := getSessionAppsFile()
+	apps, err := loadSessionApps(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning("failed to load session apps:", err)
+		}
+		return
+	}
+	// 只恢复一次，避免某个应用导致会话崩溃后反复恢复
+	err = os.Remove(filename)
+	if err != nil {
+		logger.Warning(err)
+	}
+
+	cfg := loadSessionRestoreConfig()
+	if !cfg.Enabled {
+		return
+	}
+
+	interval := time.Duration(cfg.Interval) * time.Millisecond
+	for _, app := range filterSessionApps(apps, cfg) {
+		if !Exist(app.DesktopFile) {
+			continue
+		}
+		// 自启动的应用已经被启动过了
+		if _startManager.isAutostart(app.DesktopFile) {
+			continue
+		}
+
+		logger.Debugf("restore session app %q action: %q files: %v",
+			app.DesktopFile, app.Action, app.Files)
+		if app.Action != "" {
+			err = _startManager.launchAppAction(app.DesktopFile, app.Action, 0)
+		} else {
+			err = _startManager.launchAppWithOptions(app.DesktopFile, 0, app.Files, nil)
+		}
+		if err != nil {
+			logger.Warningf("failed to restore app %q: %v", app.DesktopFile, err)
+		}
+		time.Sleep(interval)
+	}
+}
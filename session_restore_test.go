@@ -0,0 +1,46 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_filterSessionApps(t *testing.T) {
+	cfg := &sessionRestoreConfig{
+		Exclude: []string{"dde-control-center", "/usr/share/applications/deepin-terminal.desktop"},
+	}
+	apps := []*sessionApp{
+		{DesktopFile: "/usr/share/applications/dde-file-manager.desktop", Files: []string{"/tmp"}},
+		{DesktopFile: "/usr/share/applications/dde-control-center.desktop"},
+		{DesktopFile: "/usr/share/applications/deepin-terminal.desktop"},
+		{DesktopFile: "/usr/share/applications/dde-file-manager.desktop", Files: []string{"/tmp"}},
+		{DesktopFile: "/usr/share/applications/dde-file-manager.desktop"},
+		{DesktopFile: "/usr/share/applications/google-chrome.desktop", Action: "new-private-window"},
+	}
+
+	result := filterSessionApps(apps, cfg)
+	assert.Equal(t, []*sessionApp{apps[0], apps[4], apps[5]}, result)
+}
+
+func Test_saveSessionApps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "startdde-session-restore")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "startdde", "session_apps.json")
+	apps := []*sessionApp{
+		{DesktopFile: "/usr/share/applications/dde-file-manager.desktop", Files: []string{"/tmp"}},
+		{DesktopFile: "/usr/share/applications/google-chrome.desktop", Action: "new-private-window"},
+	}
+	err = saveSessionApps(filename, apps)
+	require.Nil(t, err)
+
+	result, err := loadSessionApps(filename)
+	require.Nil(t, err)
+	assert.Equal(t, apps, result)
+}
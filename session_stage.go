@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// 会话阶段状态机
+//
+//	InitBegin -> InitEnd -> CoreBegin -> CoreEnd -> AppsBegin -> AppsEnd -> Running
+//
+//	Running <-> Locking
+//	Running, Locking -> EndingQuery -> Ending -> Ended
+//	EndingQuery -> Running, Locking
+//
+// 在会话完全启动之前也可以请求结束会话，所以 Ending 之前的任何阶段都可以进入 EndingQuery，
+// 而任何阶段都可以进入 Ended。
+// 在 EndingQuery 阶段可以用 CancelEndSession 取消结束会话，按当前是否锁屏回到 Running 或 Locking 阶段。
+//
+// 为了兼容，Stage 属性和以前一样最大为 SessionStageAppsEnd，会话启动完成之后保持不变；
+// CurrentStage 属性和 StageChanged 信号使用下面所有的阶段。
+const (
+	SessionStageInitBegin int32 = iota
+	SessionStageInitEnd
+	SessionStageCoreBegin
+	SessionStageCoreEnd
+	SessionStageAppsBegin
+	SessionStageAppsEnd
+	SessionStageRunning
+	SessionStageLocking
+	SessionStageEndingQuery
+	SessionStageEnding
+	SessionStageEnded
+)
+
+const signalStageChanged = "StageChanged"
+
+var stageNames = map[int32]string{
+	SessionStageInitBegin:   "init-begin",
+	SessionStageInitEnd:     "init-end",
+	SessionStageCoreBegin:   "core-begin",
+	SessionStageCoreEnd:     "core-end",
+	SessionStageAppsBegin:   "apps-begin",
+	SessionStageAppsEnd:     "apps-end",
+	SessionStageRunning:     "running",
+	SessionStageLocking:     "locking",
+	SessionStageEndingQuery: "ending-query",
+	SessionStageEnding:      "ending",
+	SessionStageEnded:       "ended",
+}
+
+func stageName(stage int32) string {
+	name, ok := stageNames[stage]
+	if !ok {
+		return fmt.Sprintf("unknown(%d)", stage)
+	}
+	return name
+}
+
+func canTransitStage(from, to int32) bool {
+	switch to {
+	case SessionStageEnded:
+		return from != SessionStageEnded
+	case SessionStageEndingQuery:
+		return from < SessionStageEndingQuery
+	case SessionStageRunning:
+		return from == SessionStageAppsEnd || from == SessionStageLocking ||
+			from == SessionStageEndingQuery
+	case SessionStageLocking:
+		return from == SessionStageRunning || from == SessionStageEndingQuery
+	case SessionStageEnding:
+		return from == SessionStageEndingQuery
+	}
+	// 启动过程中的阶段只能按顺序前进
+	return to == from+1 && to <= SessionStageAppsEnd
+}
+
+type stageHook struct {
+	name string
+	fn   func()
+}
+
+type stageMachine struct {
+	mu      sync.Mutex
+	current int32
+	// 进入 EndingQuery 之前的阶段，取消结束会话时回到这个阶段
+	beforeEnding int32
+	timestamps   map[int32]time.Time
+	hooks        map[int32][]stageHook
+}
+
+func newStageMachine() *stageMachine {
+	return &stageMachine{
+		current: SessionStageInitBegin,
+		timestamps: map[int32]time.Time{
+			SessionStageInitBegin: time.Now(),
+		},
+		hooks: make(map[int32][]stageHook),
+	}
+}
+
+func (sm *stageMachine) getCurrent() int32 {
+	sm.mu.Lock()
+	v := sm.current
+	sm.mu.Unlock()
+	return v
+}
+
+func (sm *stageMachine) addHook(stage int32, name string, fn func()) {
+	sm.mu.Lock()
+	sm.hooks[stage] = append(sm.hooks[stage], stageHook{name: name, fn: fn})
+	sm.mu.Unlock()
+}
+
+// transit 切换到阶段 to，返回切换之前的阶段以及 to 阶段的 hook
+func (sm *stageMachine) transit(to int32) (int32, []stageHook, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	from := sm.current
+	if !canTransitStage(from, to) {
+		return from, nil, fmt.Errorf("illegal stage transition %s -> %s",
+			stageName(from), stageName(to))
+	}
+	if to == SessionStageEndingQuery {
+		sm.beforeEnding = from
+	}
+	sm.current = to
+	sm.timestamps[to] = time.Now()
+
+	hooks := make([]stageHook, len(sm.hooks[to]))
+	copy(hooks, sm.hooks[to])
+	return from, hooks, nil
+}
+
+func (sm *stageMachine) getBeforeEnding() int32 {
+	sm.mu.Lock()
+	v := sm.beforeEnding
+	sm.mu.Unlock()
+	return v
+}
+
+// 返回每个阶段最近一次进入时的时间，单位微秒
+func (sm *stageMachine) getTimestamps() map[int32]int64 {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	result := make(map[int32]int64, len(sm.timestamps))
+	for stage, t := range sm.timestamps {
+		result[stage] = t.UnixNano() / int64(time.Microsecond)
+	}
+	return result
+}
+
+// addStageHook 注册进入 stage 阶段时要执行的函数，按注册顺序同步执行
+func (m *SessionManager) addStageHook(stage int32, name string, fn func()) {
+	m.stages.addHook(stage, name, fn)
+}
+
+// 返回 Stage 属性的值
+func compatStage(stage int32) int32 {
+	if stage > SessionStageAppsEnd {
+		return SessionStageAppsEnd
+	}
+	return stage
+}
+
+func (m *SessionManager) setStage(stage int32) {
+	err := m.transitStage(stage)
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
+// transitStage 切换阶段并执行 hook，hook 中切换到了其他阶段时不再执行剩下的 hook
+func (m *SessionManager) transitStage(stage int32) error {
+	from, hooks, err := m.stages.transit(stage)
+	if err != nil {
+		return err
+	}
+	logger.Infof("session stage %s -> %s", stageName(from), stageName(stage))
+
+	m.setPropStage(compatStage(stage))
+	m.setPropCurrentStage(stage)
+	err = m.service.Emit(m, signalStageChanged, from, stage)
+	if err != nil {
+		logger.Warning(err)
+	}
+
+	for _, hook := range hooks {
+		t0 := time.Now()
+		hook.fn()
+		logger.Debugf("stage %s hook %s cost %v", stageName(stage), hook.name, time.Since(t0))
+		if m.stages.getCurrent() != stage {
+			logger.Infof("stage %s is left in hook %s", stageName(stage), hook.name)
+			break
+		}
+	}
+	return nil
+}
+
+// 取消结束会话，回到进入 EndingQuery 之前的阶段。
+// 已经收到 SIGTERM 或者关闭窗口的请求的应用不能恢复，之后退出的应用会被正常地自动重启。
+// 返回取消结束会话后切换到的阶段。
+// EndingQuery 期间锁屏或解锁不会切换阶段，所以按当前是否锁屏决定，而不是直接回到之前的阶段。
+func getCancelStage(beforeEnding int32, locked bool) (int32, error) {
+	if beforeEnding != SessionStageRunning && beforeEnding != SessionStageLocking {
+		return 0, fmt.Errorf("can not cancel ending session started in stage %s", stageName(beforeEnding))
+	}
+	if locked {
+		return SessionStageLocking, nil
+	}
+	return SessionStageRunning, nil
+}
+
+func (m *SessionManager) cancelEndSession() error {
+	m.mu.Lock()
+	locked := m.Locked
+	m.mu.Unlock()
+	to, err := getCancelStage(m.stages.getBeforeEnding(), locked)
+	if err != nil {
+		return err
+	}
+	// 只能从 EndingQuery 切换到 Running 或 Locking，进入 Ending 之后会失败
+	err = m.transitStage(to)
+	if err != nil {
+		return err
+	}
+	if _startManager != nil {
+		_startManager.setShuttingDown(false)
+	}
+	return nil
+}
+
+func (m *SessionManager) CancelEndSession() *dbus.Error {
+	logger.Info("CancelEndSession")
+	err := m.cancelEndSession()
+	return dbusutil.ToError(err)
+}
+
+func (m *SessionManager) GetStageTimestamps() (map[int32]int64, *dbus.Error) {
+	return m.stages.getTimestamps(), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_canTransitStage(t *testing.T) {
+	tests := []struct {
+		from, to int32
+		want     bool
+	}{
+		{SessionStageInitBegin, SessionStageInitEnd, true},
+		{SessionStageInitBegin, SessionStageCoreBegin, false},
+		{SessionStageCoreEnd, SessionStageAppsBegin, true},
+		{SessionStageAppsEnd, SessionStageRunning, true},
+		{SessionStageAppsBegin, SessionStageRunning, false},
+		{SessionStageRunning, SessionStageLocking, true},
+		{SessionStageLocking, SessionStageRunning, true},
+		{SessionStageAppsEnd, SessionStageLocking, false},
+		{SessionStageCoreBegin, SessionStageEndingQuery, true},
+		{SessionStageLocking, SessionStageEndingQuery, true},
+		{SessionStageEnding, SessionStageEndingQuery, false},
+		{SessionStageRunning, SessionStageEnding, false},
+		{SessionStageEndingQuery, SessionStageEnding, true},
+		{SessionStageEndingQuery, SessionStageRunning, true},
+		{SessionStageEndingQuery, SessionStageLocking, true},
+		{SessionStageEnding, SessionStageRunning, false},
+		{SessionStageRunning, SessionStageEnded, true},
+		{SessionStageEnded, SessionStageEnded, false},
+		{SessionStageEnded, SessionStageRunning, false},
+	}
+	for _, tt := range tests {
+		got := canTransitStage(tt.from, tt.to)
+		assert.Equal(t, tt.want, got, "%s -> %s", stageName(tt.from), stageName(tt.to))
+	}
+}
+
+func Test_stageMachine(t *testing.T) {
+	sm := newStageMachine()
+	var called []string
+	sm.addHook(SessionStageInitEnd, "a", func() { called = append(called, "a") })
+	sm.addHook(SessionStageInitEnd, "b", func() { called = append(called, "b") })
+
+	from, hooks, err := sm.transit(SessionStageInitEnd)
+	assert.Nil(t, err)
+	assert.Equal(t, SessionStageInitBegin, from)
+	for _, hook := range hooks {
+		hook.fn()
+	}
+	assert.Equal(t, []string{"a", "b"}, called)
+	assert.Equal(t, SessionStageInitEnd, sm.getCurrent())
+
+	_, hooks, err = sm.transit(SessionStageRunning)
+	assert.NotNil(t, err)
+	assert.Nil(t, hooks)
+	assert.Equal(t, SessionStageInitEnd, sm.getCurrent())
+
+	timestamps := sm.getTimestamps()
+	assert.Len(t, timestamps, 2)
+	assert.True(t, timestamps[SessionStageInitEnd] >= timestamps[SessionStageInitBegin])
+}
+
+func Test_stageMachine_beforeEnding(t *testing.T) {
+	sm := newStageMachine()
+	for stage := SessionStageInitEnd; stage <= SessionStageLocking; stage++ {
+		_, _, err := sm.transit(stage)
+		assert.Nil(t, err)
+	}
+	_, _, err := sm.transit(SessionStageEndingQuery)
+	assert.Nil(t, err)
+	assert.Equal(t, SessionStageLocking, sm.getBeforeEnding())
+
+	// 取消之后回到之前的阶段
+	_, _, err = sm.transit(sm.getBeforeEnding())
+	assert.Nil(t, err)
+	assert.Equal(t, SessionStageLocking, sm.getCurrent())
+}
+
+func Test_getCancelStage(t *testing.T) {
+	stage, err := getCancelStage(SessionStageRunning, false)
+	assert.Nil(t, err)
+	assert.Equal(t, SessionStageRunning, stage)
+
+	// 结束会话期间锁屏了
+	stage, err = getCancelStage(SessionStageRunning, true)
+	assert.Nil(t, err)
+	assert.Equal(t, SessionStageLocking, stage)
+
+	// 结束会话期间解锁了
+	stage, err = getCancelStage(SessionStageLocking, false)
+	assert.Nil(t, err)
+	assert.Equal(t, SessionStageRunning, stage)
+
+	_, err = getCancelStage(SessionStageAppsEnd, false)
+	assert.NotNil(t, err)
+}
+
+func Test_compatStage(t *testing.T) {
+	assert.Equal(t, SessionStageCoreEnd, compatStage(SessionStageCoreEnd))
+	assert.Equal(t, SessionStageAppsEnd, compatStage(SessionStageAppsEnd))
+	assert.Equal(t, SessionStageAppsEnd, compatStage(SessionStageRunning))
+	assert.Equal(t, SessionStageAppsEnd, compatStage(SessionStageEnded))
+}
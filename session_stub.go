@@ -45,6 +45,16 @@ func (op *SessionManager) setPropName(name string) {
 	}
 }
 
+func (m *SessionManager) setPropCurrentStage(v int32) {
+	if m.CurrentStage != v {
+		m.CurrentStage = v
+		err := m.service.EmitPropertyChanged(m, "CurrentStage", v)
+		if err != nil {
+			logger.Warning(err)
+		}
+	}
+}
+
 func (m *SessionManager) setPropStage(v int32) {
 	if m.Stage != v {
 		m.Stage = v
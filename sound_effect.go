@@ -20,6 +20,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -30,6 +31,7 @@ import (
 
 	"github.com/linuxdeepin/go-dbus-factory/com.deepin.api.soundthemeplayer"
 	"pkg.deepin.io/dde/api/soundutils"
+	"pkg.deepin.io/dde/startdde/endsession"
 	dbus1 "github.com/godbus/dbus"
 	"pkg.deepin.io/lib/pulse"
 )
@@ -105,26 +107,41 @@ func getDefaultSinkAlsaDevice() (device string, mute bool, err error) {
 	return
 }
 
-func playLogoutSound() {
+// 注销的提示音在 PulseAudio 退出之后直接通过 ALSA 设备播放，
+// 退出之前由 prepare-sound 阶段记录设备，为空时不播放
+var logoutSoundDevice string
+
+// 会话结束流水线中的 prepare-sound 阶段，需要在 PulseAudio 退出之前执行
+func prepareEndSessionSound(ctx context.Context, event string) error {
+	if event == endsession.EventShutdown {
+		preparePlayShutdownSound()
+		return nil
+	}
+
+	logoutSoundDevice = ""
+	if !soundutils.CanPlayEvent(soundutils.EventDesktopLogout) {
+		return nil
+	}
 	device, mute, err := getDefaultSinkAlsaDevice()
 	if err != nil {
-		logger.Warning(err)
-		quitPulseAudio()
-		return
+		return err
 	}
-
 	if mute {
 		logger.Debug("default sink is mute")
-		quitPulseAudio()
-		return
+		return nil
 	}
 	logger.Debugf("ALSA device: %q", device)
-	quitPulseAudio()
-	err = soundThemePlayer.Play(0, soundutils.GetSoundTheme(),
-		soundutils.EventDesktopLogout, device)
-	if err != nil {
-		logger.Warning("SoundThemePlayer.Play err:", err)
+	logoutSoundDevice = device
+	return nil
+}
+
+// 会话结束流水线中的 play-logout-sound 阶段，在 PulseAudio 退出之后执行
+func playLogoutSound(ctx context.Context, event string) error {
+	if logoutSoundDevice == "" || soundThemePlayer == nil {
+		return nil
 	}
+	return soundThemePlayer.Play(0, soundutils.GetSoundTheme(),
+		soundutils.EventDesktopLogout, logoutSoundDevice)
 }
 
 func initSoundThemePlayer() {
@@ -136,12 +153,6 @@ func initSoundThemePlayer() {
 	soundThemePlayer = soundthemeplayer.NewSoundThemePlayer(sysBus)
 }
 
-const (
-	audioInterface   = "com.deepin.daemon.Audio"
-	audioServiceName = audioInterface
-	audioPath        = "/com/deepin/daemon/Audio"
-)
-
 func startPulseAudio() error {
 	err := exec.Command("systemctl", "--user", "--runtime", "unmask", "pulseaudio.service").Run()
 	if err != nil {
@@ -155,37 +166,6 @@ func startPulseAudio() error {
 	return nil
 }
 
-func quitPulseAudio() {
-	logger.Debug("quit pulse audio")
-
-	sessionBus, err := dbus1.SessionBus()
-	if err != nil {
-		logger.Warning("failed to get session bus:", err)
-	} else {
-		audioObj := sessionBus.Object(audioServiceName, audioPath)
-		err = audioObj.Call(audioInterface+".NoRestartPulseAudio", dbus1.FlagNoAutoStart).Err
-		if err != nil {
-			logger.Warning("failed to call NoRestartPulseAudio:", err)
-		}
-	}
-
-	// mask pulseaudio.service
-	out, err := exec.Command("systemctl", "--user", "--runtime", "--now", "mask",
-		"pulseaudio.service").CombinedOutput()
-	if err != nil {
-		logger.Warningf("temp mask pulseaudio.service failed err: %v, out: %s", err, out)
-	}
-
-	// view status
-	err = exec.Command("systemctl", "--quiet", "--user", "is-active",
-		"pulseaudio.service").Run()
-	if err == nil {
-		logger.Warning("pulseaudio.service is still running")
-	} else {
-		logger.Debug("pulseaudio.service is stopped, err:", err)
-	}
-}
-
 func preparePlayShutdownSound() {
 	canPlay := soundutils.CanPlayEvent(soundutils.EventSystemShutdown)
 	var device string
@@ -85,6 +85,7 @@ type StartManager struct {
 	restartTimeMapMu    sync.Mutex
 	proxyChainsConfFile string
 	proxyChainsBin      string
+	setsidBin           string // 用 setsid 启动应用，让应用成为新的进程组的组长，为空时不使用
 	appsDir             []string
 	settings            *gio.Settings
 	appsUseProxy        strv.Strv
@@ -92,6 +93,9 @@ type StartManager struct {
 	mu                  sync.Mutex
 	appClose            chan *UeMessageItem
 	launchedHooks       []string
+	runningApps         map[*exec.Cmd]*runningApp
+	runningAppsMu       sync.Mutex
+	shuttingDown        bool // 正在注销，退出的应用不再自动重启，由 runningAppsMu 保护
 
 	NeededMemory     uint64
 	systemPower      *systemPower.Power
@@ -236,7 +240,13 @@ func newStartManager(xConn *x.Conn, service *dbusutil.Service) *StartManager {
 	m.proxyChainsBin, _ = exec.LookPath(proxychainsBinary)
 	logger.Debugf("startManager proxychain confFile %q, bin: %q", m.proxyChainsConfFile, m.proxyChainsBin)
 
+	m.setsidBin, err = exec.LookPath("setsid")
+	if err != nil {
+		logger.Warning("setsid not found, forked apps can not be tracked:", err)
+	}
+
 	m.restartTimeMap = make(map[string]time.Time)
+	m.runningApps = make(map[*exec.Cmd]*runningApp)
 	m.launchedHooks = getLaunchedHooks(launchedHookDir)
 	m.delayHandler = newMapDelayHandler(100*time.Millisecond,
 		m.emitSignalAutostartChanged)
@@ -600,6 +610,12 @@ func (m *StartManager) launch(appInfo *desktopappinfo.DesktopAppInfo, timestamp
 		}
 	}
 
+	// 应用 fork 出的进程和它在同一个进程组中，启动的进程退出后仍然可以找到它们
+	useSetsid := !isDEComponent(appInfo) && m.setsidBin != ""
+	if useSetsid {
+		cmdPrefixes = append([]string{m.setsidBin}, cmdPrefixes...)
+	}
+
 	ctx := appinfo.NewAppLaunchContext(m.xConn)
 	ctx.SetTimestamp(timestamp)
 	if len(cmdPrefixes) > 0 {
@@ -611,6 +627,26 @@ func (m *StartManager) launch(appInfo *desktopappinfo.DesktopAppInfo, timestamp
 		ctx.SetCmdSuffixes(cmdSuffixes)
 	}
 	cmd, err := iStartCmd.StartCommand(files, ctx)
+	if err == nil && !isDEComponent(appInfo) {
+		info := &sessionApp{
+			DesktopFile: desktopFile,
+			Files:       files,
+		}
+		if action, ok := iStartCmd.(*desktopappinfo.DesktopAction); ok {
+			info.Action = action.Section
+		}
+		app := &runningApp{
+			cmd:        cmd,
+			uiApp:      uiApp,
+			launchTime: time.Now(),
+			info:       info,
+		}
+		// setsid 在 exec 之前调用 setsid()，进程号不变，这时可能还没有调用
+		if useSetsid {
+			app.pgid = cmd.Process.Pid
+		}
+		m.addRunningApp(app)
+	}
 
 	// exec launched hooks
 	cGroupName := ""
@@ -725,6 +761,7 @@ func (m *StartManager) waitCmd(appInfo *desktopappinfo.DesktopAppInfo, cmd *exec
 
 	go func() {
 		err := cmd.Wait()
+		m.removeRunningApp(cmd)
 
 		// send app close info to ue module
 		// we did not care the program exit normal or not
@@ -738,7 +775,9 @@ func (m *StartManager) waitCmd(appInfo *desktopappinfo.DesktopAppInfo, cmd *exec
 
 			if appInfo != nil {
 				autoRestart, _ := appInfo.GetBool(desktopappinfo.MainSection, KeyXGnomeAutoRestart)
-				if autoRestart {
+				if autoRestart && m.isShuttingDown() {
+					logger.Infof("session is ending, do not restart app %q", appInfo.GetFileName())
+				} else if autoRestart {
 					now := time.Now()
 
 					canLaunch := true
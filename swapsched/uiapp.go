@@ -35,6 +35,11 @@ func (app *UIApp) GetCGroup() string {
 	return app.cg.Name()
 }
 
+// GetProcs 返回 cgroup 中所有进程的 pid
+func (app *UIApp) GetProcs() ([]int, error) {
+	return app.cg.GetProcs(cgroup.Memory)
+}
+
 func (app *UIApp) HasChild(pid int) bool {
 	for _, pid0 := range app.pids {
 		if pid0 == pid {
@@ -20,32 +20,45 @@
 package display
 
 import (
-	"encoding/json"
-	"fmt"
 	"math"
 	"os"
 	"path/filepath"
 
+	"pkg.deepin.io/dde/startdde/display/core"
 	"pkg.deepin.io/dde/startdde/wl_display/brightness"
 )
 
-type InvalidOutputNameError struct {
-	Name string
+type InvalidOutputNameError = core.InvalidOutputNameError
+
+type brightnessBackend struct {
+	m *Manager
 }
 
-func (err InvalidOutputNameError) Error() string {
-	return fmt.Sprintf("invalid output name %q", err.Name)
+func (b brightnessBackend) OutputEnabled(name string) (enabled, ok bool) {
+	monitor := b.m.getConnectedMonitors().GetByName(name)
+	if monitor == nil {
+		return false, false
+	}
+	monitor.PropsMu.RLock()
+	enabled = monitor.Enabled
+	monitor.PropsMu.RUnlock()
+	return enabled, true
 }
 
-func (m *Manager) saveBrightness() {
-	if m.settings == nil || m.settings.C == nil || m.settings.Object.C == nil {
-		logger.Info("[saveBrightness] object invalid, not save...")
-		return
+func (b brightnessBackend) SetOutputBrightness(name string, value float64) error {
+	monitor := b.m.getConnectedMonitors().GetByName(name)
+	if monitor == nil {
+		return InvalidOutputNameError{Name: name}
 	}
+	err := b.m.setMonitorBrightness(monitor, value)
+	if err != nil {
+		logger.Warningf("failed to set brightness for %s: %v", name, err)
+	}
+	return err
+}
 
-	jsonStr := jsonMarshal(m.Brightness)
-	logger.Info("[saveBrightness] gsettings set:", m.settings, gsKeyBrightness, jsonStr)
-	m.settings.SetString(gsKeyBrightness, jsonStr)
+func (m *Manager) saveBrightness() {
+	m.brightness.SaveAll()
 }
 
 func (m *Manager) changeBrightness(raised bool) error {
@@ -64,7 +77,7 @@ func (m *Manager) changeBrightness(raised bool) error {
 	monitors := m.getConnectedMonitors()
 
 	for _, monitor := range monitors {
-		v, ok := m.Brightness[monitor.Name]
+		v, ok := m.brightness.Get(monitor.Name)
 		if !ok {
 			v = 1.0
 		}
@@ -101,13 +114,13 @@ func (m *Manager) changeBrightness(raised bool) error {
 				br = 0.1
 			}
 			logger.Debug("[changeBrightness] will set to:", monitor.Name, br)
-			err := m.doSetBrightness(br, monitor.Name)
+			err := m.brightness.Set(monitor.Name, br)
 			if err != nil {
 				return err
 			}
 		} else {
 			logger.Debug("[changeBrightness] will update to:", monitor.Name, br)
-			err := m.doSetBrightnessFake(br, monitor.Name)
+			err := m.brightness.SetFake(monitor.Name, br)
 			if err != nil {
 				return err
 			}
@@ -118,54 +131,41 @@ func (m *Manager) changeBrightness(raised bool) error {
 	return nil
 }
 
-func (m *Manager) getSavedBrightnessTable() (map[string]float64, error) {
-	value := m.settings.GetString(gsKeyBrightness)
-	if value == "" {
-		return nil, nil
-	}
-	var result map[string]float64
-	err := json.Unmarshal([]byte(value), &result)
-	if err != nil {
-		return nil, err
-	}
-	return result, nil
-}
-
+// 第一次调用时读取保存的亮度，之后在输出设备连接时调用，设置已连接的输出设备的亮度
 func (m *Manager) initBrightness() {
-	brightnessTable, err := m.getSavedBrightnessTable()
-	if err != nil {
-		logger.Warning(err)
-	}
-	if brightnessTable == nil {
-		brightnessTable = make(map[string]float64)
-	}
-
-	var saved = false
-	monitors := m.getConnectedMonitors()
-	for _, monitor := range monitors {
-		_, ok := brightnessTable[monitor.Name]
-		if !ok {
-			// add new monitor
-			brightnessTable[monitor.Name] = 1
-			saved = true
+	if m.brightness == nil {
+		brightnessTable, err := core.ParseBrightnessTable(m.settings.GetString(gsKeyBrightness))
+		if err != nil {
+			logger.Warning(err)
+		}
+		m.brightness = core.NewBrightness(brightnessBackend{m: m}, brightnessTable)
+		m.brightness.Changed = func(values map[string]float64) {
+			m.PropsMu.Lock()
+			m.setPropBrightness(values)
+			m.PropsMu.Unlock()
+		}
+		m.brightness.Save = func(values map[string]float64) {
+			if m.settings == nil || m.settings.C == nil || m.settings.Object.C == nil {
+				logger.Info("[saveBrightness] object invalid, not save...")
+				return
+			}
+			jsonStr := core.MarshalBrightnessTable(values)
+			logger.Info("[saveBrightness] gsettings set:", m.settings, gsKeyBrightness, jsonStr)
+			m.settings.SetString(gsKeyBrightness, jsonStr)
 		}
+		m.Brightness = m.brightness.Values()
 	}
 
-	m.Brightness = brightnessTable
-	for name, v := range brightnessTable {
-		// set the saved brightness
-		err = m.doSetBrightness(v, name)
+	// 新的输出设备使用最高亮度
+	// In huawei KelvinU sometimes crash because of GObject assert failure in GSettings,
+	// so the default brightness is not saved here.
+	for _, monitor := range m.getConnectedMonitors() {
+		value := m.brightness.GetOrInit(monitor.Name, 1)
+		err := m.brightness.Set(monitor.Name, value)
 		if err != nil {
-			logger.Warning("Failed to set default brightness:", name, err)
-			continue
+			logger.Warning("Failed to set default brightness:", monitor.Name, err)
 		}
 	}
-
-	if saved {
-		logger.Info("Init default output brightness")
-		// In huawei KelvinU sometimes crash because of GObject assert failure in GSettings
-		//m.saveBrightness()
-	}
 }
 
 func (m *Manager) getBrightnessSetter() string {
@@ -190,45 +190,3 @@ func (m *Manager) setMonitorBrightness(monitor *Monitor, value float64) error {
 	// TODO
 	//return errors.New("TODO")
 }
-
-func (m *Manager) doSetBrightnessAux(fake bool, value float64, name string) error {
-	monitors := m.getConnectedMonitors()
-	monitor0 := monitors.GetByName(name)
-	if monitor0 == nil {
-		return InvalidOutputNameError{Name: name}
-	}
-
-	monitor0.PropsMu.RLock()
-	enabled := monitor0.Enabled
-	monitor0.PropsMu.RUnlock()
-
-	if !fake && enabled {
-		err := m.setMonitorBrightness(monitor0, value)
-		if err != nil {
-			logger.Warningf("failed to set brightness for %s: %v", name, err)
-			return err
-		}
-	}
-
-	oldValue := m.Brightness[name]
-	if oldValue == value {
-		return nil
-	}
-
-	// update brightness of the output
-	m.Brightness[name] = value
-	err := m.emitPropChangedBrightness(m.Brightness)
-	if err != nil {
-		logger.Warning(err)
-	}
-
-	return nil
-}
-
-func (m *Manager) doSetBrightness(value float64, name string) error {
-	return m.doSetBrightnessAux(false, value, name)
-}
-
-func (m *Manager) doSetBrightnessFake(value float64, name string) error {
-	return m.doSetBrightnessAux(true, value, name)
-}
@@ -130,6 +130,19 @@ func (v *Manager) emitPropChangedScreenHeight(value uint16) error {
 	return v.service.EmitPropertyChanged(v, "ScreenHeight", value)
 }
 
+func (v *Manager) setPropLidClosePolicy(value byte) (changed bool) {
+	if v.LidClosePolicy != value {
+		v.LidClosePolicy = value
+		v.emitPropChangedLidClosePolicy(value)
+		return true
+	}
+	return false
+}
+
+func (v *Manager) emitPropChangedLidClosePolicy(value byte) error {
+	return v.service.EmitPropertyChanged(v, "LidClosePolicy", value)
+}
+
 func (v *Monitor) setPropID(value uint32) (changed bool) {
 	if v.ID != value {
 		v.ID = value
@@ -0,0 +1,104 @@
+package display
+
+import (
+	"encoding/json"
+	"errors"
+
+	dbus "github.com/godbus/dbus"
+	"pkg.deepin.io/dde/startdde/display/core"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// 给 display-layout 命令使用，读取和应用整个布局
+
+// 应用的布局以这个名称保存为当前显示器组合的自定义模式，以后再连接同样的显示器时直接使用
+const layoutFileCustomId = "display-layout"
+
+func (m *Manager) getLayoutFile() (*core.LayoutFile, error) {
+	outputs, err := m.backend.ListOutputs()
+	if err != nil {
+		return nil, err
+	}
+	m.PropsMu.RLock()
+	primary := m.Primary
+	m.PropsMu.RUnlock()
+	return core.CurrentLayoutFile(outputs, primary), nil
+}
+
+// applyLayoutFile 检查并应用布局，返回应用之后的布局。
+// 要么全部成功，要么恢复到应用之前的状态；dryRun 为 true 时只检查，不应用。
+func (m *Manager) applyLayoutFile(f *core.LayoutFile, dryRun bool) (*core.LayoutFile, error) {
+	outputs, err := m.backend.ListOutputs()
+	if err != nil {
+		return nil, err
+	}
+	layout, err := f.Resolve(outputs)
+	if err != nil {
+		return nil, err
+	}
+	result := layout.ToLayoutFile(outputs)
+	if dryRun {
+		return result, nil
+	}
+	if m.HasChanged {
+		return nil, errors.New("has unsaved changes")
+	}
+
+	logger.Debug("apply layout file")
+	err = m.backend.ApplyLayout(layout)
+	if err != nil {
+		return nil, err
+	}
+	monitors := m.getConnectedMonitors()
+	if len(monitors) == 1 {
+		err = m.save()
+	} else {
+		err = m.saveCustomMode(layoutFileCustomId, toMonitorConfigs(monitors, m.Primary))
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.lidController.HandleLayoutChanged(true)
+	return result, nil
+}
+
+func (m *Manager) saveCustomMode(name string, configs []*MonitorConfig) error {
+	screenCfg := m.getScreenConfig()
+	screenCfg.SetMonitorConfigs(DisplayModeCustom, name, configs)
+	err := m.saveConfig()
+	if err != nil {
+		return err
+	}
+	m.setPropCustomIdList(m.getCustomIdList())
+	m.setCurrentCustomId(name)
+	m.setDisplayMode(DisplayModeCustom)
+	return nil
+}
+
+func (m *Manager) GetLayout() (string, *dbus.Error) {
+	f, err := m.getLayoutFile()
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
+
+func (m *Manager) ApplyLayout(layout string, dryRun bool) (string, *dbus.Error) {
+	f, err := core.ParseLayoutFile([]byte(layout))
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	result, err := m.applyLayoutFile(f, dryRun)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return "", dbusutil.ToError(err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,71 @@
+package display
+
+import (
+	dbus "github.com/godbus/dbus"
+	login1 "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.login1"
+	"pkg.deepin.io/lib/dbusutil"
+)
+
+// logindLidSwitch 通过 logind 的 LidClosed 属性实现 core.LidSwitch
+type logindLidSwitch struct {
+	loginManager *login1.Manager
+}
+
+func newLogindLidSwitch() (*logindLidSwitch, error) {
+	systemBus, err := dbus.SystemBus()
+	if err != nil {
+		return nil, err
+	}
+	loginManager := login1.NewManager(systemBus)
+	sigLoop := dbusutil.NewSignalLoop(systemBus, 10)
+	sigLoop.Start()
+	loginManager.InitSignalExt(sigLoop, true)
+	return &logindLidSwitch{loginManager: loginManager}, nil
+}
+
+func (s *logindLidSwitch) LidClosed() (bool, error) {
+	return s.loginManager.LidClosed().Get(0)
+}
+
+func (s *logindLidSwitch) ConnectLidClosedChanged(cb func(closed bool)) error {
+	return s.loginManager.LidClosed().ConnectChanged(func(hasValue bool, closed bool) {
+		if hasValue {
+			logger.Debug("lid closed:", closed)
+			cb(closed)
+		}
+	})
+}
+
+// lidCallbacks 实现 core.LidCallbacks
+type lidCallbacks struct {
+	m *Manager
+}
+
+func (c lidCallbacks) ApplyDisplayMode() {
+	c.m.applyDisplayMode()
+}
+
+func (c lidCallbacks) MarkClean() {
+	c.m.markClean()
+}
+
+func (c lidCallbacks) SetPropLidClosePolicy(policy uint8) {
+	c.m.PropsMu.Lock()
+	c.m.setPropLidClosePolicy(policy)
+	c.m.PropsMu.Unlock()
+}
+
+func (c lidCallbacks) ReportError(err error) {
+	logger.Warning(err)
+}
+
+// 监听 logind 的 LidClosed 属性，合上盖子时按 LidClosePolicy 禁用内置显示器
+func (m *Manager) initLid() {
+	lidSwitch, err := newLogindLidSwitch()
+	if err != nil {
+		logger.Warning(err)
+		m.lidController.Init(nil)
+		return
+	}
+	m.lidController.Init(lidSwitch)
+}
@@ -3,10 +3,7 @@ package display
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	"math"
-	"os"
-	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -14,21 +11,24 @@ import (
 
 	"github.com/davecgh/go-spew/spew"
 	kwayland "github.com/linuxdeepin/go-dbus-factory/com.deepin.daemon.kwayland"
+	ofdbus "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.dbus"
 	login1 "github.com/linuxdeepin/go-dbus-factory/org.freedesktop.login1"
 	x "github.com/linuxdeepin/go-x11-client"
 	"github.com/linuxdeepin/go-x11-client/ext/randr"
 	"pkg.deepin.io/dde/startdde/display/brightness"
+	"pkg.deepin.io/dde/startdde/display/core"
 	"pkg.deepin.io/gir/gio-2.0"
 	dbus "github.com/godbus/dbus"
 	"pkg.deepin.io/lib/dbusutil"
+	"pkg.deepin.io/lib/log"
 )
 
 const (
-	DisplayModeCustom uint8 = iota
-	DisplayModeMirror
-	DisplayModeExtend
-	DisplayModeOnlyOne
-	DisplayModeUnknow
+	DisplayModeCustom  = core.DisplayModeCustom
+	DisplayModeMirror  = core.DisplayModeMirror
+	DisplayModeExtend  = core.DisplayModeExtend
+	DisplayModeOnlyOne = core.DisplayModeOnlyOne
+	DisplayModeUnknow  = core.DisplayModeUnknow
 )
 
 const (
@@ -39,9 +39,6 @@ const (
 	gsKeyMapOutput   = "map-output"
 	//gsKeyPrimary     = "primary"
 	gsKeyCustomMode = "current-custom-mode"
-
-	customModeDelim     = "+"
-	monitorsIdDelimiter = ","
 )
 
 //go:generate dbusutil-gen -output display_dbusutil.go -import github.com/godbus/dbus,github.com/linuxdeepin/go-x11-client -type Manager,Monitor manager.go monitor.go
@@ -59,8 +56,15 @@ type Manager struct {
 	settings             *gio.Settings
 	monitorsId           string
 	mig                  *monitorIdGenerator
+	backend              *kwaylandBackend
+	switcher             *core.ModeSwitcher
+	changes              *core.ChangesManager
+	lid                  *core.LidHandler
+	brightness           *core.Brightness
+	lidController        *core.LidController
 
 	sessionSigLoop *dbusutil.SignalLoop
+	dbusDaemon     *ofdbus.DBus
 
 	// dbusutil-gen: equal=nil
 	Monitors []dbus.ObjectPath
@@ -78,21 +82,33 @@ type Manager struct {
 	PrimaryRect  x.Rectangle
 	ScreenWidth  uint16
 	ScreenHeight uint16
+	// what to do with the builtin monitor when the lid is closed
+	LidClosePolicy byte
 
 	methods *struct { //nolint
-		AssociateTouch         func() `in:"outputName,touch"`
-		ChangeBrightness       func() `in:"raised"`
-		DeleteCustomMode       func() `in:"name"`
-		GetBrightness          func() `out:"values"`
-		ListOutputNames        func() `out:"names"`
-		ListOutputsCommonModes func() `out:"modes"`
-		ModifyConfigName       func() `in:"name,newName"`
-		SetAndSaveBrightness   func() `in:"outputName,value"`
-		SetBrightness          func() `in:"outputName,value"`
-		SetPrimary             func() `in:"outputName"`
-		SwitchMode             func() `in:"mode,name"`
-		CanRotate              func() `out:"can"`
-		CanSwitchMode          func() `out:"can"`
+		AssociateTouch          func() `in:"outputName,touch"`
+		ChangeBrightness        func() `in:"raised"`
+		DeleteCustomMode        func() `in:"name"`
+		GetBrightness           func() `out:"values"`
+		ListOutputNames         func() `out:"names"`
+		ListOutputsCommonModes  func() `out:"modes"`
+		ModifyConfigName        func() `in:"name,newName"`
+		SetAndSaveBrightness    func() `in:"outputName,value"`
+		SetBrightness           func() `in:"outputName,value"`
+		SetPrimary              func() `in:"outputName"`
+		SwitchMode              func() `in:"mode,name"`
+		CanRotate               func() `out:"can"`
+		CanSwitchMode           func() `out:"can"`
+		ApplyChangesWithTimeout func() `in:"seconds"`
+		ConfirmChanges          func()
+		SetLidClosePolicy       func() `in:"policy"`
+		GetLayout               func() `out:"layout"`
+		ApplyLayout             func() `in:"layout,dryRun" out:"result"`
+	}
+
+	signals *struct { //nolint
+		// 超时没有确认或者发起修改的客户端退出，修改已经被恢复
+		ChangesReverted struct{}
 	}
 }
 
@@ -133,6 +149,28 @@ func newManager(service *dbusutil.Service) *Manager {
 		service:    service,
 		monitorMap: make(map[uint32]*Monitor),
 	}
+	m.backend = newKWaylandBackend(m)
+	m.lid = &core.LidHandler{
+		Backend: m.backend,
+		GetPrimary: func() string {
+			return m.Primary
+		},
+	}
+	m.lidController = &core.LidController{
+		Handler:    m.lid,
+		Callbacks:  lidCallbacks{m: m},
+		ConfigFile: lidConfigFile,
+	}
+	m.switcher = &core.ModeSwitcher{
+		Backend: m.backend,
+		GetPrimary: func() string {
+			return m.Primary
+		},
+		SaveConfig: m.saveConfig,
+		FixConfigs: m.lid.FixConfigs,
+	}
+	m.changes = core.NewChangesManager(changesHandler{m: m})
+	m.backend.SubscribeHotplug(m.handleHotplug)
 
 	m.settings = gio.NewSettings(gsSchemaDisplay)
 	m.DisplayMode = uint8(m.settings.GetEnum(gsKeyDisplayMode))
@@ -161,6 +199,7 @@ func newManager(service *dbusutil.Service) *Manager {
 	m.sessionSigLoop = dbusutil.NewSignalLoop(sessionBus, 10)
 	m.sessionSigLoop.Start()
 	m.listenDBusSignals()
+	m.listenNameLost()
 
 	m.monitorsId = m.getMonitorsId()
 	logger.Debugf("monitorsId: %q, monitorMap: %v", m.monitorsId, m.monitorMap)
@@ -271,36 +310,28 @@ func (m *Manager) updateMonitorsId() {
 	newMonitorsId := m.getMonitorsId()
 	if newMonitorsId != oldMonitorsId {
 		logger.Debug("new monitors id:", newMonitorsId)
-		m.markClean()
-		m.applyDisplayMode()
+		m.backend.NotifyHotplug()
 		m.monitorsId = newMonitorsId
 	}
 }
 
+// 已连接的显示器发生变化后，放弃未保存的修改并重新应用显示模式
+func (m *Manager) handleHotplug() {
+	m.markClean()
+	m.applyDisplayMode()
+	_, err := m.lid.HandleHotplug()
+	if err != nil {
+		logger.Warning(err)
+	}
+}
+
 func (m *Manager) applyDisplayMode() {
 	logger.Debug("applyDisplayMode")
 	monitors := m.getConnectedMonitors()
 	var err error
 	if len(monitors) == 1 {
 		// 单屏
-		screenCfg := m.getScreenConfig()
-		var config *MonitorConfig
-		if screenCfg.Single != nil {
-			config = screenCfg.Single
-		} else {
-			config = monitors[0].toConfig()
-			config.Enabled = true
-			config.Primary = true
-			mode := monitors[0].BestMode
-			config.X = 0
-			config.Y = 0
-			config.Width = mode.Width
-			config.Height = mode.Height
-			config.RefreshRate = mode.Rate
-			config.Rotation = randr.RotationRotate0
-		}
-
-		err = m.applyConfigs([]*MonitorConfig{config})
+		err = m.switcher.ApplySingle(m.getScreenConfig())
 		if err != nil {
 			logger.Warning("failed to apply configs:", err)
 		}
@@ -318,7 +349,7 @@ func (m *Manager) applyDisplayMode() {
 	case DisplayModeMirror:
 		err = m.switchModeMirror()
 	case DisplayModeExtend:
-		err = m.switchModeExtend("")
+		err = m.switchModeExtend()
 	case DisplayModeOnlyOne:
 		err = m.switchModeOnlyOne("")
 	}
@@ -336,6 +367,7 @@ func (m *Manager) init() {
 	m.initTouchMap()
 
 	m.addSleepMonitor()
+	m.initLid()
 }
 
 func (m *Manager) addSleepMonitor() {
@@ -573,49 +605,7 @@ func (m *Manager) updateScreenSize() {
 
 func (m *Manager) switchModeMirror() (err error) {
 	logger.Debug("switch mode mirror")
-	// screenCfg := m.getScreenConfig()
-	// configs := screenCfg.getMonitorConfigs(DisplayModeMirror, "")
-	monitors := m.getConnectedMonitors()
-	commonSizes := getMonitorsCommonSizes(monitors)
-	if len(commonSizes) == 0 {
-		err = errors.New("not found common size")
-		return
-	}
-	maxSize := getMaxAreaSize(commonSizes)
-	logger.Debug("max common size:", maxSize)
-	for _, monitor := range m.monitorMap {
-		if monitor.Connected {
-			monitor.enable(true)
-			// cfg := getMonitorConfigByUuid(configs, monitor.uuid)
-			var mode ModeInfo
-			// if cfg != nil {
-			// mode = monitor.selectMode(cfg.Width, cfg.Height, cfg.RefreshRate)
-			// } else {
-			mode, _ = getFirstModeBySize(monitor.Modes, maxSize.width, maxSize.height)
-			// }
-			monitor.setMode(mode)
-			monitor.setPosition(0, 0)
-			monitor.setRotation(randr.RotationRotate0)
-			monitor.setReflect(0)
-
-		} else {
-			monitor.enable(false)
-		}
-	}
-
-	err = m.apply()
-	if err != nil {
-		return
-	}
-
-	monitor0 := getMinIDMonitor(m.getConnectedMonitors())
-	if monitor0 != nil {
-		err = m.setMonitorPrimary(monitor0)
-		if err != nil {
-			return
-		}
-	}
-	return
+	return m.switcher.SwitchModeMirror(m.getScreenConfig())
 }
 
 //func (m *Manager) getScreenSize1() screenSize {
@@ -879,131 +869,17 @@ func (m *Manager) setMonitorPrimary(monitor *Monitor) error {
 //}
 
 func (m *Manager) setPrimary(name string) error {
-	switch m.DisplayMode {
-	case DisplayModeMirror:
-		return errors.New("not allow set primary in mirror mode")
-
-	case DisplayModeOnlyOne:
-		return m.switchModeOnlyOne(name)
-
-	case DisplayModeExtend, DisplayModeCustom:
-		screenCfg := m.getScreenConfig()
-		configs := screenCfg.getMonitorConfigs(m.DisplayMode, m.CurrentCustomId)
-
-		var monitor0 *Monitor
-		for _, monitor := range m.monitorMap {
-			if monitor.Name != name {
-				continue
-			}
-
-			if !monitor.Connected {
-				return errors.New("monitor is not connected")
-			}
-
-			monitor0 = monitor
-			break
-		}
-
-		if monitor0 == nil {
-			return errors.New("not found monitor")
-		}
-
-		if len(configs) == 0 {
-			if m.DisplayMode == DisplayModeCustom {
-				return errors.New("custom mode configs is empty")
-			}
-			configs = toMonitorConfigs(m.getConnectedMonitors(), monitor0.Name)
-		} else {
-			// modify configs
-			updateMonitorConfigsName(configs, m.monitorMap)
-			setMonitorConfigsPrimary(configs, monitor0.uuid)
-		}
-
-		err := m.setMonitorPrimary(monitor0)
-		if err != nil {
-			return err
-		}
-
-		screenCfg.setMonitorConfigs(m.DisplayMode, m.CurrentCustomId, configs)
-
-		err = m.saveConfig()
-		if err != nil {
-			return err
-		}
-
-	default:
-		return fmt.Errorf("invalid display mode %v", m.DisplayMode)
+	err := m.switcher.SetPrimary(m.getScreenConfig(), m.DisplayMode, m.CurrentCustomId, name)
+	if err != nil {
+		return err
 	}
+	m.lidController.HandleLayoutChanged(false)
 	return nil
 }
 
-func (m *Manager) switchModeExtend(primary string) (err error) {
+func (m *Manager) switchModeExtend() (err error) {
 	logger.Debug("switch mode extend")
-	var monitors []*Monitor
-	for _, monitor := range m.monitorMap {
-		monitors = append(monitors, monitor)
-	}
-	sortMonitorsByID(monitors)
-	// screenCfg := m.getScreenConfig()
-	// configs := screenCfg.getMonitorConfigs(DisplayModeExtend, "")
-
-	var xOffset int
-	var monitor0 *Monitor
-	for _, monitor := range monitors {
-		if monitor.Connected {
-			monitor.enable(true)
-
-			// cfg := getMonitorConfigByUuid(configs, monitor.uuid)
-			// if cfg != nil {
-			// mode = monitor.selectMode(cfg.Width, cfg.Height, cfg.RefreshRate)
-			// if monitor0 == nil && cfg.Primary {
-			// monitor0 = monitor
-			// }
-
-			// } else {
-			mode := monitor.BestMode
-			// }
-
-			monitor.setMode(mode)
-
-			if xOffset > math.MaxInt16 {
-				xOffset = math.MaxInt16
-			}
-			monitor.setPosition(int16(xOffset), 0)
-			monitor.setRotation(randr.RotationRotate0)
-			monitor.setReflect(0)
-
-			xOffset += int(monitor.Width)
-		} else {
-			monitor.enable(false)
-		}
-	}
-
-	if monitor0 == nil {
-		monitor0 = getMinIDMonitor(m.getConnectedMonitors())
-	}
-
-	err = m.apply()
-	if err != nil {
-		return
-	}
-
-	if primary != "" {
-		for _, m := range monitors {
-			if m.Enabled && m.Name == primary {
-				monitor0 = m
-			}
-		}
-	}
-
-	if monitor0 != nil {
-		err = m.setMonitorPrimary(monitor0)
-		if err != nil {
-			return
-		}
-	}
-
-	return
+	return m.switcher.SwitchModeExtend(m.getScreenConfig())
 }
 
 func (m *Manager) getScreenConfig() *ScreenConfig {
@@ -1018,105 +894,7 @@ func (m *Manager) getScreenConfig() *ScreenConfig {
 
 func (m *Manager) switchModeOnlyOne(name string) (err error) {
 	logger.Debug("switch mode only one", name)
-
-	screenCfg := m.getScreenConfig()
-	configs := screenCfg.getMonitorConfigs(DisplayModeOnlyOne, "")
-
-	var monitor0 *Monitor
-	var needSaveCfg bool
-	if name != "" {
-		needSaveCfg = true
-		for _, monitor := range m.monitorMap {
-			if monitor.Name == name {
-				monitor0 = monitor
-
-				if !monitor.Connected {
-					err = errors.New("monitor is not connected")
-					return
-				}
-
-				break
-			}
-		}
-		if monitor0 == nil {
-			err = errors.New("not found monitor")
-			return
-		}
-	} else {
-		var enableUuid string
-		for _, cfg := range configs {
-			if cfg.Enabled {
-				enableUuid = cfg.UUID
-				break
-			}
-		}
-		if enableUuid != "" {
-			for _, monitor := range m.monitorMap {
-				if monitor.uuid == enableUuid {
-					monitor0 = monitor
-					break
-				}
-			}
-		}
-
-		if monitor0 == nil {
-			needSaveCfg = true
-			monitor0 = getMinIDMonitor(m.getConnectedMonitors())
-		}
-
-	}
-	if monitor0 == nil {
-		err = errors.New("monitor0 is nil")
-		return
-	}
-
-	for _, monitor := range m.monitorMap {
-		if monitor.uuid == monitor0.uuid {
-			monitor.enable(true)
-			cfg := getMonitorConfigByUuid(configs, monitor.uuid)
-			var mode ModeInfo
-			var rotation uint16 = randr.RotationRotate0
-			var reflect uint16
-			if cfg != nil {
-				mode = monitor.selectMode(cfg.Width, cfg.Height, cfg.RefreshRate)
-				rotation = cfg.Rotation
-				reflect = cfg.Reflect
-			} else {
-				mode = monitor.BestMode
-			}
-
-			monitor.setMode(mode)
-			monitor.setPosition(0, 0)
-			monitor.setRotation(rotation)
-			monitor.setReflect(reflect)
-
-		} else {
-			monitor.enable(false)
-		}
-	}
-
-	err = m.apply()
-	if err != nil {
-		return
-	}
-
-	// set primary output
-	err = m.setMonitorPrimary(monitor0)
-	if err != nil {
-		return
-	}
-
-	if needSaveCfg {
-		screenCfg.setMonitorConfigs(DisplayModeOnlyOne, "",
-			toMonitorConfigs(m.getConnectedMonitors(), monitor0.Name))
-
-		err = m.saveConfig()
-		if err != nil {
-			return
-		}
-	}
-
-	return
+	return m.switcher.SwitchModeOnlyOne(m.getScreenConfig(), name)
 }
 
 func (m *Manager) switchModeCustom(name string) (err error) {
@@ -1127,7 +905,7 @@ func (m *Manager) switchModeCustom(name string) (err error) {
 	}
 
 	screenCfg := m.getScreenConfig()
-	configs := screenCfg.getMonitorConfigs(DisplayModeCustom, name)
+	configs := screenCfg.GetMonitorConfigs(DisplayModeCustom, name)
 	if len(configs) > 0 {
 		err = m.applyConfigs(configs)
 		return
@@ -1149,14 +927,14 @@ func (m *Manager) switchModeCustom(name string) (err error) {
 		// the default mode is mirror under wayland
 		err = m.switchModeMirror()
 		if err != nil {
-			err = m.switchModeExtend(m.Primary)
+			err = m.switchModeExtend()
 		}
 		if err != nil {
 			return
 		}
 	}
 
-	screenCfg.setMonitorConfigs(DisplayModeCustom, name,
+	screenCfg.SetMonitorConfigs(DisplayModeCustom, name,
 		toMonitorConfigs(m.getConnectedMonitors(), m.Primary))
 
 	err = m.saveConfig()
@@ -1172,7 +950,7 @@ func (m *Manager) switchMode(mode byte, name string) (err error) {
 	case DisplayModeMirror:
 		err = m.switchModeMirror()
 	case DisplayModeExtend:
-		err = m.switchModeExtend("")
+		err = m.switchModeExtend()
 	case DisplayModeOnlyOne:
 		err = m.switchModeOnlyOne(name)
 	case DisplayModeCustom:
@@ -1186,6 +964,7 @@ func (m *Manager) switchMode(mode byte, name string) (err error) {
 
 	if err == nil {
 		m.setDisplayMode(mode)
+		m.lidController.HandleLayoutChanged(true)
 	} else {
 		logger.Warningf("failed to switch mode %v %v: %v", mode, name, err)
 	}
@@ -1215,8 +994,10 @@ func (m *Manager) save() (err error) {
 	if len(monitors) == 1 {
 		screenCfg.Single = monitors[0].toConfig()
 	} else {
-		screenCfg.setMonitorConfigs(m.DisplayMode, m.CurrentCustomId,
-			toMonitorConfigs(monitors, m.Primary))
+		configs := toMonitorConfigs(monitors, m.Primary)
+		// 合上盖子禁用内置显示器只是临时的
+		m.lid.FixConfigs(configs)
+		screenCfg.SetMonitorConfigs(m.DisplayMode, m.CurrentCustomId, configs)
 	}
 
 	err = m.saveConfig()
@@ -1233,6 +1014,7 @@ func (m *Manager) markClean() {
 		monitor.backup = nil
 	}
 	m.monitorMapMu.Unlock()
+	m.changes.Cancel()
 
 	m.PropsMu.Lock()
 	m.setPropHasChanged(false)
@@ -1258,57 +1040,11 @@ func (m *Manager) setCurrentCustomId(name string) {
 
 func (m *Manager) applyConfigs(configs []*MonitorConfig) error {
 	logger.Debug("applyConfigs", spew.Sdump(configs))
-	var primaryMonitor *Monitor
-	for _, monitor := range m.monitorMap {
-		monitorCfg := getMonitorConfigByUuid(configs, monitor.uuid)
-		if monitorCfg == nil {
-			monitor.enable(false)
-		} else {
-			if monitorCfg.Primary && monitorCfg.Enabled {
-				primaryMonitor = monitor
-			}
-			monitor.enable(monitorCfg.Enabled)
-			monitor.setPosition(monitorCfg.X, monitorCfg.Y)
-			monitor.setRotation(monitorCfg.Rotation)
-			monitor.setReflect(monitorCfg.Reflect)
-
-			width := monitorCfg.Width
-			height := monitorCfg.Height
-			if needSwapWidthHeight(monitorCfg.Rotation) {
-				width, height = height, width
-			}
-			mode := monitor.selectMode(width, height, monitorCfg.RefreshRate)
-			monitor.setMode(mode)
-		}
-	}
-	err := m.apply()
-	if err != nil {
-		return err
-	}
-	if primaryMonitor == nil {
-		primaryMonitor = getMinIDMonitor(m.getConnectedMonitors())
-	}
-	err = m.setMonitorPrimary(primaryMonitor)
-	if err != nil {
-		return err
-	}
-	return nil
+	return m.switcher.ApplyConfigs(configs)
 }
 
 func (m *Manager) getCustomIdList() []string {
-	id := m.getMonitorsId()
-
-	screenCfg := m.config[id]
-	if screenCfg == nil {
-		return nil
-	}
-
-	result := make([]string, len(screenCfg.Custom))
-	for idx, custom := range screenCfg.Custom {
-		result[idx] = custom.Name
-	}
-	sort.Strings(result)
-	return result
+	return m.config.GetCustomIdList(m.getMonitorsId())
 }
 
 func (m *Manager) getMonitorsId() string {
@@ -1321,11 +1057,7 @@ func (m *Manager) getMonitorsId() string {
 		ids = append(ids, monitor.uuid)
 	}
 	m.monitorMapMu.Unlock()
-	if len(ids) == 0 {
-		return ""
-	}
-	sort.Strings(ids)
-	return strings.Join(ids, monitorsIdDelimiter)
+	return core.GetMonitorsId(ids)
 }
 
 func (m *Manager) updatePropMonitors() {
@@ -1515,22 +1247,7 @@ func (m *Manager) associateTouch(outputName, touch string) error {
 
 func (m *Manager) saveConfig() error {
 	logger.Debug("save config")
-	dir := filepath.Dir(configFile)
-	err := os.MkdirAll(dir, 0755)
-	if err != nil {
-		return err
-	}
-
-	err = ioutil.WriteFile(configVersionFile, []byte(configVersion), 0644)
-	if err != nil {
-		return err
-	}
-
-	err = m.config.save(configFile)
-	if err != nil {
-		return err
-	}
-	return nil
+	return m.config.Save(configFile, configVersionFile, logger.GetLogLevel() == log.LevelDebug)
 }
 
 func (m *Manager) canSwitchMode() bool {
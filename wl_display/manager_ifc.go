@@ -16,25 +16,32 @@ func (m *Manager) ApplyChanges() *dbus.Error {
 		return nil
 	}
 	err := m.apply()
-	return dbusutil.ToError(err)
+	if err != nil {
+		return dbusutil.ToError(err)
+	}
+	m.lidController.HandleLayoutChanged(false)
+	return nil
 }
 
-func (m *Manager) ResetChanges() *dbus.Error {
-	if !m.HasChanged {
-		return nil
-	}
+// ApplyChangesWithTimeout 应用修改，seconds 秒内没有调用 ConfirmChanges 就自动恢复
+func (m *Manager) ApplyChangesWithTimeout(sender dbus.Sender, seconds uint32) *dbus.Error {
+	err := m.changes.ApplyWithTimeout(string(sender), seconds)
+	return dbusutil.ToError(err)
+}
 
-	for _, monitor := range m.monitorMap {
-		monitor.resetChanges()
-	}
+func (m *Manager) ConfirmChanges() *dbus.Error {
+	err := m.changes.Confirm()
+	return dbusutil.ToError(err)
+}
 
-	err := m.apply()
-	if err != nil {
-		return dbusutil.ToError(err)
-	}
+func (m *Manager) SetLidClosePolicy(policy uint8) *dbus.Error {
+	err := m.lidController.SetPolicy(policy)
+	return dbusutil.ToError(err)
+}
 
-	m.setPropHasChanged(false)
-	return nil
+func (m *Manager) ResetChanges() *dbus.Error {
+	err := m.changes.Reset()
+	return dbusutil.ToError(err)
 }
 
 func (m *Manager) SwitchMode(mode byte, name string) *dbus.Error {
@@ -63,7 +70,7 @@ func (m *Manager) ChangeBrightness(raised bool) *dbus.Error {
 }
 
 func (m *Manager) GetBrightness() (map[string]float64, *dbus.Error) {
-	return m.Brightness, nil
+	return m.brightness.Values(), nil
 }
 
 func (m *Manager) ListOutputNames() ([]string, *dbus.Error) {
@@ -100,11 +107,9 @@ func (m *Manager) DeleteCustomMode(name string) *dbus.Error {
 }
 
 func (m *Manager) RefreshBrightness() *dbus.Error {
-	for k, v := range m.Brightness {
-		err := m.doSetBrightness(v, k)
-		if err != nil {
-			logger.Warning(err)
-		}
+	err := m.brightness.Refresh()
+	if err != nil {
+		logger.Warning(err)
 	}
 	return nil
 }
@@ -115,15 +120,12 @@ func (m *Manager) Reset() *dbus.Error {
 }
 
 func (m *Manager) SetAndSaveBrightness(outputName string, value float64) *dbus.Error {
-	err := m.doSetBrightness(value, outputName)
-	if err == nil {
-		m.saveBrightness()
-	}
+	err := m.brightness.SetAndSave(outputName, value)
 	return dbusutil.ToError(err)
 }
 
 func (m *Manager) SetBrightness(outputName string, value float64) *dbus.Error {
-	err := m.doSetBrightness(value, outputName)
+	err := m.brightness.Set(outputName, value)
 	return dbusutil.ToError(err)
 }
 
@@ -165,18 +165,6 @@ func (m *Monitor) setMode(mode ModeInfo) {
 //	return mode
 //}
 
-func (m *Monitor) selectMode(width, height uint16, rate float64) ModeInfo {
-	mode, ok := getFirstModeBySizeRate(m.Modes, width, height, rate)
-	if ok {
-		return mode
-	}
-	mode, ok = getFirstModeBySize(m.Modes, width, height)
-	if ok {
-		return mode
-	}
-	return m.BestMode
-}
-
 func (m *Monitor) SetModeBySize(width, height uint16) *dbus.Error {
 	mode, ok := getFirstModeBySize(m.Modes, width, height)
 	if !ok {
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os/exec"
 	"regexp"
 	"sort"
@@ -142,33 +141,6 @@ func sortMonitorsByID(monitors []*Monitor) {
 	})
 }
 
-func getMinIDMonitor(monitors []*Monitor) *Monitor {
-	if len(monitors) == 0 {
-		return nil
-	}
-
-	if m := guassPrimaryMonitor(monitors); m != nil {
-		return m
-	}
-
-	minMonitor := monitors[0]
-	for _, monitor := range monitors[1:] {
-		if minMonitor.ID > monitor.ID {
-			minMonitor = monitor
-		}
-	}
-	return minMonitor
-}
-
-func guassPrimaryMonitor(monitors []*Monitor) *Monitor {
-	for _, m := range monitors {
-		if isBuiltinOutput(m.Name) {
-			return m
-		}
-	}
-	return nil
-}
-
 func jsonMarshal(v interface{}) string {
 	data, _ := json.Marshal(v)
 	return string(data)
@@ -223,11 +195,3 @@ func needSwapWidthHeight(rotation uint16) bool {
 	return rotation&randr.RotationRotate90 != 0 ||
 		rotation&randr.RotationRotate270 != 0
 }
-
-func getConfigVersion(filename string) (string, error) {
-	content, err := ioutil.ReadFile(filename)
-	if err != nil {
-		return "", err
-	}
-	return string(bytes.TrimSpace(content)), nil
-}